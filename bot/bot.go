@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/keel-hq/keel/approvals"
+	"github.com/keel-hq/keel/internal/k8s"
 	"github.com/keel-hq/keel/pkg/config"
 	"github.com/keel-hq/keel/provider/kubernetes"
 	"github.com/keel-hq/keel/types"
@@ -84,6 +85,7 @@ type BotManager struct {
 	k8sImplementer     kubernetes.Implementer
 	botMessagesChannel chan *BotMessage
 	approvalsRespCh    chan *ApprovalResponse
+	scope              *k8s.Scope
 }
 
 // RegisterBot makes a bot implementation available by the provided name.
@@ -118,6 +120,13 @@ func Run(appConfig config.Config, k8sImplementer kubernetes.Implementer, approva
 		approvalsRespCh:    make(chan *ApprovalResponse), // don't add buffer to make it blocking
 		botMessagesChannel: make(chan *BotMessage),
 	}
+	scope, err := k8s.NewScope(appConfig.Kubernetes)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("bot.Run(): invalid namespace or object selector, listing all deployments")
+	}
+	bm.scope = scope
 	for botName, bot := range bots {
 		configured := bot.Configure(appConfig, bm.approvalsRespCh, bm.botMessagesChannel)
 		if configured {
@@ -186,7 +195,7 @@ func (bm *BotManager) handleCommand(eventText string) string {
 	switch eventText {
 	case "get deployments":
 		log.Info("HandleCommand: getting deployments")
-		return DeploymentsResponse(Filter{}, bm.k8sImplementer)
+		return DeploymentsResponse(Filter{Scope: bm.scope}, bm.k8sImplementer)
 	case "get approvals":
 		log.Info("HandleCommand: getting approvals")
 		return ApprovalsResponse(bm.approvalsManager)
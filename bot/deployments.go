@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/keel-hq/keel/bot/formatter"
+	"github.com/keel-hq/keel/internal/k8s"
 	"github.com/keel-hq/keel/provider/kubernetes"
 
 	apps_v1 "k8s.io/api/apps/v1"
@@ -16,10 +17,13 @@ import (
 type Filter struct {
 	Namespace string
 	All       bool // keel or not
+
+	// Scope limits deployments to the namespaces and objects keel watches
+	Scope *k8s.Scope
 }
 
-// deployments - gets all deployments
-func deployments(k8sImplementer kubernetes.Implementer) ([]apps_v1.Deployment, error) {
+// deployments - gets all deployments in scope
+func deployments(filter Filter, k8sImplementer kubernetes.Implementer) ([]apps_v1.Deployment, error) {
 	deploymentLists := []*apps_v1.DeploymentList{}
 
 	n, err := k8sImplementer.Namespaces()
@@ -28,6 +32,9 @@ func deployments(k8sImplementer kubernetes.Implementer) ([]apps_v1.Deployment, e
 	}
 
 	for _, n := range n.Items {
+		if filter.Scope != nil && !filter.Scope.IncludesNamespace(&n) {
+			continue
+		}
 		l, err := k8sImplementer.Deployments(n.GetName())
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -43,6 +50,9 @@ func deployments(k8sImplementer kubernetes.Implementer) ([]apps_v1.Deployment, e
 
 	for _, deploymentList := range deploymentLists {
 		for _, deployment := range deploymentList.Items {
+			if filter.Scope != nil && !filter.Scope.MatchesObject(deployment.Labels) {
+				continue
+			}
 			impacted = append(impacted, deployment)
 		}
 	}
@@ -51,7 +61,7 @@ func deployments(k8sImplementer kubernetes.Implementer) ([]apps_v1.Deployment, e
 }
 
 func DeploymentsResponse(filter Filter, k8sImplementer kubernetes.Implementer) string {
-	deps, err := deployments(k8sImplementer)
+	deps, err := deployments(filter, k8sImplementer)
 	if err != nil {
 		return fmt.Sprintf("got error while fetching deployments: %s", err)
 	}
@@ -6,6 +6,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/keel-hq/keel/types"
 	"github.com/slack-go/slack"
@@ -109,10 +110,15 @@ func createBlockMessage(title string, botName string, req *types.Approval) slack
 		messageBlock,
 		leftDetailSection,
 		rightDetailSection,
+	}
+	if req.Diff != "" {
+		blocks = append(blocks, diffBlock(req.Diff))
+	}
+	blocks = append(blocks,
 		slack.NewDividerBlock(),
 		slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", header, false, false)),
 		commandsBlock,
-	}
+	)
 
 	if req.VotesReceived < req.VotesRequired && !req.Expired() && !req.Rejected {
 		approveButton := slack.NewButtonBlockElement(
@@ -152,6 +158,27 @@ func createBlockMessage(title string, botName string, req *types.Approval) slack
 	}
 }
 
+// diffLimit - longest diff shown, section text is limited to 3000 characters
+const diffLimit = 2800
+
+// diffBlock shows the changes of the update, ie: the rendered manifest diff
+// of a Helm release
+func diffBlock(diff string) *slack.SectionBlock {
+	if len(diff) > diffLimit {
+		// cut on a rune boundary
+		limit := diffLimit
+		for limit > 0 && !utf8.RuneStart(diff[limit]) {
+			limit--
+		}
+		diff = diff[:limit] + "\n... (truncated)"
+	}
+	return slack.NewSectionBlock(
+		slack.NewTextBlockObject("mrkdwn", "*Changes:*\n```"+diff+"```", false, false),
+		nil,
+		nil,
+	)
+}
+
 func addBotMentionToCommand(command string, botName string) string {
 	// -- retrieve the first letter of the command in order to insert bot mention
 	firstLetterPos := -1
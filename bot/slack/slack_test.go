@@ -5,7 +5,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/slack-go/slack"
 
@@ -58,6 +60,12 @@ func (p *fakeProvider) TrackedImages() ([]*types.TrackedImage, error) {
 func (p *fakeProvider) List() []string {
 	return []string{"fakeprovider"}
 }
+func (p *fakeProvider) Plans() []*types.Plan {
+	return nil
+}
+func (p *fakeProvider) Rollback(record *types.UpdateRecord, user string) error {
+	return nil
+}
 func (p *fakeProvider) Stop() {
 	return
 }
@@ -361,3 +369,35 @@ func TestIsApproval(t *testing.T) {
 		t.Errorf("event expected to be an approval")
 	}
 }
+
+func TestApprovalMessageDiff(t *testing.T) {
+	approval := &types.Approval{
+		Identifier:     "default/app:1.1.0",
+		Provider:       types.ProviderTypeHelm,
+		VotesRequired:  1,
+		CurrentVersion: "1.0.0",
+		NewVersion:     "1.1.0",
+		Deadline:       time.Now().Add(time.Hour),
+	}
+	if len(createBlockMessage("Approval required!", "keel", approval).BlockSet) != 9 {
+		t.Fatalf("unexpected blocks without a diff")
+	}
+
+	approval.Diff = "-image: app:1.0.0\n+image: app:1.1.0\n" + strings.Repeat("x", 3000)
+	blocks := createBlockMessage("Approval required!", "keel", approval).BlockSet
+	if len(blocks) != 10 {
+		t.Fatalf("expected a diff block, got %d blocks", len(blocks))
+	}
+	text := blocks[4].(*slack.SectionBlock).Text.Text
+	if !strings.HasPrefix(text, "*Changes:*\n```-image: app:1.0.0") || !strings.Contains(text, "(truncated)") || len(text) > 3000 {
+		t.Errorf("unexpected diff block: %s", text)
+	}
+}
+
+func TestApprovalMessageDiffRuneBoundary(t *testing.T) {
+	approval := &types.Approval{Diff: strings.Repeat("é", 2000), Deadline: time.Now().Add(time.Hour)}
+	text := createBlockMessage("Approval required!", "keel", approval).BlockSet[4].(*slack.SectionBlock).Text.Text
+	if !utf8.ValidString(text) {
+		t.Error("the diff must be cut on a rune boundary")
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"context"
@@ -26,7 +28,10 @@ import (
 
 	"github.com/keel-hq/keel/extension/credentialshelper"
 	"github.com/keel-hq/keel/extension/notification"
+	"github.com/keel-hq/keel/internal/gitops"
 	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/internal/leader"
+	"github.com/keel-hq/keel/internal/window"
 	"github.com/keel-hq/keel/internal/workgroup"
 	"github.com/keel-hq/keel/provider"
 	"github.com/keel-hq/keel/provider/helm3"
@@ -76,6 +81,12 @@ const (
 	EnvKubernetesContext   = "KUBERNETES_CONTEXT"
 )
 
+// pod details set through the downward API, used by leader election
+const (
+	EnvPodNamespace = "POD_NAMESPACE"
+	EnvPodIP        = "POD_IP"
+)
+
 // @title Keel HTTP API
 // @version 1.0
 // @description HTTP API exposed by Keel. Admin routes are registered only when an authenticator is enabled. Provider webhooks require Basic or Bearer authorization only when authenticated webhooks are enabled; the registry webhook is always unauthenticated.
@@ -205,16 +216,30 @@ func main() {
 
 	var g workgroup.Group
 
+	if cfg.Kubernetes.CustomResourcesConfig != "" {
+		if err := k8s.LoadCustomKinds(cfg.Kubernetes.CustomResourcesConfig); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"path":  cfg.Kubernetes.CustomResourcesConfig,
+			}).Fatal("main: failed to load custom resources config")
+		}
+	}
+
+	if cfg.Kubernetes.LocalClusterName != "" {
+		if err := kubernetes.ValidateClusterName(cfg.Kubernetes.LocalClusterName); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Fatal("main: invalid local cluster name")
+		}
+	}
+
 	t := &k8s.Translator{
 		FieldLogger: log.WithField("context", "translator"),
+		Cluster:     cfg.Kubernetes.LocalClusterName,
 	}
+	watchCluster(&g, implementer, cfg.Kubernetes, t)
 
-	buf := k8s.NewBuffer(&g, t, log.StandardLogger(), 128)
-	wl := log.WithField("context", "watch")
-	k8s.WatchDeployments(&g, implementer.Client(), wl, cfg.Kubernetes, buf)
-	k8s.WatchStatefulSets(&g, implementer.Client(), wl, cfg.Kubernetes, buf)
-	k8s.WatchDaemonSets(&g, implementer.Client(), wl, cfg.Kubernetes, buf)
-	k8s.WatchCronJobs(&g, implementer.Client(), wl, cfg.Kubernetes, buf)
+	clusters := setupClusters(&g, cfg.Kubernetes, k8sCfg.ConfigPath)
 
 	// approvalsCache := memory.NewMemoryCache()
 	approvalsManager := approvals.New(&approvals.Opts{
@@ -234,10 +259,8 @@ func main() {
 	})
 	prometheus.MustRegister(pendindApprovalsCounter)
 
-	go approvalsManager.StartExpiryService(ctx)
-
 	// setting up providers
-	providers := setupProviders(&ProviderOpts{
+	providers, startProviders := setupProviders(&ProviderOpts{
 		k8sImplementer:   implementer,
 		sender:           sender,
 		approvalsManager: approvalsManager,
@@ -246,6 +269,7 @@ func main() {
 		k8sClient:        implementer.Client(),
 		config:           implementer.Config(),
 		appConfig:        cfg,
+		clusters:         clusters,
 	})
 
 	// registering secrets based credentials helper
@@ -259,25 +283,60 @@ func main() {
 			}).Fatalf("failed to decode secret provided in %s env variable", EnvDefaultDockerRegistryCfg)
 		}
 	}
-	secretsGetter := secrets.NewGetter(implementer, dockerConfig)
+	secretsGetter := secrets.ClusterGetter{
+		cfg.Kubernetes.LocalClusterName: secrets.NewGetter(implementer, dockerConfig),
+	}
+	for _, c := range clusters {
+		secretsGetter[c.name] = secrets.NewGetter(c.implementer, dockerConfig)
+	}
 
 	ch := secretsCredentialsHelper.New(secretsGetter)
 	credentialshelper.RegisterCredentialsHelper("secrets", ch)
 
 	// trigger setup
 	// teardownTriggers := setupTriggers(ctx, providers, approvalsManager, &t.GenericResourceCache, implementer)
-	teardownTriggers := setupTriggers(ctx, &TriggerOpts{
+	triggerOpts := &TriggerOpts{
 		providers:        providers,
 		approvalsManager: approvalsManager,
 		grc:              &t.GenericResourceCache,
 		k8sClient:        implementer,
+		clusters:         clusters,
 		store:            sqlStore,
 		uiDir:            cfg.UI.Dir,
 		authConfig:       authConfig,
 		appConfig:        cfg,
-	})
+	}
+
+	// everything that changes the cluster or talks to users runs on the
+	// leader only, followers serve the API and forward webhooks
+	lead := func(ctx context.Context) {
+		go approvalsManager.StartExpiryService(ctx)
+		startProviders()
+		startTriggers(ctx, triggerOpts)
+		bot.Run(cfg, implementer, approvalsManager)
+	}
+
+	var elector *leader.Elector
+	electionDone := make(chan struct{})
+	if cfg.Leader.Enabled {
+		elector = setupLeaderElection(implementer.Client(), cfg, lead)
+		triggerOpts.leadership = elector
+	}
+
+	teardownTriggers := setupTriggers(ctx, triggerOpts)
 
-	bot.Run(cfg, implementer, approvalsManager)
+	if elector != nil {
+		go func() {
+			defer close(electionDone)
+			elector.Run(ctx)
+			if ctx.Err() == nil {
+				log.Fatal("main: lost leadership, exiting")
+			}
+		}()
+	} else {
+		close(electionDone)
+		lead(ctx)
+	}
 
 	signalChan := make(chan os.Signal, 1)
 	cleanupDone := make(chan bool)
@@ -299,6 +358,9 @@ func main() {
 				providers.Stop()
 				teardownTriggers()
 				bot.Stop()
+				// releasing the lease, another replica takes over right away
+				cancel()
+				<-electionDone
 
 				cleanupDone <- true
 			}
@@ -318,44 +380,195 @@ type ProviderOpts struct {
 	k8sClient kube.Interface
 	config    *rest.Config
 	appConfig config.Config
+
+	// further clusters, each gets its own kubernetes provider
+	clusters []*managedCluster
+}
+
+// managedCluster - further cluster keel updates resources of, next to the one
+// it connects to first
+type managedCluster struct {
+	name        string
+	implementer *kubernetes.KubernetesImplementer
+	grc         *k8s.GenericResourceCache
+}
+
+// watchCluster - starting resource watchers of a cluster, the translator
+// keeps its resources in its cache
+func watchCluster(g *workgroup.Group, implementer *kubernetes.KubernetesImplementer, kubernetesConfig config.KubernetesConfig, t *k8s.Translator) {
+	// every cluster caches the labels of its own namespaces
+	scope, err := k8s.NewScope(kubernetesConfig)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("main: invalid namespace or object selector")
+	}
+
+	buf := k8s.NewBuffer(g, t, log.StandardLogger(), 128)
+	wl := log.WithField("context", "watch")
+	if t.Cluster != "" {
+		wl = wl.WithField("cluster", t.Cluster)
+	}
+	scope.WatchNamespaces(g, implementer.Client(), wl)
+	k8s.WatchDeployments(g, implementer.Client(), wl, scope, buf)
+	k8s.WatchStatefulSets(g, implementer.Client(), wl, scope, buf)
+	k8s.WatchDaemonSets(g, implementer.Client(), wl, scope, buf)
+	k8s.WatchCronJobs(g, implementer.Client(), wl, scope, buf)
+	for _, kind := range k8s.CustomKinds() {
+		if !k8s.ResourceServed(implementer.Client().Discovery(), kind.GroupVersionResource()) {
+			log.WithFields(log.Fields{
+				"resource": kind.GroupVersionResource().String(),
+				"cluster":  t.Cluster,
+			}).Debug("main: custom resource is not installed, watcher not started")
+			continue
+		}
+		k8s.WatchCustomKind(g, implementer.Dynamic(), wl, scope, kind, buf)
+	}
+}
+
+// setupClusters - connecting to the further clusters listed in CLUSTERS and
+// CLUSTERS_DIR and starting their watchers
+func setupClusters(g *workgroup.Group, kubernetesConfig config.KubernetesConfig, configPath string) []*managedCluster {
+	configs, err := kubernetes.ParseClusters(kubernetesConfig.Clusters, kubernetesConfig.ClustersDir, configPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("main.setupClusters: invalid clusters configuration")
+	}
+
+	var clusters []*managedCluster
+	for _, c := range configs {
+		if c.Name == kubernetesConfig.LocalClusterName {
+			log.Fatalf("main.setupClusters: cluster '%s' has the name of the local cluster", c.Name)
+		}
+
+		implementer, err := kubernetes.NewKubernetesImplementer(c.Opts)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"cluster": c.Name,
+			}).Fatal("main.setupClusters: failed to create kubernetes implementer")
+		}
+
+		t := &k8s.Translator{
+			FieldLogger: log.WithFields(log.Fields{"context": "translator", "cluster": c.Name}),
+			Cluster:     c.Name,
+		}
+		watchCluster(g, implementer, kubernetesConfig, t)
+
+		log.WithFields(log.Fields{
+			"cluster": c.Name,
+		}).Info("main.setupClusters: managing cluster")
+
+		clusters = append(clusters, &managedCluster{
+			name:        c.Name,
+			implementer: implementer,
+			grc:         &t.GenericResourceCache,
+		})
+	}
+	return clusters
 }
 
 // setupProviders - setting up available providers. New providers should be initialised here and added to
-// provider map
-func setupProviders(opts *ProviderOpts) (providers provider.Providers) {
+// provider map. Providers process events once started.
+func setupProviders(opts *ProviderOpts) (providers provider.Providers, start func()) {
 	var enabledProviders []provider.Provider
 	platformResolver := k8s.NewPlatformResolver(opts.k8sImplementer)
 	runningDigestResolver := k8s.NewRunningDigestResolver(opts.k8sImplementer)
 
-	k8sProvider, err := kubernetes.NewProvider(opts.k8sImplementer, opts.sender, opts.approvalsManager, opts.grc, platformResolver)
+	if opts.appConfig.Providers.DryRun {
+		log.Warn("main.setupProviders: dry-run mode enabled, updates are only reported")
+	}
+
+	freezes, err := window.ParseFreezes(opts.appConfig.Providers.UpdateFreezes)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
-		}).Fatal("main.setupProviders: failed to create kubernetes provider")
+		}).Fatal("main.setupProviders: failed to parse update freezes")
 	}
-	go func() {
-		err := k8sProvider.Start()
+
+	var repo *gitops.Repository
+	if gitopsConfig := opts.appConfig.GitOps; gitopsConfig.Repository != "" {
+		dir := gitopsConfig.Dir
+		if dir == "" {
+			dir = filepath.Join(opts.appConfig.Storage.DataDir, "gitops")
+		}
+		repo, err = gitops.New(gitops.Config{
+			URL:           gitopsConfig.Repository,
+			Branch:        gitopsConfig.Branch,
+			Dir:           dir,
+			AuthorName:    gitopsConfig.AuthorName,
+			AuthorEmail:   gitopsConfig.AuthorEmail,
+			CommitMessage: gitopsConfig.CommitMessage,
+		})
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error": err,
-			}).Fatal("kubernetes provider stopped with an error")
+			}).Fatal("main.setupProviders: failed to configure GitOps repository")
 		}
-	}()
+	}
+
+	// one kubernetes provider per cluster
+	var starters []func()
+	newKubernetesProvider := func(cluster string, implementer kubernetes.Implementer, grc *k8s.GenericResourceCache, platformResolver *k8s.PlatformResolver) {
+		k8sProvider, err := kubernetes.NewProvider(implementer, opts.sender, opts.approvalsManager, grc, platformResolver)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"cluster": cluster,
+			}).Fatal("main.setupProviders: failed to create kubernetes provider")
+		}
+		k8sProvider.SetCluster(cluster)
+		k8sProvider.SetDryRun(opts.appConfig.Providers.DryRun)
+		k8sProvider.SetHistory(opts.store)
+		k8sProvider.SetUpdateWindows(provider.NewDeferredQueue(k8sProvider.GetName(), opts.store, freezes))
+		k8sProvider.SetPauses(opts.store)
+		k8sProvider.SetStages(opts.store)
+		k8sProvider.SetRolloutBudget(opts.appConfig.Providers.MaxRollouts, opts.appConfig.Providers.MaxNamespaceRollouts)
+		if repo != nil {
+			k8sProvider.SetGitOps(repo)
+		}
+
+		starters = append(starters, func() {
+			err := k8sProvider.Start()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":   err,
+					"cluster": cluster,
+				}).Fatal("kubernetes provider stopped with an error")
+			}
+		})
+
+		enabledProviders = append(enabledProviders, k8sProvider)
+	}
 
-	enabledProviders = append(enabledProviders, k8sProvider)
+	newKubernetesProvider(opts.appConfig.Kubernetes.LocalClusterName, opts.k8sImplementer, opts.grc, platformResolver)
+	for _, c := range opts.clusters {
+		newKubernetesProvider(c.name, c.implementer, c.grc, k8s.NewPlatformResolver(c.implementer))
+	}
 
 	if opts.appConfig.Providers.Helm3 {
 		helm3Implementer := helm3.NewHelm3Implementer()
-		helm3Provider := helm3.NewProvider(helm3Implementer, opts.sender, opts.approvalsManager, helm3.WithWorkloadPlatforms(platformResolver, opts.grc), helm3.WithRunningDigests(runningDigestResolver))
+		helm3Options := []helm3.ProviderOption{helm3.WithWorkloadPlatforms(platformResolver, opts.grc), helm3.WithRunningDigests(runningDigestResolver), helm3.WithDryRun(opts.appConfig.Providers.DryRun), helm3.WithUpdateWindows(provider.NewDeferredQueue(helm3.ProviderName, opts.store, freezes))}
+		if releaseConfig := opts.appConfig.Providers.HelmReleaseConfig; releaseConfig != "" {
+			namespace, name, ok := strings.Cut(releaseConfig, "/")
+			if !ok || namespace == "" || name == "" {
+				log.WithFields(log.Fields{
+					"config": releaseConfig,
+				}).Fatal("main.setupProviders: Helm release configuration must be a <namespace>/<name> ConfigMap")
+			}
+			helm3Options = append(helm3Options, helm3.WithReleaseConfigs(helm3.NewConfigMapReleaseConfigs(opts.k8sImplementer.ConfigMaps(namespace), name)))
+		}
+		helm3Provider := helm3.NewProvider(helm3Implementer, opts.sender, opts.approvalsManager, helm3Options...)
 
-		go func() {
+		starters = append(starters, func() {
 			err := helm3Provider.Start()
 			if err != nil {
 				log.WithFields(log.Fields{
 					"error": err,
 				}).Fatal("helm3 provider stopped with an error")
 			}
-		}()
+		})
 
 		enabledProviders = append(enabledProviders, helm3Provider)
 
@@ -363,7 +576,47 @@ func setupProviders(opts *ProviderOpts) (providers provider.Providers) {
 
 	providers = provider.New(enabledProviders, opts.approvalsManager)
 
-	return providers
+	start = func() {
+		for _, starter := range starters {
+			go starter()
+		}
+	}
+
+	return providers, start
+}
+
+// setupLeaderElection - replicas elect a leader through a Lease in the namespace keel runs in,
+// the identity of a replica is the address the others forward webhooks to
+func setupLeaderElection(client kube.Interface, appConfig config.Config, lead func(ctx context.Context)) *leader.Elector {
+	namespace := appConfig.Leader.Namespace
+	if namespace == "" {
+		namespace = os.Getenv(EnvPodNamespace)
+	}
+
+	address := appConfig.Leader.Address
+	if address == "" {
+		host := os.Getenv(EnvPodIP)
+		if host == "" {
+			host, _ = os.Hostname()
+		}
+		address = fmt.Sprintf("http://%s:%d", host, types.KeelDefaultPort)
+	}
+
+	if appConfig.Auth.Mode == string(auth.ModeExternalProxy) {
+		log.Warn("main.setupLeaderElection: the HTTP listener is loopback-only in external proxy mode, followers can't forward webhooks to the leader")
+	}
+
+	elector, err := leader.New(client, leader.Config{
+		Namespace: namespace,
+		Name:      appConfig.Leader.Lease,
+		Identity:  address,
+	}, lead)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatalf("main.setupLeaderElection: failed to set up leader election, set %s or LEADER_ELECTION_NAMESPACE", EnvPodNamespace)
+	}
+	return elector
 }
 
 type TriggerOpts struct {
@@ -371,14 +624,17 @@ type TriggerOpts struct {
 	approvalsManager approvals.Manager
 	grc              *k8s.GenericResourceCache
 	k8sClient        kubernetes.Implementer
+	clusters         []*managedCluster
 	store            store.Store
 	uiDir            string
 	authConfig       auth.Config
 	appConfig        config.Config
+
+	// set when replicas elect a leader
+	leadership *leader.Elector
 }
 
-// setupTriggers - setting up triggers. New triggers should be added to this function. Each trigger
-// should go through all providers (or not if there is a reason) and submit events)
+// setupTriggers - setting up the HTTP server, it serves the API, UI and webhook triggers on every replica
 // func setupTriggers(ctx context.Context, providers provider.Providers, approvalsManager approvals.Manager, grc *k8s.GenericResourceCache, k8sClient kubernetes.Implementer) (teardown func()) {
 func setupTriggers(ctx context.Context, opts *TriggerOpts) (teardown func()) {
 
@@ -389,10 +645,11 @@ func setupTriggers(ctx context.Context, opts *TriggerOpts) (teardown func()) {
 	})
 
 	// setting up generic http webhook server
-	whs := http.NewTriggerServer(&http.Opts{
+	httpOpts := &http.Opts{
 		Port:                  types.KeelDefaultPort,
 		GRC:                   opts.grc,
 		KubernetesClient:      opts.k8sClient,
+		LocalCluster:          opts.appConfig.Kubernetes.LocalClusterName,
 		Providers:             opts.providers,
 		ApprovalManager:       opts.approvalsManager,
 		Store:                 opts.store,
@@ -403,7 +660,18 @@ func setupTriggers(ctx context.Context, opts *TriggerOpts) (teardown func()) {
 		AuthMode:              opts.authConfig.Mode,
 		AuthProxyUserHeader:   opts.authConfig.ProxyUserHeader,
 		AuthProxyLogoutURL:    opts.authConfig.ProxyLogoutURL,
-	})
+	}
+	if opts.leadership != nil {
+		httpOpts.Leadership = opts.leadership
+	}
+	for _, c := range opts.clusters {
+		httpOpts.Clusters = append(httpOpts.Clusters, http.Cluster{
+			Name:             c.name,
+			GRC:              c.grc,
+			KubernetesClient: c.implementer,
+		})
+	}
+	whs := http.NewTriggerServer(httpOpts)
 
 	if opts.authConfig.Mode == auth.ModeExternalProxy {
 		log.WithFields(log.Fields{
@@ -423,6 +691,16 @@ func setupTriggers(ctx context.Context, opts *TriggerOpts) (teardown func()) {
 		}
 	}()
 
+	teardown = func() {
+		whs.Stop()
+	}
+
+	return teardown
+}
+
+// startTriggers - starting triggers that watch registries. New triggers should be added to this function. Each trigger
+// should go through all providers (or not if there is a reason) and submit events)
+func startTriggers(ctx context.Context, opts *TriggerOpts) {
 	// checking whether pubsub (GCR) trigger is enabled
 	if opts.appConfig.Trigger.PubSub {
 		projectID := opts.appConfig.Trigger.ProjectID
@@ -456,10 +734,4 @@ func setupTriggers(ctx context.Context, opts *TriggerOpts) (teardown func()) {
 		go watcher.Start(ctx)
 		go pollManager.Start(ctx)
 	}
-
-	teardown = func() {
-		whs.Stop()
-	}
-
-	return teardown
 }
@@ -37,6 +37,10 @@ func (s *sender) Configure(config *notification.Config) (bool, error) {
 func (s *sender) Send(event types.EventNotification) error {
 	body := event.CreatedAt.String() + "\n" + event.Level.String() + "-" +
 		event.Type.String() + "\n" + event.Message
+	// approvals of Helm updates carry the rendered manifest diff
+	if event.Diff != "" {
+		body += "\n\n" + event.Diff
+	}
 	msg := "From: " + s.from + "\n" +
 		"To: " + s.to + "\n" +
 		"Subject: Keel notification\n\n" +
@@ -0,0 +1,312 @@
+package gitops
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/keel-hq/keel/util/image"
+
+	"gopkg.in/yaml.v3"
+)
+
+// editor updates the images referenced by a YAML document, reporting
+// whether it found any of them and whether it changed them
+type editor func(doc *yaml.Node, images []Image) (found, changed bool, err error)
+
+// editFile applies the editor to every document of the file, the file is
+// only re-encoded when something changed
+func editFile(content []byte, edit editor, images []Image) (updated []byte, found, changed bool, err error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	var docs []*yaml.Node
+	for {
+		doc := &yaml.Node{}
+		err := decoder.Decode(doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, false, err
+		}
+		docFound, docChanged, err := edit(doc, images)
+		if err != nil {
+			return nil, false, false, err
+		}
+		found = found || docFound
+		changed = changed || docChanged
+		docs = append(docs, doc)
+	}
+	if !changed {
+		return content, found, false, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			return nil, false, false, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, false, false, err
+	}
+	return buf.Bytes(), found, true, nil
+}
+
+// manifestEditor updates container images and image volume references of
+// Kubernetes manifests
+func manifestEditor(doc *yaml.Node, images []Image) (found, changed bool, err error) {
+	var visit func(node *yaml.Node, parentKey string)
+	visit = func(node *yaml.Node, parentKey string) {
+		switch node.Kind {
+		case yaml.DocumentNode, yaml.SequenceNode:
+			for _, child := range node.Content {
+				visit(child, parentKey)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				isImage := key.Value == "image" || (key.Value == "reference" && parentKey == "image")
+				if isImage && value.Kind == yaml.ScalarNode {
+					imageFound, imageChanged := setImage(value, images)
+					found = found || imageFound
+					changed = changed || imageChanged
+					continue
+				}
+				visit(value, key.Value)
+			}
+		}
+	}
+	visit(doc, "")
+	return found, changed, nil
+}
+
+// kustomizationEditor updates the newTag (and digest) of images: entries
+func kustomizationEditor(doc *yaml.Node, images []Image) (found, changed bool, err error) {
+	entries := mappingValue(documentRoot(doc), "images")
+	if entries == nil || entries.Kind != yaml.SequenceNode {
+		return false, false, nil
+	}
+	for _, entry := range entries.Content {
+		if entry.Kind != yaml.MappingNode {
+			continue
+		}
+		name := mappingValue(entry, "newName")
+		if name == nil {
+			name = mappingValue(entry, "name")
+		}
+		if name == nil {
+			continue
+		}
+		img, ok := matchImage(name.Value, images)
+		if !ok {
+			continue
+		}
+		found = true
+		if setMappingValue(entry, "newTag", img.Tag) {
+			changed = true
+		}
+		if img.Digest != "" {
+			if setMappingValue(entry, "digest", img.Digest) {
+				changed = true
+			}
+		} else if deleteMappingValue(entry, "digest") {
+			changed = true
+		}
+	}
+	return found, changed, nil
+}
+
+// valueMapping - Helm values holding an image, either the whole image or
+// its repository and tag
+type valueMapping struct {
+	image      []string
+	repository []string
+	tag        []string
+}
+
+// valuesEditor updates Helm values mapped by spec: comma separated paths of
+// values holding images (image) or repositories and their tags
+// (image.repository:image.tag)
+func valuesEditor(spec string) (editor, error) {
+	var mappings []valueMapping
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		switch len(parts) {
+		case 1:
+			mappings = append(mappings, valueMapping{image: strings.Split(parts[0], ".")})
+		case 2:
+			if parts[0] == "" || parts[1] == "" {
+				return nil, fmt.Errorf("invalid values mapping '%s', expected repository:tag paths", entry)
+			}
+			mappings = append(mappings, valueMapping{repository: strings.Split(parts[0], "."), tag: strings.Split(parts[1], ".")})
+		default:
+			return nil, fmt.Errorf("invalid values mapping '%s', expected repository:tag paths", entry)
+		}
+	}
+	if len(mappings) == 0 {
+		return nil, fmt.Errorf("values mapping '%s' is empty", spec)
+	}
+
+	return func(doc *yaml.Node, images []Image) (found, changed bool, err error) {
+		root := documentRoot(doc)
+		for _, m := range mappings {
+			if m.image != nil {
+				node := lookup(root, m.image)
+				if node == nil || node.Kind != yaml.ScalarNode {
+					continue
+				}
+				imageFound, imageChanged := setImage(node, images)
+				found = found || imageFound
+				changed = changed || imageChanged
+				continue
+			}
+
+			repository := lookup(root, m.repository)
+			if repository == nil || repository.Kind != yaml.ScalarNode {
+				continue
+			}
+			img, ok := matchImage(repository.Value, images)
+			if !ok {
+				continue
+			}
+			found = true
+			parent := lookup(root, m.tag[:len(m.tag)-1])
+			if parent == nil || parent.Kind != yaml.MappingNode {
+				return found, changed, fmt.Errorf("value %s not found", strings.Join(m.tag, "."))
+			}
+			tag := img.Tag
+			if img.Digest != "" {
+				tag = tag + "@" + img.Digest
+			}
+			if setMappingValue(parent, m.tag[len(m.tag)-1], tag) {
+				changed = true
+			}
+		}
+		return found, changed, nil
+	}, nil
+}
+
+func isKustomization(path string) bool {
+	switch filepath.Base(path) {
+	case "kustomization.yaml", "kustomization.yml", "Kustomization":
+		return true
+	}
+	return false
+}
+
+// setImage points the scalar holding an image to the new image of its
+// repository, keeping the name as written
+func setImage(node *yaml.Node, images []Image) (found, changed bool) {
+	img, ok := matchImage(node.Value, images)
+	if !ok {
+		return false, false
+	}
+	value := retag(node.Value, img.Tag, img.Digest)
+	if value == node.Value {
+		return true, false
+	}
+	setScalar(node, value)
+	return true, true
+}
+
+func matchImage(value string, images []Image) (Image, bool) {
+	ref, err := image.Parse(value)
+	if err != nil {
+		return Image{}, false
+	}
+	for _, img := range images {
+		if ref.Repository() == img.Repository {
+			return img, true
+		}
+	}
+	return Image{}, false
+}
+
+// retag replaces the tag and digest of the image
+func retag(value, tag, digest string) string {
+	name := value
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	if digest != "" {
+		return name + ":" + tag + "@" + digest
+	}
+	return name + ":" + tag
+}
+
+func documentRoot(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		return doc.Content[0]
+	}
+	return doc
+}
+
+// lookup returns the value at the path of nested mappings, nil when missing
+func lookup(node *yaml.Node, path []string) *yaml.Node {
+	for _, key := range path {
+		node = mappingValue(node, key)
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets the string value of the key, adding it when missing.
+// It reports whether the mapping changed.
+func setMappingValue(node *yaml.Node, key, value string) bool {
+	if existing := mappingValue(node, key); existing != nil {
+		if existing.Kind == yaml.ScalarNode && existing.Value == value {
+			return false
+		}
+		existing.Kind = yaml.ScalarNode
+		existing.Content = nil
+		setScalar(existing, value)
+		return true
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+	)
+	return true
+}
+
+func deleteMappingValue(node *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// setScalar sets a string value, tags like !!float of the previous value
+// (ie: tag: 1.2) would change its meaning
+func setScalar(node *yaml.Node, value string) {
+	node.Value = value
+	node.Tag = "!!str"
+}
@@ -0,0 +1,259 @@
+// Package gitops writes image updates back to a Git repository instead of
+// patching the cluster, for clusters synced from Git by Flux or Argo CD.
+package gitops
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// DefaultCommitMessage - template of commit messages, executed with the Update
+const DefaultCommitMessage = "keel: update {{ .Identifier }} {{ .CurrentVersion }} -> {{ .NewVersion }}"
+
+// pushAttempts - how many times a commit is rebuilt on top of the remote
+// branch when the push is rejected because the branch moved
+const pushAttempts = 3
+
+// Config - repository and identity keel commits with
+type Config struct {
+	// URL of the repository, credentials can be part of it
+	URL string
+	// Branch keel commits to (default main)
+	Branch string
+	// Dir is the working tree, cloned when it doesn't exist
+	Dir string
+
+	AuthorName  string // default keel
+	AuthorEmail string // default keel@keel.sh
+
+	// CommitMessage is a text/template executed with the Update (default DefaultCommitMessage)
+	CommitMessage string
+}
+
+// Image - new image of a repository
+type Image struct {
+	Repository string // ie: index.docker.io/library/nginx
+	Tag        string
+	Digest     string // set when the image is pinned by digest
+}
+
+// Update - image update of a resource written to a file of the repository
+type Update struct {
+	Identifier     string
+	Kind           string
+	Namespace      string
+	Name           string
+	CurrentVersion string
+	NewVersion     string
+
+	// Path of the file relative to the repository root: a manifest, a
+	// kustomization or a Helm values file
+	Path string
+	// Values maps Helm values to images, empty for manifests and kustomizations
+	Values string
+
+	Images []Image
+}
+
+// Repository - working tree of the GitOps repository, commits are serialized
+type Repository struct {
+	url     string
+	safeURL string
+	branch  string
+	dir     string
+	author  string
+	email   string
+	message *template.Template
+
+	mu sync.Mutex
+}
+
+// New - new repository, it's cloned on the first commit
+func New(cfg Config) (*Repository, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("gitops repository URL is not set")
+	}
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("gitops working tree directory is not set")
+	}
+	if cfg.Branch == "" {
+		cfg.Branch = "main"
+	}
+	if cfg.AuthorName == "" {
+		cfg.AuthorName = "keel"
+	}
+	if cfg.AuthorEmail == "" {
+		cfg.AuthorEmail = "keel@keel.sh"
+	}
+	if cfg.CommitMessage == "" {
+		cfg.CommitMessage = DefaultCommitMessage
+	}
+
+	message, err := template.New("message").Parse(cfg.CommitMessage)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gitops commit message template: %w", err)
+	}
+
+	return &Repository{
+		url:     cfg.URL,
+		safeURL: redactURL(cfg.URL),
+		branch:  cfg.Branch,
+		dir:     cfg.Dir,
+		author:  cfg.AuthorName,
+		email:   cfg.AuthorEmail,
+		message: message,
+	}, nil
+}
+
+// Commit writes the update to its file, commits and pushes it. It returns
+// the SHA of the commit, empty when the file already had the images.
+func (r *Repository) Commit(update *Update) (string, error) {
+	var message bytes.Buffer
+	if err := r.message.Execute(&message, update); err != nil {
+		return "", fmt.Errorf("failed to render commit message: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var pushErr error
+	for attempt := 0; attempt < pushAttempts; attempt++ {
+		if err := r.sync(); err != nil {
+			return "", err
+		}
+		changed, err := r.write(update)
+		if err != nil {
+			return "", err
+		}
+		if !changed {
+			return "", nil
+		}
+
+		if _, err := r.git("add", "--", update.Path); err != nil {
+			return "", err
+		}
+		if _, err := r.git("-c", "user.name="+r.author, "-c", "user.email="+r.email, "commit", "-m", message.String()); err != nil {
+			return "", err
+		}
+		sha, err := r.git("rev-parse", "HEAD")
+		if err != nil {
+			return "", err
+		}
+		// rejected pushes are retried on top of the new remote branch
+		if _, pushErr = r.git("push", "origin", "HEAD:refs/heads/"+r.branch); pushErr == nil {
+			return sha, nil
+		}
+	}
+	return "", fmt.Errorf("failed to push to %s after %d attempts: %w", r.safeURL, pushAttempts, pushErr)
+}
+
+// sync clones the repository or resets the working tree to the remote branch
+func (r *Repository) sync() error {
+	if _, err := os.Stat(filepath.Join(r.dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(r.dir), 0755); err != nil {
+			return err
+		}
+		_, err := r.run("", "clone", "--branch", r.branch, "--single-branch", r.url, r.dir)
+		return err
+	}
+	if _, err := r.git("fetch", "origin", r.branch); err != nil {
+		return err
+	}
+	if _, err := r.git("reset", "--hard", "FETCH_HEAD"); err != nil {
+		return err
+	}
+	_, err := r.git("clean", "-fd")
+	return err
+}
+
+// write updates the images in the file of the update, reporting whether it changed
+func (r *Repository) write(update *Update) (bool, error) {
+	path, err := r.path(update.Path)
+	if err != nil {
+		return false, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	var edit editor
+	switch {
+	case update.Values != "":
+		edit, err = valuesEditor(update.Values)
+		if err != nil {
+			return false, err
+		}
+	case isKustomization(path):
+		edit = kustomizationEditor
+	default:
+		edit = manifestEditor
+	}
+
+	updated, found, changed, err := editFile(content, edit, update.Images)
+	if err != nil {
+		return false, fmt.Errorf("failed to update %s: %w", update.Path, err)
+	}
+	if !found {
+		return false, fmt.Errorf("no image of %s found in %s", repositories(update.Images), update.Path)
+	}
+	if !changed {
+		return false, nil
+	}
+	return true, os.WriteFile(path, updated, 0644)
+}
+
+// path resolves the path of a file inside the working tree
+func (r *Repository) path(name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) {
+		return "", fmt.Errorf("invalid gitops path '%s', expected a path relative to the repository root", name)
+	}
+	cleaned := filepath.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid gitops path '%s', it is outside of the repository", name)
+	}
+	return filepath.Join(r.dir, cleaned), nil
+}
+
+func (r *Repository) git(args ...string) (string, error) {
+	return r.run(r.dir, args...)
+}
+
+func (r *Repository) run(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	// never wait for credentials on a terminal
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		command := strings.ReplaceAll(strings.Join(args, " "), r.url, r.safeURL)
+		output := strings.ReplaceAll(strings.TrimSpace(string(out)), r.url, r.safeURL)
+		return "", fmt.Errorf("git %s failed: %s: %s", command, err, output)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// redactURL hides credentials of the repository URL in errors and logs
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = url.User("redacted")
+	return u.String()
+}
+
+func repositories(images []Image) string {
+	var names []string
+	for _, img := range images {
+		names = append(names, img.Repository)
+	}
+	return strings.Join(names, ", ")
+}
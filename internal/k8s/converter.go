@@ -4,6 +4,7 @@ import (
 	apps_v1 "k8s.io/api/apps/v1"
 	batch_v1 "k8s.io/api/batch/v1"
 	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func getContainerImages(containers []core_v1.Container, filter ContainerFilter) []string {
@@ -113,3 +114,30 @@ func updateCronJobInitContainer(s *batch_v1.CronJob, index int, image string) {
 func updateCronJobImageVolume(s *batch_v1.CronJob, index int, image string) {
 	s.Spec.JobTemplate.Spec.Template.Spec.Volumes[index].Image.Reference = image
 }
+
+// argo rollouts https://argo-rollouts.readthedocs.io/en/stable/features/specification/
+// Keel only changes the pod template, canary and blue-green progression is
+// left to the Rollouts controller.
+
+// RolloutResource - Argo Rollouts resource, served through the dynamic client
+var RolloutResource = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+
+// RolloutKind - Argo Rollouts object kind
+const RolloutKind = "Rollout"
+
+// rolloutKind - Rollouts embed a regular pod template, so they are handled
+// as a built-in custom kind
+var rolloutKind = &CustomKind{
+	Group:       RolloutResource.Group,
+	Version:     RolloutResource.Version,
+	Kind:        RolloutKind,
+	Resource:    RolloutResource.Resource,
+	PodTemplate: "spec.template",
+	Selector:    "spec.selector",
+}
+
+func init() {
+	if err := RegisterCustomKind(rolloutKind); err != nil {
+		panic(err)
+	}
+}
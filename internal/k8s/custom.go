@@ -0,0 +1,445 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// CustomKind describes a custom resource that Keel watches and updates through
+// the dynamic client. Image locations are JSONPath expressions limited to
+// field names, list indexes and the [*] wildcard, for example
+// spec.template.spec.containers[*].image or {.spec.jobTargetRef.template.spec.containers[*].image}.
+type CustomKind struct {
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	Kind     string `json:"kind"`
+	Resource string `json:"resource"`
+
+	// PodTemplate - optional path to an embedded pod template (e.g. spec.template),
+	// used for pull secrets, node selector, volumes and the update-time annotation.
+	// When Images are not set, containers are read from the pod template.
+	PodTemplate string `json:"podTemplate,omitempty"`
+	// Selector - optional path to a label selector used to find the resource pods,
+	// defaults to the pod template labels
+	Selector string `json:"selector,omitempty"`
+
+	Images     []string `json:"images,omitempty"`
+	InitImages []string `json:"initImages,omitempty"`
+
+	podTemplate []string
+	selector    []string
+	images      []fieldPath
+	initImages  []fieldPath
+}
+
+var (
+	customKindsMu sync.RWMutex
+	customKinds   = map[schema.GroupKind]*CustomKind{}
+)
+
+// RegisterCustomKind - validates and registers a custom resource kind, replacing
+// a previous registration of the same group and kind
+func RegisterCustomKind(kind *CustomKind) error {
+	if err := kind.compile(); err != nil {
+		return err
+	}
+	customKindsMu.Lock()
+	defer customKindsMu.Unlock()
+	customKinds[kind.GroupKind()] = kind
+	return nil
+}
+
+// CustomKinds - returns registered custom resource kinds sorted by group and kind
+func CustomKinds() []*CustomKind {
+	customKindsMu.RLock()
+	defer customKindsMu.RUnlock()
+	kinds := make([]*CustomKind, 0, len(customKinds))
+	for _, kind := range customKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		return kinds[i].GroupKind().String() < kinds[j].GroupKind().String()
+	})
+	return kinds
+}
+
+func lookupCustomKind(gk schema.GroupKind) *CustomKind {
+	customKindsMu.RLock()
+	defer customKindsMu.RUnlock()
+	return customKinds[gk]
+}
+
+// LoadCustomKinds - reads a YAML (or JSON) list of custom kinds from path and
+// registers them. The file is typically mounted from a ConfigMap.
+func LoadCustomKinds(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read custom resources config: %w", err)
+	}
+	var kinds []*CustomKind
+	if err := yaml.Unmarshal(data, &kinds); err != nil {
+		return fmt.Errorf("failed to parse custom resources config %s: %w", path, err)
+	}
+	for _, kind := range kinds {
+		if err := RegisterCustomKind(kind); err != nil {
+			return fmt.Errorf("invalid custom resource in %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// GroupKind - custom resource group and kind
+func (k *CustomKind) GroupKind() schema.GroupKind {
+	return schema.GroupKind{Group: k.Group, Kind: k.Kind}
+}
+
+// GroupVersionResource - resource used with the dynamic client
+func (k *CustomKind) GroupVersionResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: k.Group, Version: k.Version, Resource: k.Resource}
+}
+
+func (k *CustomKind) compile() error {
+	if k.Kind == "" || k.Version == "" || k.Resource == "" {
+		return fmt.Errorf("custom resource %q: version, kind and resource are required", k.GroupKind())
+	}
+
+	var err error
+	if k.podTemplate, err = parseFieldNames(k.PodTemplate); err != nil {
+		return fmt.Errorf("custom resource %q: podTemplate: %w", k.GroupKind(), err)
+	}
+	if k.selector, err = parseFieldNames(k.Selector); err != nil {
+		return fmt.Errorf("custom resource %q: selector: %w", k.GroupKind(), err)
+	}
+
+	images, initImages := k.Images, k.InitImages
+	if len(images) == 0 && len(k.podTemplate) > 0 {
+		images = []string{k.PodTemplate + ".spec.containers[*].image"}
+		if len(initImages) == 0 {
+			initImages = []string{k.PodTemplate + ".spec.initContainers[*].image"}
+		}
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("custom resource %q: either images or podTemplate must be set", k.GroupKind())
+	}
+	if k.images, err = parseFieldPaths(images); err != nil {
+		return fmt.Errorf("custom resource %q: images: %w", k.GroupKind(), err)
+	}
+	if k.initImages, err = parseFieldPaths(initImages); err != nil {
+		return fmt.Errorf("custom resource %q: initImages: %w", k.GroupKind(), err)
+	}
+	return nil
+}
+
+func (k *CustomKind) kind() string {
+	return strings.ToLower(k.Kind)
+}
+
+func (k *CustomKind) identifier(u *unstructured.Unstructured) string {
+	return k.kind() + "/" + u.GetNamespace() + "/" + u.GetName()
+}
+
+// podSpec returns a copy of the embedded pod spec, the zero value when the
+// kind has no pod template or the object does not define one.
+func (k *CustomKind) podSpec(u *unstructured.Unstructured) core_v1.PodSpec {
+	if len(k.podTemplate) == 0 {
+		return core_v1.PodSpec{}
+	}
+	spec := getUnstructuredPodSpec(u, k.podTemplate)
+	if spec == nil {
+		return core_v1.PodSpec{}
+	}
+	return *spec
+}
+
+func (k *CustomKind) getPodSpec(u *unstructured.Unstructured) *core_v1.PodSpec {
+	if len(k.podTemplate) == 0 {
+		return nil
+	}
+	return getUnstructuredPodSpec(u, k.podTemplate)
+}
+
+// spec annotations fall back to the object annotations for kinds without a
+// pod template, the update-time annotation is still recorded on the object
+func (k *CustomKind) getSpecAnnotations(u *unstructured.Unstructured) map[string]string {
+	if len(k.podTemplate) == 0 {
+		return u.GetAnnotations()
+	}
+	return getUnstructuredTemplateAnnotations(u, k.podTemplate)
+}
+
+func (k *CustomKind) setSpecAnnotations(u *unstructured.Unstructured, annotations map[string]string) {
+	if len(k.podTemplate) == 0 {
+		u.SetAnnotations(annotations)
+		return
+	}
+	setUnstructuredTemplateAnnotations(u, k.podTemplate, annotations)
+}
+
+func (k *CustomKind) podSelector(u *unstructured.Unstructured) (string, bool) {
+	if len(k.selector) > 0 {
+		selector := getUnstructuredLabelSelector(u, k.selector)
+		if selector == nil {
+			return "", false
+		}
+		parsed, err := meta_v1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return "", false
+		}
+		return parsed.String(), true
+	}
+	if len(k.podTemplate) == 0 {
+		return "", false
+	}
+	template := getUnstructuredPodTemplate(u, k.podTemplate)
+	if template == nil || len(template.Labels) == 0 {
+		return "", false
+	}
+	return labels.Set(template.Labels).String(), true
+}
+
+func (k *CustomKind) updateImageVolume(u *unstructured.Unstructured, index int, image string) {
+	if len(k.podTemplate) == 0 {
+		return
+	}
+	setUnstructuredListField(u, subPath(k.podTemplate, "spec", "volumes"), index, image, "image", "reference")
+}
+
+// containers synthesises a container for every image found by paths. When
+// the image is the "image" field of a container-like object the whole object
+// is converted, otherwise only the name and image are set and the name
+// falls back to the image location.
+func containersAt(u *unstructured.Unstructured, paths []fieldPath) []core_v1.Container {
+	var containers []core_v1.Container
+	for _, match := range findImages(u, paths) {
+		container := core_v1.Container{}
+		if match.field == "image" {
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(match.parent, &container); err != nil {
+				container = core_v1.Container{}
+			}
+		}
+		if container.Name == "" {
+			if name, ok := match.parent["name"].(string); ok && name != "" {
+				container.Name = name
+			} else {
+				container.Name = match.location
+			}
+		}
+		container.Image = match.value
+		containers = append(containers, container)
+	}
+	return containers
+}
+
+// updateImageAt sets the index-th image found by paths, using the same order
+// as containersAt
+func updateImageAt(u *unstructured.Unstructured, paths []fieldPath, index int, image string) {
+	matches := findImages(u, paths)
+	if index < 0 || index >= len(matches) {
+		return
+	}
+	matches[index].parent[matches[index].field] = image
+}
+
+// field paths
+
+type pathElem struct {
+	field    string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+type fieldPath struct {
+	raw   string
+	elems []pathElem
+}
+
+type imageMatch struct {
+	parent   map[string]interface{}
+	field    string
+	value    string
+	location string
+}
+
+func parseFieldPaths(exprs []string) ([]fieldPath, error) {
+	paths := make([]fieldPath, 0, len(exprs))
+	for _, expr := range exprs {
+		elems, err := parseFieldPath(expr)
+		if err != nil {
+			return nil, err
+		}
+		if len(elems) == 0 || elems[len(elems)-1].field == "" {
+			return nil, fmt.Errorf("path %q must end with a field name", expr)
+		}
+		paths = append(paths, fieldPath{raw: expr, elems: elems})
+	}
+	return paths, nil
+}
+
+// parseFieldNames parses a path made only of field names, an empty
+// expression returns no names
+func parseFieldNames(expr string) ([]string, error) {
+	elems, err := parseFieldPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		if elem.field == "" {
+			return nil, fmt.Errorf("path %q may only contain field names", expr)
+		}
+		names = append(names, elem.field)
+	}
+	return names, nil
+}
+
+func parseFieldPath(expr string) ([]pathElem, error) {
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "{") {
+		if !strings.HasSuffix(s, "}") {
+			return nil, fmt.Errorf("path %q: unterminated '{'", expr)
+		}
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	s = strings.TrimPrefix(s, "$")
+	s = strings.TrimPrefix(s, ".")
+
+	var elems []pathElem
+	for len(s) > 0 {
+		switch s[0] {
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unterminated '['", expr)
+			}
+			elem, err := parseBracket(s[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("path %q: %w", expr, err)
+			}
+			elems = append(elems, elem)
+			s = s[end+1:]
+			if strings.HasPrefix(s, ".") {
+				s = s[1:]
+				if s == "" {
+					return nil, fmt.Errorf("path %q: trailing '.'", expr)
+				}
+			}
+		default:
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			if name == "" {
+				return nil, fmt.Errorf("path %q: empty field name", expr)
+			}
+			elems = append(elems, pathElem{field: name})
+			s = s[end:]
+			if strings.HasPrefix(s, ".") {
+				s = s[1:]
+				if s == "" {
+					return nil, fmt.Errorf("path %q: trailing '.'", expr)
+				}
+			}
+		}
+	}
+	return elems, nil
+}
+
+func parseBracket(s string) (pathElem, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "*":
+		return pathElem{wildcard: true}, nil
+	case len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]:
+		if len(s) == 2 {
+			return pathElem{}, fmt.Errorf("empty field name")
+		}
+		return pathElem{field: s[1 : len(s)-1]}, nil
+	}
+	index, err := strconv.Atoi(s)
+	if err != nil || index < 0 {
+		return pathElem{}, fmt.Errorf("unsupported expression [%s]", s)
+	}
+	return pathElem{index: index, isIndex: true}, nil
+}
+
+func findImages(u *unstructured.Unstructured, paths []fieldPath) []imageMatch {
+	var matches []imageMatch
+	for _, path := range paths {
+		last := path.elems[len(path.elems)-1]
+		walkFieldPath(u.Object, path.elems[:len(path.elems)-1], "", func(parent map[string]interface{}, location string) {
+			value, ok := parent[last.field].(string)
+			if !ok || value == "" {
+				return
+			}
+			matches = append(matches, imageMatch{
+				parent:   parent,
+				field:    last.field,
+				value:    value,
+				location: joinLocation(location, last.field),
+			})
+		})
+	}
+	return matches
+}
+
+// walkFieldPath calls fn for every object found at elems, maps are traversed
+// in key order so the results are stable between calls
+func walkFieldPath(obj interface{}, elems []pathElem, location string, fn func(parent map[string]interface{}, location string)) {
+	if len(elems) == 0 {
+		if parent, ok := obj.(map[string]interface{}); ok {
+			fn(parent, location)
+		}
+		return
+	}
+
+	elem, rest := elems[0], elems[1:]
+	switch {
+	case elem.wildcard:
+		switch obj := obj.(type) {
+		case []interface{}:
+			for i, item := range obj {
+				walkFieldPath(item, rest, location+"["+strconv.Itoa(i)+"]", fn)
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(obj))
+			for key := range obj {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walkFieldPath(obj[key], rest, joinLocation(location, key), fn)
+			}
+		}
+	case elem.isIndex:
+		if items, ok := obj.([]interface{}); ok && elem.index < len(items) {
+			walkFieldPath(items[elem.index], rest, location+"["+strconv.Itoa(elem.index)+"]", fn)
+		}
+	default:
+		if m, ok := obj.(map[string]interface{}); ok {
+			if value, found := m[elem.field]; found {
+				walkFieldPath(value, rest, joinLocation(location, elem.field), fn)
+			}
+		}
+	}
+}
+
+func joinLocation(location, field string) string {
+	if location == "" {
+		return field
+	}
+	return location + "." + field
+}
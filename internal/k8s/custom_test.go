@@ -0,0 +1,226 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func registerTestKind(t *testing.T, kind *CustomKind) {
+	t.Helper()
+	if err := RegisterCustomKind(kind); err != nil {
+		t.Fatalf("failed to register kind: %s", err)
+	}
+	t.Cleanup(func() {
+		customKindsMu.Lock()
+		delete(customKinds, kind.GroupKind())
+		customKindsMu.Unlock()
+	})
+}
+
+func TestParseFieldPath(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    []pathElem
+		wantErr bool
+	}{
+		{expr: "spec.image", want: []pathElem{{field: "spec"}, {field: "image"}}},
+		{expr: "{.spec.containers[*].image}", want: []pathElem{{field: "spec"}, {field: "containers"}, {wildcard: true}, {field: "image"}}},
+		{expr: "$.spec.containers[1].image", want: []pathElem{{field: "spec"}, {field: "containers"}, {index: 1, isIndex: true}, {field: "image"}}},
+		{expr: "spec['my.field']", want: []pathElem{{field: "spec"}, {field: "my.field"}}},
+		{expr: "spec.containers[", wantErr: true},
+		{expr: "spec..image", wantErr: true},
+		{expr: "spec.containers[?(@.name=='x')].image", wantErr: true},
+		{expr: "spec.", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := parseFieldPath(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFieldPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFieldPath() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomKindScaledJob(t *testing.T) {
+	registerTestKind(t, &CustomKind{
+		Group:    "keda.sh",
+		Version:  "v1alpha1",
+		Kind:     "ScaledJob",
+		Resource: "scaledjobs",
+		Images:   []string{"{.spec.jobTargetRef.template.spec.containers[*].image}"},
+	})
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "keda.sh/v1alpha1",
+		"kind":       "ScaledJob",
+		"metadata":   map[string]interface{}{"name": "worker", "namespace": "xxxx"},
+		"spec": map[string]interface{}{
+			"jobTargetRef": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{"name": "worker", "image": "karolisr/worker:1.0.0", "args": []interface{}{"run"}},
+							map[string]interface{}{"name": "proxy", "image": "karolisr/proxy:2.0.0"},
+						},
+					},
+				},
+			},
+		},
+	}}
+
+	gr, err := NewGenericResource(obj)
+	if err != nil {
+		t.Fatalf("failed to create generic resource: %s", err)
+	}
+	if gr.Identifier != "scaledjob/xxxx/worker" || gr.Kind() != "scaledjob" {
+		t.Errorf("unexpected identifier: %s, kind: %s", gr.Identifier, gr.Kind())
+	}
+	containers := gr.Containers()
+	if len(containers) != 2 || containers[0].Name != "worker" || containers[1].Image != "karolisr/proxy:2.0.0" {
+		t.Fatalf("unexpected containers: %+v", containers)
+	}
+	if len(containers[0].Args) != 1 {
+		t.Errorf("expected container fields to be converted, got: %+v", containers[0])
+	}
+	if len(gr.GetInitImages(nil)) != 0 {
+		t.Errorf("unexpected init images: %v", gr.GetInitImages(nil))
+	}
+
+	gr.UpdateContainer(1, "karolisr/proxy:2.1.0")
+	if images := gr.GetImages(nil); images[0] != "karolisr/worker:1.0.0" || images[1] != "karolisr/proxy:2.1.0" {
+		t.Errorf("unexpected images after update: %v", images)
+	}
+
+	// kinds without a pod template keep the update time on the object
+	annotations := gr.GetSpecAnnotations()
+	annotations["keel.sh/update-time"] = "now"
+	gr.SetSpecAnnotations(annotations)
+	if gr.GetAnnotations()["keel.sh/update-time"] != "now" {
+		t.Errorf("expected update time annotation on the object: %v", gr.GetAnnotations())
+	}
+	if _, ok := gr.GetPodSelector(); ok {
+		t.Errorf("did not expect a pod selector")
+	}
+}
+
+func TestCustomKindPlainImageFields(t *testing.T) {
+	registerTestKind(t, &CustomKind{
+		Group:    "example.com",
+		Version:  "v1",
+		Kind:     "Widget",
+		Resource: "widgets",
+		Images:   []string{"spec.image", "spec.sidecars[*].ref"},
+	})
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "w", "namespace": "xxxx"},
+		"spec": map[string]interface{}{
+			"image": "karolisr/widget:1.0.0",
+			"sidecars": []interface{}{
+				map[string]interface{}{"ref": "karolisr/logger:1.0.0"},
+				map[string]interface{}{"name": "metrics", "ref": "karolisr/metrics:1.0.0"},
+			},
+		},
+	}}
+
+	gr, err := NewGenericResource(obj)
+	if err != nil {
+		t.Fatalf("failed to create generic resource: %s", err)
+	}
+	names := []string{}
+	for _, c := range gr.Containers() {
+		names = append(names, c.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"spec.image", "spec.sidecars[0].ref", "metrics"}) {
+		t.Errorf("unexpected container names: %v", names)
+	}
+
+	gr.UpdateContainer(0, "karolisr/widget:1.1.0")
+	gr.UpdateContainer(2, "karolisr/metrics:1.1.0")
+	updated := gr.GetResource().(*unstructured.Unstructured)
+	if image, _, _ := unstructured.NestedString(updated.Object, "spec", "image"); image != "karolisr/widget:1.1.0" {
+		t.Errorf("unexpected image: %s", image)
+	}
+	if images := gr.GetImages(nil); images[1] != "karolisr/logger:1.0.0" || images[2] != "karolisr/metrics:1.1.0" {
+		t.Errorf("unexpected images: %v", images)
+	}
+}
+
+func TestLoadCustomKinds(t *testing.T) {
+	config := `
+- group: serving.knative.dev
+  version: v1
+  kind: Service
+  resource: services
+  podTemplate: spec.template
+`
+	path := filepath.Join(t.TempDir(), "custom-resources.yaml")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+	if err := LoadCustomKinds(path); err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	t.Cleanup(func() {
+		customKindsMu.Lock()
+		delete(customKinds, (&CustomKind{Group: "serving.knative.dev", Kind: "Service"}).GroupKind())
+		customKindsMu.Unlock()
+	})
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "serving.knative.dev/v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "hello", "namespace": "xxxx"},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "hello"}},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"image": "karolisr/hello:1.0.0"},
+					},
+				},
+			},
+		},
+	}}
+	gr, err := NewGenericResource(obj)
+	if err != nil {
+		t.Fatalf("failed to create generic resource: %s", err)
+	}
+	if images := gr.GetImages(nil); len(images) != 1 || images[0] != "karolisr/hello:1.0.0" {
+		t.Errorf("unexpected images: %v", images)
+	}
+	if selector, ok := gr.GetPodSelector(); !ok || selector != "app=hello" {
+		t.Errorf("unexpected selector: %s", selector)
+	}
+	if gr.GetCustomKind().GroupVersionResource().Resource != "services" {
+		t.Errorf("unexpected resource: %v", gr.GetCustomKind().GroupVersionResource())
+	}
+}
+
+func TestLoadCustomKindsInvalid(t *testing.T) {
+	for name, config := range map[string]string{
+		"missing images": "- {group: example.com, version: v1, kind: Widget, resource: widgets}",
+		"bad path":       "- {group: example.com, version: v1, kind: Widget, resource: widgets, images: ['spec.containers[']}",
+		"not a list":     "group: example.com",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "custom-resources.yaml")
+			if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+				t.Fatalf("failed to write config: %s", err)
+			}
+			if err := LoadCustomKinds(path); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
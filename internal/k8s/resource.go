@@ -9,6 +9,7 @@ import (
 	batch_v1 "k8s.io/api/batch/v1"
 	core_v1 "k8s.io/api/core/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 )
 
@@ -17,10 +18,15 @@ import (
 type GenericResource struct {
 	// original resource
 	obj interface{}
+	// custom kind descriptor for unstructured resources
+	custom *CustomKind
 
 	Identifier string
 	Namespace  string
 	Name       string
+	// Cluster the resource belongs to, empty for the cluster keel runs in
+	// when it isn't named
+	Cluster string
 }
 
 type genericResource []*GenericResource
@@ -46,17 +52,24 @@ func (c genericResource) Less(i, j int) bool {
 // NewGenericResource - create new generic k8s resource
 func NewGenericResource(obj interface{}) (*GenericResource, error) {
 
-	switch obj.(type) {
+	var custom *CustomKind
+	switch obj := obj.(type) {
 	case *apps_v1.Deployment, *apps_v1.StatefulSet, *apps_v1.DaemonSet:
 		// ok
 	case *batch_v1.CronJob:
 		// ok
+	case *unstructured.Unstructured:
+		custom = lookupCustomKind(obj.GroupVersionKind().GroupKind())
+		if custom == nil {
+			return nil, fmt.Errorf("unsupported resource kind: %s", obj.GroupVersionKind())
+		}
 	default:
 		return nil, fmt.Errorf("unsupported resource type: %v", reflect.TypeOf(obj).Kind())
 	}
 
 	gr := &GenericResource{
-		obj: obj,
+		obj:    obj,
+		custom: custom,
 	}
 
 	gr.Identifier = gr.GetIdentifier()
@@ -79,6 +92,8 @@ func (r *GenericResource) DeepCopy() *GenericResource {
 	gr.Identifier = r.Identifier
 	gr.Namespace = r.Namespace
 	gr.Name = r.Name
+	gr.Cluster = r.Cluster
+	gr.custom = r.custom
 
 	switch obj := r.obj.(type) {
 	case *apps_v1.Deployment:
@@ -89,12 +104,30 @@ func (r *GenericResource) DeepCopy() *GenericResource {
 		gr.obj = obj.DeepCopy()
 	case *batch_v1.CronJob:
 		gr.obj = obj.DeepCopy()
+	case *unstructured.Unstructured:
+		gr.obj = obj.DeepCopy()
 	}
 
 	return gr
 }
 
-// GetIdentifier returns resource identifier
+// SetCluster names the cluster of the resource, the identifier is prefixed
+// with it
+func (r *GenericResource) SetCluster(name string) {
+	r.Cluster = name
+	r.Identifier = ClusterIdentifier(name, r.GetIdentifier())
+}
+
+// ClusterIdentifier - identifier of a resource of the named cluster, ie:
+// production/deployment/default/app
+func ClusterIdentifier(cluster, identifier string) string {
+	if cluster == "" {
+		return identifier
+	}
+	return cluster + "/" + identifier
+}
+
+// GetIdentifier returns resource identifier, without the cluster
 func (r *GenericResource) GetIdentifier() string {
 	switch obj := r.obj.(type) {
 	case *apps_v1.Deployment:
@@ -105,6 +138,8 @@ func (r *GenericResource) GetIdentifier() string {
 		return getDaemonsetSetIdentifier(obj)
 	case *batch_v1.CronJob:
 		return getCronJobIdentifier(obj)
+	case *unstructured.Unstructured:
+		return r.custom.identifier(obj)
 	}
 	return ""
 }
@@ -120,6 +155,8 @@ func (r *GenericResource) GetName() string {
 		return obj.GetName()
 	case *batch_v1.CronJob:
 		return obj.GetName()
+	case *unstructured.Unstructured:
+		return obj.GetName()
 	}
 	return ""
 }
@@ -135,6 +172,8 @@ func (r *GenericResource) GetNamespace() string {
 		return obj.GetNamespace()
 	case *batch_v1.CronJob:
 		return obj.GetNamespace()
+	case *unstructured.Unstructured:
+		return obj.GetNamespace()
 	}
 	return ""
 }
@@ -150,6 +189,8 @@ func (r *GenericResource) Kind() string {
 		return "daemonset"
 	case *batch_v1.CronJob:
 		return "cronjob"
+	case *unstructured.Unstructured:
+		return r.custom.kind()
 	}
 	return ""
 }
@@ -159,6 +200,11 @@ func (r *GenericResource) GetResource() interface{} {
 	return r.obj
 }
 
+// GetCustomKind - get custom kind descriptor, nil for built-in workload types
+func (r *GenericResource) GetCustomKind() *CustomKind {
+	return r.custom
+}
+
 // GetLabels - get resource labels
 func (r *GenericResource) GetLabels() (labels map[string]string) {
 	switch obj := r.obj.(type) {
@@ -170,6 +216,8 @@ func (r *GenericResource) GetLabels() (labels map[string]string) {
 		return getOrInitialise(obj.GetLabels())
 	case *batch_v1.CronJob:
 		return getOrInitialise(obj.GetLabels())
+	case *unstructured.Unstructured:
+		return getOrInitialise(obj.GetLabels())
 	}
 	return
 }
@@ -185,6 +233,8 @@ func (r *GenericResource) SetLabels(labels map[string]string) {
 		obj.SetLabels(labels)
 	case *batch_v1.CronJob:
 		obj.SetLabels(labels)
+	case *unstructured.Unstructured:
+		obj.SetLabels(labels)
 	}
 }
 
@@ -199,6 +249,8 @@ func (r *GenericResource) GetSpecAnnotations() (annotations map[string]string) {
 		return getOrInitialise(obj.Spec.Template.GetAnnotations())
 	case *batch_v1.CronJob:
 		return getOrInitialise(obj.Spec.JobTemplate.GetAnnotations())
+	case *unstructured.Unstructured:
+		return getOrInitialise(r.custom.getSpecAnnotations(obj))
 	}
 	return
 }
@@ -214,6 +266,8 @@ func (r *GenericResource) SetSpecAnnotations(annotations map[string]string) {
 		obj.Spec.Template.SetAnnotations(annotations)
 	case *batch_v1.CronJob:
 		obj.Spec.JobTemplate.SetAnnotations(annotations)
+	case *unstructured.Unstructured:
+		r.custom.setSpecAnnotations(obj, annotations)
 	}
 }
 
@@ -235,6 +289,8 @@ func (r *GenericResource) GetAnnotations() (annotations map[string]string) {
 		return getOrInitialise(obj.GetAnnotations())
 	case *batch_v1.CronJob:
 		return getOrInitialise(obj.GetAnnotations())
+	case *unstructured.Unstructured:
+		return getOrInitialise(obj.GetAnnotations())
 	}
 	return
 }
@@ -250,6 +306,8 @@ func (r *GenericResource) SetAnnotations(annotations map[string]string) {
 		obj.SetAnnotations(annotations)
 	case *batch_v1.CronJob:
 		obj.SetAnnotations(annotations)
+	case *unstructured.Unstructured:
+		obj.SetAnnotations(annotations)
 	}
 }
 
@@ -264,6 +322,8 @@ func (r *GenericResource) GetImagePullSecrets() (secrets []string) {
 		return getImagePullSecrets(obj.Spec.Template.Spec.ImagePullSecrets)
 	case *batch_v1.CronJob:
 		return getImagePullSecrets(obj.Spec.JobTemplate.Spec.Template.Spec.ImagePullSecrets)
+	case *unstructured.Unstructured:
+		return getImagePullSecrets(r.custom.podSpec(obj).ImagePullSecrets)
 	}
 	return
 }
@@ -279,6 +339,8 @@ func (r *GenericResource) GetNodeSelector() map[string]string {
 		return obj.Spec.Template.Spec.NodeSelector
 	case *batch_v1.CronJob:
 		return obj.Spec.JobTemplate.Spec.Template.Spec.NodeSelector
+	case *unstructured.Unstructured:
+		return r.custom.podSpec(obj).NodeSelector
 	}
 	return nil
 }
@@ -294,6 +356,8 @@ func (r *GenericResource) GetPodSpec() *core_v1.PodSpec {
 		return &obj.Spec.Template.Spec
 	case *batch_v1.CronJob:
 		return &obj.Spec.JobTemplate.Spec.Template.Spec
+	case *unstructured.Unstructured:
+		return r.custom.getPodSpec(obj)
 	}
 	return nil
 }
@@ -313,6 +377,8 @@ func (r *GenericResource) GetPodSelector() (string, bool) {
 			return "", false
 		}
 		return labels.Set(obj.Spec.JobTemplate.Spec.Template.Labels).String(), true
+	case *unstructured.Unstructured:
+		return r.custom.podSelector(obj)
 	}
 	if selector == nil {
 		return "", false
@@ -335,6 +401,8 @@ func (r *GenericResource) GetImages(filter ContainerFilter) (images []string) {
 		return getContainerImages(obj.Spec.Template.Spec.Containers, filter)
 	case *batch_v1.CronJob:
 		return getContainerImages(obj.Spec.JobTemplate.Spec.Template.Spec.Containers, filter)
+	case *unstructured.Unstructured:
+		return getContainerImages(containersAt(obj, r.custom.images), filter)
 	}
 	return
 }
@@ -350,6 +418,8 @@ func (r *GenericResource) GetInitImages(filter ContainerFilter) (images []string
 		return getContainerImages(obj.Spec.Template.Spec.InitContainers, filter)
 	case *batch_v1.CronJob:
 		return getContainerImages(obj.Spec.JobTemplate.Spec.Template.Spec.InitContainers, filter)
+	case *unstructured.Unstructured:
+		return getContainerImages(containersAt(obj, r.custom.initImages), filter)
 	}
 	return
 }
@@ -365,6 +435,8 @@ func (r *GenericResource) Containers() (containers []core_v1.Container) {
 		return obj.Spec.Template.Spec.Containers
 	case *batch_v1.CronJob:
 		return obj.Spec.JobTemplate.Spec.Template.Spec.Containers
+	case *unstructured.Unstructured:
+		return containersAt(obj, r.custom.images)
 	}
 	return
 }
@@ -380,6 +452,8 @@ func (r *GenericResource) InitContainers() (containers []core_v1.Container) {
 		return obj.Spec.Template.Spec.InitContainers
 	case *batch_v1.CronJob:
 		return obj.Spec.JobTemplate.Spec.Template.Spec.InitContainers
+	case *unstructured.Unstructured:
+		return containersAt(obj, r.custom.initImages)
 	}
 	return
 }
@@ -395,6 +469,8 @@ func (r *GenericResource) UpdateContainer(index int, image string) {
 		updateDaemonsetSetContainer(obj, index, image)
 	case *batch_v1.CronJob:
 		updateCronJobContainer(obj, index, image)
+	case *unstructured.Unstructured:
+		updateImageAt(obj, r.custom.images, index, image)
 	}
 }
 
@@ -409,6 +485,8 @@ func (r *GenericResource) UpdateInitContainer(index int, image string) {
 		updateDaemonsetSetInitContainer(obj, index, image)
 	case *batch_v1.CronJob:
 		updateCronJobInitContainer(obj, index, image)
+	case *unstructured.Unstructured:
+		updateImageAt(obj, r.custom.initImages, index, image)
 	}
 }
 
@@ -423,6 +501,8 @@ func (r *GenericResource) Volumes() (volumes []core_v1.Volume) {
 		return obj.Spec.Template.Spec.Volumes
 	case *batch_v1.CronJob:
 		return obj.Spec.JobTemplate.Spec.Template.Spec.Volumes
+	case *unstructured.Unstructured:
+		return r.custom.podSpec(obj).Volumes
 	}
 	return
 }
@@ -446,6 +526,8 @@ func (r *GenericResource) UpdateImageVolume(index int, image string) {
 		updateDaemonsetSetImageVolume(obj, index, image)
 	case *batch_v1.CronJob:
 		updateCronJobImageVolume(obj, index, image)
+	case *unstructured.Unstructured:
+		r.custom.updateImageVolume(obj, index, image)
 	}
 }
 
@@ -507,6 +589,75 @@ func (r *GenericResource) GetStatus() Status {
 			AvailableReplicas:   0,
 			UnavailableReplicas: 0,
 		}
+	case *unstructured.Unstructured:
+		replicas := getUnstructuredInt32(obj, "status", "replicas")
+		available := getUnstructuredInt32(obj, "status", "availableReplicas")
+		unavailable := replicas - available
+		if unavailable < 0 {
+			unavailable = 0
+		}
+		return Status{
+			Replicas:            replicas,
+			UpdatedReplicas:     getUnstructuredInt32(obj, "status", "updatedReplicas"),
+			ReadyReplicas:       getUnstructuredInt32(obj, "status", "readyReplicas"),
+			AvailableReplicas:   available,
+			UnavailableReplicas: unavailable,
+		}
 	}
 	return Status{}
 }
+
+// OnDeleteUpdates reports whether the controller replaces pods only when they
+// are deleted (OnDelete update strategy), so template changes don't roll them
+func (r *GenericResource) OnDeleteUpdates() bool {
+	switch obj := r.obj.(type) {
+	case *apps_v1.StatefulSet:
+		return obj.Spec.UpdateStrategy.Type == apps_v1.OnDeleteStatefulSetStrategyType
+	case *apps_v1.DaemonSet:
+		return obj.Spec.UpdateStrategy.Type == apps_v1.OnDeleteDaemonSetStrategyType
+	}
+	return false
+}
+
+// RolloutComplete reports whether the controller has observed the latest spec
+// and every replica runs the current template. ok is false for kinds that
+// don't report rollout progress, such as cron jobs or custom resources without
+// a replica status.
+func (r *GenericResource) RolloutComplete() (complete bool, ok bool) {
+	switch obj := r.obj.(type) {
+	case *apps_v1.Deployment:
+		desired := int32(1)
+		if obj.Spec.Replicas != nil {
+			desired = *obj.Spec.Replicas
+		}
+		return obj.Status.ObservedGeneration >= obj.Generation &&
+			obj.Status.UpdatedReplicas == desired &&
+			obj.Status.Replicas == desired &&
+			obj.Status.AvailableReplicas == desired, true
+	case *apps_v1.StatefulSet:
+		desired := int32(1)
+		if obj.Spec.Replicas != nil {
+			desired = *obj.Spec.Replicas
+		}
+		return obj.Status.ObservedGeneration >= obj.Generation &&
+			obj.Status.UpdatedReplicas == desired &&
+			obj.Status.ReadyReplicas == desired, true
+	case *apps_v1.DaemonSet:
+		return obj.Status.ObservedGeneration >= obj.Generation &&
+			obj.Status.UpdatedNumberScheduled == obj.Status.DesiredNumberScheduled &&
+			obj.Status.NumberAvailable == obj.Status.DesiredNumberScheduled, true
+	case *unstructured.Unstructured:
+		if _, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "status", "replicas"); !found {
+			return false, false
+		}
+		// argo rollouts report the observed generation as a string
+		observed, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "status", "observedGeneration")
+		if found && fmt.Sprint(observed) != fmt.Sprint(obj.GetGeneration()) {
+			return false, true
+		}
+		status := r.GetStatus()
+		return status.UpdatedReplicas == status.Replicas &&
+			status.AvailableReplicas == status.Replicas, true
+	}
+	return false, false
+}
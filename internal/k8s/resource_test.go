@@ -303,3 +303,59 @@ func TestDaemonsetlSetMultipleContainers(t *testing.T) {
 		t.Errorf("unexpected image: %s", updated.Spec.Template.Spec.Containers[0].Image)
 	}
 }
+
+func TestDeploymentRolloutComplete(t *testing.T) {
+	replicas := int32(2)
+	d := &apps_v1.Deployment{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "dep-1", Namespace: "xxxx", Generation: 2},
+		Spec:       apps_v1.DeploymentSpec{Replicas: &replicas},
+		Status: apps_v1.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           2,
+			UpdatedReplicas:    2,
+			AvailableReplicas:  2,
+		},
+	}
+	gr, err := NewGenericResource(d)
+	if err != nil {
+		t.Fatalf("failed to create generic resource: %s", err)
+	}
+	if complete, ok := gr.RolloutComplete(); complete || !ok {
+		t.Errorf("rollout of an unobserved generation should not be complete")
+	}
+
+	d.Status.ObservedGeneration = 2
+	d.Status.Replicas = 3
+	d.Status.UpdatedReplicas = 1
+	if complete, _ := gr.RolloutComplete(); complete {
+		t.Errorf("rollout with old replicas should not be complete")
+	}
+
+	d.Status.Replicas = 2
+	d.Status.UpdatedReplicas = 2
+	if complete, ok := gr.RolloutComplete(); !complete || !ok {
+		t.Errorf("expected rollout to be complete")
+	}
+}
+
+func TestSetCluster(t *testing.T) {
+	gr, err := NewGenericResource(&apps_v1.Deployment{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "dep-1", Namespace: "xxxx"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create generic resource: %s", err)
+	}
+
+	gr.SetCluster("")
+	if gr.Identifier != "deployment/xxxx/dep-1" {
+		t.Errorf("unexpected identifier: %s", gr.Identifier)
+	}
+
+	gr.SetCluster("production")
+	if gr.Identifier != "production/deployment/xxxx/dep-1" {
+		t.Errorf("unexpected identifier: %s", gr.Identifier)
+	}
+	if copied := gr.DeepCopy(); copied.Cluster != "production" || copied.Identifier != gr.Identifier {
+		t.Errorf("cluster not copied: %s, %s", copied.Cluster, copied.Identifier)
+	}
+}
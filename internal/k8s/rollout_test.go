@@ -0,0 +1,126 @@
+package k8s
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testRollout() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Rollout",
+		"metadata": map[string]interface{}{
+			"name":        "ro-1",
+			"namespace":   "xxxx",
+			"annotations": map[string]interface{}{"keel.sh/policy": "minor"},
+		},
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{"app": "ro-1"},
+			},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{"app": "ro-1"},
+				},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app", "image": "gcr.io/v2-namespace/hello-world:1.1.1"},
+						map[string]interface{}{"name": "sidecar", "image": "gcr.io/v2-namespace/sidecar:1.0.0"},
+					},
+					"initContainers": []interface{}{
+						map[string]interface{}{"name": "init", "image": "gcr.io/v2-namespace/init:1.0.0"},
+					},
+					"imagePullSecrets": []interface{}{
+						map[string]interface{}{"name": "very-secret"},
+					},
+				},
+			},
+			"strategy": map[string]interface{}{
+				"canary": map[string]interface{}{"steps": []interface{}{}},
+			},
+		},
+		"status": map[string]interface{}{
+			"replicas":          int64(3),
+			"updatedReplicas":   int64(1),
+			"readyReplicas":     int64(2),
+			"availableReplicas": int64(2),
+		},
+	}}
+}
+
+func TestRollout(t *testing.T) {
+	gr, err := NewGenericResource(testRollout())
+	if err != nil {
+		t.Fatalf("failed to create generic resource: %s", err)
+	}
+
+	if gr.Identifier != "rollout/xxxx/ro-1" {
+		t.Errorf("unexpected identifier: %s", gr.Identifier)
+	}
+	if gr.Kind() != "rollout" {
+		t.Errorf("unexpected kind: %s", gr.Kind())
+	}
+	if gr.GetAnnotations()["keel.sh/policy"] != "minor" {
+		t.Errorf("unexpected annotations: %v", gr.GetAnnotations())
+	}
+	if images := gr.GetImages(nil); len(images) != 2 || images[1] != "gcr.io/v2-namespace/sidecar:1.0.0" {
+		t.Errorf("unexpected images: %v", images)
+	}
+	if images := gr.GetInitImages(nil); len(images) != 1 || images[0] != "gcr.io/v2-namespace/init:1.0.0" {
+		t.Errorf("unexpected init images: %v", images)
+	}
+	if secrets := gr.GetImagePullSecrets(); len(secrets) != 1 || secrets[0] != "very-secret" {
+		t.Errorf("unexpected secrets: %v", secrets)
+	}
+	if selector, ok := gr.GetPodSelector(); !ok || selector != "app=ro-1" {
+		t.Errorf("unexpected selector: %s", selector)
+	}
+
+	gr.UpdateContainer(1, "gcr.io/v2-namespace/sidecar:1.1.0")
+	gr.UpdateInitContainer(0, "gcr.io/v2-namespace/init:1.1.0")
+	specAnnotations := gr.GetSpecAnnotations()
+	specAnnotations["keel.sh/update-time"] = "now"
+	gr.SetSpecAnnotations(specAnnotations)
+
+	updated := gr.GetResource().(*unstructured.Unstructured)
+	containers, _, _ := unstructured.NestedSlice(updated.Object, "spec", "template", "spec", "containers")
+	if image := containers[1].(map[string]interface{})["image"]; image != "gcr.io/v2-namespace/sidecar:1.1.0" {
+		t.Errorf("unexpected image: %s", image)
+	}
+	if image := containers[0].(map[string]interface{})["image"]; image != "gcr.io/v2-namespace/hello-world:1.1.1" {
+		t.Errorf("first container should not be changed, got: %s", image)
+	}
+	if images := gr.GetInitImages(nil); images[0] != "gcr.io/v2-namespace/init:1.1.0" {
+		t.Errorf("unexpected init image: %s", images[0])
+	}
+	if gr.GetSpecAnnotations()["keel.sh/update-time"] != "now" {
+		t.Errorf("spec annotations not set: %v", gr.GetSpecAnnotations())
+	}
+	// the canary strategy is left untouched for the rollouts controller
+	if _, found, _ := unstructured.NestedMap(updated.Object, "spec", "strategy", "canary"); !found {
+		t.Errorf("rollout strategy should be preserved")
+	}
+
+	status := gr.GetStatus()
+	if status.Replicas != 3 || status.UpdatedReplicas != 1 || status.ReadyReplicas != 2 || status.UnavailableReplicas != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	copied := gr.DeepCopy()
+	copied.UpdateContainer(0, "gcr.io/v2-namespace/hello-world:9.9.9")
+	if images := gr.GetImages(nil); images[0] != "gcr.io/v2-namespace/hello-world:1.1.1" {
+		t.Errorf("deep copy should not change the original: %v", images)
+	}
+}
+
+func TestUnsupportedUnstructured(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "w", "namespace": "xxxx"},
+	}}
+	if _, err := NewGenericResource(obj); err == nil {
+		t.Errorf("expected an error for an unsupported kind")
+	}
+}
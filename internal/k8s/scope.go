@@ -0,0 +1,180 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/keel-hq/keel/internal/workgroup"
+	appconfig "github.com/keel-hq/keel/pkg/config"
+	"github.com/sirupsen/logrus"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Scope - namespaces and objects keel watches: included and excluded
+// namespaces, a namespace label selector and an object label selector
+type Scope struct {
+	include           []string // empty includes all namespaces
+	exclude           map[string]bool
+	namespaceSelector labels.Selector // nil when not set
+	objectSelector    labels.Selector // nil when not set
+
+	// namespaces caches namespace labels for the namespace selector
+	namespaces cache.Store
+	synced     cache.InformerSynced
+}
+
+// NewScope - scope of the configuration. RESTRICTED_NAMESPACE is kept as a
+// single included namespace.
+func NewScope(config appconfig.KubernetesConfig) (*Scope, error) {
+	s := &Scope{
+		exclude: make(map[string]bool),
+	}
+
+	s.include = splitList(config.Namespaces)
+	if restricted := namespaceFor(config); restricted != v1.NamespaceAll && !contains(s.include, restricted) {
+		s.include = append(s.include, restricted)
+	}
+	for _, namespace := range splitList(config.ExcludedNamespaces) {
+		s.exclude[namespace] = true
+	}
+
+	if config.NamespaceSelector != "" {
+		selector, err := labels.Parse(config.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector '%s': %w", config.NamespaceSelector, err)
+		}
+		s.namespaceSelector = selector
+	}
+	if config.ObjectSelector != "" {
+		selector, err := labels.Parse(config.ObjectSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object selector '%s': %w", config.ObjectSelector, err)
+		}
+		s.objectSelector = selector
+	}
+
+	return s, nil
+}
+
+// IncludesNamespace - whether objects of the namespace are watched
+func (s *Scope) IncludesNamespace(namespace *v1.Namespace) bool {
+	if !s.includesNamespaceName(namespace.Name) {
+		return false
+	}
+	return s.namespaceSelector == nil || s.namespaceSelector.Matches(labels.Set(namespace.Labels))
+}
+
+// IncludesObject - whether the object is watched, namespace labels come from
+// the namespaces watched with WatchNamespaces
+func (s *Scope) IncludesObject(namespace string, objectLabels map[string]string) bool {
+	if !s.includesNamespaceName(namespace) {
+		return false
+	}
+	if !s.MatchesObject(objectLabels) {
+		return false
+	}
+	if s.namespaceSelector == nil {
+		return true
+	}
+	if s.namespaces == nil {
+		return false
+	}
+	item, exists, err := s.namespaces.GetByKey(namespace)
+	if err != nil || !exists {
+		return false
+	}
+	ns, ok := item.(*v1.Namespace)
+	return ok && s.namespaceSelector.Matches(labels.Set(ns.Labels))
+}
+
+// MatchesObject - whether the object labels match the object selector
+func (s *Scope) MatchesObject(objectLabels map[string]string) bool {
+	return s.objectSelector == nil || s.objectSelector.Matches(labels.Set(objectLabels))
+}
+
+// WatchNamespaces creates a SharedInformer for namespaces when the scope has
+// a namespace selector and registers it with g, object watchers wait for it
+// to sync
+func (s *Scope) WatchNamespaces(g *workgroup.Group, client kubernetes.Interface, log logrus.FieldLogger) {
+	if s.namespaceSelector == nil {
+		return
+	}
+	lw := cache.NewListWatchFromClient(client.CoreV1().RESTClient(), "namespaces", v1.NamespaceAll, fields.Everything())
+	informer := cache.NewSharedInformer(lw, new(v1.Namespace), 0)
+	s.namespaces = informer.GetStore()
+	s.synced = informer.HasSynced
+	g.Add(func(stop <-chan struct{}) {
+		log := log.WithField("resource", "namespaces")
+		log.Println("started")
+		defer log.Println("stopped")
+		informer.Run(stop)
+	})
+}
+
+// listNamespaces - namespaces informers list objects from
+func (s *Scope) listNamespaces() []string {
+	if len(s.include) == 0 {
+		return []string{v1.NamespaceAll}
+	}
+	var namespaces []string
+	for _, namespace := range s.include {
+		if !s.exclude[namespace] {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// labelSelector - object selector applied by the API server
+func (s *Scope) labelSelector() string {
+	if s.objectSelector == nil {
+		return ""
+	}
+	return s.objectSelector.String()
+}
+
+// filter wraps the handler so it only gets events of objects in scope,
+// objects leaving the scope are deleted from it
+func (s *Scope) filter(rh cache.ResourceEventHandler) cache.ResourceEventHandler {
+	if len(s.exclude) == 0 && s.namespaceSelector == nil {
+		// the API server lists objects of the included namespaces matching
+		// the object selector only
+		return rh
+	}
+	return cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			accessor, err := meta.Accessor(obj)
+			if err != nil {
+				return false
+			}
+			return s.IncludesObject(accessor.GetNamespace(), accessor.GetLabels())
+		},
+		Handler: rh,
+	}
+}
+
+func (s *Scope) includesNamespaceName(namespace string) bool {
+	if s.exclude[namespace] {
+		return false
+	}
+	return len(s.include) == 0 || contains(s.include, namespace)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,132 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/keel-hq/keel/pkg/config"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func namespace(name string, labels map[string]string) *v1.Namespace {
+	return &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func scopedDeployment(namespace, name string, labels map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels}}
+}
+
+func TestScopeListNamespaces(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  config.KubernetesConfig
+		want []string
+	}{
+		{"all", config.KubernetesConfig{}, []string{v1.NamespaceAll}},
+		{"excluded only", config.KubernetesConfig{ExcludedNamespaces: "kube-system"}, []string{v1.NamespaceAll}},
+		{"restricted namespace", config.KubernetesConfig{RestrictedNamespace: "typed"}, []string{"typed"}},
+		{"included", config.KubernetesConfig{Namespaces: "team-a, team-b,,team-c", ExcludedNamespaces: "team-b"}, []string{"team-a", "team-c"}},
+		{"included and restricted", config.KubernetesConfig{Namespaces: "team-a", RestrictedNamespace: "team-b"}, []string{"team-a", "team-b"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := NewScope(tt.cfg)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := scope.listNamespaces(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listNamespaces() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeInvalidSelectors(t *testing.T) {
+	if _, err := NewScope(config.KubernetesConfig{NamespaceSelector: "keel in (a"}); err == nil {
+		t.Error("expected namespace selector error")
+	}
+	if _, err := NewScope(config.KubernetesConfig{ObjectSelector: "=x"}); err == nil {
+		t.Error("expected object selector error")
+	}
+}
+
+func TestScopeIncludes(t *testing.T) {
+	scope, err := NewScope(config.KubernetesConfig{
+		ExcludedNamespaces: "kube-system",
+		NamespaceSelector:  "team in (a, b)",
+		ObjectSelector:     "tier!=db",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	scope.namespaces = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, ns := range []*v1.Namespace{
+		namespace("team-a", map[string]string{"team": "a"}),
+		namespace("team-c", map[string]string{"team": "c"}),
+		namespace("kube-system", map[string]string{"team": "a"}),
+	} {
+		scope.namespaces.Add(ns)
+	}
+
+	if !scope.IncludesNamespace(namespace("team-a", map[string]string{"team": "a"})) {
+		t.Error("team-a must be included")
+	}
+	if scope.IncludesNamespace(namespace("team-c", map[string]string{"team": "c"})) {
+		t.Error("team-c doesn't match the namespace selector")
+	}
+	if scope.IncludesNamespace(namespace("kube-system", map[string]string{"team": "a"})) {
+		t.Error("kube-system is excluded")
+	}
+
+	for _, tt := range []struct {
+		namespace string
+		labels    map[string]string
+		want      bool
+	}{
+		{"team-a", map[string]string{"tier": "web"}, true},
+		{"team-a", nil, true},
+		{"team-a", map[string]string{"tier": "db"}, false},
+		{"team-c", nil, false},
+		{"kube-system", nil, false},
+		{"unknown", nil, false},
+	} {
+		if got := scope.IncludesObject(tt.namespace, tt.labels); got != tt.want {
+			t.Errorf("IncludesObject(%s, %v) = %t, want %t", tt.namespace, tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestScopeFilter(t *testing.T) {
+	scope, err := NewScope(config.KubernetesConfig{ExcludedNamespaces: "kube-system"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var added, deleted []string
+	handler := scope.filter(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			added = append(added, obj.(*appsv1.Deployment).Name)
+		},
+		DeleteFunc: func(obj interface{}) {
+			deleted = append(deleted, obj.(*appsv1.Deployment).Name)
+		},
+	})
+
+	handler.OnAdd(scopedDeployment("default", "api", nil), true)
+	handler.OnAdd(scopedDeployment("kube-system", "coredns", nil), true)
+	handler.OnDelete(scopedDeployment("kube-system", "coredns", nil))
+
+	if !reflect.DeepEqual(added, []string{"api"}) || len(deleted) != 0 {
+		t.Errorf("unexpected events, added: %v, deleted: %v", added, deleted)
+	}
+
+	// nothing to filter client side
+	unfiltered, _ := NewScope(config.KubernetesConfig{Namespaces: "default", ObjectSelector: "tier=web"})
+	rh := cache.ResourceEventHandlerFuncs{}
+	if _, ok := unfiltered.filter(rh).(cache.ResourceEventHandlerFuncs); !ok {
+		t.Error("expected the handler to be used as is")
+	}
+}
@@ -10,6 +10,9 @@ type Translator struct {
 	GenericResourceCache
 
 	KeelSelector string
+
+	// Cluster names the cluster resources are translated from
+	Cluster string
 }
 
 func (t *Translator) OnAdd(obj interface{}, isInInitialList bool) {
@@ -18,6 +21,7 @@ func (t *Translator) OnAdd(obj interface{}, isInInitialList bool) {
 		t.Errorf("OnAdd failed to add resource %T: %#v", obj, obj)
 		return
 	}
+	gr.SetCluster(t.Cluster)
 	t.Debugf("added %s %s", gr.Kind(), gr.Name)
 	t.GenericResourceCache.Add(gr)
 }
@@ -28,6 +32,7 @@ func (t *Translator) OnUpdate(oldObj, newObj interface{}) {
 		t.Errorf("OnUpdate failed to update resource %T: %#v", newObj, newObj)
 		return
 	}
+	gr.SetCluster(t.Cluster)
 	t.Debugf("updated %s %s", gr.Kind(), gr.Name)
 	t.GenericResourceCache.Add(gr)
 }
@@ -38,6 +43,7 @@ func (t *Translator) OnDelete(obj interface{}) {
 		t.Errorf("OnDelete failed to delete resource %T: %#v", obj, obj)
 		return
 	}
+	gr.SetCluster(t.Cluster)
 	t.Debugf("deleted %s %s", gr.Kind(), gr.Name)
-	t.GenericResourceCache.Remove(gr.GetIdentifier())
+	t.GenericResourceCache.Remove(gr.Identifier)
 }
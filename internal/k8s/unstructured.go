@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// helpers for resources that are only available through the dynamic client
+// and embed a regular pod template (for example Argo Rollouts). The path
+// points at the pod template, i.e. ["spec", "template"].
+
+func getUnstructuredPodTemplate(u *unstructured.Unstructured, path []string) *core_v1.PodTemplateSpec {
+	raw, found, err := unstructured.NestedMap(u.Object, path...)
+	if err != nil || !found {
+		return nil
+	}
+	template := &core_v1.PodTemplateSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, template); err != nil {
+		return nil
+	}
+	return template
+}
+
+func getUnstructuredPodSpec(u *unstructured.Unstructured, path []string) *core_v1.PodSpec {
+	template := getUnstructuredPodTemplate(u, path)
+	if template == nil {
+		return nil
+	}
+	return &template.Spec
+}
+
+func getUnstructuredTemplateAnnotations(u *unstructured.Unstructured, path []string) map[string]string {
+	annotations, _, _ := unstructured.NestedStringMap(u.Object, subPath(path, "metadata", "annotations")...)
+	return annotations
+}
+
+func setUnstructuredTemplateAnnotations(u *unstructured.Unstructured, path []string, annotations map[string]string) {
+	unstructured.SetNestedStringMap(u.Object, annotations, subPath(path, "metadata", "annotations")...)
+}
+
+func getUnstructuredLabelSelector(u *unstructured.Unstructured, path []string) *meta_v1.LabelSelector {
+	raw, found, err := unstructured.NestedMap(u.Object, path...)
+	if err != nil || !found {
+		return nil
+	}
+	selector := &meta_v1.LabelSelector{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, selector); err != nil {
+		return nil
+	}
+	return selector
+}
+
+// setUnstructuredListField sets field of the index-th element of the list
+// found under path, e.g. spec.template.spec.containers[index].image.
+func setUnstructuredListField(u *unstructured.Unstructured, path []string, index int, value string, field ...string) {
+	items, found, err := unstructured.NestedSlice(u.Object, path...)
+	if err != nil || !found || index < 0 || index >= len(items) {
+		return
+	}
+	item, ok := items[index].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if err := unstructured.SetNestedField(item, value, field...); err != nil {
+		return
+	}
+	items[index] = item
+	unstructured.SetNestedSlice(u.Object, items, path...)
+}
+
+func getUnstructuredInt32(u *unstructured.Unstructured, path ...string) int32 {
+	value, _, _ := unstructured.NestedInt64(u.Object, path...)
+	return int32(value)
+}
+
+func subPath(path []string, elems ...string) []string {
+	return append(append([]string{}, path...), elems...)
+}
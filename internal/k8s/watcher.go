@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"container/list"
+	"context"
 	"fmt"
 	"reflect"
 	"sync"
@@ -18,8 +19,13 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
-	"k8s.io/apimachinery/pkg/fields"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8swatch "k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 )
@@ -55,34 +61,86 @@ func init() {
 	prometheus.MustRegister(bufferEvents, bufferCoalesced, bufferBackpressure, bufferDropped, bufferQueueDepth, bufferQueueCapacity)
 }
 
-// WatchDeployments creates a SharedInformer for apps/v1.Deployments and registers it with g.
-func WatchDeployments(g *workgroup.Group, client *kubernetes.Clientset, log logrus.FieldLogger, config appconfig.KubernetesConfig, rs ...cache.ResourceEventHandler) {
-	watch(g, client.AppsV1().RESTClient(), log, config, "deployments", new(apps_v1.Deployment), rs...)
+// WatchDeployments creates SharedInformers for apps/v1.Deployments in scope and registers them with g.
+func WatchDeployments(g *workgroup.Group, client *kubernetes.Clientset, log logrus.FieldLogger, scope *Scope, rs ...cache.ResourceEventHandler) {
+	watch(g, client.AppsV1().RESTClient(), log, scope, "deployments", new(apps_v1.Deployment), rs...)
 }
 
-// WatchStatefulSets creates a SharedInformer for apps/v1.StatefulSet and registers it with g.
-func WatchStatefulSets(g *workgroup.Group, client *kubernetes.Clientset, log logrus.FieldLogger, config appconfig.KubernetesConfig, rs ...cache.ResourceEventHandler) {
-	watch(g, client.AppsV1().RESTClient(), log, config, "statefulsets", new(apps_v1.StatefulSet), rs...)
+// WatchStatefulSets creates SharedInformers for apps/v1.StatefulSet in scope and registers them with g.
+func WatchStatefulSets(g *workgroup.Group, client *kubernetes.Clientset, log logrus.FieldLogger, scope *Scope, rs ...cache.ResourceEventHandler) {
+	watch(g, client.AppsV1().RESTClient(), log, scope, "statefulsets", new(apps_v1.StatefulSet), rs...)
 }
 
-// WatchDaemonSets creates a SharedInformer for apps/v1.DaemonSet and registers it with g.
-func WatchDaemonSets(g *workgroup.Group, client *kubernetes.Clientset, log logrus.FieldLogger, config appconfig.KubernetesConfig, rs ...cache.ResourceEventHandler) {
-	watch(g, client.AppsV1().RESTClient(), log, config, "daemonsets", new(apps_v1.DaemonSet), rs...)
+// WatchDaemonSets creates SharedInformers for apps/v1.DaemonSet in scope and registers them with g.
+func WatchDaemonSets(g *workgroup.Group, client *kubernetes.Clientset, log logrus.FieldLogger, scope *Scope, rs ...cache.ResourceEventHandler) {
+	watch(g, client.AppsV1().RESTClient(), log, scope, "daemonsets", new(apps_v1.DaemonSet), rs...)
 }
 
-// WatchCronJobs creates a SharedInformer for batch_v1.CronJob and registers it with g.
-func WatchCronJobs(g *workgroup.Group, client *kubernetes.Clientset, log logrus.FieldLogger, config appconfig.KubernetesConfig, rs ...cache.ResourceEventHandler) {
-	watch(g, client.BatchV1().RESTClient(), log, config, "cronjobs", new(batch_v1.CronJob), rs...)
+// WatchCronJobs creates SharedInformers for batch_v1.CronJob in scope and registers them with g.
+func WatchCronJobs(g *workgroup.Group, client *kubernetes.Clientset, log logrus.FieldLogger, scope *Scope, rs ...cache.ResourceEventHandler) {
+	watch(g, client.BatchV1().RESTClient(), log, scope, "cronjobs", new(batch_v1.CronJob), rs...)
 }
 
-func watch(g *workgroup.Group, c cache.Getter, log logrus.FieldLogger, config appconfig.KubernetesConfig, resource string, objType runtime.Object, rs ...cache.ResourceEventHandler) {
-	lw := cache.NewListWatchFromClient(c, resource, namespaceFor(config), fields.Everything())
+// WatchCustomKind creates SharedInformers for a registered custom resource kind
+// (for example argoproj.io/v1alpha1.Rollout) in scope, served by the dynamic
+// client, and registers them with g.
+func WatchCustomKind(g *workgroup.Group, client dynamic.Interface, log logrus.FieldLogger, scope *Scope, kind *CustomKind, rs ...cache.ResourceEventHandler) {
+	watchDynamic(g, client, log, scope, kind.GroupVersionResource(), rs...)
+}
+
+// ResourceServed reports whether the API server serves the given resource, so
+// watchers for optional CRDs are only started when they are installed.
+func ResourceServed(client discovery.DiscoveryInterface, gvr schema.GroupVersionResource) bool {
+	resources, err := client.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return false
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == gvr.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+// watch runs an informer per included namespace (a single one for all
+// namespaces), listing objects matching the object selector
+func watch(g *workgroup.Group, c cache.Getter, log logrus.FieldLogger, scope *Scope, resource string, objType runtime.Object, rs ...cache.ResourceEventHandler) {
+	for _, namespace := range scope.listNamespaces() {
+		lw := cache.NewFilteredListWatchFromClient(c, resource, namespace, func(options *meta_v1.ListOptions) {
+			options.LabelSelector = scope.labelSelector()
+		})
+		run(g, lw, log.WithField("namespace", namespace), scope, resource, objType, rs...)
+	}
+}
+
+func watchDynamic(g *workgroup.Group, client dynamic.Interface, log logrus.FieldLogger, scope *Scope, gvr schema.GroupVersionResource, rs ...cache.ResourceEventHandler) {
+	for _, namespace := range scope.listNamespaces() {
+		ri := client.Resource(gvr).Namespace(namespace)
+		lw := &cache.ListWatch{
+			ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+				options.LabelSelector = scope.labelSelector()
+				return ri.List(context.TODO(), options)
+			},
+			WatchFunc: func(options meta_v1.ListOptions) (k8swatch.Interface, error) {
+				options.LabelSelector = scope.labelSelector()
+				return ri.Watch(context.TODO(), options)
+			},
+		}
+		run(g, lw, log.WithField("namespace", namespace), scope, gvr.Resource, &unstructured.Unstructured{}, rs...)
+	}
+}
+
+func run(g *workgroup.Group, lw cache.ListerWatcher, log logrus.FieldLogger, scope *Scope, resource string, objType runtime.Object, rs ...cache.ResourceEventHandler) {
 	sw := cache.NewSharedInformer(lw, objType, 30*time.Minute)
 	for _, r := range rs {
-		sw.AddEventHandler(r)
+		sw.AddEventHandler(scope.filter(r))
 	}
 	g.Add(func(stop <-chan struct{}) {
 		log := log.WithField("resource", resource)
+		if scope.synced != nil && !cache.WaitForCacheSync(stop, scope.synced) {
+			return
+		}
 		log.Println("started")
 		defer log.Println("stopped")
 		sw.Run(stop)
@@ -0,0 +1,140 @@
+// Package leader elects the keel replica that applies updates, using a
+// Kubernetes Lease. Only one replica runs triggers, providers and bots, the
+// others serve the read-only API and forward webhooks to the leader.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kube "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// default timings of the election, same as Kubernetes controllers use
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewDeadline = 10 * time.Second
+	DefaultRetryPeriod   = 2 * time.Second
+)
+
+// Config - Lease and identity of the replica
+type Config struct {
+	Namespace string
+	Name      string // Lease name, default keel
+	// Identity of the replica in the Lease, it's the URL other replicas
+	// forward webhooks to while this one leads, ie: http://10.0.0.12:9300
+	Identity string
+
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// Elector - leader election of keel replicas
+type Elector struct {
+	identity string
+	elector  *leaderelection.LeaderElector
+	lead     func(ctx context.Context)
+}
+
+// New - new elector, lead is called once this replica becomes the leader
+func New(client kube.Interface, cfg Config, lead func(ctx context.Context)) (*Elector, error) {
+	if cfg.Namespace == "" {
+		return nil, fmt.Errorf("leader election namespace is not set")
+	}
+	if cfg.Identity == "" {
+		return nil, fmt.Errorf("leader election identity is not set")
+	}
+	if cfg.Name == "" {
+		cfg.Name = "keel"
+	}
+	if cfg.LeaseDuration == 0 {
+		cfg.LeaseDuration = DefaultLeaseDuration
+	}
+	if cfg.RenewDeadline == 0 {
+		cfg.RenewDeadline = DefaultRenewDeadline
+	}
+	if cfg.RetryPeriod == 0 {
+		cfg.RetryPeriod = DefaultRetryPeriod
+	}
+
+	e := &Elector{
+		identity: cfg.Identity,
+		lead:     lead,
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Namespace: cfg.Namespace,
+				Name:      cfg.Name,
+			},
+			Client:     client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: cfg.Identity},
+		},
+		LeaseDuration:   cfg.LeaseDuration,
+		RenewDeadline:   cfg.RenewDeadline,
+		RetryPeriod:     cfg.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            cfg.Name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: e.startedLeading,
+			OnStoppedLeading: e.stoppedLeading,
+			OnNewLeader:      e.newLeader,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.elector = elector
+	return e, nil
+}
+
+// Run - campaigns for the Lease, it returns when the context is cancelled or
+// this replica loses the lead. Components started by lead can't be stopped
+// safely while another replica takes over, replicas losing the lead exit.
+func (e *Elector) Run(ctx context.Context) {
+	log.WithFields(log.Fields{
+		"identity": e.identity,
+	}).Info("leader: waiting for leadership")
+	e.elector.Run(ctx)
+}
+
+// IsLeader - whether this replica leads
+func (e *Elector) IsLeader() bool {
+	return e.elector.IsLeader()
+}
+
+// Leader - identity of the current leader, empty when unknown
+func (e *Elector) Leader() string {
+	return e.elector.GetLeader()
+}
+
+func (e *Elector) startedLeading(ctx context.Context) {
+	log.WithFields(log.Fields{
+		"identity": e.identity,
+	}).Info("leader: started leading, starting triggers and providers")
+	e.lead(ctx)
+}
+
+func (e *Elector) stoppedLeading() {
+	log.WithFields(log.Fields{
+		"identity": e.identity,
+	}).Warn("leader: stopped leading")
+}
+
+func (e *Elector) newLeader(identity string) {
+	if identity == e.identity {
+		return
+	}
+	log.WithFields(log.Fields{
+		"leader": identity,
+	}).Info("leader: following")
+}
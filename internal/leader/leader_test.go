@@ -0,0 +1,90 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testConfig(identity string) Config {
+	return Config{
+		Namespace:     "keel",
+		Identity:      identity,
+		LeaseDuration: time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   50 * time.Millisecond,
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestElection(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	led := make(chan string, 2)
+	first, err := New(client, testConfig("http://10.0.0.1:9300"), func(ctx context.Context) { led <- "first" })
+	if err != nil {
+		t.Fatalf("failed to create elector: %s", err)
+	}
+	firstCtx, stopFirst := context.WithCancel(ctx)
+	firstDone := make(chan struct{})
+	go func() {
+		first.Run(firstCtx)
+		close(firstDone)
+	}()
+	waitFor(t, first.IsLeader)
+	if who := <-led; who != "first" {
+		t.Fatalf("unexpected leader: %s", who)
+	}
+
+	second, err := New(client, testConfig("http://10.0.0.2:9300"), func(ctx context.Context) { led <- "second" })
+	if err != nil {
+		t.Fatalf("failed to create elector: %s", err)
+	}
+	go second.Run(ctx)
+	waitFor(t, func() bool { return second.Leader() == "http://10.0.0.1:9300" })
+	if second.IsLeader() {
+		t.Fatal("second replica must follow")
+	}
+
+	lease, err := client.CoordinationV1().Leases("keel").Get(ctx, "keel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get lease: %s", err)
+	}
+	if *lease.Spec.HolderIdentity != "http://10.0.0.1:9300" {
+		t.Errorf("unexpected holder: %s", *lease.Spec.HolderIdentity)
+	}
+
+	// the leader shuts down and releases the lease
+	stopFirst()
+	<-firstDone
+	waitFor(t, second.IsLeader)
+	if who := <-led; who != "second" {
+		t.Fatalf("unexpected leader: %s", who)
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	lead := func(ctx context.Context) {}
+	if _, err := New(client, Config{Identity: "keel-0"}, lead); err == nil {
+		t.Error("expected error without namespace")
+	}
+	if _, err := New(client, Config{Namespace: "keel"}, lead); err == nil {
+		t.Error("expected error without identity")
+	}
+}
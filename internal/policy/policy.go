@@ -43,6 +43,50 @@ func GetPolicyFromLabelsOrAnnotations(labels map[string]string, annotations map[
 	return GetPolicy(policyNameL, &Options{MatchTag: getMatchTag(labels), MatchPreRelease: getMatchPreRelease(labels)})
 }
 
+// GetContainerPolicy - gets policy for a single container, container scoped annotations
+// (keel.sh/<container>/policy, keel.sh/<container>/matchTag, keel.sh/<container>/matchPreRelease)
+// take precedence over the resource policy
+func GetContainerPolicy(container string, labels map[string]string, annotations map[string]string) Policy {
+	return GetPolicyFromLabelsOrAnnotations(labels, ContainerAnnotations(container, annotations))
+}
+
+// HasContainerPolicy - checks whether container has its own policy configuration
+func HasContainerPolicy(container string, annotations map[string]string) bool {
+	for _, key := range []string{types.KeelPolicyLabel, types.KeelForceTagMatchLabel, types.KeelMatchPreReleaseAnnotation} {
+		if _, ok := annotations[types.ContainerAnnotation(container, key)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// HasContainerPolicies - checks whether any container of the resource has its own
+// policy, such resources are tracked even without a resource wide policy
+func HasContainerPolicies(annotations map[string]string) bool {
+	for key := range annotations {
+		if strings.HasPrefix(key, "keel.sh/") && strings.HasSuffix(key, "/policy") && strings.Count(key, "/") == 2 {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainerAnnotations - returns annotations as seen by a single container: container scoped
+// keel.sh/<container>/<name> annotations replace keel.sh/<name>
+func ContainerAnnotations(container string, annotations map[string]string) map[string]string {
+	prefix := "keel.sh/" + container + "/"
+	scoped := make(map[string]string, len(annotations))
+	for key, value := range annotations {
+		scoped[key] = value
+	}
+	for key, value := range annotations {
+		if strings.HasPrefix(key, prefix) {
+			scoped["keel.sh/"+strings.TrimPrefix(key, prefix)] = value
+		}
+	}
+	return scoped
+}
+
 // Options - additional options when parsing policy
 type Options struct {
 	MatchTag        bool
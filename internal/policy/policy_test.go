@@ -146,3 +146,31 @@ func TestGetPolicyFromLabelsOrAnnotations(t *testing.T) {
 		})
 	}
 }
+
+func TestGetContainerPolicy(t *testing.T) {
+	labels := map[string]string{types.KeelPolicyLabel: "minor"}
+	annotations := map[string]string{
+		"keel.sh/sidecar/policy":          "patch",
+		"keel.sh/sidecar/matchPreRelease": "false",
+	}
+
+	if got := GetContainerPolicy("app", labels, annotations); got.Name() != "minor" {
+		t.Errorf("expected resource policy for app container, got: %s", got.Name())
+	}
+	sidecar := GetContainerPolicy("sidecar", labels, annotations)
+	if sidecar.Name() != "patch" {
+		t.Errorf("expected patch policy for sidecar container, got: %s", sidecar.Name())
+	}
+	if !reflect.DeepEqual(sidecar, NewSemverPolicy(SemverPolicyTypePatch, false)) {
+		t.Errorf("expected container scoped matchPreRelease, got: %+v", sidecar)
+	}
+	if !HasContainerPolicy("sidecar", annotations) || HasContainerPolicy("app", annotations) {
+		t.Errorf("unexpected container policy detection")
+	}
+	if !HasContainerPolicies(annotations) {
+		t.Errorf("expected container policies to be found")
+	}
+	if HasContainerPolicies(map[string]string{types.KeelPolicyLabel: "all", "keel.sh/a/b/policy": "all"}) {
+		t.Errorf("did not expect container policies")
+	}
+}
@@ -0,0 +1,280 @@
+// Package window evaluates update windows and freeze periods, the times
+// when keel is allowed to apply updates.
+package window
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// time zone database, keel images don't ship one
+	_ "time/tzdata"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window - weekly recurring time range, ie: Mon-Fri 09:00-17:00 Europe/London.
+// Ranges ending before they start cross midnight and belong to the day they
+// start on.
+type Window struct {
+	days     [7]bool
+	start    int // minutes after midnight
+	end      int
+	location *time.Location
+}
+
+// Windows - updates are allowed while any of the windows is open
+type Windows []Window
+
+// Parse parses ';' separated windows. Each window is a time range with
+// optional days (every day by default) and time zone (UTC by default):
+//
+//	Mon-Fri 09:00-17:00 Europe/London; Sat 10:00-12:00
+func Parse(spec string) (Windows, error) {
+	var windows Windows
+	for _, part := range strings.Split(spec, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		w, err := parseWindow(part)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("update window '%s' is empty", spec)
+	}
+	return windows, nil
+}
+
+func parseWindow(spec string) (Window, error) {
+	w := Window{start: -1, location: time.UTC}
+	hasDays := false
+	for _, field := range strings.Fields(spec) {
+		switch {
+		case strings.Contains(field, ":"):
+			start, end, err := parseTimeRange(field)
+			if err != nil {
+				return w, err
+			}
+			w.start, w.end = start, end
+		case !hasDays && isDays(field):
+			days, err := parseDays(field)
+			if err != nil {
+				return w, err
+			}
+			w.days = days
+			hasDays = true
+		default:
+			location, err := time.LoadLocation(field)
+			if err != nil {
+				return w, fmt.Errorf("unknown time zone '%s' in update window '%s'", field, strings.TrimSpace(spec))
+			}
+			w.location = location
+		}
+	}
+	if w.start < 0 {
+		return w, fmt.Errorf("update window '%s' has no time range", strings.TrimSpace(spec))
+	}
+	if !hasDays {
+		for d := range w.days {
+			w.days[d] = true
+		}
+	}
+	return w, nil
+}
+
+func isDays(field string) bool {
+	name := strings.ToLower(field)
+	if len(name) < 3 {
+		return false
+	}
+	_, ok := weekdays[name[:3]]
+	return ok
+}
+
+// parseDays parses day lists and ranges such as Mon-Fri or Sat,Sun
+func parseDays(field string) (days [7]bool, err error) {
+	for _, item := range strings.Split(strings.ToLower(field), ",") {
+		bounds := strings.SplitN(item, "-", 2)
+		first, ok := weekdays[bounds[0]]
+		if !ok {
+			return days, fmt.Errorf("unknown day '%s'", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, ok = weekdays[bounds[1]]
+			if !ok {
+				return days, fmt.Errorf("unknown day '%s'", bounds[1])
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseTimeRange(field string) (start, end int, err error) {
+	bounds := strings.SplitN(field, "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("invalid time range '%s', expected HH:MM-HH:MM", field)
+	}
+	if start, err = parseClock(bounds[0]); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseClock(bounds[1]); err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("empty time range '%s'", field)
+	}
+	return start, end, nil
+}
+
+func parseClock(value string) (int, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time '%s', expected HH:MM", value)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s', expected HH:MM", value)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s', expected HH:MM", value)
+	}
+	if hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time '%s'", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// Open - whether the window is open at t
+func (w Window) Open(t time.Time) bool {
+	local := t.In(w.location)
+	minute := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+	if w.start < w.end {
+		return w.days[day] && minute >= w.start && minute < w.end
+	}
+	if minute >= w.start {
+		return w.days[day]
+	}
+	return minute < w.end && w.days[(day+6)%7]
+}
+
+// Open - whether any of the windows is open at t, no windows means
+// updates are always allowed
+func (ws Windows) Open(t time.Time) bool {
+	if len(ws) == 0 {
+		return true
+	}
+	for _, w := range ws {
+		if w.Open(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Freeze - period when no updates are applied, End is exclusive
+type Freeze struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Active - whether the freeze is in effect at t
+func (f Freeze) Active(t time.Time) bool {
+	return !t.Before(f.Start) && t.Before(f.End)
+}
+
+// ParseFreezes parses ',' separated start/end periods. Bounds are RFC3339
+// timestamps or dates (midnight UTC):
+//
+//	2026-12-20/2027-01-04,2027-03-01T18:00:00Z/2027-03-02T06:00:00Z
+func ParseFreezes(spec string) ([]Freeze, error) {
+	var freezes []Freeze
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "/", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid freeze period '%s', expected start/end", part)
+		}
+		start, err := parseTimestamp(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimestamp(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("freeze period '%s' ends before it starts", part)
+		}
+		freezes = append(freezes, Freeze{Start: start, End: end})
+	}
+	return freezes, nil
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, fmt.Errorf("invalid freeze bound '%s', expected RFC3339 timestamp or date", value)
+	}
+	return t, nil
+}
+
+// searchHorizon - how far ahead Next looks for an open window, a week of
+// windows plus a day for the time zone differences
+const searchHorizon = 8 * 24 * time.Hour
+
+// Next returns the first time, starting from now, when updates are allowed:
+// one of the windows is open and no freeze is active.
+func Next(windows Windows, freezes []Freeze, now time.Time) (time.Time, error) {
+	t := now
+	deadline := now.Add(searchHorizon)
+	for !t.After(deadline) {
+		if frozen, ok := activeFreeze(freezes, t); ok {
+			// freezes don't count towards the horizon
+			deadline = deadline.Add(frozen.End.Sub(t))
+			t = frozen.End
+			continue
+		}
+		if windows.Open(t) {
+			return t, nil
+		}
+		t = t.Truncate(time.Minute).Add(time.Minute)
+	}
+	return time.Time{}, fmt.Errorf("update window never opens")
+}
+
+func activeFreeze(freezes []Freeze, t time.Time) (Freeze, bool) {
+	for _, f := range freezes {
+		if f.Active(t) {
+			return f, true
+		}
+	}
+	return Freeze{}, false
+}
@@ -0,0 +1,108 @@
+package window
+
+import (
+	"testing"
+	"time"
+)
+
+func mustTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestWindowsOpen(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		at   string
+		want bool
+	}{
+		{"business hours", "Mon-Fri 09:00-17:00", "2026-10-14T10:30:00Z", true},
+		{"after hours", "Mon-Fri 09:00-17:00", "2026-10-14T17:00:00Z", false},
+		{"weekend", "Mon-Fri 09:00-17:00", "2026-10-17T10:30:00Z", false},
+		{"time zone", "Mon-Fri 09:00-17:00 America/New_York", "2026-10-14T14:00:00Z", true},
+		{"time zone before opening", "Mon-Fri 09:00-17:00 America/New_York", "2026-10-14T12:00:00Z", false},
+		{"every day", "02:00-04:00", "2026-10-18T03:00:00Z", true},
+		{"day list", "Sat,Sun 10:00-12:00", "2026-10-18T11:00:00Z", true},
+		{"crossing midnight after start", "Fri 22:00-02:00", "2026-10-16T23:00:00Z", true},
+		{"crossing midnight next day", "Fri 22:00-02:00", "2026-10-17T01:00:00Z", true},
+		{"crossing midnight other day", "Fri 22:00-02:00", "2026-10-18T01:00:00Z", false},
+		{"multiple windows", "Mon-Fri 09:00-17:00; Sat 10:00-12:00", "2026-10-17T11:00:00Z", true},
+		{"whole day", "Sun 00:00-24:00", "2026-10-18T23:59:00Z", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("failed to parse window: %s", err)
+			}
+			if got := windows.Open(mustTime(tt.at)); got != tt.want {
+				t.Errorf("Open() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{"", "Mon-Fri", "Mon-Fri 09:00", "Mon-Fri 09:00-09:00", "Mon-Fri 25:00-26:00", "Mon-Fri 09:00-17:00 Mars/Base"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected error for '%s'", spec)
+		}
+	}
+}
+
+func TestParseFreezes(t *testing.T) {
+	freezes, err := ParseFreezes("2026-12-20/2027-01-04, 2027-03-01T18:00:00Z/2027-03-02T06:00:00Z")
+	if err != nil {
+		t.Fatalf("failed to parse freezes: %s", err)
+	}
+	if len(freezes) != 2 {
+		t.Fatalf("expected 2 freezes, got: %d", len(freezes))
+	}
+	if !freezes[0].Active(mustTime("2027-01-03T23:59:00Z")) || freezes[0].Active(mustTime("2027-01-04T00:00:00Z")) {
+		t.Errorf("unexpected freeze bounds: %+v", freezes[0])
+	}
+
+	for _, spec := range []string{"2026-12-20", "2026-12-20/2026-12-19", "tomorrow/2026-12-19"} {
+		if _, err := ParseFreezes(spec); err == nil {
+			t.Errorf("expected error for '%s'", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	windows, err := Parse("Mon-Fri 09:00-17:00")
+	if err != nil {
+		t.Fatalf("failed to parse window: %s", err)
+	}
+	freezes, err := ParseFreezes("2026-10-19/2026-10-21")
+	if err != nil {
+		t.Fatalf("failed to parse freezes: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		windows Windows
+		at      string
+		want    string
+	}{
+		{"open now", windows, "2026-10-16T10:00:30Z", "2026-10-16T10:00:30Z"},
+		{"next morning", windows, "2026-10-15T18:00:00Z", "2026-10-16T09:00:00Z"},
+		{"after the freeze", windows, "2026-10-16T18:00:00Z", "2026-10-21T09:00:00Z"},
+		{"freeze without windows", nil, "2026-10-20T12:00:00Z", "2026-10-21T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := Next(tt.windows, freezes, mustTime(tt.at))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !next.Equal(mustTime(tt.want)) {
+				t.Errorf("Next() = %s, want %s", next, tt.want)
+			}
+		})
+	}
+}
@@ -120,6 +120,7 @@ func (a *DefaultAuthenticator) GenerateToken(u User) (*AuthResponse, error) {
 
 	return &AuthResponse{
 		Token: tokenString,
+		User:  u,
 	}, nil
 }
 
@@ -19,6 +19,11 @@ var environmentVariables = []string{
 	"TEAMS_WEBHOOK_URL", "DISCORD_WEBHOOK_URL", "SHOUTRRR_URLS", "SHOUTRRR_TIMEOUT", "MAIL_TO", "MAIL_FROM", "MAIL_SMTP_SERVER",
 	"MAIL_SMTP_PORT", "MAIL_SMTP_USER", "MAIL_SMTP_PASS", "BASIC_AUTH_USER", "BASIC_AUTH_PASSWORD", "AUTHENTICATED_WEBHOOKS",
 	"TOKEN_SECRET", "AUTH_MODE", "AUTH_PROXY_USER_HEADER", "AUTH_PROXY_LOGOUT_URL", "RESTRICTED_NAMESPACE",
+	"CUSTOM_RESOURCES_CONFIG", "DRY_RUN", "UPDATE_FREEZES", "MAX_ROLLOUTS", "MAX_NAMESPACE_ROLLOUTS", "HELM_RELEASE_CONFIG",
+	"GITOPS_REPOSITORY", "GITOPS_BRANCH", "GITOPS_DIR", "GITOPS_AUTHOR_NAME", "GITOPS_AUTHOR_EMAIL", "GITOPS_COMMIT_MESSAGE",
+	"LEADER_ELECTION", "LEADER_ELECTION_NAMESPACE", "LEADER_ELECTION_LEASE", "LEADER_ELECTION_ADDRESS",
+	"NAMESPACES", "EXCLUDED_NAMESPACES", "NAMESPACE_SELECTOR", "OBJECT_SELECTOR",
+	"LOCAL_CLUSTER_NAME", "CLUSTERS", "CLUSTERS_DIR",
 }
 
 // Config contains Keel's application configuration loaded from environment variables.
@@ -27,6 +32,8 @@ type Config struct {
 	Trigger       TriggerConfig
 	Storage       StorageConfig
 	Providers     ProviderConfig
+	GitOps        GitOpsConfig
+	Leader        LeaderElectionConfig
 	UI            UIConfig
 	Notifications NotificationConfig
 	Bots          BotConfig
@@ -55,6 +62,44 @@ const DefaultEventBufferSize = 512
 // ProviderConfig controls which workload update providers Keel enables.
 type ProviderConfig struct {
 	Helm3 bool `envconfig:"HELM3_PROVIDER" default:"false"`
+	// DryRun makes providers plan and report updates without applying them.
+	DryRun bool `envconfig:"DRY_RUN" default:"false"`
+	// UpdateFreezes lists periods (start/end, comma separated) when no updates are applied.
+	UpdateFreezes string `envconfig:"UPDATE_FREEZES"`
+	// MaxRollouts limits rollouts in flight, further updates are queued. Zero means unlimited.
+	MaxRollouts int `envconfig:"MAX_ROLLOUTS" default:"0"`
+	// MaxNamespaceRollouts limits rollouts in flight per namespace. Zero means unlimited.
+	MaxNamespaceRollouts int `envconfig:"MAX_NAMESPACE_ROLLOUTS" default:"0"`
+	// HelmReleaseConfig is the <namespace>/<name> ConfigMap configuring Helm releases outside of their values.
+	HelmReleaseConfig string `envconfig:"HELM_RELEASE_CONFIG"`
+}
+
+// GitOpsConfig controls writing updates of resources synced from Git back to
+// their repository instead of patching them in the cluster.
+type GitOpsConfig struct {
+	// Repository is the URL Keel clones and pushes to, credentials can be part of it.
+	Repository string `envconfig:"GITOPS_REPOSITORY"`
+	// Branch defaults to main.
+	Branch string `envconfig:"GITOPS_BRANCH"`
+	// Dir is the working tree, defaults to gitops in the data directory.
+	Dir         string `envconfig:"GITOPS_DIR"`
+	AuthorName  string `envconfig:"GITOPS_AUTHOR_NAME"`
+	AuthorEmail string `envconfig:"GITOPS_AUTHOR_EMAIL"`
+	// CommitMessage is a Go template of commit messages.
+	CommitMessage string `envconfig:"GITOPS_COMMIT_MESSAGE"`
+}
+
+// LeaderElectionConfig controls running several replicas, only the elected
+// leader applies updates.
+type LeaderElectionConfig struct {
+	Enabled bool `envconfig:"LEADER_ELECTION" default:"false"`
+	// Namespace of the Lease, defaults to the namespace keel runs in.
+	Namespace string `envconfig:"LEADER_ELECTION_NAMESPACE"`
+	// Lease name, defaults to keel.
+	Lease string `envconfig:"LEADER_ELECTION_LEASE"`
+	// Address other replicas forward webhooks to while this one leads,
+	// defaults to http://<pod IP>:9300.
+	Address string `envconfig:"LEADER_ELECTION_ADDRESS"`
 }
 
 // UIConfig controls where the HTTP server finds the web UI static files.
@@ -168,6 +213,26 @@ type AuthConfig struct {
 // KubernetesConfig controls the scope of Kubernetes resources watched by Keel.
 type KubernetesConfig struct {
 	RestrictedNamespace string `envconfig:"RESTRICTED_NAMESPACE"`
+	// Namespaces lists the watched namespaces (comma separated), empty watches all.
+	Namespaces string `envconfig:"NAMESPACES"`
+	// ExcludedNamespaces lists namespaces that are never watched (comma separated).
+	ExcludedNamespaces string `envconfig:"EXCLUDED_NAMESPACES"`
+	// NamespaceSelector is a label selector of the watched namespaces.
+	NamespaceSelector string `envconfig:"NAMESPACE_SELECTOR"`
+	// ObjectSelector is a label selector of the watched workloads.
+	ObjectSelector string `envconfig:"OBJECT_SELECTOR"`
+	// CustomResourcesConfig is an optional path to a file (usually a mounted
+	// ConfigMap) declaring extra custom resource kinds and their image paths.
+	CustomResourcesConfig string `envconfig:"CUSTOM_RESOURCES_CONFIG"`
+	// LocalClusterName names the cluster Keel connects to first, empty keeps
+	// its identifiers unprefixed.
+	LocalClusterName string `envconfig:"LOCAL_CLUSTER_NAME"`
+	// Clusters lists further kubeconfig contexts to manage (comma separated,
+	// name=context or context).
+	Clusters string `envconfig:"CLUSTERS"`
+	// ClustersDir is a directory of kubeconfig files, one per managed cluster
+	// named after the file, usually mounted secrets.
+	ClustersDir string `envconfig:"CLUSTERS_DIR"`
 }
 
 // Load reads configuration from environment variables.
@@ -194,6 +259,8 @@ func Load() (Config, error) {
 		&cfg.Trigger,
 		&cfg.Storage,
 		&cfg.Providers,
+		&cfg.GitOps,
+		&cfg.Leader,
 		&cfg.UI,
 		&notifications,
 		&cfg.Notifications.Webhook,
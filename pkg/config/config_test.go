@@ -100,7 +100,12 @@ func TestLoadMapsEveryTypedPath(t *testing.T) {
 		"HIPCHAT_SERVER": "https://hipchat", "HIPCHAT_TOKEN": "hip-token", "HIPCHAT_BOT_NAME": "hip-notifier", "HIPCHAT_CHANNELS": "ops,dev", "HIPCHAT_APPROVALS_CHANNEL": "hip-approvals", "HIPCHAT_APPROVALS_USER_NAME": "hip-user", "HIPCHAT_APPROVALS_BOT_NAME": "hip-bot", "HIPCHAT_APPROVALS_PASSWORT": "hip-pass", "HIPCHAT_CONNECTION_ATTEMPTS": "4",
 		"MATTERMOST_ENDPOINT": "https://mattermost", "MATTERMOST_USERNAME": "matter-bot", "TEAMS_WEBHOOK_URL": "https://teams", "DISCORD_WEBHOOK_URL": "https://discord", "SHOUTRRR_URLS": "discord://token@id", "SHOUTRRR_TIMEOUT": "3s",
 		"MAIL_TO": "to@example.com", "MAIL_FROM": "from@example.com", "MAIL_SMTP_SERVER": "smtp.example.com", "MAIL_SMTP_PORT": "2525", "MAIL_SMTP_USER": "smtp-user", "MAIL_SMTP_PASS": "smtp-pass",
-		"BASIC_AUTH_USER": "admin", "BASIC_AUTH_PASSWORD": "secret", "AUTHENTICATED_WEBHOOKS": "true", "TOKEN_SECRET": "token-secret", "AUTH_MODE": "proxy", "AUTH_PROXY_USER_HEADER": "X-User", "AUTH_PROXY_LOGOUT_URL": "https://logout", "RESTRICTED_NAMESPACE": "production",
+		"BASIC_AUTH_USER": "admin", "BASIC_AUTH_PASSWORD": "secret", "AUTHENTICATED_WEBHOOKS": "true", "TOKEN_SECRET": "token-secret", "AUTH_MODE": "proxy", "AUTH_PROXY_USER_HEADER": "X-User", "AUTH_PROXY_LOGOUT_URL": "https://logout", "RESTRICTED_NAMESPACE": "production", "CUSTOM_RESOURCES_CONFIG": "/etc/keel/custom-resources.yaml", "DRY_RUN": "true", "UPDATE_FREEZES": "2026-12-20/2027-01-04",
+		"MAX_ROLLOUTS": "20", "MAX_NAMESPACE_ROLLOUTS": "5", "HELM_RELEASE_CONFIG": "keel/helm-releases",
+		"GITOPS_REPOSITORY": "https://git.example.com/apps.git", "GITOPS_BRANCH": "production", "GITOPS_DIR": "/var/lib/keel/apps", "GITOPS_AUTHOR_NAME": "keel-bot", "GITOPS_AUTHOR_EMAIL": "keel@example.com", "GITOPS_COMMIT_MESSAGE": "update {{ .Identifier }}",
+		"LEADER_ELECTION": "true", "LEADER_ELECTION_NAMESPACE": "keel-system", "LEADER_ELECTION_LEASE": "keel-leader", "LEADER_ELECTION_ADDRESS": "http://keel-0.keel:9300",
+		"NAMESPACES": "team-a,team-b", "EXCLUDED_NAMESPACES": "kube-system", "NAMESPACE_SELECTOR": "keel=enabled", "OBJECT_SELECTOR": "tier!=db",
+		"LOCAL_CLUSTER_NAME": "local", "CLUSTERS": "production=prod-context", "CLUSTERS_DIR": "/etc/keel/clusters",
 	}
 	for key, value := range values {
 		t.Setenv(key, value)
@@ -108,10 +113,12 @@ func TestLoadMapsEveryTypedPath(t *testing.T) {
 	cfg, err := Load()
 	require.NoError(t, err)
 	require.Equal(t, Config{
-		Debug: true, Trigger: TriggerConfig{PubSub: true, ProjectID: "project", ClusterName: "cluster"}, Storage: StorageConfig{DataDir: "/var/lib/keel"}, Providers: ProviderConfig{Helm3: true}, UI: UIConfig{Dir: "/ui"},
+		Debug: true, Trigger: TriggerConfig{PubSub: true, ProjectID: "project", ClusterName: "cluster"}, Storage: StorageConfig{DataDir: "/var/lib/keel"}, Providers: ProviderConfig{Helm3: true, DryRun: true, UpdateFreezes: "2026-12-20/2027-01-04", MaxRollouts: 20, MaxNamespaceRollouts: 5, HelmReleaseConfig: "keel/helm-releases"}, UI: UIConfig{Dir: "/ui"},
+		GitOps:        GitOpsConfig{Repository: "https://git.example.com/apps.git", Branch: "production", Dir: "/var/lib/keel/apps", AuthorName: "keel-bot", AuthorEmail: "keel@example.com", CommitMessage: "update {{ .Identifier }}"},
+		Leader:        LeaderElectionConfig{Enabled: true, Namespace: "keel-system", Lease: "keel-leader", Address: "http://keel-0.keel:9300"},
 		Notifications: NotificationConfig{Level: "warn", Webhook: WebhookConfig{Endpoint: "https://webhook"}, Slack: SlackNotificationConfig{BotToken: "xoxb-typed", BotName: "typed-bot", Channels: "one,two"}, Hipchat: HipchatNotificationConfig{Server: "https://hipchat", Token: "hip-token", BotName: "hip-notifier", Channels: "ops,dev"}, Mattermost: MattermostConfig{Endpoint: "https://mattermost", Username: "matter-bot"}, Teams: TeamsConfig{WebhookURL: "https://teams"}, Discord: DiscordConfig{WebhookURL: "https://discord"}, Shoutrrr: ShoutrrrConfig{URLs: "discord://token@id", Timeout: "3s"}, Mail: MailConfig{To: "to@example.com", From: "from@example.com", SMTPServer: "smtp.example.com", SMTPPort: 2525, SMTPUser: "smtp-user", SMTPPass: "smtp-pass"}},
 		Bots:          BotConfig{Slack: SlackBotConfig{BotToken: "xoxb-typed", AppToken: "xapp-typed", BotName: "typed-bot", ApprovalsChannel: "approvals"}, Hipchat: HipchatBotConfig{ApprovalsChannel: "hip-approvals", ApprovalsUserName: "hip-user", ApprovalsBotName: "hip-bot", ApprovalsPassword: "hip-pass", ConnectionAttempts: 4}},
-		Auth:          AuthConfig{BasicUser: "admin", BasicPassword: "secret", AuthenticatedWebhooks: true, TokenSecret: "token-secret", Mode: "proxy", ProxyUserHeader: "X-User", ProxyLogoutURL: "https://logout"}, Kubernetes: KubernetesConfig{RestrictedNamespace: "production"},
+		Auth:          AuthConfig{BasicUser: "admin", BasicPassword: "secret", AuthenticatedWebhooks: true, TokenSecret: "token-secret", Mode: "proxy", ProxyUserHeader: "X-User", ProxyLogoutURL: "https://logout"}, Kubernetes: KubernetesConfig{RestrictedNamespace: "production", CustomResourcesConfig: "/etc/keel/custom-resources.yaml", Namespaces: "team-a,team-b", ExcludedNamespaces: "kube-system", NamespaceSelector: "keel=enabled", ObjectSelector: "tier!=db", LocalClusterName: "local", Clusters: "production=prod-context", ClustersDir: "/etc/keel/clusters"},
 	}, cfg)
 }
 
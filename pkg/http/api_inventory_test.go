@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
 	"testing"
@@ -32,7 +33,16 @@ var documentedAPIOperations = []apiOperation{
 	{http.MethodPost, "/v1/approvals", "updateApproval"},
 	{http.MethodPut, "/v1/approvals", "setResourceApprovals"},
 	{http.MethodGet, "/v1/resources", "listResources"},
+	{http.MethodGet, "/v1/resources/{identifier}/history", "listResourceHistory"},
+	{http.MethodPost, "/v1/resources/{identifier}/rollback", "rollbackResource"},
+	{http.MethodPost, "/v1/resources/{identifier}/pause", "pauseResource"},
+	{http.MethodPost, "/v1/resources/{identifier}/resume", "resumeResource"},
+	{http.MethodGet, "/v1/namespaces/paused", "listPausedNamespaces"},
+	{http.MethodPost, "/v1/namespaces/{namespace}/pause", "pauseNamespace"},
+	{http.MethodPost, "/v1/namespaces/{namespace}/resume", "resumeNamespace"},
 	{http.MethodPut, "/v1/policies", "updateResourcePolicy"},
+	{http.MethodGet, "/v1/plans", "listPlans"},
+	{http.MethodGet, "/v1/stages", "listStages"},
 	{http.MethodGet, "/v1/tracked", "listTrackedImages"},
 	{http.MethodPut, "/v1/tracked", "updateTrackedImage"},
 	{http.MethodGet, "/v1/audit", "listAuditLogs"},
@@ -47,6 +57,8 @@ var documentedAPIOperations = []apiOperation{
 	{http.MethodPost, "/v1/webhooks/registry", "receiveRegistryWebhook"},
 }
 
+var pathVariablePattern = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
 var documentedAPIExclusions = []string{
 	"OPTIONS and CORS preflight",
 	"/metrics",
@@ -70,6 +82,9 @@ func TestAPIRouteInventory(t *testing.T) {
 			return nil
 		}
 
+		// path variable patterns are not part of the documented path
+		path = pathVariablePattern.ReplaceAllString(path, "{$1}")
+
 		methods, err := route.GetMethods()
 		if err != nil {
 			return nil
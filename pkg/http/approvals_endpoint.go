@@ -29,19 +29,22 @@ const (
 
 // approvalsHandler lists approval records.
 // @Summary List approvals
-// @Description Lists active and archived approvals. This route exists only when the authenticator is enabled. Legacy store and serialization error paths write text with status 200.
+// @Description Lists active and archived approvals, of the cluster given in the cluster parameter only when set. Helm release approvals include the rendered manifest diff. This route exists only when the authenticator is enabled. Legacy store and serialization error paths write text with status 200.
 // @Tags Admin
 // @ID listApprovals
 // @Produce json
 // @Security BasicAuth
 // @Security BearerAuth
+// @Param cluster query string false "Approvals of the cluster only"
 // @Success 200 {array} types.Approval
 // @Failure 401 {string} string "Unauthorized"
 // @Router /v1/approvals [get]
 func (s *TriggerServer) approvalsHandler(resp http.ResponseWriter, req *http.Request) {
 
 	// lists all (both archived)
-	approvals, err := s.store.ListApprovals(&types.GetApprovalQuery{})
+	approvals, err := s.store.ListApprovals(&types.GetApprovalQuery{
+		Cluster: req.URL.Query().Get("cluster"),
+	})
 	if err != nil {
 		fmt.Fprintf(resp, "%s", err)
 		resp.WriteHeader(http.StatusInternalServerError)
@@ -119,8 +122,9 @@ func (s *TriggerServer) approvalSetHandler(resp http.ResponseWriter, req *http.R
 		return
 	}
 
-	for _, v := range s.grc.Values() {
+	for _, v := range s.resources("") {
 		if v.Identifier == approvalUpdateRequest.Identifier {
+			previous := v.DeepCopy()
 
 			labels := v.GetLabels()
 			delete(labels, types.KeelMinimumApprovalsLabel)
@@ -131,7 +135,7 @@ func (s *TriggerServer) approvalSetHandler(resp http.ResponseWriter, req *http.R
 
 			v.SetAnnotations(ann)
 
-			err := s.kubernetesClient.Update(v)
+			err := s.clientFor(v).Update(v, previous)
 			if err == nil {
 				err = s.approvalsManager.SetRequiredVotes(
 					approvalUpdateRequest.Identifier,
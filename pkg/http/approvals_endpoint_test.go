@@ -43,6 +43,7 @@ func TestListApprovals(t *testing.T) {
 		VotesRequired:  5,
 		NewVersion:     "2.0.0",
 		CurrentVersion: "1.0.0",
+		Diff:           "-image: app:1.0.0\n+image: app:2.0.0\n",
 	})
 
 	if err != nil {
@@ -86,6 +87,9 @@ func TestListApprovals(t *testing.T) {
 	if approvals[0].CurrentVersion != "1.0.0" {
 		t.Errorf("unexpected current version: %s", approvals[0].CurrentVersion)
 	}
+	if approvals[0].Diff != "-image: app:1.0.0\n+image: app:2.0.0\n" {
+		t.Errorf("unexpected diff: %s", approvals[0].Diff)
+	}
 }
 
 func TestDeleteApproval(t *testing.T) {
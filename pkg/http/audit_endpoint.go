@@ -20,6 +20,7 @@ import (
 // @Param offset query int false "Entry offset"
 // @Param filter query string false "Comma-separated resource kinds"
 // @Param email query string false "Account email"
+// @Param cluster query string false "Entries of resources in the cluster only"
 // @Success 200 {object} AuditLogsResponse
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 403 {string} string "Permission denied"
@@ -55,6 +56,8 @@ func (s *TriggerServer) adminAuditLogHandler(resp http.ResponseWriter, req *http
 		query.Email = strings.TrimSpace(emailFilter)
 	}
 
+	query.Cluster = req.URL.Query().Get("cluster")
+
 	entries, err := s.store.GetAuditLogs(query)
 	if err != nil {
 		response(nil, 500, err, resp, req)
@@ -0,0 +1,60 @@
+package http
+
+import (
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/provider/kubernetes"
+)
+
+// Cluster - further cluster managed next to the one of Opts.GRC, identifiers
+// of its resources are prefixed with the cluster name
+type Cluster struct {
+	Name             string
+	GRC              *k8s.GenericResourceCache
+	KubernetesClient kubernetes.Implementer
+}
+
+// resources - resources of every cluster, or of the named cluster only
+func (s *TriggerServer) resources(cluster string) []*k8s.GenericResource {
+	caches := []*k8s.GenericResourceCache{s.grc}
+	for _, c := range s.clusters {
+		caches = append(caches, c.GRC)
+	}
+
+	var resources []*k8s.GenericResource
+	for _, cache := range caches {
+		if cache == nil {
+			continue
+		}
+		for _, v := range cache.Values() {
+			if cluster == "" || v.Cluster == cluster {
+				resources = append(resources, v)
+			}
+		}
+	}
+	return resources
+}
+
+// knownCluster - whether keel manages the named cluster
+func (s *TriggerServer) knownCluster(name string) bool {
+	if name == s.localCluster {
+		return true
+	}
+	for _, c := range s.clusters {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// clientFor - client of the cluster the resource belongs to
+func (s *TriggerServer) clientFor(resource *k8s.GenericResource) kubernetes.Implementer {
+	if resource.Cluster != "" {
+		for _, c := range s.clusters {
+			if c.Name == resource.Cluster {
+				return c.KubernetesClient
+			}
+		}
+	}
+	return s.kubernetesClient
+}
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func clusterResource(t *testing.T, cluster, name string) *k8s.GenericResource {
+	resource, err := k8s.NewGenericResource(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:        name,
+		Namespace:   "default",
+		Annotations: map[string]string{types.KeelPolicyLabel: "minor"},
+	}})
+	if err != nil {
+		t.Fatalf("create generic resource: %v", err)
+	}
+	resource.SetCluster(cluster)
+	return resource
+}
+
+func TestClusterResources(t *testing.T) {
+	fp := &fakeProvider{}
+	srv, teardown := NewTestingServer(fp)
+	defer teardown()
+
+	local := &recordingKubernetesImplementer{}
+	remote := &recordingKubernetesImplementer{}
+	srv.grc = &k8s.GenericResourceCache{}
+	srv.grc.Add(clusterResource(t, "", "api"))
+	srv.kubernetesClient = local
+	srv.clusters = []Cluster{{Name: "production", GRC: &k8s.GenericResourceCache{}, KubernetesClient: remote}}
+	srv.clusters[0].GRC.Add(clusterResource(t, "production", "api"))
+
+	for cluster, want := range map[string][]string{
+		"":           {"deployment/default/api", "production/deployment/default/api"},
+		"production": {"production/deployment/default/api"},
+		"staging":    nil,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/resources?cluster="+cluster, nil)
+		req.SetBasicAuth("user-1", "secret")
+		rec := httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d, body: %s", rec.Code, rec.Body.String())
+		}
+
+		var resources []ResourceResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resources); err != nil {
+			t.Fatalf("failed to decode response: %s", err)
+		}
+		if len(resources) != len(want) {
+			t.Fatalf("cluster '%s': expected %d resources, got: %+v", cluster, len(want), resources)
+		}
+		for i, resource := range resources {
+			if resource.Identifier != want[i] {
+				t.Errorf("cluster '%s': unexpected identifier: %s", cluster, resource.Identifier)
+			}
+		}
+	}
+
+	// updates go to the cluster of the resource
+	req := httptest.NewRequest(http.MethodPut, "/v1/policies", bytes.NewBufferString(`{"identifier": "production/deployment/default/api", "policy": "major", "provider": "kubernetes"}`))
+	req.SetBasicAuth("user-1", "secret")
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if local.updated != nil {
+		t.Error("expected the local cluster to be left alone")
+	}
+	if remote.updated == nil || remote.updated.GetAnnotations()[types.KeelPolicyLabel] != "major" {
+		t.Error("expected the resource to be updated in the production cluster")
+	}
+}
+
+func TestClusterApprovals(t *testing.T) {
+	fp := &fakeProvider{}
+	srv, teardown := NewTestingServer(fp)
+	defer teardown()
+
+	for _, approval := range []*types.Approval{
+		{Provider: types.ProviderTypeKubernetes, Identifier: "deployment/default/api", VotesRequired: 1, NewVersion: "2.0.0", CurrentVersion: "1.0.0"},
+		{Provider: types.ProviderTypeKubernetes, Cluster: "production", Identifier: "production/deployment/default/api", VotesRequired: 1, NewVersion: "2.0.0", CurrentVersion: "1.0.0"},
+	} {
+		if err := srv.approvalsManager.Create(approval); err != nil {
+			t.Fatalf("failed to create approval: %s", err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/approvals?cluster=production", nil)
+	req.SetBasicAuth("user-1", "secret")
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+
+	var approvals []*types.Approval
+	if err := json.Unmarshal(rec.Body.Bytes(), &approvals); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	if len(approvals) != 1 || approvals[0].Cluster != "production" {
+		t.Errorf("expected the production approval only, got: %+v", approvals)
+	}
+}
+
+func TestClusterAuditLogs(t *testing.T) {
+	fp := &fakeProvider{}
+	srv, teardown := NewTestingServer(fp)
+	defer teardown()
+
+	for _, identifier := range []string{"deployment/default/api", "production/deployment/default/api", "Production/deployment/default/api", "pro_uction/deployment/default/api"} {
+		if _, err := srv.store.CreateAuditLog(&types.AuditLog{Action: "update", ResourceKind: "deployment", Identifier: identifier}); err != nil {
+			t.Fatalf("failed to create audit log: %s", err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/audit?filter=*&cluster=production", nil)
+	req.SetBasicAuth("user-1", "secret")
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+
+	var logs AuditLogsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &logs); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	if len(logs.Data) != 1 || logs.Data[0].Identifier != "production/deployment/default/api" || logs.Total != 1 {
+		t.Errorf("expected the production entry only, got: %+v", logs)
+	}
+
+	// wildcards in the name match nothing but the cluster itself
+	req = httptest.NewRequest(http.MethodGet, "/v1/audit?filter=*&cluster=pro_uction", nil)
+	req.SetBasicAuth("user-1", "secret")
+	rec = httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	logs = AuditLogsResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &logs); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	if len(logs.Data) != 1 || logs.Data[0].Identifier != "pro_uction/deployment/default/api" || logs.Total != 1 {
+		t.Errorf("expected the pro_uction entry only, got: %+v", logs)
+	}
+}
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/keel-hq/keel/pkg/store"
+	"github.com/keel-hq/keel/provider"
+	"github.com/keel-hq/keel/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RollbackRequest selects the update history entry whose previous image
+// should be re-applied.
+type RollbackRequest struct {
+	ID string `json:"id"`
+}
+
+// historyHandler lists updates applied to a resource.
+// @Summary List resource update history
+// @Description Returns updates applied to a resource, newest first. Every updated container, init container or image volume has its own entry with the previous and new image, digests, trigger and approver. Resource identifiers contain slashes, ie: deployment/default/app. This route exists only when the authenticator is enabled.
+// @Tags Admin
+// @ID listResourceHistory
+// @Produce json
+// @Security BasicAuth
+// @Security BearerAuth
+// @Param identifier path string true "Resource identifier"
+// @Param limit query int false "Maximum entries"
+// @Success 200 {array} types.UpdateRecord
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Permission denied"
+// @Failure 500 {string} string "Store query failed"
+// @Router /v1/resources/{identifier}/history [get]
+func (s *TriggerServer) historyHandler(resp http.ResponseWriter, req *http.Request) {
+	query := &types.UpdateRecordQuery{
+		Identifier: mux.Vars(req)["identifier"],
+	}
+	if limit, err := strconv.Atoi(req.URL.Query().Get("limit")); err == nil {
+		query.Limit = limit
+	}
+
+	records, err := s.store.ListUpdateRecords(query)
+	if records == nil {
+		records = []*types.UpdateRecord{}
+	}
+	response(&records, 200, err, resp, req)
+}
+
+// rollbackHandler re-applies the previous image of an update history entry.
+// @Summary Roll back a resource update
+// @Description Re-applies the previous image of the selected update history entry through the provider, the same way as any other update: the rollback counts towards the rollout budget, notifications are sent, the rollout is verified and a new history entry is stored. The request returns once the provider accepts the rollback, without waiting for it to be applied. Approvals and pre-update jobs are not required and a rollback audit log entry is created for the requesting user. Resources in dry-run mode can't be rolled back. This route exists only when the authenticator is enabled.
+// @Tags Admin
+// @ID rollbackResource
+// @Accept json
+// @Produce json
+// @Security BasicAuth
+// @Security BearerAuth
+// @Param identifier path string true "Resource identifier"
+// @Param body body RollbackRequest true "Update history entry"
+// @Success 200 {object} APIResponse
+// @Failure 400 {string} string "Malformed request or nothing to roll back"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Permission denied"
+// @Failure 404 {string} string "History entry or resource not found"
+// @Failure 500 {string} string "Rollback failed"
+// @Router /v1/resources/{identifier}/rollback [post]
+func (s *TriggerServer) rollbackHandler(resp http.ResponseWriter, req *http.Request) {
+	var rollbackRequest RollbackRequest
+	dec := json.NewDecoder(req.Body)
+	defer req.Body.Close()
+
+	err := dec.Decode(&rollbackRequest)
+	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(resp, "%s", err)
+		return
+	}
+
+	if rollbackRequest.ID == "" {
+		http.Error(resp, "id cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	record, err := s.store.GetUpdateRecord(&types.UpdateRecordQuery{
+		ID:         rollbackRequest.ID,
+		Identifier: mux.Vars(req)["identifier"],
+	})
+	if err != nil {
+		if err == store.ErrRecordNotFound {
+			http.Error(resp, fmt.Sprintf("history entry '%s' not found", rollbackRequest.ID), http.StatusNotFound)
+			return
+		}
+		response(nil, 500, err, resp, req)
+		return
+	}
+
+	username := getUsername(req)
+
+	err = s.providers.Rollback(record, username)
+	switch {
+	case errors.Is(err, provider.ErrResourceNotFound):
+		http.Error(resp, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, provider.ErrInvalidRollback), errors.Is(err, provider.ErrRollbackNotSupported):
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		response(nil, 500, err, resp, req)
+		return
+	}
+
+	s.addRollbackAuditEntry(record, username)
+
+	response(&APIResponse{Status: "rolling back"}, 200, nil, resp, req)
+}
+
+func (s *TriggerServer) addRollbackAuditEntry(record *types.UpdateRecord, username string) {
+	entry := &types.AuditLog{
+		AccountID:    username,
+		Username:     username,
+		Action:       types.AuditActionRollback,
+		ResourceKind: record.ResourceKind,
+		Identifier:   record.Identifier,
+		Message:      fmt.Sprintf("Rolled back %s container %s to %s", record.Identifier, record.Container, record.PreviousImage),
+	}
+	entry.SetMetadata(map[string]string{
+		"provider":  record.Provider,
+		"container": record.Container,
+		"image":     record.PreviousImage,
+		"digest":    record.PreviousDigest,
+		"record_id": record.ID,
+	})
+
+	_, err := s.store.CreateAuditLog(entry)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":      err,
+			"identifier": record.Identifier,
+		}).Error("http.rollbackHandler: failed to create audit log")
+	}
+}
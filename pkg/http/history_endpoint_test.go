@@ -0,0 +1,71 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keel-hq/keel/types"
+)
+
+func TestRollbackHandler(t *testing.T) {
+	fp := &fakeProvider{}
+	srv, teardown := NewTestingServer(fp)
+	defer teardown()
+
+	record, err := srv.store.CreateUpdateRecord(&types.UpdateRecord{
+		Provider:      "fp",
+		Identifier:    "deployment/default/app",
+		ResourceKind:  "deployment",
+		Container:     "app",
+		PreviousImage: "karolisr/keel:0.1.0",
+		NewImage:      "karolisr/keel:0.2.0",
+	})
+	if err != nil {
+		t.Fatalf("failed to create history entry: %s", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/resources/deployment/default/app/history", nil)
+	req.SetBasicAuth("user-1", "secret")
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var history []*types.UpdateRecord
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatalf("failed to decode history: %s", err)
+	}
+	if len(history) != 1 || history[0].ID != record.ID {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/resources/deployment/default/other/rollback", bytes.NewBufferString(`{"id":"`+record.ID+`"}`))
+	req.SetBasicAuth("user-1", "secret")
+	rec = httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected entry of another resource to be rejected, got: %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/resources/deployment/default/app/rollback", bytes.NewBufferString(`{"id":"`+record.ID+`"}`))
+	req.SetBasicAuth("user-1", "secret")
+	rec = httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if len(fp.rolledBack) != 1 || fp.rolledBack[0].PreviousImage != "karolisr/keel:0.1.0" {
+		t.Fatalf("expected rollback to be submitted to the provider, got: %+v", fp.rolledBack)
+	}
+
+	logs, err := srv.store.GetAuditLogs(&types.AuditLogQuery{ResourceKindFilter: []string{"*"}})
+	if err != nil {
+		t.Fatalf("failed to get audit logs: %s", err)
+	}
+	if len(logs) != 1 || logs[0].Action != types.AuditActionRollback || logs[0].Username != "user-1" || logs[0].Identifier != "deployment/default/app" {
+		t.Errorf("unexpected audit logs: %+v", logs)
+	}
+}
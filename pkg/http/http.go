@@ -41,6 +41,11 @@ type Opts struct {
 
 	KubernetesClient kubernetes.Implementer
 
+	// LocalCluster - name of the cluster of GRC, empty when it isn't named
+	LocalCluster string
+	// Clusters - further clusters keel manages
+	Clusters []Cluster
+
 	Store store.Store
 
 	UIDir string
@@ -51,12 +56,18 @@ type Opts struct {
 	AuthMode            auth.Mode
 	AuthProxyUserHeader string
 	AuthProxyLogoutURL  string
+
+	// Leadership is set when several replicas elect a leader, followers
+	// forward webhooks to it and serve the API read-only
+	Leadership Leadership
 }
 
 // TriggerServer - webhook trigger & healthcheck server
 type TriggerServer struct {
 	grc              *k8s.GenericResourceCache
 	kubernetesClient kubernetes.Implementer
+	localCluster     string
+	clusters         []Cluster
 
 	providers        provider.Providers
 	approvalsManager approvals.Manager
@@ -74,6 +85,8 @@ type TriggerServer struct {
 	authMode              auth.Mode
 	authProxyUserHeader   string
 	authProxyLogoutURL    string
+
+	leadership Leadership
 }
 
 // NewTriggerServer - create new HTTP trigger based server
@@ -82,6 +95,8 @@ func NewTriggerServer(opts *Opts) *TriggerServer {
 		port:                  opts.Port,
 		grc:                   opts.GRC,
 		kubernetesClient:      opts.KubernetesClient,
+		localCluster:          opts.LocalCluster,
+		clusters:              opts.Clusters,
 		providers:             opts.Providers,
 		approvalsManager:      opts.ApprovalManager,
 		router:                mux.NewRouter(),
@@ -93,6 +108,7 @@ func NewTriggerServer(opts *Opts) *TriggerServer {
 		authMode:              opts.AuthMode,
 		authProxyUserHeader:   opts.AuthProxyUserHeader,
 		authProxyLogoutURL:    opts.AuthProxyLogoutURL,
+		leadership:            opts.Leadership,
 	}
 }
 
@@ -103,6 +119,7 @@ func (s *TriggerServer) Start() error {
 
 	n := negroni.New(negroni.NewRecovery())
 	n.Use(negroni.HandlerFunc(corsHeadersMiddleware))
+	n.Use(negroni.HandlerFunc(s.followerMiddleware))
 	n.UseHandler(s.router)
 
 	address := fmt.Sprintf(":%d", s.port)
@@ -171,9 +188,22 @@ func (s *TriggerServer) registerRoutes(mux *mux.Router) {
 
 		// available resources
 		mux.HandleFunc("/v1/resources", s.requireAdminAuthorization(s.resourcesHandler)).Methods("GET", "OPTIONS")
+		// update history and rollbacks, identifiers contain slashes
+		mux.HandleFunc("/v1/resources/{identifier:.+}/history", s.requireAdminAuthorization(s.historyHandler)).Methods("GET", "OPTIONS")
+		mux.HandleFunc("/v1/resources/{identifier:.+}/rollback", s.requireAdminAuthorization(s.rollbackHandler)).Methods("POST", "OPTIONS")
+		// pausing updates
+		mux.HandleFunc("/v1/resources/{identifier:.+}/pause", s.requireAdminAuthorization(s.pauseResourceHandler)).Methods("POST", "OPTIONS")
+		mux.HandleFunc("/v1/resources/{identifier:.+}/resume", s.requireAdminAuthorization(s.resumeResourceHandler)).Methods("POST", "OPTIONS")
+		mux.HandleFunc("/v1/namespaces/paused", s.requireAdminAuthorization(s.pausedNamespacesHandler)).Methods("GET", "OPTIONS")
+		mux.HandleFunc("/v1/namespaces/{namespace}/pause", s.requireAdminAuthorization(s.pauseNamespaceHandler)).Methods("POST", "OPTIONS")
+		mux.HandleFunc("/v1/namespaces/{namespace}/resume", s.requireAdminAuthorization(s.resumeNamespaceHandler)).Methods("POST", "OPTIONS")
 
 		mux.HandleFunc("/v1/policies", s.requireAdminAuthorization(s.policyUpdateHandler)).Methods("PUT", "OPTIONS")
 
+		// update plans for the latest events, including dry-run ones
+		mux.HandleFunc("/v1/plans", s.requireAdminAuthorization(s.plansHandler)).Methods("GET", "OPTIONS")
+		mux.HandleFunc("/v1/stages", s.requireAdminAuthorization(s.stagesHandler)).Methods("GET", "OPTIONS")
+
 		// tracked images
 		mux.HandleFunc("/v1/tracked", s.requireAdminAuthorization(s.trackedHandler)).Methods("GET", "OPTIONS")
 		mux.HandleFunc("/v1/tracked", s.requireAdminAuthorization(s.trackSetHandler)).Methods("PUT", "OPTIONS")
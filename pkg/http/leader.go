@@ -0,0 +1,74 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Leadership - leader election state of the replica, nil when keel runs a
+// single replica
+type Leadership interface {
+	IsLeader() bool
+	// Leader returns the URL of the leader, empty when unknown
+	Leader() string
+}
+
+// followerMiddleware makes followers read-only: webhooks are forwarded to the
+// leader, which is the only replica running providers, and other changes
+// are rejected
+func (s *TriggerServer) followerMiddleware(resp http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	if s.leadership == nil || s.leadership.IsLeader() || !followerRestricted(req) {
+		next(resp, req)
+		return
+	}
+
+	leader := s.leadership.Leader()
+	if leader == "" {
+		http.Error(resp, "no leader elected, retry later", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !strings.HasPrefix(req.URL.Path, "/v1/webhooks/") {
+		resp.Header().Set("X-Keel-Leader", leader)
+		http.Error(resp, "this replica is read-only, send changes to the leader "+leader, http.StatusServiceUnavailable)
+		return
+	}
+
+	target, err := url.Parse(leader)
+	if err != nil || target.Host == "" {
+		log.WithFields(log.Fields{
+			"leader": leader,
+		}).Error("trigger.http: invalid leader address, can't forward webhook")
+		http.Error(resp, "invalid leader address", http.StatusBadGateway)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"path":   req.URL.Path,
+		"leader": leader,
+	}).Debug("trigger.http: forwarding webhook to the leader")
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(resp http.ResponseWriter, req *http.Request, err error) {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"leader": leader,
+		}).Error("trigger.http: failed to forward webhook to the leader")
+		resp.WriteHeader(http.StatusBadGateway)
+	}
+	proxy.ServeHTTP(resp, req)
+}
+
+// followerRestricted - requests followers don't serve themselves: webhooks
+// and API changes. Logging in and out works on every replica.
+func followerRestricted(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return !strings.HasPrefix(req.URL.Path, "/v1/auth/")
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/urfave/negroni"
+)
+
+type fakeLeadership struct {
+	leader  bool
+	address string
+}
+
+func (l *fakeLeadership) IsLeader() bool {
+	return l.leader
+}
+
+func (l *fakeLeadership) Leader() string {
+	return l.address
+}
+
+// withMiddleware - router of the server behind its follower middleware, as Start sets it up
+func withMiddleware(srv *TriggerServer) http.Handler {
+	n := negroni.New()
+	n.Use(negroni.HandlerFunc(srv.followerMiddleware))
+	n.UseHandler(srv.router)
+	return n
+}
+
+func TestFollowerForwardsWebhooks(t *testing.T) {
+	leaderProvider := &fakeProvider{}
+	leader, teardownLeader := NewTestingServer(leaderProvider)
+	defer teardownLeader()
+	leader.leadership = &fakeLeadership{leader: true}
+	leaderServer := httptest.NewServer(withMiddleware(leader))
+	defer leaderServer.Close()
+
+	followerProvider := &fakeProvider{}
+	follower, teardownFollower := NewTestingServer(followerProvider)
+	defer teardownFollower()
+	follower.leadership = &fakeLeadership{address: leaderServer.URL}
+
+	req := httptest.NewRequest("POST", "/v1/webhooks/native", bytes.NewBufferString(`{"name": "gcr.io/v2-namespace/hello-world", "tag": "1.1.1"}`))
+	rec := httptest.NewRecorder()
+	withMiddleware(follower).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", rec.Code)
+	}
+	if len(leaderProvider.submitted) != 1 || leaderProvider.submitted[0].Repository.Tag != "1.1.1" {
+		t.Errorf("expected the event to be submitted on the leader, got: %+v", leaderProvider.submitted)
+	}
+	if len(followerProvider.submitted) != 0 {
+		t.Errorf("follower must not submit events, got: %+v", followerProvider.submitted)
+	}
+}
+
+func TestFollowerReadOnlyAPI(t *testing.T) {
+	fp := &fakeProvider{}
+	srv, teardown := NewTestingServer(fp)
+	defer teardown()
+	srv.leadership = &fakeLeadership{address: "http://10.0.0.1:9300"}
+	handler := withMiddleware(srv)
+
+	req := httptest.NewRequest("GET", "/v1/approvals", nil)
+	req.SetBasicAuth("user-1", "secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("followers must serve reads, got status code: %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/v1/approvals", bytes.NewBufferString(`{"id": "dev/whd-dev", "action": "approve"}`))
+	req.SetBasicAuth("user-1", "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("followers must reject changes, got status code: %d", rec.Code)
+	}
+	if leader := rec.Header().Get("X-Keel-Leader"); leader != "http://10.0.0.1:9300" {
+		t.Errorf("expected the leader in the response, got: %s", leader)
+	}
+
+	req = httptest.NewRequest("POST", "/v1/auth/login", bytes.NewBufferString(`{"username": "user-1", "password": "secret"}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code == http.StatusServiceUnavailable {
+		t.Errorf("followers must serve logins")
+	}
+}
+
+func TestFollowerWithoutLeader(t *testing.T) {
+	fp := &fakeProvider{}
+	srv, teardown := NewTestingServer(fp)
+	defer teardown()
+	srv.leadership = &fakeLeadership{}
+
+	req := httptest.NewRequest("POST", "/v1/webhooks/native", bytes.NewBufferString(`{"name": "gcr.io/v2-namespace/hello-world", "tag": "1.1.1"}`))
+	rec := httptest.NewRecorder()
+	withMiddleware(srv).ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status code: %d", rec.Code)
+	}
+	if len(fp.submitted) != 0 {
+		t.Errorf("follower must not submit events")
+	}
+}
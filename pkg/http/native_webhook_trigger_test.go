@@ -66,8 +66,9 @@ func NewTestingServer(fp provider.Provider) (*TriggerServer, func()) {
 }
 
 type fakeProvider struct {
-	submitted []types.Event
-	images    []*types.TrackedImage
+	submitted  []types.Event
+	images     []*types.TrackedImage
+	rolledBack []*types.UpdateRecord
 }
 
 func (p *fakeProvider) Submit(event types.Event) error {
@@ -81,6 +82,13 @@ func (p *fakeProvider) TrackedImages() ([]*types.TrackedImage, error) {
 func (p *fakeProvider) List() []string {
 	return []string{"fakeprovider"}
 }
+func (p *fakeProvider) Plans() []*types.Plan {
+	return nil
+}
+func (p *fakeProvider) Rollback(record *types.UpdateRecord, user string) error {
+	p.rolledBack = append(p.rolledBack, record)
+	return nil
+}
 func (p *fakeProvider) Stop() {
 	return
 }
@@ -0,0 +1,301 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/pkg/auth"
+	"github.com/keel-hq/keel/provider/kubernetes"
+	"github.com/keel-hq/keel/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pauseResourceHandler pauses updates of a resource.
+// @Summary Pause resource updates
+// @Description Sets the keel.sh/paused annotation of a Kubernetes resource. Keel stops updating the resource but keeps tracking the newest available version, reported in the available field of /v1/resources. A paused audit log entry is created for the requesting user. Resource identifiers contain slashes, ie: deployment/default/app. This route exists only when the authenticator is enabled.
+// @Tags Admin
+// @ID pauseResource
+// @Produce json
+// @Security BasicAuth
+// @Security BearerAuth
+// @Param identifier path string true "Resource identifier"
+// @Success 200 {object} APIResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Permission denied"
+// @Failure 404 {string} string "Resource not found"
+// @Failure 500 {string} string "Update failed"
+// @Router /v1/resources/{identifier}/pause [post]
+func (s *TriggerServer) pauseResourceHandler(resp http.ResponseWriter, req *http.Request) {
+	s.setResourcePaused(resp, req, true)
+}
+
+// resumeResourceHandler resumes updates of a resource.
+// @Summary Resume resource updates
+// @Description Removes the keel.sh/paused annotation of a Kubernetes resource and the versions tracked while it was paused, the next event or poll updates it. Resources in a paused namespace stay paused until the namespace is resumed. A resumed audit log entry is created for the requesting user. This route exists only when the authenticator is enabled.
+// @Tags Admin
+// @ID resumeResource
+// @Produce json
+// @Security BasicAuth
+// @Security BearerAuth
+// @Param identifier path string true "Resource identifier"
+// @Success 200 {object} APIResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Permission denied"
+// @Failure 404 {string} string "Resource not found"
+// @Failure 500 {string} string "Update failed"
+// @Router /v1/resources/{identifier}/resume [post]
+func (s *TriggerServer) resumeResourceHandler(resp http.ResponseWriter, req *http.Request) {
+	s.setResourcePaused(resp, req, false)
+}
+
+func (s *TriggerServer) setResourcePaused(resp http.ResponseWriter, req *http.Request, paused bool) {
+	identifier := mux.Vars(req)["identifier"]
+
+	for _, v := range s.resources("") {
+		if v.Identifier != identifier {
+			continue
+		}
+
+		previous := v.DeepCopy()
+		ann := v.GetAnnotations()
+		delete(ann, types.KeelPausedAnnotation)
+		if paused {
+			ann[types.KeelPausedAnnotation] = "true"
+		}
+		v.SetAnnotations(ann)
+
+		// the label would keep the resource paused
+		if !paused {
+			labels := v.GetLabels()
+			delete(labels, types.KeelPausedAnnotation)
+			v.SetLabels(labels)
+		}
+
+		err := s.clientFor(v).Update(v, previous)
+		if err != nil {
+			response(nil, 500, err, resp, req)
+			return
+		}
+
+		if !paused {
+			err = s.clearAvailableUpdates(kubernetes.ProviderNameFor(v.Cluster), identifier)
+			if err != nil {
+				response(nil, 500, err, resp, req)
+				return
+			}
+		}
+
+		s.addPauseAuditEntry(v.Kind(), identifier, paused, getUsername(req))
+
+		response(&APIResponse{Status: pauseStatus(paused)}, 200, nil, resp, req)
+		return
+	}
+
+	http.Error(resp, fmt.Sprintf("resource with identifier '%s' not found", identifier), http.StatusNotFound)
+}
+
+func (s *TriggerServer) clearAvailableUpdates(provider, identifier string) error {
+	updates, err := s.store.ListAvailableUpdates(&types.AvailableUpdateQuery{
+		Provider:   provider,
+		Identifier: identifier,
+	})
+	if err != nil {
+		return err
+	}
+	for _, update := range updates {
+		if err := s.store.DeleteAvailableUpdate(update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pausedNamespacesHandler lists paused namespaces.
+// @Summary List paused namespaces
+// @Description Returns namespaces paused through the API. This route exists only when the authenticator is enabled.
+// @Tags Admin
+// @ID listPausedNamespaces
+// @Produce json
+// @Security BasicAuth
+// @Security BearerAuth
+// @Param cluster query string false "Namespaces of the cluster only"
+// @Success 200 {array} types.PausedNamespace
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Permission denied"
+// @Failure 500 {string} string "Store query failed"
+// @Router /v1/namespaces/paused [get]
+func (s *TriggerServer) pausedNamespacesHandler(resp http.ResponseWriter, req *http.Request) {
+	all, err := s.store.ListPausedNamespaces()
+	cluster, filter := req.URL.Query()["cluster"]
+	paused := []*types.PausedNamespace{}
+	for _, p := range all {
+		if !filter || p.Cluster == cluster[0] {
+			paused = append(paused, p)
+		}
+	}
+	response(&paused, 200, err, resp, req)
+}
+
+// pauseNamespaceHandler pauses updates of every resource in a namespace.
+// @Summary Pause namespace updates
+// @Description Pauses updates of every Kubernetes resource in the namespace of a cluster, including resources created later. Keel keeps tracking the newest available versions, reported in the available field of /v1/resources. Pausing a paused namespace is a no-op. A paused audit log entry is created for the requesting user. This route exists only when the authenticator is enabled.
+// @Tags Admin
+// @ID pauseNamespace
+// @Produce json
+// @Security BasicAuth
+// @Security BearerAuth
+// @Param namespace path string true "Namespace"
+// @Param cluster query string false "Cluster of the namespace, the cluster keel runs in by default"
+// @Success 200 {object} APIResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Permission denied"
+// @Failure 404 {string} string "Cluster not found"
+// @Failure 500 {string} string "Store query failed"
+// @Router /v1/namespaces/{namespace}/pause [post]
+func (s *TriggerServer) pauseNamespaceHandler(resp http.ResponseWriter, req *http.Request) {
+	namespace := mux.Vars(req)["namespace"]
+	cluster, ok := s.namespaceCluster(resp, req)
+	if !ok {
+		return
+	}
+
+	existing, err := s.findPausedNamespace(cluster, namespace)
+	if err != nil {
+		response(nil, 500, err, resp, req)
+		return
+	}
+	if existing != nil {
+		response(&APIResponse{Status: pauseStatus(true)}, 200, nil, resp, req)
+		return
+	}
+
+	username := getUsername(req)
+	_, err = s.store.CreatePausedNamespace(&types.PausedNamespace{
+		Cluster:   cluster,
+		Namespace: namespace,
+		User:      username,
+	})
+	if err != nil {
+		response(nil, 500, err, resp, req)
+		return
+	}
+
+	s.addPauseAuditEntry(types.AuditResourceKindNamespace, k8s.ClusterIdentifier(cluster, namespace), true, username)
+
+	response(&APIResponse{Status: pauseStatus(true)}, 200, nil, resp, req)
+}
+
+// resumeNamespaceHandler resumes updates of a namespace.
+// @Summary Resume namespace updates
+// @Description Resumes updates of the resources in a namespace paused through the API. Resources with the keel.sh/paused annotation stay paused. A resumed audit log entry is created for the requesting user. This route exists only when the authenticator is enabled.
+// @Tags Admin
+// @ID resumeNamespace
+// @Produce json
+// @Security BasicAuth
+// @Security BearerAuth
+// @Param namespace path string true "Namespace"
+// @Param cluster query string false "Cluster of the namespace, the cluster keel runs in by default"
+// @Success 200 {object} APIResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Permission denied"
+// @Failure 404 {string} string "Namespace is not paused or cluster not found"
+// @Failure 500 {string} string "Store query failed"
+// @Router /v1/namespaces/{namespace}/resume [post]
+func (s *TriggerServer) resumeNamespaceHandler(resp http.ResponseWriter, req *http.Request) {
+	namespace := mux.Vars(req)["namespace"]
+	cluster, ok := s.namespaceCluster(resp, req)
+	if !ok {
+		return
+	}
+
+	existing, err := s.findPausedNamespace(cluster, namespace)
+	if err != nil {
+		response(nil, 500, err, resp, req)
+		return
+	}
+	if existing == nil {
+		http.Error(resp, fmt.Sprintf("namespace '%s' is not paused", namespace), http.StatusNotFound)
+		return
+	}
+
+	err = s.store.DeletePausedNamespace(existing)
+	if err != nil {
+		response(nil, 500, err, resp, req)
+		return
+	}
+
+	s.addPauseAuditEntry(types.AuditResourceKindNamespace, k8s.ClusterIdentifier(cluster, namespace), false, getUsername(req))
+
+	response(&APIResponse{Status: pauseStatus(false)}, 200, nil, resp, req)
+}
+
+// namespaceCluster - cluster named by the cluster parameter, the cluster keel
+// runs in when it's missing
+func (s *TriggerServer) namespaceCluster(resp http.ResponseWriter, req *http.Request) (string, bool) {
+	cluster, ok := req.URL.Query()["cluster"]
+	if !ok {
+		return s.localCluster, true
+	}
+	if !s.knownCluster(cluster[0]) {
+		http.Error(resp, fmt.Sprintf("cluster '%s' not found", cluster[0]), http.StatusNotFound)
+		return "", false
+	}
+	return cluster[0], true
+}
+
+func (s *TriggerServer) findPausedNamespace(cluster, namespace string) (*types.PausedNamespace, error) {
+	paused, err := s.store.ListPausedNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paused {
+		if p.Cluster == cluster && p.Namespace == namespace {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+func getUsername(req *http.Request) string {
+	if user := auth.GetAccountFromCtx(req.Context()); user != nil {
+		return user.Username
+	}
+	return ""
+}
+
+func pauseStatus(paused bool) string {
+	if paused {
+		return "paused"
+	}
+	return "resumed"
+}
+
+func (s *TriggerServer) addPauseAuditEntry(kind, identifier string, paused bool, username string) {
+	action := types.AuditActionResumed
+	message := fmt.Sprintf("Resumed updates of %s %s", kind, identifier)
+	if paused {
+		action = types.AuditActionPaused
+		message = fmt.Sprintf("Paused updates of %s %s", kind, identifier)
+	}
+
+	entry := &types.AuditLog{
+		AccountID:    username,
+		Username:     username,
+		Action:       action,
+		ResourceKind: kind,
+		Identifier:   identifier,
+		Message:      message,
+	}
+
+	_, err := s.store.CreateAuditLog(entry)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":      err,
+			"identifier": identifier,
+		}).Error("http.pauseHandler: failed to create audit log")
+	}
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPauseResumeResource(t *testing.T) {
+	fp := &fakeProvider{}
+	srv, teardown := NewTestingServer(fp)
+	defer teardown()
+
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:        "storefront",
+		Namespace:   "keel-demo",
+		Annotations: map[string]string{types.KeelPolicyLabel: "minor"},
+	}}
+	resource, err := k8s.NewGenericResource(deployment)
+	if err != nil {
+		t.Fatalf("create generic resource: %v", err)
+	}
+	client := &recordingKubernetesImplementer{}
+	srv.grc = &k8s.GenericResourceCache{}
+	srv.grc.Add(resource)
+	srv.kubernetesClient = client
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/resources/deployment/keel-demo/storefront/pause", nil)
+	req.SetBasicAuth("user-1", "secret")
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if client.updated == nil || client.updated.GetAnnotations()[types.KeelPausedAnnotation] != "true" {
+		t.Fatalf("expected resource to be paused")
+	}
+
+	_, err = srv.store.CreateAvailableUpdate(&types.AvailableUpdate{
+		Provider:   "kubernetes",
+		Identifier: "deployment/keel-demo/storefront",
+		NewVersion: "1.2.0",
+	})
+	if err != nil {
+		t.Fatalf("failed to create available update: %s", err)
+	}
+
+	srv.grc.Add(client.updated)
+	req = httptest.NewRequest(http.MethodPost, "/v1/resources/deployment/keel-demo/storefront/resume", nil)
+	req.SetBasicAuth("user-1", "secret")
+	rec = httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := client.updated.GetAnnotations()[types.KeelPausedAnnotation]; ok {
+		t.Errorf("expected pause annotation to be removed")
+	}
+	if available, _ := srv.store.ListAvailableUpdates(&types.AvailableUpdateQuery{}); len(available) != 0 {
+		t.Errorf("expected available updates to be cleared, got: %+v", available)
+	}
+
+	logs, err := srv.store.GetAuditLogs(&types.AuditLogQuery{ResourceKindFilter: []string{"*"}})
+	if err != nil {
+		t.Fatalf("failed to get audit logs: %s", err)
+	}
+	actions := map[string]bool{}
+	for _, l := range logs {
+		if l.Identifier == "deployment/keel-demo/storefront" && l.Username == "user-1" {
+			actions[l.Action] = true
+		}
+	}
+	if !actions[types.AuditActionPaused] || !actions[types.AuditActionResumed] {
+		t.Errorf("expected paused and resumed audit entries, got: %+v", logs)
+	}
+}
+
+func TestPauseResumeNamespace(t *testing.T) {
+	fp := &fakeProvider{}
+	srv, teardown := NewTestingServer(fp)
+	defer teardown()
+
+	for _, path := range []string{"/v1/namespaces/keel-demo/pause", "/v1/namespaces/keel-demo/pause"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.SetBasicAuth("user-1", "secret")
+		rec := httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d, body: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/namespaces/paused", nil)
+	req.SetBasicAuth("user-1", "secret")
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	var paused []*types.PausedNamespace
+	if err := json.Unmarshal(rec.Body.Bytes(), &paused); err != nil {
+		t.Fatalf("failed to decode paused namespaces: %s", err)
+	}
+	if len(paused) != 1 || paused[0].Namespace != "keel-demo" || paused[0].User != "user-1" {
+		t.Fatalf("unexpected paused namespaces: %+v", paused)
+	}
+
+	for _, expected := range []int{http.StatusOK, http.StatusNotFound} {
+		req = httptest.NewRequest(http.MethodPost, "/v1/namespaces/keel-demo/resume", nil)
+		req.SetBasicAuth("user-1", "secret")
+		rec = httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, req)
+		if rec.Code != expected {
+			t.Errorf("unexpected status code: %d, expected: %d", rec.Code, expected)
+		}
+	}
+
+	logs, err := srv.store.GetAuditLogs(&types.AuditLogQuery{ResourceKindFilter: []string{"*"}})
+	if err != nil {
+		t.Fatalf("failed to get audit logs: %s", err)
+	}
+	if len(logs) != 2 {
+		t.Errorf("expected a single paused and resumed audit entry, got: %+v", logs)
+	}
+}
+
+func TestPauseNamespaceOfCluster(t *testing.T) {
+	fp := &fakeProvider{}
+	srv, teardown := NewTestingServer(fp)
+	defer teardown()
+	srv.clusters = []Cluster{{Name: "staging"}}
+
+	for path, expected := range map[string]int{
+		"/v1/namespaces/keel-demo/pause?cluster=staging": http.StatusOK,
+		"/v1/namespaces/keel-demo/pause":                 http.StatusOK,
+		"/v1/namespaces/keel-demo/pause?cluster=unknown": http.StatusNotFound,
+	} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.SetBasicAuth("user-1", "secret")
+		rec := httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, req)
+		if rec.Code != expected {
+			t.Errorf("%s: unexpected status code: %d, expected: %d", path, rec.Code, expected)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/namespaces/paused?cluster=staging", nil)
+	req.SetBasicAuth("user-1", "secret")
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	var paused []*types.PausedNamespace
+	if err := json.Unmarshal(rec.Body.Bytes(), &paused); err != nil {
+		t.Fatalf("failed to decode paused namespaces: %s", err)
+	}
+	if len(paused) != 1 || paused[0].Cluster != "staging" || paused[0].Namespace != "keel-demo" {
+		t.Fatalf("unexpected paused namespaces: %+v", paused)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/namespaces/keel-demo/resume?cluster=staging", nil)
+	req.SetBasicAuth("user-1", "secret")
+	rec = httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	all, err := srv.store.ListPausedNamespaces()
+	if err != nil {
+		t.Fatalf("failed to list paused namespaces: %s", err)
+	}
+	if len(all) != 1 || all[0].Cluster != "" {
+		t.Errorf("expected the namespace to stay paused in the local cluster, got: %+v", all)
+	}
+}
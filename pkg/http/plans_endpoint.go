@@ -0,0 +1,22 @@
+package http
+
+import (
+	"net/http"
+)
+
+// plansHandler lists update plans computed for the latest events.
+// @Summary List update plans
+// @Description Returns update plans computed by providers for the latest events, newest first. Plans include updates skipped in dry-run mode (cluster wide DRY_RUN or the keel.sh/dryRun annotation) and updates waiting for approvals. This route exists only when the authenticator is enabled.
+// @Tags Admin
+// @ID listPlans
+// @Produce json
+// @Security BasicAuth
+// @Security BearerAuth
+// @Success 200 {array} types.Plan
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Permission denied"
+// @Router /v1/plans [get]
+func (s *TriggerServer) plansHandler(resp http.ResponseWriter, req *http.Request) {
+	plans := s.providers.Plans()
+	response(&plans, 200, nil, resp, req)
+}
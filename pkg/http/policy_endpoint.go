@@ -8,16 +8,18 @@ import (
 	"github.com/keel-hq/keel/types"
 )
 
-// ResourcePolicyUpdateRequest changes the update policy for a resource.
+// ResourcePolicyUpdateRequest changes the update policy for a resource, or
+// for a single container of it when Container is set.
 type ResourcePolicyUpdateRequest struct {
 	Policy     string `json:"policy"`
 	Identifier string `json:"identifier"`
+	Container  string `json:"container,omitempty"`
 	Provider   string `json:"provider"`
 }
 
 // policyUpdateHandler changes a resource update policy.
 // @Summary Update resource policy
-// @Description Updates the policy annotation for a Kubernetes resource. An empty policy removes the policy configuration. This route exists only when the authenticator is enabled.
+// @Description Updates the policy annotation for a Kubernetes resource. When container is set, keel.sh/<container>/policy is updated instead and the container no longer follows the resource policy. An empty policy removes the policy configuration. This route exists only when the authenticator is enabled.
 // @Tags Admin
 // @ID updateResourcePolicy
 // @Accept json
@@ -49,8 +51,24 @@ func (s *TriggerServer) policyUpdateHandler(resp http.ResponseWriter, req *http.
 		return
 	}
 
-	for _, v := range s.grc.Values() {
+	for _, v := range s.resources("") {
 		if v.Identifier == policyRequest.Identifier {
+			previous := v.DeepCopy()
+
+			if policyRequest.Container != "" {
+				ann := v.GetAnnotations()
+				key := types.ContainerAnnotation(policyRequest.Container, types.KeelPolicyLabel)
+				delete(ann, key)
+				if policyRequest.Policy != "" {
+					ann[key] = policyRequest.Policy
+				}
+				v.SetAnnotations(ann)
+
+				err := s.clientFor(v).Update(v, previous)
+
+				response(&APIResponse{Status: "updated"}, 200, err, resp, req)
+				return
+			}
 
 			labels := v.GetLabels()
 			delete(labels, types.KeelPolicyLabel)
@@ -66,7 +84,7 @@ func (s *TriggerServer) policyUpdateHandler(resp http.ResponseWriter, req *http.
 
 			v.SetAnnotations(ann)
 
-			err := s.kubernetesClient.Update(v)
+			err := s.clientFor(v).Update(v, previous)
 
 			response(&APIResponse{Status: "updated"}, 200, err, resp, req)
 			return
@@ -18,7 +18,7 @@ type recordingKubernetesImplementer struct {
 	updated *k8s.GenericResource
 }
 
-func (i *recordingKubernetesImplementer) Update(resource *k8s.GenericResource) error {
+func (i *recordingKubernetesImplementer) Update(resource, previous *k8s.GenericResource) error {
 	i.updated = resource
 	return nil
 }
@@ -71,3 +71,38 @@ func TestPolicyUpdateHandlerClearsPolicy(t *testing.T) {
 		}
 	}
 }
+
+func TestPolicyUpdateHandlerSetsContainerPolicy(t *testing.T) {
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:        "storefront",
+		Namespace:   "keel-demo",
+		Annotations: map[string]string{types.KeelPolicyLabel: "minor"},
+	}}
+	resource, err := k8s.NewGenericResource(deployment)
+	if err != nil {
+		t.Fatalf("create generic resource: %v", err)
+	}
+	cache := &k8s.GenericResourceCache{}
+	cache.Add(resource)
+	client := &recordingKubernetesImplementer{}
+	server := NewTriggerServer(&Opts{GRC: cache, KubernetesClient: client})
+
+	req := httptest.NewRequest(
+		http.MethodPut,
+		"/v1/policies",
+		bytes.NewBufferString(`{"identifier":"deployment/keel-demo/storefront","provider":"kubernetes","container":"proxy","policy":"patch"}`),
+	)
+	rec := httptest.NewRecorder()
+	server.policyUpdateHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: got %d, want %d", rec.Code, http.StatusOK)
+	}
+	annotations := client.updated.GetAnnotations()
+	if annotations["keel.sh/proxy/policy"] != "patch" {
+		t.Errorf("expected container policy to be set, got: %v", annotations)
+	}
+	if annotations[types.KeelPolicyLabel] != "minor" {
+		t.Errorf("expected resource policy to be kept, got: %v", annotations)
+	}
+}
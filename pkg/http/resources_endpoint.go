@@ -5,6 +5,7 @@ import (
 
 	"github.com/keel-hq/keel/internal/k8s"
 	"github.com/keel-hq/keel/internal/policy"
+	"github.com/keel-hq/keel/types"
 
 	"github.com/keel-hq/keel/provider/kubernetes"
 )
@@ -12,6 +13,7 @@ import (
 // ResourceResponse is the resource representation returned by the admin API.
 type ResourceResponse struct {
 	Provider    string            `json:"provider"`
+	Cluster     string            `json:"cluster,omitempty"`
 	Identifier  string            `json:"identifier"`
 	Name        string            `json:"name"`
 	Namespace   string            `json:"namespace"`
@@ -21,22 +23,67 @@ type ResourceResponse struct {
 	Labels      map[string]string `json:"labels"`
 	Annotations map[string]string `json:"annotations"`
 	Status      k8s.Status        `json:"status"`
+	// Deferred - update waiting for the update window, if any
+	Deferred *types.DeferredUpdate `json:"deferred,omitempty"`
+	// Paused - updates are paused through the keel.sh/paused annotation or
+	// the namespace
+	Paused bool `json:"paused"`
+	// Available - newest versions found while the resource is paused
+	Available []*types.AvailableUpdate `json:"available,omitempty"`
 }
 
 // resourcesHandler lists Kubernetes resources known to Keel.
 // @Summary List resources
-// @Description Returns monitored Kubernetes resources, or JSON null when the source slice is nil. This route exists only when the authenticator is enabled.
+// @Description Returns monitored Kubernetes resources of every managed cluster, or of the cluster given in the cluster parameter, or JSON null when the source slice is nil. Updates deferred until the keel.sh/updateWindow of a resource opens (or a freeze period ends) are reported in its deferred field. Resources paused through the keel.sh/paused annotation or their namespace report the newest versions found since in the available field. This route exists only when the authenticator is enabled.
 // @Tags Admin
 // @ID listResources
 // @Produce json
 // @Security BasicAuth
 // @Security BearerAuth
+// @Param cluster query string false "Resources of the cluster only"
 // @Success 200 {array} ResourceResponse
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Store query failed"
 // @Router /v1/resources [get]
 func (s *TriggerServer) resourcesHandler(resp http.ResponseWriter, req *http.Request) {
 
-	vals := s.grc.Values()
+	vals := s.resources(req.URL.Query().Get("cluster"))
+
+	// updates are keyed by provider and identifier, every cluster has its
+	// own kubernetes provider
+	deferred := make(map[string]*types.DeferredUpdate)
+	if s.store != nil {
+		updates, err := s.store.ListDeferredUpdates(&types.DeferredUpdateQuery{})
+		if err != nil {
+			response(nil, 500, err, resp, req)
+			return
+		}
+		for _, update := range updates {
+			deferred[update.Provider+" "+update.Identifier] = update
+		}
+	}
+
+	pausedNamespaces := make(map[string]bool)
+	available := make(map[string][]*types.AvailableUpdate)
+	if s.store != nil {
+		namespaces, err := s.store.ListPausedNamespaces()
+		if err != nil {
+			response(nil, 500, err, resp, req)
+			return
+		}
+		for _, ns := range namespaces {
+			pausedNamespaces[k8s.ClusterIdentifier(ns.Cluster, ns.Namespace)] = true
+		}
+		updates, err := s.store.ListAvailableUpdates(&types.AvailableUpdateQuery{})
+		if err != nil {
+			response(nil, 500, err, resp, req)
+			return
+		}
+		for _, update := range updates {
+			key := update.Provider + " " + update.Identifier
+			available[key] = append(available[key], update)
+		}
+	}
 
 	var res []ResourceResponse
 
@@ -44,9 +91,17 @@ func (s *TriggerServer) resourcesHandler(resp http.ResponseWriter, req *http.Req
 
 		p := policy.GetPolicyFromLabelsOrAnnotations(v.GetLabels(), v.GetAnnotations())
 		filterFunc := kubernetes.GetMonitorContainersFromMeta(v.GetLabels(), v.GetAnnotations())
+		paused := pausedNamespaces[k8s.ClusterIdentifier(v.Cluster, v.Namespace)] || kubernetes.IsPausedFromMeta(v.GetLabels(), v.GetAnnotations())
+		key := kubernetes.ProviderNameFor(v.Cluster) + " " + v.Identifier
+
+		var versions []*types.AvailableUpdate
+		if paused {
+			versions = available[key]
+		}
 
 		res = append(res, ResourceResponse{
 			Provider:    "kubernetes",
+			Cluster:     v.Cluster,
 			Identifier:  v.Identifier,
 			Name:        v.Name,
 			Namespace:   v.Namespace,
@@ -56,6 +111,9 @@ func (s *TriggerServer) resourcesHandler(resp http.ResponseWriter, req *http.Req
 			Annotations: v.GetAnnotations(),
 			Images:      v.GetImages(filterFunc),
 			Status:      v.GetStatus(),
+			Deferred:    deferred[key],
+			Paused:      paused,
+			Available:   versions,
 		})
 	}
 
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/keel-hq/keel/types"
+)
+
+// stagesHandler lists versions running in promotion stages.
+// @Summary List promotion stages
+// @Description Returns the version of every image running in each promotion stage (keel.sh/stage), whether all resources of the stage run it with a completed rollout and since when. Resources with keel.sh/promoteAfter are updated to a version once it has been healthy in their previous stage for keel.sh/soakTime. This route exists only when the authenticator is enabled.
+// @Tags Admin
+// @ID listStages
+// @Produce json
+// @Security BasicAuth
+// @Security BearerAuth
+// @Success 200 {array} types.StageVersion
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Permission denied"
+// @Failure 500 {string} string "Store query failed"
+// @Router /v1/stages [get]
+func (s *TriggerServer) stagesHandler(resp http.ResponseWriter, req *http.Request) {
+	versions, err := s.store.ListStageVersions(&types.StageVersionQuery{})
+	if versions == nil {
+		versions = []*types.StageVersion{}
+	}
+	response(&versions, 200, err, resp, req)
+}
@@ -12,9 +12,11 @@ import (
 // TrackedImage is the polling configuration returned for a tracked image.
 type TrackedImage struct {
 	Image        string `json:"image"`
+	Container    string `json:"container,omitempty"`
 	Trigger      string `json:"trigger"`
 	PollSchedule string `json:"pollSchedule"`
 	Provider     string `json:"provider"`
+	Cluster      string `json:"cluster,omitempty"`
 	Namespace    string `json:"namespace"`
 	Policy       string `json:"policy"`
 	Registry     string `json:"registry"`
@@ -22,12 +24,13 @@ type TrackedImage struct {
 
 // trackedHandler lists tracked images.
 // @Summary List tracked images
-// @Description Returns image polling configuration, or JSON null when the source slice is nil. This route exists only when the authenticator is enabled.
+// @Description Returns image polling configuration of every managed cluster, or of the cluster given in the cluster parameter, or JSON null when the source slice is nil. This route exists only when the authenticator is enabled.
 // @Tags Admin
 // @ID listTrackedImages
 // @Produce json
 // @Security BasicAuth
 // @Security BearerAuth
+// @Param cluster query string false "Images of the cluster only"
 // @Success 200 {array} TrackedImage
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 403 {string} string "Permission denied"
@@ -35,15 +38,21 @@ type TrackedImage struct {
 // @Router /v1/tracked [get]
 func (s *TriggerServer) trackedHandler(resp http.ResponseWriter, req *http.Request) {
 	trackedImages, err := s.providers.TrackedImages()
+	cluster := req.URL.Query().Get("cluster")
 
 	var imgs []TrackedImage
 
 	for _, img := range trackedImages {
+		if cluster != "" && img.Cluster != cluster {
+			continue
+		}
 		imgs = append(imgs, TrackedImage{
 			Image:        img.Image.Name(),
+			Container:    img.Container,
 			Trigger:      img.Trigger.String(),
 			PollSchedule: img.PollSchedule,
 			Provider:     img.Provider,
+			Cluster:      img.Cluster,
 			Namespace:    img.Namespace,
 			Policy:       img.Policy.Name(),
 			Registry:     img.Image.Registry(),
@@ -53,17 +62,19 @@ func (s *TriggerServer) trackedHandler(resp http.ResponseWriter, req *http.Reque
 	response(&imgs, 200, err, resp, req)
 }
 
-// TrackRequest changes the trigger and polling schedule for a resource.
+// TrackRequest changes the trigger and polling schedule for a resource. When
+// Container is set, the schedule applies to that container only.
 type TrackRequest struct {
 	Provider   string `json:"provider"`
 	Identifier string `json:"identifier"`
+	Container  string `json:"container,omitempty"`
 	Trigger    string `json:"trigger"`
 	Schedule   string `json:"schedule"`
 }
 
 // trackSetHandler changes tracking for a resource.
 // @Summary Update image tracking
-// @Description Sets the trigger and polling schedule for a Kubernetes resource. This route exists only when the authenticator is enabled.
+// @Description Sets the trigger and polling schedule for a Kubernetes resource. When container is set, the polling schedule is stored in keel.sh/<container>/pollSchedule and applies to that container only, the trigger is always set for the whole resource. This route exists only when the authenticator is enabled.
 // @Tags Admin
 // @ID updateTrackedImage
 // @Accept json
@@ -118,8 +129,9 @@ func (s *TriggerServer) trackSetHandler(resp http.ResponseWriter, req *http.Requ
 		trackReq.Schedule = types.KeelPollDefaultSchedule
 	}
 
-	for _, v := range s.grc.Values() {
+	for _, v := range s.resources("") {
 		if v.Identifier == trackReq.Identifier {
+			previous := v.DeepCopy()
 
 			labels := v.GetLabels()
 			delete(labels, types.KeelTriggerLabel)
@@ -127,11 +139,15 @@ func (s *TriggerServer) trackSetHandler(resp http.ResponseWriter, req *http.Requ
 
 			ann := v.GetAnnotations()
 			ann[types.KeelTriggerLabel] = trackReq.Trigger
-			ann[types.KeelPollScheduleAnnotation] = trackReq.Schedule
+			if trackReq.Container != "" {
+				ann[types.ContainerAnnotation(trackReq.Container, types.KeelPollScheduleAnnotation)] = trackReq.Schedule
+			} else {
+				ann[types.KeelPollScheduleAnnotation] = trackReq.Schedule
+			}
 
 			v.SetAnnotations(ann)
 
-			err := s.kubernetesClient.Update(v)
+			err := s.clientFor(v).Update(v, previous)
 
 			response(&APIResponse{Status: "updated"}, 200, err, resp, req)
 			return
@@ -62,6 +62,7 @@ func (s *SQLStore) ListApprovals(q *types.GetApprovalQuery) ([]*types.Approval,
 	err := s.db.Order("updated_at desc").Where(&types.Approval{
 		Identifier: q.Identifier,
 		Archived:   q.Archived,
+		Cluster:    q.Cluster,
 	}).Find(&approvals).Error
 	return approvals, err
 }
@@ -3,8 +3,10 @@ package sql
 import (
 	"fmt"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
 	"github.com/keel-hq/keel/types"
 )
 
@@ -41,12 +43,17 @@ func (s *SQLStore) GetAuditLogs(query *types.AuditLogQuery) (logs []*types.Audit
 		query.Order = "created_at desc"
 	}
 
+	db := s.db
+	if query.Cluster != "" {
+		db = whereCluster(db, query.Cluster)
+	}
+
 	if len(query.ResourceKindFilter) == 1 && query.ResourceKindFilter[0] == "*" {
-		err = s.db.Order(query.Order).Limit(query.Limit).Offset(query.Offset).Find(&logs).Error
+		err = db.Order(query.Order).Limit(query.Limit).Offset(query.Offset).Find(&logs).Error
 	} else if query.Username != "" {
-		err = s.db.Order(query.Order).Where("resource_kind in (?)", query.ResourceKindFilter).Limit(query.Limit).Offset(query.Offset).Where("username = ?", query.Username).Find(&logs).Error
+		err = db.Order(query.Order).Where("resource_kind in (?)", query.ResourceKindFilter).Limit(query.Limit).Offset(query.Offset).Where("username = ?", query.Username).Find(&logs).Error
 	} else {
-		err = s.db.Order(query.Order).Where("resource_kind in (?)", query.ResourceKindFilter).Limit(query.Limit).Offset(query.Offset).Find(&logs).Error
+		err = db.Order(query.Order).Where("resource_kind in (?)", query.ResourceKindFilter).Limit(query.Limit).Offset(query.Offset).Find(&logs).Error
 	}
 
 	return logs, err
@@ -56,16 +63,29 @@ func (s *SQLStore) AuditLogsCount(query *types.AuditLogQuery) (int, error) {
 	var err error
 	var count int
 
+	db := s.db.Model(&types.AuditLog{})
+	if query.Cluster != "" {
+		db = whereCluster(db, query.Cluster)
+	}
+
 	if len(query.ResourceKindFilter) == 1 && query.ResourceKindFilter[0] == "*" {
-		err = s.db.Model(&types.AuditLog{}).Count(&count).Error
+		err = db.Count(&count).Error
 	} else if query.Username != "" {
-		err = s.db.Model(&types.AuditLog{}).Where("resource_kind in (?)", query.ResourceKindFilter).Where("username = ?", query.Username).Count(&count).Error
+		err = db.Where("resource_kind in (?)", query.ResourceKindFilter).Where("username = ?", query.Username).Count(&count).Error
 	} else {
-		err = s.db.Model(&types.AuditLog{}).Where("resource_kind in (?)", query.ResourceKindFilter).Count(&count).Error
+		err = db.Where("resource_kind in (?)", query.ResourceKindFilter).Count(&count).Error
 	}
 	return count, err
 }
 
+// whereCluster filters entries of resources in the cluster, identifiers are
+// prefixed by the cluster name. Prefixes are compared as is, LIKE would treat
+// % and _ in the name as wildcards and ignore the case.
+func whereCluster(db *gorm.DB, cluster string) *gorm.DB {
+	prefix := cluster + "/"
+	return db.Where("substr(identifier, 1, ?) = ?", utf8.RuneCountInString(prefix), prefix)
+}
+
 var logsWeeklyStats = `SELECT day, COALESCE(updates, 0) AS updates, COALESCE(approved, 0) as approved
 FROM  (SELECT ? - d AS day FROM generate_series (0, 6) d) d  -- 6, not 7
 LEFT   JOIN (
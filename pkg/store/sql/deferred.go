@@ -0,0 +1,54 @@
+package sql
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/keel-hq/keel/types"
+)
+
+// CreateDeferredUpdate - stores an update deferred until its window opens
+func (s *SQLStore) CreateDeferredUpdate(update *types.DeferredUpdate) (*types.DeferredUpdate, error) {
+	if update.ID == "" {
+		update.ID = uuid.New().String()
+	}
+
+	tx := s.db.Begin()
+	if err := tx.Create(update).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	tx.Commit()
+
+	return update, nil
+}
+
+func (s *SQLStore) UpdateDeferredUpdate(update *types.DeferredUpdate) error {
+	if update.ID == "" {
+		return fmt.Errorf("ID not specified")
+	}
+	return s.db.Save(update).Error
+}
+
+// ListDeferredUpdates - deferred updates, the ones due first go first
+func (s *SQLStore) ListDeferredUpdates(q *types.DeferredUpdateQuery) ([]*types.DeferredUpdate, error) {
+	var updates []*types.DeferredUpdate
+	db := s.db.Order("not_before").Where(&types.DeferredUpdate{
+		Provider:   q.Provider,
+		Identifier: q.Identifier,
+	})
+	if !q.Due.IsZero() {
+		db = db.Where("not_before <= ?", q.Due)
+	}
+	err := db.Find(&updates).Error
+	return updates, err
+}
+
+func (s *SQLStore) DeleteDeferredUpdate(update *types.DeferredUpdate) error {
+	if update.ID == "" {
+		return fmt.Errorf("ID not specified")
+	}
+	return s.db.Delete(update).Error
+}
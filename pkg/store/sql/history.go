@@ -0,0 +1,55 @@
+package sql
+
+import (
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github.com/keel-hq/keel/pkg/store"
+	"github.com/keel-hq/keel/types"
+)
+
+// CreateUpdateRecord - stores an applied update
+func (s *SQLStore) CreateUpdateRecord(record *types.UpdateRecord) (*types.UpdateRecord, error) {
+	if record.ID == "" {
+		record.ID = uuid.New().String()
+	}
+
+	tx := s.db.Begin()
+	if err := tx.Create(record).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	tx.Commit()
+
+	return record, nil
+}
+
+// GetUpdateRecord - get applied update by ID
+func (s *SQLStore) GetUpdateRecord(q *types.UpdateRecordQuery) (*types.UpdateRecord, error) {
+	var result types.UpdateRecord
+	err := s.db.Where(&types.UpdateRecord{
+		ID:         q.ID,
+		Identifier: q.Identifier,
+	}).First(&result).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, store.ErrRecordNotFound
+	}
+
+	return &result, err
+}
+
+// ListUpdateRecords - applied updates of a resource, newest first
+func (s *SQLStore) ListUpdateRecords(q *types.UpdateRecordQuery) ([]*types.UpdateRecord, error) {
+	limit := q.Limit
+	if limit == 0 {
+		limit = -1
+	}
+
+	var records []*types.UpdateRecord
+	err := s.db.Order("created_at desc").Where(&types.UpdateRecord{
+		ID:         q.ID,
+		Identifier: q.Identifier,
+	}).Limit(limit).Find(&records).Error
+	return records, err
+}
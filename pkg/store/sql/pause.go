@@ -0,0 +1,79 @@
+package sql
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/keel-hq/keel/types"
+)
+
+// CreatePausedNamespace - pauses updates of the namespace
+func (s *SQLStore) CreatePausedNamespace(paused *types.PausedNamespace) (*types.PausedNamespace, error) {
+	if paused.ID == "" {
+		paused.ID = uuid.New().String()
+	}
+
+	tx := s.db.Begin()
+	if err := tx.Create(paused).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	tx.Commit()
+
+	return paused, nil
+}
+
+func (s *SQLStore) ListPausedNamespaces() ([]*types.PausedNamespace, error) {
+	var paused []*types.PausedNamespace
+	err := s.db.Order("namespace").Find(&paused).Error
+	return paused, err
+}
+
+func (s *SQLStore) DeletePausedNamespace(paused *types.PausedNamespace) error {
+	if paused.ID == "" {
+		return fmt.Errorf("ID not specified")
+	}
+	return s.db.Delete(paused).Error
+}
+
+// CreateAvailableUpdate - stores the newest version found for a paused resource
+func (s *SQLStore) CreateAvailableUpdate(update *types.AvailableUpdate) (*types.AvailableUpdate, error) {
+	if update.ID == "" {
+		update.ID = uuid.New().String()
+	}
+
+	tx := s.db.Begin()
+	if err := tx.Create(update).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	tx.Commit()
+
+	return update, nil
+}
+
+func (s *SQLStore) UpdateAvailableUpdate(update *types.AvailableUpdate) error {
+	if update.ID == "" {
+		return fmt.Errorf("ID not specified")
+	}
+	return s.db.Save(update).Error
+}
+
+func (s *SQLStore) ListAvailableUpdates(q *types.AvailableUpdateQuery) ([]*types.AvailableUpdate, error) {
+	var updates []*types.AvailableUpdate
+	err := s.db.Order("identifier, repository").Where(&types.AvailableUpdate{
+		Provider:   q.Provider,
+		Identifier: q.Identifier,
+	}).Find(&updates).Error
+	return updates, err
+}
+
+func (s *SQLStore) DeleteAvailableUpdate(update *types.AvailableUpdate) error {
+	if update.ID == "" {
+		return fmt.Errorf("ID not specified")
+	}
+	return s.db.Delete(update).Error
+}
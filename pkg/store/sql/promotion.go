@@ -0,0 +1,50 @@
+package sql
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/keel-hq/keel/types"
+)
+
+// CreateStageVersion - stores the version running in a promotion stage
+func (s *SQLStore) CreateStageVersion(version *types.StageVersion) (*types.StageVersion, error) {
+	if version.ID == "" {
+		version.ID = uuid.New().String()
+	}
+
+	tx := s.db.Begin()
+	if err := tx.Create(version).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	tx.Commit()
+
+	return version, nil
+}
+
+func (s *SQLStore) UpdateStageVersion(version *types.StageVersion) error {
+	if version.ID == "" {
+		return fmt.Errorf("ID not specified")
+	}
+	return s.db.Save(version).Error
+}
+
+func (s *SQLStore) ListStageVersions(q *types.StageVersionQuery) ([]*types.StageVersion, error) {
+	var versions []*types.StageVersion
+	err := s.db.Order("stage, repository").Where(&types.StageVersion{
+		Provider:   q.Provider,
+		Stage:      q.Stage,
+		Repository: q.Repository,
+	}).Find(&versions).Error
+	return versions, err
+}
+
+func (s *SQLStore) DeleteStageVersion(version *types.StageVersion) error {
+	if version.ID == "" {
+		return fmt.Errorf("ID not specified")
+	}
+	return s.db.Delete(version).Error
+}
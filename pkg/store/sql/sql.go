@@ -34,6 +34,11 @@ func New(opts Opts) (*SQLStore, error) {
 	err = db.AutoMigrate(
 		&types.Approval{},
 		&types.AuditLog{},
+		&types.UpdateRecord{},
+		&types.DeferredUpdate{},
+		&types.PausedNamespace{},
+		&types.AvailableUpdate{},
+		&types.StageVersion{},
 	).Error
 	if err != nil {
 		log.WithFields(log.Fields{
@@ -42,6 +47,17 @@ func New(opts Opts) (*SQLStore, error) {
 		return nil, err
 	}
 
+	// paused namespaces used to be unique across clusters
+	if db.Dialect().HasIndex("paused_namespaces", "uix_paused_namespaces_namespace") {
+		err = db.Model(&types.PausedNamespace{}).RemoveIndex("uix_paused_namespaces_namespace").Error
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Error("database migration failed ")
+			return nil, err
+		}
+	}
+
 	return &SQLStore{
 		db: db,
 	}, nil
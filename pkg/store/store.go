@@ -18,6 +18,29 @@ type Store interface {
 	ListApprovals(q *types.GetApprovalQuery) ([]*types.Approval, error)
 	DeleteApproval(approval *types.Approval) error
 
+	CreateUpdateRecord(record *types.UpdateRecord) (*types.UpdateRecord, error)
+	GetUpdateRecord(q *types.UpdateRecordQuery) (*types.UpdateRecord, error)
+	ListUpdateRecords(q *types.UpdateRecordQuery) ([]*types.UpdateRecord, error)
+
+	CreateDeferredUpdate(update *types.DeferredUpdate) (*types.DeferredUpdate, error)
+	UpdateDeferredUpdate(update *types.DeferredUpdate) error
+	ListDeferredUpdates(q *types.DeferredUpdateQuery) ([]*types.DeferredUpdate, error)
+	DeleteDeferredUpdate(update *types.DeferredUpdate) error
+
+	CreatePausedNamespace(paused *types.PausedNamespace) (*types.PausedNamespace, error)
+	ListPausedNamespaces() ([]*types.PausedNamespace, error)
+	DeletePausedNamespace(paused *types.PausedNamespace) error
+
+	CreateAvailableUpdate(update *types.AvailableUpdate) (*types.AvailableUpdate, error)
+	UpdateAvailableUpdate(update *types.AvailableUpdate) error
+	ListAvailableUpdates(q *types.AvailableUpdateQuery) ([]*types.AvailableUpdate, error)
+	DeleteAvailableUpdate(update *types.AvailableUpdate) error
+
+	CreateStageVersion(version *types.StageVersion) (*types.StageVersion, error)
+	UpdateStageVersion(version *types.StageVersion) error
+	ListStageVersions(q *types.StageVersionQuery) ([]*types.StageVersion, error)
+	DeleteStageVersion(version *types.StageVersion) error
+
 	OK() bool
 	Close() error
 }
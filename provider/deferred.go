@@ -0,0 +1,122 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/keel-hq/keel/internal/window"
+	"github.com/keel-hq/keel/types"
+)
+
+// DeferredCheckInterval - how often providers look for deferred updates
+// whose update window opened
+const DeferredCheckInterval = time.Minute
+
+// DeferredStore - persists updates deferred until their update window opens
+type DeferredStore interface {
+	CreateDeferredUpdate(update *types.DeferredUpdate) (*types.DeferredUpdate, error)
+	UpdateDeferredUpdate(update *types.DeferredUpdate) error
+	ListDeferredUpdates(q *types.DeferredUpdateQuery) ([]*types.DeferredUpdate, error)
+	DeleteDeferredUpdate(update *types.DeferredUpdate) error
+}
+
+// DeferredQueue - decides whether updates can be applied now, given the
+// update window of the resource and the global freeze calendar, and keeps
+// the ones that can't until they can. A resource has at most one deferred
+// update, the latest one.
+type DeferredQueue struct {
+	provider string
+	store    DeferredStore
+	freezes  []window.Freeze
+}
+
+// NewDeferredQueue - new queue of the provider, without a store updates
+// outside of their window are skipped instead of deferred
+func NewDeferredQueue(provider string, store DeferredStore, freezes []window.Freeze) *DeferredQueue {
+	return &DeferredQueue{
+		provider: provider,
+		store:    store,
+		freezes:  freezes,
+	}
+}
+
+// NextOpen returns when updates with the update window spec (empty when
+// the resource has none) are allowed, now if they already are
+func (q *DeferredQueue) NextOpen(spec string, now time.Time) (time.Time, error) {
+	var windows window.Windows
+	if spec != "" {
+		var err error
+		windows, err = window.Parse(spec)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return window.Next(windows, q.freezes, now)
+}
+
+// Defer stores the update, replacing the one already deferred for the
+// resource. It reports whether the update is new, so it's announced once
+// even though polling finds it again and again.
+func (q *DeferredQueue) Defer(update *types.DeferredUpdate) (created bool, err error) {
+	if q.store == nil {
+		return false, fmt.Errorf("no store to defer updates")
+	}
+	update.Provider = q.provider
+
+	existing, err := q.store.ListDeferredUpdates(&types.DeferredUpdateQuery{
+		Provider:   q.provider,
+		Identifier: update.Identifier,
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(existing) == 0 {
+		_, err = q.store.CreateDeferredUpdate(update)
+		return err == nil, err
+	}
+
+	current := existing[0]
+	created = current.NewVersion != update.NewVersion || !current.NotBefore.Equal(update.NotBefore)
+	update.ID = current.ID
+	update.CreatedAt = current.CreatedAt
+	return created, q.store.UpdateDeferredUpdate(update)
+}
+
+// Due removes and returns updates whose window opened by now
+func (q *DeferredQueue) Due(now time.Time) ([]*types.DeferredUpdate, error) {
+	if q.store == nil {
+		return nil, nil
+	}
+	due, err := q.store.ListDeferredUpdates(&types.DeferredUpdateQuery{
+		Provider: q.provider,
+		Due:      now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, update := range due {
+		if err := q.store.DeleteDeferredUpdate(update); err != nil {
+			return nil, err
+		}
+	}
+	return due, nil
+}
+
+// DueEvents - events of the due updates, each submitted once even when it
+// was deferred for several resources
+func DueEvents(updates []*types.DeferredUpdate) []*types.Event {
+	var events []*types.Event
+	seen := make(map[string]bool)
+	for _, update := range updates {
+		if update.Event == nil {
+			continue
+		}
+		key := update.Event.TriggerName + " " + update.Event.Repository.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		events = append(events, update.Event)
+	}
+	return events
+}
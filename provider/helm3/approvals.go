@@ -81,8 +81,29 @@ func (p *Provider) isApproved(event *types.Event, plan *UpdatePlan) (bool, error
 				plan.Name,
 				approval.Delta(),
 			)
+			if plan.ChartVersion != "" {
+				approval.Message = fmt.Sprintf("New chart version is available for release %s/%s (%s).",
+					plan.Namespace,
+					plan.Name,
+					approval.Delta(),
+				)
+			}
+
+			diff, err := p.manifestDiff(plan)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":        err,
+					"release_name": plan.Name,
+					"namespace":    plan.Namespace,
+				}).Warn("provider.helm3: failed to diff release manifest, requesting approval without it")
+			}
+			approval.Diff = diff
 
-			return false, p.approvalManager.Create(approval)
+			if err := p.approvalManager.Create(approval); err != nil {
+				return false, err
+			}
+			p.notifyApprovalRequired(plan, approval)
+			return false, nil
 		}
 
 		return false, err
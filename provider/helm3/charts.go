@@ -0,0 +1,221 @@
+package helm3
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keel-hq/keel/types"
+
+	"github.com/rusenask/cron"
+	"helm.sh/helm/v3/pkg/release"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// chartCheckInterval - how often releases are checked for a due chart
+// repository poll
+var chartCheckInterval = 30 * time.Second
+
+// chartReference - repository/name identifying a tracked chart in events
+func chartReference(details *ChartDetails) string {
+	return strings.TrimSuffix(details.Repository, "/") + "/" + details.Name
+}
+
+// releaseChartConfig returns the keel configuration of a release tracking
+// its chart, the chart name defaults to the chart of the release
+func releaseChartConfig(rel *release.Release, configs map[string]string) (*KeelChartConfig, bool) {
+	if rel.Chart == nil || rel.Chart.Metadata == nil {
+		return nil, false
+	}
+	vals, err := values(rel.Chart, rel.Config)
+	if err == nil {
+		vals, err = mergeKeelConfig(vals, configs[releaseConfigKey(rel.Namespace, rel.Name)])
+	}
+	if err != nil {
+		return nil, false
+	}
+	cfg, err := getKeelConfig(vals)
+	if err != nil || cfg.Chart == nil || cfg.Chart.Repository == "" {
+		return nil, false
+	}
+	if cfg.Chart.Name == "" {
+		cfg.Chart.Name = rel.Chart.Metadata.Name
+	}
+	if cfg.Chart.Plc.Type() == types.PolicyTypeNone {
+		return nil, false
+	}
+	return cfg, true
+}
+
+// watchCharts checks chart repositories until the provider stops. Chart
+// indexes and registries are slow to answer, so they are polled next to the
+// event loop and the events are submitted to it, like the poll trigger does.
+func (p *Provider) watchCharts() {
+	ticker := time.NewTicker(chartCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, event := range p.checkCharts() {
+				if err := p.Submit(*event); err != nil {
+					return
+				}
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// checkCharts polls chart repositories of releases that are due and returns
+// events for the newest chart versions their policies allow
+func (p *Provider) checkCharts() (events []*types.Event) {
+	releases, err := p.implementer.ListReleases()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("provider.helm3: failed to list releases for chart checks")
+		return nil
+	}
+
+	configs := p.loadReleaseConfigs()
+	now := time.Now()
+	for _, rel := range releases {
+		cfg, ok := releaseChartConfig(rel, configs)
+		if !ok {
+			continue
+		}
+
+		key := rel.Namespace + "/" + rel.Name
+		if next, ok := p.chartChecks[key]; ok && now.Before(next) {
+			continue
+		}
+		p.chartChecks[key] = nextChartCheck(cfg, now)
+
+		versions, err := p.implementer.ChartVersions(cfg.Chart.Repository, cfg.Chart.Name)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":      err,
+				"release":    rel.Name,
+				"namespace":  rel.Namespace,
+				"repository": cfg.Chart.Repository,
+				"chart":      cfg.Chart.Name,
+			}).Error("provider.helm3: failed to get chart versions")
+			continue
+		}
+
+		version, ok := newestChartVersion(cfg.Chart, rel.Chart.Metadata.Version, versions)
+		if !ok {
+			continue
+		}
+
+		events = append(events, &types.Event{
+			Repository:  types.Repository{Name: chartReference(cfg.Chart), Tag: version},
+			CreatedAt:   now,
+			TriggerName: types.TriggerTypePoll.String(),
+			Chart:       true,
+		})
+	}
+	return events
+}
+
+// nextChartCheck - when the chart repository is polled next, following the
+// chart or release poll schedule
+func nextChartCheck(cfg *KeelChartConfig, now time.Time) time.Time {
+	schedule := cfg.Chart.PollSchedule
+	if schedule == "" {
+		schedule = cfg.PollSchedule
+	}
+	if schedule == "" {
+		schedule = types.KeelPollDefaultSchedule
+	}
+	parsed, err := cron.Parse(schedule)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"schedule": schedule,
+		}).Error("provider.helm3: invalid chart poll schedule, using default")
+		parsed, _ = cron.Parse(types.KeelPollDefaultSchedule)
+	}
+	return parsed.Next(now)
+}
+
+// newestChartVersion returns the newest of versions the chart policy allows
+// updating current to
+func newestChartVersion(details *ChartDetails, current string, versions []string) (string, bool) {
+	for _, version := range details.Plc.Filter(versions) {
+		if version == current {
+			return "", false
+		}
+		update, err := details.Plc.ShouldUpdate(current, version)
+		if err != nil || !update {
+			continue
+		}
+		return version, true
+	}
+	return "", false
+}
+
+// createChartUpdatePlans - plans upgrading releases that track the chart of
+// the event to its version
+func createChartUpdatePlans(event *types.Event, releases []*release.Release, configs map[string]string) []*UpdatePlan {
+	var plans []*UpdatePlan
+	for _, rel := range releases {
+		cfg, ok := releaseChartConfig(rel, configs)
+		if !ok || chartReference(cfg.Chart) != event.Repository.Name {
+			continue
+		}
+
+		current := rel.Chart.Metadata.Version
+		update, err := cfg.Chart.Plc.ShouldUpdate(current, event.Repository.Tag)
+		if err != nil || !update {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"release":   rel.Name,
+				"namespace": rel.Namespace,
+				"current":   current,
+				"new":       event.Repository.Tag,
+				"policy":    cfg.Chart.Plc.Name(),
+			}).Debug("provider.helm3: chart version not allowed, ignoring")
+			continue
+		}
+
+		plans = append(plans, &UpdatePlan{
+			Namespace:      rel.Namespace,
+			Name:           rel.Name,
+			Config:         cfg,
+			Chart:          rel.Chart,
+			Values:         make(map[string]string),
+			CurrentVersion: current,
+			NewVersion:     event.Repository.Tag,
+			EmptyConfig:    rel.Config == nil,
+			ChartVersion:   event.Repository.Tag,
+			Manifest:       rel.Manifest,
+		})
+	}
+	return plans
+}
+
+// loadPlanChart downloads the chart version a plan upgrades the release to
+func (p *Provider) loadPlanChart(plan *UpdatePlan) error {
+	if plan.ChartVersion == "" {
+		return nil
+	}
+	chart, err := p.implementer.LoadChart(plan.Config.Chart.Repository, plan.Config.Chart.Name, plan.ChartVersion)
+	if err != nil {
+		return fmt.Errorf("failed to load chart %s version %s: %w", chartReference(plan.Config.Chart), plan.ChartVersion, err)
+	}
+	plan.Chart = chart
+	return nil
+}
+
+// planChanges - values and chart version changed by the plan, for messages
+func planChanges(plan *UpdatePlan) []string {
+	changes := mapToSlice(plan.Values)
+	if plan.ChartVersion != "" {
+		changes = append(changes, fmt.Sprintf("chart=%s-%s", plan.Config.Chart.Name, plan.ChartVersion))
+	}
+	return changes
+}
@@ -0,0 +1,189 @@
+package helm3
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keel-hq/keel/internal/policy"
+	"github.com/keel-hq/keel/types"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+
+	"github.com/stretchr/testify/require"
+)
+
+const chartTrackingValues = `
+image:
+  repository: gcr.io/v2-namespace/hello-world
+  tag: 1.1.0
+
+keel:
+  approvals: %d
+  chart:
+    repository: https://charts.example.com/stable/
+    policy: minor
+`
+
+func chartTrackingRelease(t *testing.T, approvals int) *release.Release {
+	c, err := testingStringToChart(fmt.Sprintf(chartTrackingValues, approvals))
+	if err != nil {
+		t.Fatalf("failed to create chart: %s", err)
+	}
+	c.Metadata.Version = "1.2.0"
+	return &release.Release{Name: "app", Namespace: "default", Chart: c}
+}
+
+func chartVersion(version string) *chart.Chart {
+	return &chart.Chart{Metadata: &chart.Metadata{Name: "app-x", Version: version}}
+}
+
+func TestNewestChartVersion(t *testing.T) {
+	details := &ChartDetails{Plc: policy.GetPolicy("minor", &policy.Options{})}
+	versions := []string{"1.2.0", "1.3.0", "1.4.1", "2.0.0", "1.1.0", "latest"}
+
+	version, ok := newestChartVersion(details, "1.2.0", versions)
+	if !ok || version != "1.4.1" {
+		t.Errorf("expected 1.4.1, got: %s, %t", version, ok)
+	}
+	if version, ok := newestChartVersion(details, "1.4.1", versions); ok {
+		t.Errorf("expected no update, got: %s", version)
+	}
+}
+
+func TestChartOnlyConfig(t *testing.T) {
+	rel := chartTrackingRelease(t, 0)
+	vals, err := values(rel.Chart, rel.Config)
+	if err != nil {
+		t.Fatalf("failed to get values: %s", err)
+	}
+	cfg, err := getKeelConfig(vals)
+	if err != nil {
+		t.Fatalf("chart policy should be enough: %s", err)
+	}
+	if cfg.Chart.Plc.Name() != "minor" {
+		t.Errorf("unexpected chart policy: %s", cfg.Chart.Plc.Name())
+	}
+	images, err := getImages(vals)
+	if err != nil || len(images) != 0 {
+		t.Errorf("images without a policy must not be tracked, got: %v, %v", images, err)
+	}
+
+	// image events leave the release alone
+	plan, update, err := checkRelease(&types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.2.0"}, rel.Namespace, rel.Name, rel.Chart, rel.Config, "")
+	if err != nil || update {
+		t.Errorf("unexpected image update: %+v, %v", plan, err)
+	}
+}
+
+// processChartEvents processes events of due chart checks the way the event
+// loop does
+func processChartEvents(t *testing.T, provider *Provider) {
+	t.Helper()
+	for _, event := range provider.checkCharts() {
+		if err := provider.processEvent(event); err != nil {
+			t.Fatalf("failed to process chart event: %s", err)
+		}
+	}
+}
+
+func TestCheckChartsUpgradesRelease(t *testing.T) {
+	rel := chartTrackingRelease(t, 0)
+	fakeImpl := &fakeImplementer{
+		listReleasesResponse: []*release.Release{rel},
+		charts: map[string]*chart.Chart{
+			"1.2.0": rel.Chart,
+			"1.3.0": chartVersion("1.3.0"),
+			"2.0.0": chartVersion("2.0.0"),
+		},
+	}
+	approver, teardown := approver()
+	defer teardown()
+	sender := &threadSafeSender{}
+	provider := NewProvider(fakeImpl, sender, approver)
+
+	processChartEvents(t, provider)
+
+	if fakeImpl.updatedRlsName != "app" || fakeImpl.updatedChart == nil || fakeImpl.updatedChart.Metadata.Version != "1.3.0" {
+		t.Fatalf("expected the release to be upgraded to chart 1.3.0, got: %s %+v", fakeImpl.updatedRlsName, fakeImpl.updatedChart)
+	}
+	last := sender.sent[len(sender.sent)-1]
+	if last.Type != types.NotificationReleaseUpdate || last.Level != types.LevelSuccess || !strings.Contains(last.Message, "1.2.0->1.3.0") {
+		t.Errorf("unexpected notification: %+v", last)
+	}
+
+	// the repository isn't polled again before the next scheduled check
+	processChartEvents(t, provider)
+	if fakeImpl.chartRequests != 1 {
+		t.Errorf("expected a single chart repository request, got: %d", fakeImpl.chartRequests)
+	}
+	provider.chartChecks["default/app"] = time.Now().Add(-time.Second)
+	processChartEvents(t, provider)
+	if fakeImpl.chartRequests != 2 {
+		t.Errorf("expected the repository to be polled again, got: %d requests", fakeImpl.chartRequests)
+	}
+}
+
+func TestChartChecksSubmittedToEventLoop(t *testing.T) {
+	defer func(interval time.Duration) { chartCheckInterval = interval }(chartCheckInterval)
+	chartCheckInterval = 5 * time.Millisecond
+
+	rel := chartTrackingRelease(t, 0)
+	fakeImpl := &fakeImplementer{
+		listReleasesResponse: []*release.Release{rel},
+		charts:               map[string]*chart.Chart{"1.3.0": chartVersion("1.3.0")},
+	}
+	approver, teardown := approver()
+	defer teardown()
+	provider := NewProvider(fakeImpl, &fakeSender{}, approver)
+
+	go provider.Start()
+	defer provider.Stop()
+
+	require.Eventually(t, func() bool {
+		fakeImpl.mu.Lock()
+		defer fakeImpl.mu.Unlock()
+		return fakeImpl.updatedChart != nil && fakeImpl.updatedChart.Metadata.Version == "1.3.0"
+	}, 5*time.Second, 5*time.Millisecond, "expected the release to be upgraded by the event loop")
+}
+
+func TestChartUpdateApproval(t *testing.T) {
+	rel := chartTrackingRelease(t, 1)
+	fakeImpl := &fakeImplementer{
+		listReleasesResponse: []*release.Release{rel},
+		charts:               map[string]*chart.Chart{"1.3.0": chartVersion("1.3.0")},
+	}
+	approver, teardown := approver()
+	defer teardown()
+	provider := NewProvider(fakeImpl, &fakeSender{}, approver)
+
+	processChartEvents(t, provider)
+
+	if fakeImpl.updatedChart != nil {
+		t.Fatal("the release must wait for approval")
+	}
+	approval, err := approver.Get("default/app:1.3.0")
+	if err != nil {
+		t.Fatalf("expected an approval: %s", err)
+	}
+	if !approval.Event.Chart || approval.Event.Repository.Name != "https://charts.example.com/stable/app-x" {
+		t.Errorf("unexpected approval event: %+v", approval.Event)
+	}
+	if !strings.Contains(approval.Message, "New chart version") {
+		t.Errorf("unexpected approval message: %s", approval.Message)
+	}
+
+	// approved events are processed like any other event
+	if _, err := approver.Approve("default/app:1.3.0", "user"); err != nil {
+		t.Fatalf("failed to approve: %s", err)
+	}
+	approval.Event.TriggerName = types.TriggerTypeApproval.String()
+	if err := provider.processEvent(approval.Event); err != nil {
+		t.Fatalf("failed to process event: %s", err)
+	}
+	if fakeImpl.updatedChart == nil || fakeImpl.updatedChart.Metadata.Version != "1.3.0" {
+		t.Errorf("expected the release to be upgraded after approval, got: %+v", fakeImpl.updatedChart)
+	}
+}
@@ -33,6 +33,12 @@ func getImages(vals chartutil.Values) ([]*types.TrackedImage, error) {
 	}
 
 	for _, imageDetails := range keelCfg.Images {
+		// only the chart or other images are tracked
+		plc := keelCfg.imagePolicy(&imageDetails)
+		if plc.Type() == types.PolicyTypeNone {
+			continue
+		}
+
 		imageRef, err := parseImage(vals, &imageDetails)
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -45,9 +51,9 @@ func getImages(vals chartutil.Values) ([]*types.TrackedImage, error) {
 
 		trackedImage := &types.TrackedImage{
 			Image:        imageRef,
-			PollSchedule: keelCfg.PollSchedule,
-			Trigger:      keelCfg.Trigger,
-			Policy:       keelCfg.Plc,
+			PollSchedule: keelCfg.imagePollSchedule(&imageDetails),
+			Trigger:      keelCfg.imageTrigger(&imageDetails),
+			Policy:       plc,
 		}
 
 		if imageDetails.ImagePullSecret != "" {
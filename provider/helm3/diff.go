@@ -0,0 +1,174 @@
+package helm3
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/keel-hq/keel/types"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/yaml"
+)
+
+// maxManifestDiff - longest manifest diff kept with an approval
+const maxManifestDiff = 32 << 10
+
+// manifestDiff renders the plan with a dry-run upgrade and returns the
+// unified diff of the deployed and the rendered release manifest
+func (p *Provider) manifestDiff(plan *UpdatePlan) (string, error) {
+	if err := p.loadPlanChart(plan); err != nil {
+		return "", err
+	}
+	rendered, err := p.implementer.DryRunUpgrade(plan.Name, plan.Chart, plan.Values, plan.Namespace, upgradeOptions(plan))
+	if err != nil {
+		return "", fmt.Errorf("failed to render release upgrade: %w", err)
+	}
+
+	deployed, renderedManifest := redactSecrets(plan.Manifest, rendered.Manifest)
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(deployed),
+		B:        difflib.SplitLines(renderedManifest),
+		FromFile: fmt.Sprintf("%s/%s %s", plan.Namespace, plan.Name, plan.CurrentVersion),
+		ToFile:   fmt.Sprintf("%s/%s %s", plan.Namespace, plan.Name, plan.NewVersion),
+		Context:  3,
+	})
+	if err != nil {
+		return "", err
+	}
+	return truncateDiff(diff, maxManifestDiff), nil
+}
+
+// truncateDiff cuts the diff to at most limit bytes on a rune boundary
+func truncateDiff(diff string, limit int) string {
+	if len(diff) <= limit {
+		return diff
+	}
+	for limit > 0 && !utf8.RuneStart(diff[limit]) {
+		limit--
+	}
+	return diff[:limit] + "\n... (truncated)\n"
+}
+
+// manifestSeparator - separates objects of a release manifest
+var manifestSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// redactSecrets replaces the data and stringData values of Secret objects in
+// both manifests, like helm-diff does. Values that differ between the
+// manifests are marked as changed so reviewers still see which keys change.
+func redactSecrets(deployed, rendered string) (string, string) {
+	deployedDocs := manifestSeparator.Split(deployed, -1)
+	renderedDocs := manifestSeparator.Split(rendered, -1)
+
+	deployedValues := secretValues(deployedDocs)
+	renderedValues := secretValues(renderedDocs)
+
+	return redactDocs(deployedDocs, deployedValues, renderedValues), redactDocs(renderedDocs, renderedValues, deployedValues)
+}
+
+// secretValues - data and stringData values of the Secret objects, keyed by
+// <namespace>/<name>/<field>/<key>
+func secretValues(docs []string) map[string]string {
+	values := make(map[string]string)
+	for _, doc := range docs {
+		secret, ok, _ := parseSecret(doc)
+		if !ok || secret == nil {
+			continue
+		}
+		for _, field := range []string{"data", "stringData"} {
+			entries, _ := secret[field].(map[string]interface{})
+			for key, value := range entries {
+				values[secretValueKey(secret, field, key)] = fmt.Sprint(value)
+			}
+		}
+	}
+	return values
+}
+
+func redactDocs(docs []string, values, other map[string]string) string {
+	redacted := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		secret, ok, err := parseSecret(doc)
+		if !ok {
+			redacted = append(redacted, doc)
+			continue
+		}
+		if err != nil {
+			// never let a Secret through unredacted
+			redacted = append(redacted, "\n"+leadingComments(doc)+"# Secret omitted, failed to parse it\n")
+			continue
+		}
+		for _, field := range []string{"data", "stringData"} {
+			entries, _ := secret[field].(map[string]interface{})
+			for key := range entries {
+				valueKey := secretValueKey(secret, field, key)
+				otherValue, found := other[valueKey]
+				if found && otherValue != values[valueKey] {
+					entries[key] = "REDACTED (changed)"
+				} else {
+					entries[key] = "REDACTED"
+				}
+			}
+		}
+		out, err := yaml.Marshal(secret)
+		if err != nil {
+			out = []byte("# Secret omitted, failed to redact it\n")
+		}
+		redacted = append(redacted, "\n"+leadingComments(doc)+string(out))
+	}
+	return strings.Join(redacted, "---")
+}
+
+// secretKind matches the kind of Secret objects
+var secretKind = regexp.MustCompile(`(?m)^kind:\s*["']?Secret["']?\s*$`)
+
+// parseSecret returns the object of a manifest document when it's a Secret,
+// err is set when the document looks like a Secret but can't be parsed
+func parseSecret(doc string) (secret map[string]interface{}, ok bool, err error) {
+	if !secretKind.MatchString(doc) {
+		return nil, false, nil
+	}
+	if err := yaml.Unmarshal([]byte(doc), &secret); err != nil {
+		return nil, true, err
+	}
+	if secret["kind"] != "Secret" {
+		return nil, false, nil
+	}
+	return secret, true, nil
+}
+
+func secretValueKey(secret map[string]interface{}, field, key string) string {
+	metadata, _ := secret["metadata"].(map[string]interface{})
+	return fmt.Sprintf("%v/%v/%s/%s", metadata["namespace"], metadata["name"], field, key)
+}
+
+// leadingComments - the # Source: comment helm puts before each object
+func leadingComments(doc string) string {
+	var comments strings.Builder
+	for _, line := range strings.Split(strings.TrimLeft(doc, "\n"), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		comments.WriteString(line + "\n")
+	}
+	return comments.String()
+}
+
+// notifyApprovalRequired - reports an update waiting for approvals along
+// with the manifest diff reviewers approve
+func (p *Provider) notifyApprovalRequired(plan *UpdatePlan, approval *types.Approval) {
+	p.sender.Send(types.EventNotification{
+		ResourceKind: "chart",
+		Identifier:   fmt.Sprintf("%s/%s/%s", "chart", plan.Namespace, plan.Name),
+		Name:         "approval required",
+		Message:      fmt.Sprintf("%s Approvals required: %d.", approval.Message, approval.VotesRequired),
+		CreatedAt:    time.Now(),
+		Type:         types.NotificationApprovalRequired,
+		Level:        types.LevelInfo,
+		Channels:     plan.Config.NotificationChannels,
+		Metadata:     releaseMetadata(plan, p.GetName()),
+		Diff:         approval.Diff,
+	})
+}
@@ -0,0 +1,135 @@
+package helm3
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/keel-hq/keel/types"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const approvalValues = `
+image:
+  repository: karolisr/webhook-demo
+  tag: 0.0.10
+
+keel:
+  policy: all
+  approvals: 1
+  images:
+    - repository: image.repository
+      tag: image.tag
+`
+
+func TestApprovalManifestDiff(t *testing.T) {
+	myChart, err := testingStringToChart(approvalValues)
+	if err != nil {
+		t.Fatalf("failed to create chart: %s", err)
+	}
+	fakeImpl := &fakeImplementer{
+		listReleasesResponse: []*release.Release{
+			{
+				Name:      "release-1",
+				Namespace: "default",
+				Chart:     myChart,
+				Version:   1,
+				Manifest:  "kind: Deployment\nspec:\n  image: karolisr/webhook-demo:0.0.10\n",
+			},
+		},
+		renderedManifest: "kind: Deployment\nspec:\n  image: karolisr/webhook-demo:0.0.11\n",
+	}
+	approver, teardown := approver()
+	defer teardown()
+	sender := &threadSafeSender{}
+	provider := NewProvider(fakeImpl, sender, approver)
+
+	err = provider.processEvent(&types.Event{
+		Repository: types.Repository{Name: "karolisr/webhook-demo", Tag: "0.0.11"},
+	})
+	if err != nil {
+		t.Fatalf("failed to process event: %s", err)
+	}
+	if fakeImpl.updatedChart != nil {
+		t.Fatal("the release must wait for approval")
+	}
+
+	approval, err := approver.Get("default/release-1:0.0.11")
+	if err != nil {
+		t.Fatalf("expected an approval: %s", err)
+	}
+	if !strings.Contains(approval.Diff, "-  image: karolisr/webhook-demo:0.0.10") || !strings.Contains(approval.Diff, "+  image: karolisr/webhook-demo:0.0.11") {
+		t.Errorf("unexpected diff: %s", approval.Diff)
+	}
+	if strings.Contains(approval.Diff, "-kind: Deployment") {
+		t.Errorf("unchanged lines must be context only: %s", approval.Diff)
+	}
+
+	last := sender.sent[len(sender.sent)-1]
+	if last.Type != types.NotificationApprovalRequired || last.Diff != approval.Diff {
+		t.Errorf("expected an approval notification with the diff, got: %+v", last)
+	}
+	if _, ok := last.Metadata["diff"]; ok {
+		t.Errorf("the diff must not be sent as metadata, senders print and store it: %+v", last.Metadata)
+	}
+}
+
+const secretManifest = `---
+# Source: app/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+  namespace: default
+data:
+  password: %s
+  username: YWRtaW4=
+stringData:
+  token: %s
+---
+# Source: app/templates/deployment.yaml
+kind: Deployment
+spec:
+  image: karolisr/webhook-demo:%s
+`
+
+func TestRedactSecrets(t *testing.T) {
+	deployed := fmt.Sprintf(secretManifest, "b2xkLXBhc3N3b3Jk", "old-token", "0.0.10")
+	rendered := fmt.Sprintf(secretManifest, "bmV3LXBhc3N3b3Jk", "old-token", "0.0.11")
+
+	redactedDeployed, redactedRendered := redactSecrets(deployed, rendered)
+	for _, manifest := range []string{redactedDeployed, redactedRendered} {
+		for _, secret := range []string{"b2xkLXBhc3N3b3Jk", "bmV3LXBhc3N3b3Jk", "YWRtaW4=", "old-token"} {
+			if strings.Contains(manifest, secret) {
+				t.Errorf("secret value %s not redacted:\n%s", secret, manifest)
+			}
+		}
+		if !strings.Contains(manifest, "# Source: app/templates/secret.yaml") {
+			t.Errorf("expected the source comment to be kept:\n%s", manifest)
+		}
+	}
+	if !strings.Contains(redactedRendered, "password: REDACTED (changed)") || !strings.Contains(redactedRendered, "username: REDACTED\n") {
+		t.Errorf("expected changed values to be marked:\n%s", redactedRendered)
+	}
+	if !strings.Contains(redactedRendered, "image: karolisr/webhook-demo:0.0.11") {
+		t.Errorf("other objects must be left alone:\n%s", redactedRendered)
+	}
+
+	// unparsable Secrets are left out
+	_, redacted := redactSecrets("", "kind: Secret\ndata: [password: c2VjcmV0\n")
+	if strings.Contains(redacted, "c2VjcmV0") {
+		t.Errorf("unparsable secret leaked:\n%s", redacted)
+	}
+}
+
+func TestTruncateDiff(t *testing.T) {
+	diff := truncateDiff(strings.Repeat("é", 10), 5)
+	if !utf8.ValidString(diff) || !strings.HasPrefix(diff, "éé\n") {
+		t.Errorf("unexpected truncated diff: %q", diff)
+	}
+	if diff := truncateDiff("short", 10); diff != "short" {
+		t.Errorf("unexpected diff: %q", diff)
+	}
+}
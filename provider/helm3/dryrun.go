@@ -0,0 +1,83 @@
+package helm3
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keel-hq/keel/provider"
+	"github.com/keel-hq/keel/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Plans - plans computed for the latest events
+func (p *Provider) Plans() []*types.Plan {
+	return p.plans.Plans()
+}
+
+func (p *Provider) isDryRun(plan *UpdatePlan) bool {
+	return p.dryRun || (plan.Config != nil && plan.Config.DryRun)
+}
+
+func (p *Provider) splitDryRunPlans(plans []*UpdatePlan) (live, dryRun []*UpdatePlan) {
+	return provider.SplitDryRunPlans(plans, p.isDryRun)
+}
+
+// previewPlans reports dry-run plans, releases are left untouched. Since the
+// release keeps running the old version, polling finds the same update again,
+// it is reported only once.
+func (p *Provider) previewPlans(plans []*UpdatePlan) {
+	for _, plan := range plans {
+		identifier := fmt.Sprintf("%s/%s/%s", "chart", plan.Namespace, plan.Name)
+		version := plan.NewVersion + "@" + plan.NewDigest
+		if p.previewed[identifier] == version {
+			continue
+		}
+		p.previewed[identifier] = version
+
+		currentVersion := formatVersionWithDigest(plan.CurrentVersion, plan.CurrentDigest)
+		newVersion := formatVersionWithDigest(plan.NewVersion, plan.NewDigest)
+
+		log.WithFields(log.Fields{
+			"name":      plan.Name,
+			"namespace": plan.Namespace,
+			"update":    fmt.Sprintf("%s->%s", currentVersion, newVersion),
+		}).Info("provider.helm3: dry-run, release would be updated")
+
+		metadata := releaseMetadata(plan, p.GetName())
+		metadata["dryRun"] = "true"
+
+		p.sender.Send(types.EventNotification{
+			ResourceKind: "chart",
+			Identifier:   identifier,
+			Name:         "dry-run update",
+			Message:      fmt.Sprintf("Would update release %s/%s %s->%s (%s)", plan.Namespace, plan.Name, currentVersion, newVersion, strings.Join(planChanges(plan), ", ")),
+			CreatedAt:    time.Now(),
+			Type:         types.NotificationWouldUpdate,
+			Level:        types.LevelInfo,
+			Channels:     plan.Config.NotificationChannels,
+			Metadata:     metadata,
+		})
+	}
+}
+
+// recordPlans stores plans computed for the event so they can be listed
+// through the API
+func (p *Provider) recordPlans(event *types.Event, plans, approved, dryRun []*UpdatePlan) {
+	provider.RecordPlans(p.plans, event, plans, approved, dryRun, p.describePlan)
+}
+
+func (p *Provider) describePlan(plan *UpdatePlan) *types.Plan {
+	return &types.Plan{
+		Provider:       p.GetName(),
+		Identifier:     fmt.Sprintf("%s/%s/%s", "chart", plan.Namespace, plan.Name),
+		Namespace:      plan.Namespace,
+		Name:           plan.Name,
+		CurrentVersion: plan.CurrentVersion,
+		NewVersion:     plan.NewVersion,
+		CurrentDigest:  plan.CurrentDigest,
+		NewDigest:      plan.NewDigest,
+		Changes:        planChanges(plan),
+	}
+}
@@ -0,0 +1,57 @@
+package helm3
+
+import (
+	"testing"
+
+	"github.com/keel-hq/keel/types"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestProcessEventDryRun(t *testing.T) {
+	chartVals := `
+image:
+  repository: karolisr/webhook-demo
+  tag: 0.0.10
+
+keel:
+  policy: all
+  dryRun: true
+  images:
+    - repository: image.repository
+      tag: image.tag
+`
+	myChart, err := testingStringToChart(chartVals)
+	if err != nil {
+		t.Fatalf("chartutil.ReadValues error = %v", err)
+	}
+
+	fakeImpl := &fakeImplementer{
+		listReleasesResponse: []*release.Release{
+			{Name: "release-1", Namespace: "default", Chart: myChart, Config: make(map[string]interface{})},
+		},
+	}
+
+	approver, teardown := approver()
+	defer teardown()
+	sender := &fakeSender{}
+	provider := NewProvider(fakeImpl, sender, approver)
+
+	err = provider.processEvent(&types.Event{
+		Repository: types.Repository{Name: "karolisr/webhook-demo", Tag: "0.0.11"},
+	})
+	if err != nil {
+		t.Fatalf("failed to process event, error: %s", err)
+	}
+
+	if fakeImpl.updatedRlsName != "" {
+		t.Errorf("release must not be updated in dry-run mode, got: %s", fakeImpl.updatedRlsName)
+	}
+	if sender.sentEvent.Type != types.NotificationWouldUpdate {
+		t.Errorf("expected would update notification, got: %s", sender.sentEvent.Type)
+	}
+	plans := provider.Plans()
+	if len(plans) != 1 || !plans[0].DryRun || plans[0].Identifier != "chart/default/release-1" || plans[0].NewVersion != "0.0.11" {
+		t.Errorf("unexpected plans: %+v", plans)
+	}
+}
@@ -49,7 +49,7 @@ type slowHelmImplementer struct {
 	updated []string
 }
 
-func (i *slowHelmImplementer) UpdateReleaseFromChart(rlsName string, chart *hapi_chart.Chart, vals map[string]string, namespace string, opts ...bool) (*release.Release, error) {
+func (i *slowHelmImplementer) UpdateReleaseFromChart(rlsName string, chart *hapi_chart.Chart, vals map[string]string, namespace string, opts UpgradeOptions) (*release.Release, error) {
 	time.Sleep(i.delay)
 	i.mu.Lock()
 	defer i.mu.Unlock()
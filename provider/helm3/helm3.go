@@ -3,6 +3,7 @@ package helm3
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/keel-hq/keel/internal/k8s"
 	"github.com/keel-hq/keel/internal/policy"
 	"github.com/keel-hq/keel/pkg/config"
+	"github.com/keel-hq/keel/provider"
 	"github.com/keel-hq/keel/types"
 	"github.com/keel-hq/keel/util/image"
 
@@ -124,6 +126,17 @@ type UpdatePlan struct {
 
 	// used as fix to bug in chartutil.coalesce v3.1.2
 	EmptyConfig bool
+
+	// ChartVersion - chart version the release is upgraded to, the chart is
+	// downloaded when the plan is applied. Empty for image updates.
+	ChartVersion string
+
+	// Revision - release revision deployed right before the upgrade, failed
+	// upgrades are rolled back to it. Read when the plan is applied as
+	// plans wait for approvals and update windows.
+	Revision int
+	// Manifest - manifest of the deployed release revision
+	Manifest string
 }
 
 // keel:
@@ -136,6 +149,11 @@ type UpdatePlan struct {
 //   images:
 //     - repository: image.repository
 //       tag: image.tag
+//   # chart to track, upgrades the release to new chart versions
+//   chart:
+//     repository: oci://registry.example.com/charts
+//     name: app
+//     policy: minor
 
 // Root - root element of the values yaml
 type Root struct {
@@ -153,8 +171,16 @@ type KeelChartConfig struct {
 	ApprovalDeadline     int               `json:"approvalDeadline"` // Deadline in hours
 	Images               []ImageDetails    `json:"images"`
 	NotificationChannels []string          `json:"notificationChannels"` // optional notification channels
-
-	Plc policy.Policy `json:"-"`
+	DryRun               bool              `json:"dryRun"`               // only report updates, never upgrade the release
+	UpdateWindow         string            `json:"updateWindow"`         // when updates may be applied, ie: Mon-Fri 09:00-17:00 Europe/London
+	Chart                *ChartDetails     `json:"chart"`                // chart repository to upgrade the release from
+	Wait                 bool              `json:"wait"`                 // wait for release resources to become ready
+	Atomic               bool              `json:"atomic"`               // helm rolls a failed upgrade back itself, implies wait
+	Timeout              string            `json:"timeout"`              // how long an upgrade may take, ie: 10m
+	MaxHistory           int               `json:"maxHistory"`           // revisions kept per release, 0 keeps all
+
+	Plc            policy.Policy `json:"-"`
+	UpgradeTimeout time.Duration `json:"-"`
 }
 
 // ImageDetails - image details
@@ -164,6 +190,27 @@ type ImageDetails struct {
 	DigestPath      string `json:"digest"`
 	ReleaseNotes    string `json:"releaseNotes"`
 	ImagePullSecret string `json:"imagePullSecret"`
+
+	// optional per-image settings, the release settings apply when not set
+	Policy          string            `json:"policy"`
+	MatchTag        *bool             `json:"matchTag"`
+	MatchPreRelease *bool             `json:"matchPreRelease"`
+	Trigger         types.TriggerType `json:"trigger"`
+	PollSchedule    string            `json:"pollSchedule"`
+}
+
+// ChartDetails - chart repository tracked for new chart versions
+type ChartDetails struct {
+	// Repository - chart repository URL (https://...) or OCI registry path
+	// (oci://...) the chart is published to
+	Repository string `json:"repository"`
+	// Name - chart name, defaults to the chart of the release
+	Name string `json:"name"`
+	// Policy - policy for chart versions, defaults to the release policy
+	Policy       string `json:"policy"`
+	PollSchedule string `json:"pollSchedule"`
+
+	Plc policy.Policy `json:"-"`
 }
 
 // Provider - helm3 provider, responsible for managing release updates
@@ -177,6 +224,23 @@ type Provider struct {
 
 	approvalManager approvals.Manager
 
+	// dryRun - plan and report updates without upgrading any release
+	dryRun bool
+	plans  *provider.PlanHistory
+	// previewed - latest version reported per release in dry-run mode,
+	// only accessed while processing events
+	previewed map[string]string
+
+	// deferred - updates waiting for their update window
+	deferred *provider.DeferredQueue
+
+	// chartChecks - next time the chart repository of a release is
+	// checked, only accessed by watchCharts
+	chartChecks map[string]time.Time
+
+	// releaseConfigs - keel configuration kept outside of release values
+	releaseConfigs ReleaseConfigs
+
 	events chan *types.Event
 	stop   chan struct{}
 }
@@ -205,12 +269,24 @@ func WithRunningDigests(runningDigests *k8s.RunningDigestResolver) ProviderOptio
 	}
 }
 
+// WithDryRun enables cluster wide dry-run mode, updates are planned and
+// reported but releases are never upgraded.
+func WithDryRun(dryRun bool) ProviderOption {
+	return func(provider *Provider) {
+		provider.dryRun = dryRun
+	}
+}
+
 // NewProvider - create new Helm provider
 func NewProvider(implementer Implementer, sender notification.Sender, approvalManager approvals.Manager, options ...ProviderOption) *Provider {
 	provider := &Provider{
 		implementer:     implementer,
 		approvalManager: approvalManager,
 		sender:          sender,
+		plans:           provider.NewPlanHistory(provider.DefaultPlanHistory),
+		previewed:       make(map[string]string),
+		chartChecks:     make(map[string]time.Time),
+		deferred:        provider.NewDeferredQueue(ProviderName, nil, nil),
 		events:          make(chan *types.Event, config.DefaultEventBufferSize),
 		stop:            make(chan struct{}),
 	}
@@ -295,10 +371,14 @@ func (p *Provider) TrackedImages() ([]*types.TrackedImage, error) {
 	if err != nil {
 		return nil, err
 	}
+	configs := p.loadReleaseConfigs()
 
 	for _, release := range releases {
 		// getting configuration
 		vals, err := values(release.Chart, release.Config)
+		if err == nil {
+			vals, err = mergeKeelConfig(vals, configs[releaseConfigKey(release.Namespace, release.Name)])
+		}
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error":     err,
@@ -308,8 +388,7 @@ func (p *Provider) TrackedImages() ([]*types.TrackedImage, error) {
 			continue
 		}
 
-		cfg, err := getKeelConfig(vals)
-		if err != nil {
+		if _, err := getKeelConfig(vals); err != nil {
 			log.WithFields(log.Fields{
 				"error":     err,
 				"release":   release.Name,
@@ -318,9 +397,6 @@ func (p *Provider) TrackedImages() ([]*types.TrackedImage, error) {
 			continue
 		}
 
-		if cfg.PollSchedule == "" {
-			cfg.PollSchedule = types.KeelPollDefaultSchedule
-		}
 		// used to check pod secrets
 		selector := fmt.Sprintf("app=%s,release=%s", release.Chart.Metadata.Name, release.Name)
 
@@ -335,6 +411,11 @@ func (p *Provider) TrackedImages() ([]*types.TrackedImage, error) {
 		}
 
 		for _, img := range releaseImages {
+			// images without their own or a release schedule are polled
+			// on the default one
+			if img.PollSchedule == "" {
+				img.PollSchedule = types.KeelPollDefaultSchedule
+			}
 			img.Meta = map[string]string{
 				"selector":      selector,
 				"helm.sh/chart": fmt.Sprintf("%s-%s", release.Chart.Metadata.Name, release.Chart.Metadata.Version),
@@ -357,6 +438,10 @@ func (p *Provider) startInternal() error {
 		"event_buffer_size": cap(p.events),
 	}).Info("provider.helm3: starting event loop")
 
+	deferredTicker := time.NewTicker(provider.DeferredCheckInterval)
+	defer deferredTicker.Stop()
+	go p.watchCharts()
+
 	for {
 		select {
 		case event := <-p.events:
@@ -368,6 +453,8 @@ func (p *Provider) startInternal() error {
 					"tag":   event.Repository.Tag,
 				}).Error("provider.helm3: failed to process event")
 			}
+		case <-deferredTicker.C:
+			p.processDeferred()
 		case <-p.stop:
 			log.Info("provider.helm3: got shutdown signal, stopping...")
 			return nil
@@ -381,7 +468,13 @@ func (p *Provider) processEvent(event *types.Event) (err error) {
 		return err
 	}
 
+	// dry-run plans are only reported, they don't wait for approvals
+	plans, previews := p.splitDryRunPlans(plans)
+	p.previewPlans(previews)
+
 	approved := p.checkForApprovals(event, plans)
+	p.recordPlans(event, plans, approved, previews)
+	approved = p.deferPlans(event, approved)
 
 	return p.applyPlans(approved)
 }
@@ -394,9 +487,14 @@ func (p *Provider) createUpdatePlans(event *types.Event) ([]*UpdatePlan, error)
 		return nil, err
 	}
 
+	configs := p.loadReleaseConfigs()
+	if event.Chart {
+		return createChartUpdatePlans(event, releases, configs), nil
+	}
+
 	for _, release := range releases {
 
-		plan, update, err := checkRelease(&event.Repository, release.Namespace, release.Name, release.Chart, release.Config)
+		plan, update, err := checkRelease(&event.Repository, release.Namespace, release.Name, release.Chart, release.Config, configs[releaseConfigKey(release.Namespace, release.Name)])
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error":     err,
@@ -407,6 +505,7 @@ func (p *Provider) createUpdatePlans(event *types.Event) ([]*UpdatePlan, error)
 		}
 
 		if update {
+			plan.Manifest = release.Manifest
 			// report the digest the release workloads are currently running
 			// so notifications can show the full image transition
 			if eventRepoRef, parseErr := image.Parse(event.Repository.String()); parseErr == nil {
@@ -459,7 +558,7 @@ func (p *Provider) applyPlan(plan *UpdatePlan) {
 		ResourceKind: "chart",
 		Identifier:   fmt.Sprintf("%s/%s/%s", "chart", plan.Namespace, plan.Name),
 		Name:         "update release",
-		Message:      fmt.Sprintf("Preparing to update release %s/%s %s->%s (%s)", plan.Namespace, plan.Name, currentVersion, newVersion, strings.Join(mapToSlice(plan.Values), ", ")),
+		Message:      fmt.Sprintf("Preparing to update release %s/%s %s->%s (%s)", plan.Namespace, plan.Name, currentVersion, newVersion, strings.Join(planChanges(plan), ", ")),
 		CreatedAt:    time.Now(),
 		Type:         types.NotificationPreReleaseUpdate,
 		Level:        types.LevelDebug,
@@ -467,8 +566,10 @@ func (p *Provider) applyPlan(plan *UpdatePlan) {
 		Metadata:     releaseMetadata(plan, p.GetName()),
 	})
 
-	// err := updateHelmRelease(p.implementer, plan.Name, plan.Chart, plan.Values)
-	err := updateHelmRelease(p.implementer, plan.Name, plan.Chart, plan.Values, plan.Namespace, plan.EmptyConfig)
+	err := p.loadPlanChart(plan)
+	if err == nil {
+		err = updateHelmRelease(p.implementer, plan)
+	}
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error":     err,
@@ -480,13 +581,14 @@ func (p *Provider) applyPlan(plan *UpdatePlan) {
 			ResourceKind: "chart",
 			Identifier:   fmt.Sprintf("%s/%s/%s", "chart", plan.Namespace, plan.Name),
 			Name:         "update release",
-			Message:      fmt.Sprintf("Release update failed %s/%s %s->%s (%s), error: %s", plan.Namespace, plan.Name, currentVersion, newVersion, strings.Join(mapToSlice(plan.Values), ", "), err),
+			Message:      fmt.Sprintf("Release update failed %s/%s %s->%s (%s), error: %s", plan.Namespace, plan.Name, currentVersion, newVersion, strings.Join(planChanges(plan), ", "), err),
 			CreatedAt:    time.Now(),
 			Type:         types.NotificationReleaseUpdate,
 			Level:        types.LevelError,
 			Channels:     plan.Config.NotificationChannels,
 			Metadata:     releaseMetadata(plan, p.GetName()),
 		})
+		p.rollbackRelease(plan, err)
 		return
 	}
 
@@ -500,9 +602,9 @@ func (p *Provider) applyPlan(plan *UpdatePlan) {
 
 	var msg string
 	if len(plan.ReleaseNotes) == 0 {
-		msg = fmt.Sprintf("Successfully updated release %s/%s %s->%s (%s)", plan.Namespace, plan.Name, currentVersion, newVersion, strings.Join(mapToSlice(plan.Values), ", "))
+		msg = fmt.Sprintf("Successfully updated release %s/%s %s->%s (%s)", plan.Namespace, plan.Name, currentVersion, newVersion, strings.Join(planChanges(plan), ", "))
 	} else {
-		msg = fmt.Sprintf("Successfully updated release %s/%s %s->%s (%s). Release notes: %s", plan.Namespace, plan.Name, currentVersion, newVersion, strings.Join(mapToSlice(plan.Values), ", "), strings.Join(plan.ReleaseNotes, ", "))
+		msg = fmt.Sprintf("Successfully updated release %s/%s %s->%s (%s). Release notes: %s", plan.Namespace, plan.Name, currentVersion, newVersion, strings.Join(planChanges(plan), ", "), strings.Join(plan.ReleaseNotes, ", "))
 	}
 
 	p.sender.Send(types.EventNotification{
@@ -518,27 +620,77 @@ func (p *Provider) applyPlan(plan *UpdatePlan) {
 	})
 }
 
-func updateHelmRelease(implementer Implementer, releaseName string, chart *hapi_chart.Chart, overrideValues map[string]string, namespace string, opts ...bool) error {
-
-	// set reuse values to false if currentRelease.config is nil
-	emptyConfig := false
-	if len(opts) == 1 && opts[0] {
-		emptyConfig = opts[0]
+func updateHelmRelease(implementer Implementer, plan *UpdatePlan) error {
+	deployed, err := implementer.GetRelease(plan.Name, plan.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get deployed release: %w", err)
 	}
-	resp, err := implementer.UpdateReleaseFromChart(releaseName, chart, overrideValues, namespace, emptyConfig)
+	plan.Revision = deployed.Version
 
+	resp, err := implementer.UpdateReleaseFromChart(plan.Name, plan.Chart, plan.Values, plan.Namespace, upgradeOptions(plan))
 	if err != nil {
 		return err
 	}
 
 	log.WithFields(log.Fields{
 		"version":        resp.Version,
-		"release":        releaseName,
-		"overrideValues": overrideValues,
+		"release":        plan.Name,
+		"overrideValues": plan.Values,
 	}).Info("provider.helm3: release updated")
 	return nil
 }
 
+// upgradeOptions - upgrade settings of the release keel configuration
+func upgradeOptions(plan *UpdatePlan) UpgradeOptions {
+	return UpgradeOptions{
+		// reuse values only if currentRelease.config isn't nil
+		EmptyConfig: plan.EmptyConfig,
+		Wait:        plan.Config.Wait,
+		Atomic:      plan.Config.Atomic,
+		Timeout:     plan.Config.UpgradeTimeout,
+		MaxHistory:  plan.Config.MaxHistory,
+	}
+}
+
+// rollbackRelease rolls a release back to the revision the failed plan was
+// created from. Atomic upgrades are rolled back by helm already.
+func (p *Provider) rollbackRelease(plan *UpdatePlan, updateErr error) {
+	if plan.Config.Atomic || plan.Revision == 0 {
+		return
+	}
+
+	currentVersion := formatVersionWithDigest(plan.CurrentVersion, plan.CurrentDigest)
+	newVersion := formatVersionWithDigest(plan.NewVersion, plan.NewDigest)
+	metadata := releaseMetadata(plan, p.GetName())
+	metadata["rollbackReason"] = updateErr.Error()
+	metadata["revision"] = strconv.Itoa(plan.Revision)
+
+	level := types.LevelWarn
+	msg := fmt.Sprintf("Release %s/%s rolled back to revision %d after failed update %s->%s", plan.Namespace, plan.Name, plan.Revision, currentVersion, newVersion)
+	if err := p.implementer.RollbackRelease(plan.Name, plan.Namespace, plan.Revision); err != nil {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"name":      plan.Name,
+			"namespace": plan.Namespace,
+			"revision":  plan.Revision,
+		}).Error("provider.helm3: failed to roll back release")
+		level = types.LevelError
+		msg = fmt.Sprintf("Release %s/%s rollback to revision %d after failed update %s->%s failed, error: %s", plan.Namespace, plan.Name, plan.Revision, currentVersion, newVersion, err)
+	}
+
+	p.sender.Send(types.EventNotification{
+		ResourceKind: "chart",
+		Identifier:   fmt.Sprintf("%s/%s/%s", "chart", plan.Namespace, plan.Name),
+		Name:         "rollback release",
+		Message:      msg,
+		CreatedAt:    time.Now(),
+		Type:         types.NotificationDeploymentRollback,
+		Level:        level,
+		Channels:     plan.Config.NotificationChannels,
+		Metadata:     metadata,
+	})
+}
+
 func mapToSlice(values map[string]string) []string {
 	converted := []string{}
 	for k, v := range values {
@@ -617,13 +769,78 @@ func getKeelConfig(vals chartutil.Values) (*KeelChartConfig, error) {
 		return nil, fmt.Errorf("failed to parse keel config: %s", err)
 	}
 
-	if r.Keel.Policy == "" {
+	if r.Keel.Policy == "" && (r.Keel.Chart == nil || r.Keel.Chart.Policy == "") && !hasImagePolicy(r.Keel.Images) {
 		return nil, ErrPolicyNotSpecified
 	}
 
 	cfg := r.Keel
 
 	cfg.Plc = policy.GetPolicy(cfg.Policy, &policy.Options{MatchTag: cfg.MatchTag, MatchPreRelease: cfg.MatchPreRelease})
+	if cfg.Chart != nil {
+		chartPolicy := cfg.Chart.Policy
+		if chartPolicy == "" {
+			chartPolicy = cfg.Policy
+		}
+		cfg.Chart.Plc = policy.GetPolicy(chartPolicy, &policy.Options{MatchPreRelease: cfg.MatchPreRelease})
+	}
+
+	if cfg.Timeout != "" {
+		timeout, err := time.ParseDuration(cfg.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid upgrade timeout '%s'", cfg.Timeout)
+		}
+		cfg.UpgradeTimeout = timeout
+	}
+	if cfg.MaxHistory < 0 {
+		return nil, fmt.Errorf("maxHistory cannot be negative")
+	}
 
 	return &cfg, nil
 }
+
+func hasImagePolicy(images []ImageDetails) bool {
+	for _, details := range images {
+		if details.Policy != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// imagePolicy - policy of an image, its own settings override the release
+// ones
+func (cfg *KeelChartConfig) imagePolicy(details *ImageDetails) policy.Policy {
+	if details.Policy == "" && details.MatchTag == nil && details.MatchPreRelease == nil {
+		return cfg.Plc
+	}
+
+	name := details.Policy
+	if name == "" {
+		name = cfg.Policy
+	}
+	opts := &policy.Options{MatchTag: cfg.MatchTag, MatchPreRelease: cfg.MatchPreRelease}
+	if details.MatchTag != nil {
+		opts.MatchTag = *details.MatchTag
+	}
+	if details.MatchPreRelease != nil {
+		opts.MatchPreRelease = *details.MatchPreRelease
+	}
+	return policy.GetPolicy(name, opts)
+}
+
+// imageTrigger - trigger of an image, defaults to the release trigger
+func (cfg *KeelChartConfig) imageTrigger(details *ImageDetails) types.TriggerType {
+	if details.Trigger != types.TriggerTypeDefault {
+		return details.Trigger
+	}
+	return cfg.Trigger
+}
+
+// imagePollSchedule - poll schedule of an image, defaults to the release
+// schedule
+func (cfg *KeelChartConfig) imagePollSchedule(details *ImageDetails) string {
+	if details.PollSchedule != "" {
+		return details.PollSchedule
+	}
+	return cfg.PollSchedule
+}
@@ -1,12 +1,16 @@
 package helm3
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/keel-hq/keel/approvals"
 	"github.com/keel-hq/keel/extension/notification"
@@ -70,21 +74,39 @@ type fakeImplementer struct {
 	// updated info
 	updatedRlsName string
 	updatedChart   *chart.Chart
-	// updatedOptions []helm.UpdateOption
+	updatedOptions UpgradeOptions
+	// updateErr - error returned by upgrades
+	updateErr error
+
+	// rolled back revisions
+	rollbacks []int
+	// deployedRevision - revision returned by GetRelease when the release
+	// was upgraded after ListReleases
+	deployedRevision int
+
+	// manifest rendered by dry-run upgrades
+	renderedManifest string
+
+	// chart repository contents, by version
+	charts        map[string]*chart.Chart
+	chartRequests int
 }
 
 func (i *fakeImplementer) ListReleases() ([]*release.Release, error) {
 	return i.listReleasesResponse, nil
 }
 
-func (i *fakeImplementer) UpdateReleaseFromChart(rlsName string, chart *chart.Chart, vals map[string]string, namespace string, opts ...bool) (*release.Release, error) {
-	// func (i *fakeImplementer) UpdateReleaseFromChart(rlsName string, chart *chart.Chart, opts ...helm.UpdateOption) (*rls.UpdateReleaseResponse, error) {
+func (i *fakeImplementer) UpdateReleaseFromChart(rlsName string, chart *chart.Chart, vals map[string]string, namespace string, opts UpgradeOptions) (*release.Release, error) {
 	i.mu.Lock()
 	i.updatedRlsName = rlsName
 	i.updatedChart = chart
-	// i.updatedOptions = opts
+	i.updatedOptions = opts
 	i.mu.Unlock()
 
+	if i.updateErr != nil {
+		return nil, i.updateErr
+	}
+
 	return &release.Release{
 		Name:    rlsName,
 		Chart:   chart,
@@ -92,6 +114,51 @@ func (i *fakeImplementer) UpdateReleaseFromChart(rlsName string, chart *chart.Ch
 	}, nil
 }
 
+func (i *fakeImplementer) GetRelease(rlsName, namespace string) (*release.Release, error) {
+	for _, rel := range i.listReleasesResponse {
+		if rel.Name != rlsName || rel.Namespace != namespace {
+			continue
+		}
+		if i.deployedRevision != 0 {
+			deployed := *rel
+			deployed.Version = i.deployedRevision
+			return &deployed, nil
+		}
+		return rel, nil
+	}
+	return &release.Release{Name: rlsName, Namespace: namespace, Version: 1}, nil
+}
+
+func (i *fakeImplementer) DryRunUpgrade(rlsName string, chart *chart.Chart, vals map[string]string, namespace string, opts UpgradeOptions) (*release.Release, error) {
+	return &release.Release{Name: rlsName, Chart: chart, Manifest: i.renderedManifest}, nil
+}
+
+func (i *fakeImplementer) RollbackRelease(rlsName, namespace string, revision int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.rollbacks = append(i.rollbacks, revision)
+	return nil
+}
+
+func (i *fakeImplementer) ChartVersions(repository, name string) ([]string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.chartRequests++
+	var versions []string
+	for version := range i.charts {
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+func (i *fakeImplementer) LoadChart(repository, name, version string) (*chart.Chart, error) {
+	c, ok := i.charts[version]
+	if !ok {
+		return nil, fmt.Errorf("chart %s version %s not found", name, version)
+	}
+	return c, nil
+}
+
 // helper function to generate keel configuration
 func testingConfigYaml(cfg *KeelChartConfig) (vals chartutil.Values, err error) {
 	root := &Root{Keel: *cfg}
@@ -747,3 +814,107 @@ keel:
 		t.Errorf("policy not found")
 	}
 }
+
+const upgradeValues = `
+image:
+  repository: karolisr/webhook-demo
+  tag: 0.0.10
+
+keel:
+  policy: all
+  wait: true
+  atomic: %t
+  timeout: 10m
+  maxHistory: 5
+  images:
+    - repository: image.repository
+      tag: image.tag
+`
+
+func upgradeRelease(t *testing.T, atomic bool, updateErr error, deployedRevision int) (*fakeImplementer, *threadSafeSender) {
+	myChart, err := testingStringToChart(fmt.Sprintf(upgradeValues, atomic))
+	if err != nil {
+		t.Fatalf("failed to create chart: %s", err)
+	}
+	fakeImpl := &fakeImplementer{
+		listReleasesResponse: []*release.Release{
+			{Name: "release-1", Namespace: "default", Chart: myChart, Config: make(map[string]interface{}), Version: 3},
+		},
+		updateErr:        updateErr,
+		deployedRevision: deployedRevision,
+	}
+
+	approver, teardown := approver()
+	defer teardown()
+	sender := &threadSafeSender{}
+	provider := NewProvider(fakeImpl, sender, approver)
+
+	err = provider.processEvent(&types.Event{
+		Repository: types.Repository{Name: "karolisr/webhook-demo", Tag: "0.0.11"},
+	})
+	if err != nil {
+		t.Fatalf("failed to process event, error: %s", err)
+	}
+	return fakeImpl, sender
+}
+
+func TestUpgradeOptions(t *testing.T) {
+	fakeImpl, _ := upgradeRelease(t, true, nil, 0)
+
+	expected := UpgradeOptions{Wait: true, Atomic: true, Timeout: 10 * time.Minute, MaxHistory: 5}
+	if fakeImpl.updatedOptions != expected {
+		t.Errorf("unexpected upgrade options: %+v", fakeImpl.updatedOptions)
+	}
+
+	vals, err := chartutil.ReadValues([]byte("keel:\n  policy: all\n  timeout: soon\n"))
+	if err != nil {
+		t.Fatalf("failed to read values: %s", err)
+	}
+	if _, err := getKeelConfig(vals); err == nil {
+		t.Error("expected an invalid timeout error")
+	}
+}
+
+func TestFailedUpgradeRollsBack(t *testing.T) {
+	fakeImpl, sender := upgradeRelease(t, false, errors.New("timed out waiting for the condition"), 0)
+
+	if len(fakeImpl.rollbacks) != 1 || fakeImpl.rollbacks[0] != 3 {
+		t.Fatalf("expected a rollback to revision 3, got: %v", fakeImpl.rollbacks)
+	}
+
+	var failed bool
+	for _, event := range sender.sent {
+		if event.Type == types.NotificationReleaseUpdate && event.Level == types.LevelError && strings.Contains(event.Message, "timed out") {
+			failed = true
+		}
+	}
+	if !failed {
+		t.Error("expected an update failure notification")
+	}
+	last := sender.sent[len(sender.sent)-1]
+	if last.Type != types.NotificationDeploymentRollback || last.Metadata["revision"] != "3" {
+		t.Errorf("expected a rollback notification, got: %+v", last)
+	}
+}
+
+func TestFailedUpgradeRollsBackToDeployedRevision(t *testing.T) {
+	// release was upgraded to revision 5 after the plan was created
+	fakeImpl, _ := upgradeRelease(t, false, errors.New("timed out waiting for the condition"), 5)
+
+	if len(fakeImpl.rollbacks) != 1 || fakeImpl.rollbacks[0] != 5 {
+		t.Fatalf("expected a rollback to revision 5, got: %v", fakeImpl.rollbacks)
+	}
+}
+
+func TestFailedAtomicUpgrade(t *testing.T) {
+	fakeImpl, sender := upgradeRelease(t, true, errors.New("timed out waiting for the condition"), 0)
+
+	// helm rolls atomic upgrades back itself
+	if len(fakeImpl.rollbacks) != 0 {
+		t.Errorf("unexpected rollbacks: %v", fakeImpl.rollbacks)
+	}
+	last := sender.sent[len(sender.sent)-1]
+	if last.Type != types.NotificationReleaseUpdate || last.Level != types.LevelError {
+		t.Errorf("expected an update failure notification, got: %+v", last)
+	}
+}
@@ -1,11 +1,18 @@
 package helm3
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"strings"
 	"time"
 
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
 
 	log "github.com/sirupsen/logrus"
 
@@ -28,9 +35,39 @@ const DefaultUpdateTimeout = 5 * time.Minute
 type Implementer interface {
 	// ListReleases(opts ...helm.ReleaseListOption) ([]*release.Release, error)
 	ListReleases() ([]*release.Release, error)
-	UpdateReleaseFromChart(rlsName string, chart *chart.Chart, vals map[string]string, namespace string, opts ...bool) (*release.Release, error)
+	UpdateReleaseFromChart(rlsName string, chart *chart.Chart, vals map[string]string, namespace string, opts UpgradeOptions) (*release.Release, error)
+	// GetRelease - the latest revision of a release
+	GetRelease(rlsName, namespace string) (*release.Release, error)
+	// DryRunUpgrade - render the release upgrade without applying it
+	DryRunUpgrade(rlsName string, chart *chart.Chart, vals map[string]string, namespace string, opts UpgradeOptions) (*release.Release, error)
+	// RollbackRelease - roll the release back to a revision
+	RollbackRelease(rlsName, namespace string, revision int) error
+	// ChartVersions - versions of a chart in a chart repository or OCI registry
+	ChartVersions(repository, name string) ([]string, error)
+	// LoadChart - download a chart version
+	LoadChart(repository, name, version string) (*chart.Chart, error)
 }
 
+// UpgradeOptions - how a release is upgraded
+type UpgradeOptions struct {
+	// EmptyConfig - the release has no user supplied values, they are not
+	// reused (fix for a bug in chartutil.coalesce v3.1.2)
+	EmptyConfig bool
+	// Wait - wait for the release resources to become ready
+	Wait bool
+	// Atomic - helm rolls the release back when the upgrade fails, implies
+	// Wait
+	Atomic bool
+	// Timeout - how long the upgrade may take, DefaultUpdateTimeout when
+	// not set
+	Timeout time.Duration
+	// MaxHistory - revisions kept per release, 0 keeps all
+	MaxHistory int
+}
+
+// chartDownloadTimeout - timeout of chart repository requests
+const chartDownloadTimeout = time.Minute
+
 // Helm3Implementer - actual helm3 implementer
 type Helm3Implementer struct {
 	// actionConfig *action.Configuration
@@ -52,30 +89,26 @@ func NewHelm3Implementer() *Helm3Implementer {
 
 // ListReleases - list available releases
 func (i *Helm3Implementer) ListReleases() ([]*release.Release, error) {
-	actionConfig := i.generateConfig("")
+	actionConfig, err := i.generateConfig("")
+	if err != nil {
+		return nil, err
+	}
 	client := action.NewList(actionConfig)
 	results, err := client.Run()
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
-		}).Fatal("helm3: failed to list release")
+		}).Error("helm3: failed to list release")
 		return []*release.Release{}, err
 	}
 	return results, nil
 }
 
 // UpdateReleaseFromChart - update release from chart
-func (i *Helm3Implementer) UpdateReleaseFromChart(rlsName string, chart *chart.Chart, vals map[string]string, namespace string, opts ...bool) (*release.Release, error) {
-	actionConfig := i.generateConfig(namespace)
-	client := action.NewUpgrade(actionConfig)
-	client.Namespace = namespace
-	client.Force = true
-	client.Timeout = DefaultUpdateTimeout
-	client.ReuseValues = true
-
-	// set reuse values to false if currentRelease.config is nil (temp fix for bug in chartutil.coalesce v3.1.2)
-	if len(opts) == 1 && opts[0] {
-		client.ReuseValues = false
+func (i *Helm3Implementer) UpdateReleaseFromChart(rlsName string, chart *chart.Chart, vals map[string]string, namespace string, opts UpgradeOptions) (*release.Release, error) {
+	client, err := i.newUpgrade(namespace, opts)
+	if err != nil {
+		return nil, err
 	}
 
 	convertedVals := convertToInterface(vals)
@@ -85,13 +118,173 @@ func (i *Helm3Implementer) UpdateReleaseFromChart(rlsName string, chart *chart.C
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
-		}).Fatal("helm3: failed to update release from chart")
+		}).Error("helm3: failed to update release from chart")
 		return nil, err
 	}
 	return results, err
 }
 
-func (i *Helm3Implementer) generateConfig(namespace string) *action.Configuration {
+// GetRelease - the latest revision of a release
+func (i *Helm3Implementer) GetRelease(rlsName, namespace string) (*release.Release, error) {
+	actionConfig, err := i.generateConfig(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return action.NewGet(actionConfig).Run(rlsName)
+}
+
+// DryRunUpgrade - render the release upgrade, the returned release holds
+// the manifest it would deploy
+func (i *Helm3Implementer) DryRunUpgrade(rlsName string, chart *chart.Chart, vals map[string]string, namespace string, opts UpgradeOptions) (*release.Release, error) {
+	client, err := i.newUpgrade(namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	client.DryRun = true
+	return client.Run(rlsName, chart, convertToInterface(vals))
+}
+
+func (i *Helm3Implementer) newUpgrade(namespace string, opts UpgradeOptions) (*action.Upgrade, error) {
+	actionConfig, err := i.generateConfig(namespace)
+	if err != nil {
+		return nil, err
+	}
+	client := action.NewUpgrade(actionConfig)
+	client.Namespace = namespace
+	client.Force = true
+	client.Timeout = DefaultUpdateTimeout
+	if opts.Timeout > 0 {
+		client.Timeout = opts.Timeout
+	}
+	client.Wait = opts.Wait
+	client.Atomic = opts.Atomic
+	client.MaxHistory = opts.MaxHistory
+
+	// set reuse values to false if currentRelease.config is nil (temp fix for bug in chartutil.coalesce v3.1.2)
+	client.ReuseValues = !opts.EmptyConfig
+	return client, nil
+}
+
+// RollbackRelease - roll the release back to a revision, nothing is done
+// when the revision is already deployed (ie: helm rolled back an atomic
+// upgrade)
+func (i *Helm3Implementer) RollbackRelease(rlsName, namespace string, revision int) error {
+	actionConfig, err := i.generateConfig(namespace)
+	if err != nil {
+		return err
+	}
+
+	current, err := action.NewGet(actionConfig).Run(rlsName)
+	if err == nil && current.Version == revision && current.Info != nil && current.Info.Status == release.StatusDeployed {
+		return nil
+	}
+
+	client := action.NewRollback(actionConfig)
+	client.Version = revision
+	client.Timeout = DefaultUpdateTimeout
+	if err := client.Run(rlsName); err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"release":  rlsName,
+			"revision": revision,
+		}).Error("helm3: failed to roll back release")
+		return err
+	}
+	return nil
+}
+
+// ChartVersions - versions of a chart, read from the index.yaml of a chart
+// repository or the tags of an oci:// repository
+func (i *Helm3Implementer) ChartVersions(repository, name string) ([]string, error) {
+	if registry.IsOCI(repository) {
+		client, err := registry.NewClient()
+		if err != nil {
+			return nil, err
+		}
+		return client.Tags(strings.TrimPrefix(ociChartRef(repository, name), registry.OCIScheme+"://"))
+	}
+
+	index, err := loadRepositoryIndex(repository)
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, version := range index.Entries[name] {
+		versions = append(versions, version.Version)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("chart %s not found in repository %s", name, repository)
+	}
+	return versions, nil
+}
+
+// LoadChart - download a chart version from a chart repository or an oci://
+// repository
+func (i *Helm3Implementer) LoadChart(repository, name, version string) (*chart.Chart, error) {
+	if registry.IsOCI(repository) {
+		client, err := registry.NewClient()
+		if err != nil {
+			return nil, err
+		}
+		result, err := client.Pull(strings.TrimPrefix(ociChartRef(repository, name), registry.OCIScheme+"://") + ":" + version)
+		if err != nil {
+			return nil, err
+		}
+		return loader.LoadArchive(bytes.NewReader(result.Chart.Data))
+	}
+
+	index, err := loadRepositoryIndex(repository)
+	if err != nil {
+		return nil, err
+	}
+	chartVersion, err := index.Get(name, version)
+	if err != nil {
+		return nil, err
+	}
+	if len(chartVersion.URLs) == 0 {
+		return nil, fmt.Errorf("chart %s version %s has no download URL", name, version)
+	}
+	chartURL, err := repo.ResolveReferenceURL(repository, chartVersion.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+	httpGetter, err := getter.NewHTTPGetter(getter.WithTimeout(chartDownloadTimeout))
+	if err != nil {
+		return nil, err
+	}
+	archive, err := httpGetter.Get(chartURL)
+	if err != nil {
+		return nil, err
+	}
+	return loader.LoadArchive(archive)
+}
+
+func ociChartRef(repository, name string) string {
+	return strings.TrimSuffix(repository, "/") + "/" + name
+}
+
+func loadRepositoryIndex(repository string) (*repo.IndexFile, error) {
+	httpGetter, err := getter.NewHTTPGetter(getter.WithTimeout(chartDownloadTimeout))
+	if err != nil {
+		return nil, err
+	}
+	indexURL, err := repo.ResolveReferenceURL(repository, "index.yaml")
+	if err != nil {
+		return nil, err
+	}
+	data, err := httpGetter.Get(indexURL)
+	if err != nil {
+		return nil, err
+	}
+	index := &repo.IndexFile{}
+	if err := yaml.Unmarshal(data.Bytes(), index); err != nil {
+		return nil, fmt.Errorf("failed to parse index of %s: %w", repository, err)
+	}
+	index.SortEntries()
+	return index, nil
+}
+
+func (i *Helm3Implementer) generateConfig(namespace string) (*action.Configuration, error) {
 	// settings := cli.New()
 	config := &genericclioptions.ConfigFlags{
 		Namespace:   &namespace,
@@ -103,11 +296,14 @@ func (i *Helm3Implementer) generateConfig(namespace string) *action.Configuratio
 	actionConfig := &action.Configuration{}
 
 	if err := actionConfig.Init(config, namespace, i.HelmDriver, log.Printf); err != nil {
-		log.Printf("%+v", err)
-		os.Exit(1)
+		log.WithFields(log.Fields{
+			"error":     err,
+			"namespace": namespace,
+		}).Error("helm3: failed to initialize helm configuration")
+		return nil, fmt.Errorf("failed to initialize helm configuration: %w", err)
 	}
 
-	return actionConfig
+	return actionConfig, nil
 }
 
 // convert map[string]string to map[string]interface
@@ -0,0 +1,108 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"sigs.k8s.io/yaml"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ReleaseConfigs - keel configuration of releases kept outside of their
+// values, ie: for third party charts that can't carry a keel section
+type ReleaseConfigs interface {
+	// Load returns the keel section of releases as YAML, keyed by
+	// <namespace>/<release name>
+	Load() (map[string]string, error)
+}
+
+// ConfigMapReleaseConfigs reads release configuration from a ConfigMap,
+// its keys are <namespace>.<release name> and values the keel section
+type ConfigMapReleaseConfigs struct {
+	configMaps core_v1.ConfigMapInterface
+	name       string
+}
+
+// NewConfigMapReleaseConfigs - release configuration from the named
+// ConfigMap
+func NewConfigMapReleaseConfigs(configMaps core_v1.ConfigMapInterface, name string) *ConfigMapReleaseConfigs {
+	return &ConfigMapReleaseConfigs{configMaps: configMaps, name: name}
+}
+
+// Load - reads the ConfigMap, a missing ConfigMap configures no releases
+func (c *ConfigMapReleaseConfigs) Load() (map[string]string, error) {
+	configMap, err := c.configMaps.Get(context.TODO(), c.name, meta_v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ConfigMap %s: %w", c.name, err)
+	}
+
+	configs := make(map[string]string, len(configMap.Data))
+	for key, value := range configMap.Data {
+		// namespaces can't contain dots, release names can
+		namespace, name, ok := strings.Cut(key, ".")
+		if !ok || namespace == "" || name == "" {
+			log.WithFields(log.Fields{
+				"key":       key,
+				"configmap": c.name,
+			}).Warn("provider.helm3: ignoring release configuration, expected <namespace>.<release> key")
+			continue
+		}
+		configs[releaseConfigKey(namespace, name)] = value
+	}
+	return configs, nil
+}
+
+// WithReleaseConfigs configures releases from a source besides their values,
+// its settings take precedence over the keel section of the values.
+func WithReleaseConfigs(configs ReleaseConfigs) ProviderOption {
+	return func(provider *Provider) {
+		provider.releaseConfigs = configs
+	}
+}
+
+// loadReleaseConfigs - keel configuration of releases kept outside of their
+// values, failures are logged and leave releases with their values only
+func (p *Provider) loadReleaseConfigs() map[string]string {
+	if p.releaseConfigs == nil {
+		return nil
+	}
+	configs, err := p.releaseConfigs.Load()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("provider.helm3: failed to load release configuration")
+		return nil
+	}
+	return configs
+}
+
+// releaseConfigKey - key of a release in loaded release configuration
+func releaseConfigKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// mergeKeelConfig merges keel configuration kept outside of a release into
+// its values, the outside configuration takes precedence
+func mergeKeelConfig(vals chartutil.Values, config string) (chartutil.Values, error) {
+	if config == "" {
+		return vals, nil
+	}
+	keel := make(map[string]interface{})
+	if err := yaml.Unmarshal([]byte(config), &keel); err != nil {
+		return nil, fmt.Errorf("failed to parse release configuration: %w", err)
+	}
+	if current, ok := vals["keel"].(map[string]interface{}); ok {
+		keel = chartutil.CoalesceTables(keel, current)
+	}
+	vals["keel"] = keel
+	return vals, nil
+}
@@ -0,0 +1,117 @@
+package helm3
+
+import (
+	"testing"
+
+	"github.com/keel-hq/keel/types"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func releaseConfigs(data map[string]string) ReleaseConfigs {
+	client := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "keel-helm-releases", Namespace: "keel"},
+		Data:       data,
+	})
+	return NewConfigMapReleaseConfigs(client.CoreV1().ConfigMaps("keel"), "keel-helm-releases")
+}
+
+func TestConfigMapReleaseConfigs(t *testing.T) {
+	configs, err := releaseConfigs(map[string]string{
+		"ingress.ingress-nginx": "policy: patch",
+		"default.app.v2":        "policy: minor",
+		"invalid":               "policy: all",
+	}).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(configs) != 2 || configs["ingress/ingress-nginx"] != "policy: patch" || configs["default/app.v2"] != "policy: minor" {
+		t.Errorf("unexpected configs: %v", configs)
+	}
+
+	client := fake.NewSimpleClientset()
+	configs, err = NewConfigMapReleaseConfigs(client.CoreV1().ConfigMaps("keel"), "missing").Load()
+	if err != nil || len(configs) != 0 {
+		t.Errorf("a missing ConfigMap configures no releases, got: %v, %v", configs, err)
+	}
+}
+
+func TestMergeKeelConfig(t *testing.T) {
+	vals, err := chartutil.ReadValues([]byte(`
+keel:
+  policy: all
+  trigger: poll
+  images:
+    - repository: image.repository
+      tag: image.tag
+`))
+	if err != nil {
+		t.Fatalf("failed to read values: %s", err)
+	}
+	vals, err = mergeKeelConfig(vals, "policy: patch\napprovals: 1\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cfg, err := getKeelConfig(vals)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cfg.Policy != "patch" || cfg.Approvals != 1 || cfg.Trigger != types.TriggerTypePoll || len(cfg.Images) != 1 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+
+	if _, err := mergeKeelConfig(vals, "policy: [patch"); err == nil {
+		t.Error("expected a parse error")
+	}
+}
+
+func TestReleaseConfiguredFromConfigMap(t *testing.T) {
+	// a third party chart without a keel section
+	myChart, err := testingStringToChart(`
+controller:
+  image:
+    repository: registry.k8s.io/ingress-nginx/controller
+    tag: v1.9.4
+`)
+	if err != nil {
+		t.Fatalf("failed to create chart: %s", err)
+	}
+	fakeImpl := &fakeImplementer{
+		listReleasesResponse: []*release.Release{
+			{Name: "ingress-nginx", Namespace: "ingress", Chart: myChart, Version: 1},
+		},
+	}
+	approver, teardown := approver()
+	defer teardown()
+	provider := NewProvider(fakeImpl, &fakeSender{}, approver, WithReleaseConfigs(releaseConfigs(map[string]string{
+		"ingress.ingress-nginx": `
+policy: patch
+trigger: poll
+images:
+  - repository: controller.image.repository
+    tag: controller.image.tag
+`,
+	})))
+
+	tracked, err := provider.TrackedImages()
+	if err != nil || len(tracked) != 1 {
+		t.Fatalf("expected a tracked image, got: %v, %v", tracked, err)
+	}
+	if tracked[0].Image.Remote() != "registry.k8s.io/ingress-nginx/controller:v1.9.4" || tracked[0].Policy.Name() != "patch" {
+		t.Errorf("unexpected tracked image: %+v", tracked[0])
+	}
+
+	err = provider.processEvent(&types.Event{
+		Repository: types.Repository{Name: "registry.k8s.io/ingress-nginx/controller", Tag: "v1.9.5"},
+	})
+	if err != nil {
+		t.Fatalf("failed to process event: %s", err)
+	}
+	if fakeImpl.updatedRlsName != "ingress-nginx" || !fakeImpl.updatedOptions.EmptyConfig {
+		t.Errorf("expected the release to be upgraded keeping its empty config, got: %s %+v", fakeImpl.updatedRlsName, fakeImpl.updatedOptions)
+	}
+}
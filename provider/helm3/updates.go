@@ -9,7 +9,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func checkRelease(repo *types.Repository, namespace, name string, chart *hapi_chart.Chart, config map[string]interface{}) (plan *UpdatePlan, shouldUpdateRelease bool, err error) {
+// checkRelease - plans updating the release images to the repository tag,
+// keelConfig is the keel section kept outside of the release values
+func checkRelease(repo *types.Repository, namespace, name string, chart *hapi_chart.Chart, config map[string]interface{}, keelConfig string) (plan *UpdatePlan, shouldUpdateRelease bool, err error) {
 
 	plan = &UpdatePlan{
 		Chart:       chart,
@@ -30,6 +32,9 @@ func checkRelease(repo *types.Repository, namespace, name string, chart *hapi_ch
 
 	// getting configuration
 	vals, err := values(chart, config)
+	if err == nil {
+		vals, err = mergeKeelConfig(vals, keelConfig)
+	}
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
@@ -51,11 +56,6 @@ func checkRelease(repo *types.Repository, namespace, name string, chart *hapi_ch
 	}
 	log.Infof("policy for release %s/%s parsed: %s", namespace, name, keelCfg.Plc.Name())
 
-	if keelCfg.Plc.Type() == types.PolicyTypeNone {
-		// policy is not set, ignoring release
-		return plan, false, nil
-	}
-
 	// checking for impacted images
 	for _, imageDetails := range keelCfg.Images {
 		imageRef, err := parseImage(vals, &imageDetails)
@@ -76,7 +76,13 @@ func checkRelease(repo *types.Repository, namespace, name string, chart *hapi_ch
 			continue
 		}
 
-		shouldUpdate, err := keelCfg.Plc.ShouldUpdate(imageRef.Tag(), eventRepoRef.Tag())
+		plc := keelCfg.imagePolicy(&imageDetails)
+		if plc.Type() == types.PolicyTypeNone {
+			// policy is not set, ignoring image
+			continue
+		}
+
+		shouldUpdate, err := plc.ShouldUpdate(imageRef.Tag(), eventRepoRef.Tag())
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error":           err,
@@ -90,7 +96,7 @@ func checkRelease(repo *types.Repository, namespace, name string, chart *hapi_ch
 			log.WithFields(log.Fields{
 				"parsed_image_name": imageRef.Remote(),
 				"target_image_name": repo.Name,
-				"policy":            keelCfg.Plc.Name(),
+				"policy":            plc.Name(),
 			}).Info("provider.helm3: ignoring")
 			continue
 		}
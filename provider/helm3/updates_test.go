@@ -197,7 +197,7 @@ keel:
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotPlan, gotShouldUpdateRelease, err := checkRelease(tt.args.repo, tt.args.namespace, tt.args.name, tt.args.chart, tt.args.config)
+			gotPlan, gotShouldUpdateRelease, err := checkRelease(tt.args.repo, tt.args.namespace, tt.args.name, tt.args.chart, tt.args.config, "")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("checkRelease() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -497,7 +497,7 @@ image:
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotPlan, gotShouldUpdateRelease, err := checkRelease(tt.args.repo, tt.args.namespace, tt.args.name, tt.args.chart, tt.args.config)
+			gotPlan, gotShouldUpdateRelease, err := checkRelease(tt.args.repo, tt.args.namespace, tt.args.name, tt.args.chart, tt.args.config, "")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("checkRelease() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -511,3 +511,61 @@ image:
 		})
 	}
 }
+
+const perImagePolicyValues = `
+image:
+  repository: gcr.io/v2-namespace/hello-world
+  tag: 1.1.0
+db:
+  image: postgres:14.1.0
+
+keel:
+  policy: minor
+  trigger: poll
+  pollSchedule: "@every 10m"
+  images:
+    - repository: image.repository
+      tag: image.tag
+    - repository: db.image
+      policy: patch
+      pollSchedule: "@every 1h"
+`
+
+func Test_checkReleasePerImagePolicy(t *testing.T) {
+	chart, err := testingStringToChart(perImagePolicyValues)
+	if err != nil {
+		t.Fatalf("failed to create chart: %s", err)
+	}
+
+	for _, tt := range []struct {
+		repo   types.Repository
+		update bool
+	}{
+		{types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.2.0"}, true},
+		{types.Repository{Name: "postgres", Tag: "14.2.0"}, false},
+		{types.Repository{Name: "postgres", Tag: "14.1.1"}, true},
+	} {
+		plan, update, err := checkRelease(&tt.repo, "default", "app", chart, nil, "")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tt.repo.String(), err)
+		}
+		if update != tt.update {
+			t.Errorf("%s: expected update %t, got: %t (%v)", tt.repo.String(), tt.update, update, plan.Values)
+		}
+	}
+
+	vals, err := values(chart, nil)
+	if err != nil {
+		t.Fatalf("failed to get values: %s", err)
+	}
+	images, err := getImages(vals)
+	if err != nil || len(images) != 2 {
+		t.Fatalf("expected 2 images, got: %v, %v", images, err)
+	}
+	if images[0].Policy.Name() != "minor" || images[0].PollSchedule != "@every 10m" || images[0].Trigger != types.TriggerTypePoll {
+		t.Errorf("expected release settings, got: %+v", images[0])
+	}
+	if images[1].Policy.Name() != "patch" || images[1].PollSchedule != "@every 1h" || images[1].Trigger != types.TriggerTypePoll {
+		t.Errorf("expected image settings, got: %+v", images[1])
+	}
+}
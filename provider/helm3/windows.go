@@ -0,0 +1,105 @@
+package helm3
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keel-hq/keel/provider"
+	"github.com/keel-hq/keel/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WithUpdateWindows - queue keeping updates that fall outside of the
+// updateWindow of their release or into a freeze period
+func WithUpdateWindows(queue *provider.DeferredQueue) ProviderOption {
+	return func(provider *Provider) {
+		provider.deferred = queue
+	}
+}
+
+// deferPlans returns plans that can be applied now, the rest is deferred
+// until the update window of the release opens
+func (p *Provider) deferPlans(event *types.Event, plans []*UpdatePlan) (ready []*UpdatePlan) {
+	now := time.Now()
+	for _, plan := range plans {
+		notBefore, err := p.deferred.NextOpen(plan.Config.UpdateWindow, now)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"name":      plan.Name,
+				"namespace": plan.Namespace,
+			}).Error("provider.helm3: invalid update window, release is not updated")
+			continue
+		}
+		if !notBefore.After(now) {
+			ready = append(ready, plan)
+			continue
+		}
+
+		identifier := fmt.Sprintf("%s/%s/%s", "chart", plan.Namespace, plan.Name)
+		created, err := p.deferred.Defer(&types.DeferredUpdate{
+			Identifier:     identifier,
+			ResourceKind:   "chart",
+			Event:          event,
+			CurrentVersion: plan.CurrentVersion,
+			NewVersion:     plan.NewVersion,
+			NotBefore:      notBefore,
+		})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"name":      plan.Name,
+				"namespace": plan.Namespace,
+			}).Error("provider.helm3: failed to defer update")
+			continue
+		}
+		if !created {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"name":       plan.Name,
+			"namespace":  plan.Namespace,
+			"update":     fmt.Sprintf("%s->%s", plan.CurrentVersion, plan.NewVersion),
+			"not_before": notBefore,
+		}).Info("provider.helm3: outside of the update window, update deferred")
+
+		metadata := releaseMetadata(plan, p.GetName())
+		metadata["notBefore"] = notBefore.Format(time.RFC3339)
+
+		p.sender.Send(types.EventNotification{
+			ResourceKind: "chart",
+			Identifier:   identifier,
+			Name:         "update deferred",
+			Message:      fmt.Sprintf("Update of release %s/%s %s->%s (%s) deferred until %s", plan.Namespace, plan.Name, formatVersionWithDigest(plan.CurrentVersion, plan.CurrentDigest), formatVersionWithDigest(plan.NewVersion, plan.NewDigest), strings.Join(planChanges(plan), ", "), notBefore.Format(time.RFC3339)),
+			CreatedAt:    time.Now(),
+			Type:         types.NotificationUpdateDeferred,
+			Level:        types.LevelInfo,
+			Channels:     plan.Config.NotificationChannels,
+			Metadata:     metadata,
+		})
+	}
+	return ready
+}
+
+// processDeferred submits events of deferred updates whose window opened
+func (p *Provider) processDeferred() {
+	due, err := p.deferred.Due(time.Now())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("provider.helm3: failed to get deferred updates")
+		return
+	}
+	for _, event := range provider.DueEvents(due) {
+		if err := p.processEvent(event); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"image": event.Repository.Name,
+				"tag":   event.Repository.Tag,
+			}).Error("provider.helm3: failed to process deferred event")
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package helm3
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/keel-hq/keel/provider"
+	"github.com/keel-hq/keel/types"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestProcessEventOutsideUpdateWindow(t *testing.T) {
+	// a window two days from now is closed
+	day := time.Now().UTC().Add(48 * time.Hour).Weekday().String()[:3]
+	chartVals := fmt.Sprintf(`
+image:
+  repository: karolisr/webhook-demo
+  tag: 0.0.10
+
+keel:
+  policy: all
+  updateWindow: "%s 10:00-11:00"
+  images:
+    - repository: image.repository
+      tag: image.tag
+`, day)
+	myChart, err := testingStringToChart(chartVals)
+	if err != nil {
+		t.Fatalf("chartutil.ReadValues error = %v", err)
+	}
+
+	fakeImpl := &fakeImplementer{
+		listReleasesResponse: []*release.Release{
+			{Name: "release-1", Namespace: "default", Chart: myChart, Config: make(map[string]interface{})},
+		},
+	}
+
+	store, teardown := newTestingUtils()
+	defer teardown()
+	approver, teardownApprover := approver()
+	defer teardownApprover()
+	sender := &fakeSender{}
+	p := NewProvider(fakeImpl, sender, approver, WithUpdateWindows(provider.NewDeferredQueue(ProviderName, store, nil)))
+
+	err = p.processEvent(&types.Event{
+		Repository: types.Repository{Name: "karolisr/webhook-demo", Tag: "0.0.11"},
+	})
+	if err != nil {
+		t.Fatalf("failed to process event, error: %s", err)
+	}
+
+	if fakeImpl.updatedRlsName != "" {
+		t.Errorf("release must not be updated outside of the update window, got: %s", fakeImpl.updatedRlsName)
+	}
+	if sender.sentEvent.Type != types.NotificationUpdateDeferred {
+		t.Errorf("expected update deferred notification, got: %s", sender.sentEvent.Type)
+	}
+	deferred, err := store.ListDeferredUpdates(&types.DeferredUpdateQuery{Provider: ProviderName})
+	if err != nil {
+		t.Fatalf("failed to list deferred updates: %s", err)
+	}
+	if len(deferred) != 1 || deferred[0].Identifier != "chart/default/release-1" || deferred[0].NewVersion != "0.0.11" {
+		t.Errorf("unexpected deferred updates: %+v", deferred)
+	}
+}
@@ -0,0 +1,25 @@
+package provider
+
+import (
+	"errors"
+
+	"github.com/keel-hq/keel/types"
+)
+
+// rollback errors
+var (
+	ErrResourceNotFound     = errors.New("resource not found")
+	ErrRollbackNotSupported = errors.New("provider does not support rollbacks")
+	ErrInvalidRollback      = errors.New("invalid rollback")
+)
+
+// HistoryStore - persists updates applied by providers
+type HistoryStore interface {
+	CreateUpdateRecord(record *types.UpdateRecord) (*types.UpdateRecord, error)
+}
+
+// Rollbacker - implemented by providers that can re-apply a previous image
+// of an update record
+type Rollbacker interface {
+	Rollback(record *types.UpdateRecord, user string) error
+}
@@ -2,9 +2,12 @@ package kubernetes
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/keel-hq/keel/internal/k8s"
 	"github.com/keel-hq/keel/pkg/store"
 	"github.com/keel-hq/keel/types"
 
@@ -45,6 +48,21 @@ func (p *Provider) updateComplete(plan *UpdatePlan) error {
 	return nil
 }
 
+// approvalVoters returns voters of the approval collected for the plan
+func (p *Provider) approvalVoters(plan *UpdatePlan) string {
+	identifier := getApprovalIdentifier(plan.Resource.Identifier, plan.NewVersion)
+	if !p.approvalManager.Exists(identifier) {
+		return ""
+	}
+	approval, err := p.approvalManager.Get(identifier)
+	if err != nil {
+		return ""
+	}
+	voters := approval.GetVoters()
+	sort.Strings(voters)
+	return strings.Join(voters, ", ")
+}
+
 func getInt(key string, labels map[string]string, annotations map[string]string) (int, error) {
 
 	var (
@@ -73,9 +91,50 @@ func getInt(key string, labels map[string]string, annotations map[string]string)
 	return 0, nil
 }
 
+// getMinApprovals returns the number of approvals required for the plan. Updated
+// containers with keel.sh/<container>/approvals use their own requirement instead
+// of the resource one, the highest requirement wins.
+func getMinApprovals(plan *UpdatePlan) (int, error) {
+	annotations := plan.Resource.GetAnnotations()
+	minApprovals, err := getInt(types.KeelMinimumApprovalsLabel, plan.Resource.GetLabels(), annotations)
+	if err != nil || plan.Previous == nil {
+		return minApprovals, err
+	}
+	// same tag updates (force policy) don't change images
+	names := updatedContainers(plan.Previous, plan.Resource)
+	if len(names) == 0 {
+		return minApprovals, nil
+	}
+
+	required := 0
+	for _, name := range names {
+		key := types.ContainerAnnotation(name, types.KeelMinimumApprovalsLabel)
+		containerApprovals := minApprovals
+		if _, ok := annotations[key]; ok {
+			containerApprovals, err = getInt(key, nil, annotations)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if containerApprovals > required {
+			required = containerApprovals
+		}
+	}
+	return required, nil
+}
+
+// updatedContainers returns names of containers, init containers and image
+// volumes with different images in previous and updated
+func updatedContainers(previous, updated *k8s.GenericResource) (names []string) {
+	for _, c := range changedImages(previous, updated) {
+		names = append(names, c.name)
+	}
+	return names
+}
+
 func (p *Provider) isApproved(event *types.Event, plan *UpdatePlan) (bool, error) {
 
-	minApprovals, err := getInt(types.KeelMinimumApprovalsLabel, plan.Resource.GetLabels(), plan.Resource.GetAnnotations())
+	minApprovals, err := getMinApprovals(plan)
 	if err != nil {
 		return false, err
 	}
@@ -113,6 +172,7 @@ func (p *Provider) isApproved(event *types.Event, plan *UpdatePlan) (bool, error
 			// creating new one
 			approval := &types.Approval{
 				Provider:       types.ProviderTypeKubernetes,
+				Cluster:        plan.Resource.Cluster,
 				Identifier:     identifier,
 				Event:          event,
 				CurrentVersion: plan.CurrentVersion,
@@ -128,6 +188,14 @@ func (p *Provider) isApproved(event *types.Event, plan *UpdatePlan) (bool, error
 				plan.Resource.Name,
 				approval.Delta(),
 			)
+			if plan.Resource.Cluster != "" {
+				approval.Message = fmt.Sprintf("New image is available for resource %s/%s in cluster %s (%s).",
+					plan.Resource.Namespace,
+					plan.Resource.Name,
+					plan.Resource.Cluster,
+					approval.Delta(),
+				)
+			}
 
 			return false, p.approvalManager.Create(approval)
 		}
@@ -0,0 +1,379 @@
+package kubernetes
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var rolloutsQueuedGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "kubernetes_rollouts_queued",
+		Help: "How many updates wait for the rollout budget, partitioned by cluster and namespace.",
+	},
+	[]string{"cluster", "namespace"},
+)
+
+var rolloutsInFlightGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "kubernetes_rollouts_in_flight",
+		Help: "How many resources updated by keel are still rolling out, partitioned by cluster and namespace.",
+	},
+	[]string{"cluster", "namespace"},
+)
+
+func init() {
+	prometheus.MustRegister(rolloutsQueuedGauge)
+	prometheus.MustRegister(rolloutsInFlightGauge)
+}
+
+// inFlightTimeout - rollouts that don't complete in time stop counting
+// towards the budget, so a stuck resource doesn't block updates forever
+var inFlightTimeout = 30 * time.Minute
+
+// inFlightRollout - resource updated by keel that is still rolling out
+type inFlightRollout struct {
+	resource *k8s.GenericResource
+	started  time.Time
+}
+
+// rolloutBudget limits how many resources updated by keel roll out at the
+// same time, in total and per namespace. Plans over the budget are queued
+// per namespace and admitted round robin, so a namespace with hundreds of
+// updates can't starve the others. Zero limits disable the budget. Every
+// cluster has its own budget.
+type rolloutBudget struct {
+	mu           sync.Mutex
+	cluster      string
+	global       int
+	perNamespace int
+
+	inFlight map[string]*inFlightRollout
+	queues   map[string][]*UpdatePlan
+	// namespaces - namespaces with queued plans, in round robin order
+	namespaces []string
+	// gauged - namespaces the gauges report for the cluster
+	gauged map[string]bool
+}
+
+func newRolloutBudget(cluster string, global, perNamespace int) *rolloutBudget {
+	return &rolloutBudget{
+		cluster:      cluster,
+		global:       global,
+		perNamespace: perNamespace,
+		inFlight:     make(map[string]*inFlightRollout),
+		queues:       make(map[string][]*UpdatePlan),
+	}
+}
+
+// SetRolloutBudget - limits rollouts in flight of the cluster in total and
+// per namespace, zero means unlimited
+func (p *Provider) SetRolloutBudget(global, perNamespace int) {
+	p.budget = newRolloutBudget(p.cluster, global, perNamespace)
+}
+
+func (b *rolloutBudget) enabled() bool {
+	return b.global > 0 || b.perNamespace > 0
+}
+
+// admit queues the plans and returns the ones that can be applied now,
+// queued plans go first. A newer plan for a queued resource replaces the
+// queued one and keeps its place.
+func (b *rolloutBudget) admit(plans []*UpdatePlan, current func(identifier string) *k8s.GenericResource) []*UpdatePlan {
+	if !b.enabled() {
+		return plans
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, plan := range plans {
+		b.enqueue(plan)
+	}
+	return b.dequeue(current)
+}
+
+// next returns queued plans that fit into the budget now
+func (b *rolloutBudget) next(current func(identifier string) *k8s.GenericResource) []*UpdatePlan {
+	if !b.enabled() {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dequeue(current)
+}
+
+// track counts the resources of the plans, replacing what was counted for
+// them, ie: after queued plans were planned again
+func (b *rolloutBudget) track(plans []*UpdatePlan) {
+	if !b.enabled() || len(plans) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, plan := range plans {
+		b.inFlight[plan.Resource.Identifier] = &inFlightRollout{resource: plan.Resource, started: time.Now()}
+	}
+	b.updateGauges()
+}
+
+// release stops counting the resource, ie: when its update failed
+func (b *rolloutBudget) release(resource *k8s.GenericResource) {
+	if !b.enabled() {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.inFlight, resource.Identifier)
+	b.updateGauges()
+}
+
+// requeue puts admitted plans back into their queues, ie: when their
+// dependencies still roll out
+func (b *rolloutBudget) requeue(plans []*UpdatePlan) {
+	if !b.enabled() || len(plans) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, plan := range plans {
+		delete(b.inFlight, plan.Resource.Identifier)
+		b.enqueue(plan)
+	}
+	b.updateGauges()
+}
+
+// queued checks whether an update of the resource waits for the budget
+func (b *rolloutBudget) queued(identifier string) bool {
+	if !b.enabled() {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.isQueued(identifier)
+}
+
+func (b *rolloutBudget) isQueued(identifier string) bool {
+	for _, queue := range b.queues {
+		for _, plan := range queue {
+			if plan.Resource.Identifier == identifier {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (b *rolloutBudget) enqueue(plan *UpdatePlan) {
+	namespace := plan.Resource.Namespace
+	queue := b.queues[namespace]
+	for i, queued := range queue {
+		if queued.Resource.Identifier == plan.Resource.Identifier {
+			queue[i] = plan
+			return
+		}
+	}
+	if len(queue) == 0 {
+		b.namespaces = append(b.namespaces, namespace)
+	}
+	b.queues[namespace] = append(queue, plan)
+}
+
+func (b *rolloutBudget) dequeue(current func(identifier string) *k8s.GenericResource) (admitted []*UpdatePlan) {
+	b.refresh(current)
+
+	perNamespace := make(map[string]int)
+	for _, rollout := range b.inFlight {
+		perNamespace[rollout.resource.Namespace]++
+	}
+
+	for progress := true; progress; {
+		progress = false
+		var remaining []string
+		for _, namespace := range b.namespaces {
+			queue := b.queues[namespace]
+			fits := (b.global <= 0 || len(b.inFlight) < b.global) &&
+				(b.perNamespace <= 0 || perNamespace[namespace] < b.perNamespace)
+			next := slices.IndexFunc(queue, b.admissible)
+			if fits && next >= 0 {
+				plan := queue[next]
+				queue = slices.Delete(queue, next, next+1)
+				b.inFlight[plan.Resource.Identifier] = &inFlightRollout{resource: plan.Resource, started: time.Now()}
+				perNamespace[namespace]++
+				admitted = append(admitted, plan)
+				progress = true
+			}
+			if len(queue) == 0 {
+				delete(b.queues, namespace)
+				continue
+			}
+			b.queues[namespace] = queue
+			remaining = append(remaining, namespace)
+		}
+		b.namespaces = remaining
+	}
+
+	b.updateGauges()
+	return admitted
+}
+
+// admissible checks whether the queued plan can be admitted. Resources still
+// rolling out an earlier update wait, rollbacks replace the update in
+// flight. Dependents wait for queued dependencies to be admitted first.
+func (b *rolloutBudget) admissible(plan *UpdatePlan) bool {
+	if b.inFlight[plan.Resource.Identifier] != nil && plan.Trigger != types.TriggerTypeRollback.String() {
+		return false
+	}
+	for _, dependency := range getDependencies(plan.Resource) {
+		if dependency != plan.Resource.Identifier && b.isQueued(dependency) {
+			return false
+		}
+	}
+	return true
+}
+
+// refresh drops rollouts that completed: the resource runs the updated
+// images and reports a complete rollout (or doesn't report rollout status)
+func (b *rolloutBudget) refresh(current func(identifier string) *k8s.GenericResource) {
+	for identifier, rollout := range b.inFlight {
+		if time.Since(rollout.started) > inFlightTimeout {
+			log.WithFields(log.Fields{
+				"name":      rollout.resource.Name,
+				"kind":      rollout.resource.Kind(),
+				"namespace": rollout.resource.Namespace,
+			}).Warn("provider.kubernetes: rollout didn't complete in time, it no longer counts towards the budget")
+			delete(b.inFlight, identifier)
+			continue
+		}
+		resource := current(identifier)
+		if resource == nil {
+			delete(b.inFlight, identifier)
+			continue
+		}
+		if !sameImages(resource, rollout.resource) {
+			continue
+		}
+		if complete, ok := resource.RolloutComplete(); complete || !ok {
+			delete(b.inFlight, identifier)
+		}
+	}
+}
+
+// updateGauges reports the budget of the cluster, series of other clusters
+// are left alone
+func (b *rolloutBudget) updateGauges() {
+	queued := make(map[string]int)
+	inFlight := make(map[string]int)
+	gauged := make(map[string]bool)
+	for namespace, queue := range b.queues {
+		queued[namespace] = len(queue)
+		gauged[namespace] = true
+	}
+	for _, rollout := range b.inFlight {
+		inFlight[rollout.resource.Namespace]++
+		gauged[rollout.resource.Namespace] = true
+	}
+
+	for namespace := range b.gauged {
+		if !gauged[namespace] {
+			rolloutsQueuedGauge.DeleteLabelValues(b.cluster, namespace)
+			rolloutsInFlightGauge.DeleteLabelValues(b.cluster, namespace)
+		}
+	}
+	for namespace := range gauged {
+		rolloutsQueuedGauge.WithLabelValues(b.cluster, namespace).Set(float64(queued[namespace]))
+		rolloutsInFlightGauge.WithLabelValues(b.cluster, namespace).Set(float64(inFlight[namespace]))
+	}
+	b.gauged = gauged
+}
+
+// admitPlans returns plans of the event that can be applied now, the rest
+// is queued. Plans ordered by keel.sh/dependsOn count towards the budget
+// like any other, dependents stay queued while their dependencies are.
+func (p *Provider) admitPlans(plans []*UpdatePlan) []*UpdatePlan {
+	admitted := p.budget.admit(plans, p.cachedResource)
+	for _, plan := range plans {
+		if !slices.Contains(admitted, plan) {
+			log.WithFields(log.Fields{
+				"name":      plan.Resource.Name,
+				"kind":      plan.Resource.Kind(),
+				"namespace": plan.Resource.Namespace,
+				"new":       plan.NewVersion,
+			}).Info("provider.kubernetes: rollout budget exhausted, update queued")
+		}
+	}
+	return admitted
+}
+
+// processQueued applies queued plans that fit into the budget. Plans are
+// planned again from the cached resources first, so pauses, windows,
+// promotions, blocked versions and changes of the resource made while the
+// plan was queued apply to it too.
+func (p *Provider) processQueued() {
+	queued := p.budget.next(p.cachedResource)
+	if len(queued) == 0 {
+		return
+	}
+
+	var plans []*UpdatePlan
+	for _, plan := range queued {
+		current, err := p.replan(plan)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"name":      plan.Resource.Name,
+				"kind":      plan.Resource.Kind(),
+				"namespace": plan.Resource.Namespace,
+			}).Error("provider.kubernetes: failed to plan queued update again")
+			p.budget.requeue([]*UpdatePlan{plan})
+			continue
+		}
+		if current == nil {
+			log.WithFields(log.Fields{
+				"name":      plan.Resource.Name,
+				"kind":      plan.Resource.Kind(),
+				"namespace": plan.Resource.Namespace,
+				"new":       plan.NewVersion,
+			}).Info("provider.kubernetes: queued update no longer applies, dropping it")
+			p.budget.release(plan.Resource)
+			continue
+		}
+		plans = append(plans, current)
+	}
+	p.budget.track(plans)
+
+	plans, held := p.holdDependents(plans)
+	p.budget.requeue(held)
+	p.applyOrderedPlans(plans)
+}
+
+// replan plans the queued update again for the event it was planned for,
+// nil when the resource no longer takes the update right now
+func (p *Provider) replan(queued *UpdatePlan) (*UpdatePlan, error) {
+	// rollbacks are requested explicitly
+	if queued.event == nil {
+		return queued, nil
+	}
+	plans, err := p.createUpdatePlansForTrigger(&queued.event.Repository, queued.event.TriggerName)
+	if err != nil {
+		return nil, err
+	}
+	for _, plan := range plans {
+		if plan.Resource.Identifier != queued.Resource.Identifier || plan.NewVersion != queued.NewVersion || p.isDryRun(plan.Resource) {
+			continue
+		}
+		plan.Trigger = queued.Trigger
+		plan.Approver = queued.Approver
+		plan.event = queued.event
+		if len(p.deferPlans(queued.event, []*UpdatePlan{plan})) == 0 {
+			return nil, nil
+		}
+		return plan, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,190 @@
+package kubernetes
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRolloutBudgetQueuesUpdates(t *testing.T) {
+	grc := &k8s.GenericResourceCache{}
+	for _, name := range []string{"a", "b"} {
+		grc.Add(MustParseGR(dryRunTestDeployment(name, "1.1.1", map[string]string{})))
+	}
+	other := dryRunTestDeployment("c", "1.1.1", map[string]string{})
+	other.Namespace = "yyyy"
+	grc.Add(MustParseGR(other))
+
+	fp := &rolloutImplementer{cache: grc, stuck: map[string]bool{"a": true, "b": true, "c": true}}
+	approver, teardown := approver()
+	defer teardown()
+	p, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	p.SetRolloutBudget(2, 1)
+
+	if _, err := p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}}); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	applied := append([]string{}, fp.applied...)
+	sort.Strings(applied)
+	if len(applied) != 2 || applied[1] != "c" {
+		t.Fatalf("expected one update per namespace, got: %v", fp.applied)
+	}
+	if queued := testutil.ToFloat64(rolloutsQueuedGauge.WithLabelValues("", "xxxx")); queued != 1 {
+		t.Errorf("expected 1 queued update, got: %v", queued)
+	}
+	if inFlight := testutil.ToFloat64(rolloutsInFlightGauge.WithLabelValues("", "xxxx")); inFlight != 1 {
+		t.Errorf("expected 1 rollout in flight, got: %v", inFlight)
+	}
+
+	// rollouts still progressing
+	p.processQueued()
+	if len(fp.applied) != 2 {
+		t.Fatalf("queued update must wait for the rollout in its namespace, got: %v", fp.applied)
+	}
+
+	// the first rollout in xxxx completes
+	first := applied[0]
+	fp.stuck[first] = false
+	grc.Add(MustParseGR(rolledOut(dryRunTestDeployment(first, "1.4.5", map[string]string{}))))
+
+	p.processQueued()
+	applied = append([]string{}, fp.applied...)
+	sort.Strings(applied)
+	if !reflect.DeepEqual(applied, []string{"a", "b", "c"}) {
+		t.Fatalf("expected the queued update to be applied, got: %v", fp.applied)
+	}
+	if queued := testutil.ToFloat64(rolloutsQueuedGauge.WithLabelValues("", "xxxx")); queued != 0 {
+		t.Errorf("expected no queued updates, got: %v", queued)
+	}
+}
+
+func TestRolloutBudgetGaugesPerCluster(t *testing.T) {
+	a := newRolloutBudget("a", 1, 0)
+	b := newRolloutBudget("b", 1, 0)
+	current := func(identifier string) *k8s.GenericResource { return nil }
+
+	plan := &UpdatePlan{Resource: MustParseGR(dryRunTestDeployment("hello", "1.1.1", map[string]string{}))}
+	a.track([]*UpdatePlan{plan})
+	b.track([]*UpdatePlan{plan})
+	b.admit([]*UpdatePlan{{Resource: MustParseGR(dryRunTestDeployment("other", "1.1.1", map[string]string{}))}}, func(identifier string) *k8s.GenericResource {
+		return plan.Resource
+	})
+
+	if inFlight := testutil.ToFloat64(rolloutsInFlightGauge.WithLabelValues("a", "xxxx")); inFlight != 1 {
+		t.Errorf("expected 1 rollout in flight in cluster a, got: %v", inFlight)
+	}
+	if queued := testutil.ToFloat64(rolloutsQueuedGauge.WithLabelValues("b", "xxxx")); queued != 1 {
+		t.Errorf("expected 1 queued update in cluster b, got: %v", queued)
+	}
+
+	// the rollout of cluster b completes, cluster a still reports its own
+	b.release(plan.Resource)
+	b.next(current)
+	if inFlight := testutil.ToFloat64(rolloutsInFlightGauge.WithLabelValues("a", "xxxx")); inFlight != 1 {
+		t.Errorf("expected cluster a to keep its rollout in flight, got: %v", inFlight)
+	}
+}
+
+func TestRolloutBudgetQueuedUpdatePlannedAgain(t *testing.T) {
+	grc := &k8s.GenericResourceCache{}
+	for _, name := range []string{"a", "b"} {
+		grc.Add(MustParseGR(dryRunTestDeployment(name, "1.1.1", map[string]string{})))
+	}
+	fp := &rolloutImplementer{cache: grc, stuck: map[string]bool{"a": true, "b": true}}
+	approver, teardown := approver()
+	defer teardown()
+	p, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	p.SetRolloutBudget(1, 0)
+
+	if _, err := p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}}); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	applied := fp.appliedNames()
+	if len(applied) != 1 {
+		t.Fatalf("expected one update, got: %v", applied)
+	}
+	first, queued := applied[0], "a"
+	if first == "a" {
+		queued = "b"
+	}
+
+	// the queued resource is paused meanwhile
+	grc.Add(MustParseGR(dryRunTestDeployment(queued, "1.1.1", map[string]string{types.KeelPausedAnnotation: "true"})))
+	grc.Add(MustParseGR(rolledOut(dryRunTestDeployment(first, "1.4.5", map[string]string{}))))
+
+	p.processQueued()
+	if !reflect.DeepEqual(fp.appliedNames(), []string{first}) {
+		t.Errorf("paused resource must not be updated, got: %v", fp.appliedNames())
+	}
+	if p.budget.queued("deployment/xxxx/"+queued) || len(p.budget.inFlight) != 0 {
+		t.Errorf("expected the queued update to be dropped")
+	}
+}
+
+func TestRolloutBudgetLimitsDependencies(t *testing.T) {
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("worker", "1.1.1", map[string]string{types.KeelDependsOnAnnotation: "deployment/xxxx/api"})))
+	grc.Add(MustParseGR(dryRunTestDeployment("api", "1.1.1", map[string]string{})))
+	grc.Add(MustParseGR(dryRunTestDeployment("db", "1.1.1", map[string]string{})))
+	fp := &rolloutImplementer{cache: grc, stuck: map[string]bool{"api": true, "db": true}}
+	approver, teardown := approver()
+	defer teardown()
+	p, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	p.SetRolloutBudget(1, 0)
+
+	if _, err := p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}}); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if applied := fp.appliedNames(); len(applied) != 1 || applied[0] == "worker" {
+		t.Fatalf("expected a single update without the dependent, got: %v", applied)
+	}
+	if len(p.budget.inFlight) != 1 {
+		t.Errorf("expected 1 rollout in flight, got: %d", len(p.budget.inFlight))
+	}
+
+	// one update at a time, the dependent waits for its dependency
+	for i := 2; i <= 3; i++ {
+		for _, name := range fp.appliedNames() {
+			grc.Add(MustParseGR(rolledOut(dryRunTestDeployment(name, "1.4.5", map[string]string{}))))
+		}
+		p.processQueued()
+		if applied := fp.appliedNames(); len(applied) != i {
+			t.Fatalf("expected %d updates, got: %v", i, applied)
+		}
+	}
+	if applied := fp.appliedNames(); applied[2] != "worker" {
+		t.Errorf("expected the dependent to be updated last, got: %v", applied)
+	}
+}
+
+func TestRolloutBudgetSkipsResourcesInFlight(t *testing.T) {
+	b := newRolloutBudget("", 2, 0)
+	resource := MustParseGR(dryRunTestDeployment("hello", "1.1.1", map[string]string{}))
+	current := func(identifier string) *k8s.GenericResource { return resource }
+
+	admitted := b.admit([]*UpdatePlan{{Resource: resource, NewVersion: "1.1.2"}}, current)
+	if len(admitted) != 1 {
+		t.Fatalf("expected the update to be admitted, got: %d", len(admitted))
+	}
+	// a newer update while the first one still rolls out
+	if admitted := b.admit([]*UpdatePlan{{Resource: resource, NewVersion: "1.1.3"}}, current); len(admitted) != 0 {
+		t.Errorf("resource in flight must not be admitted again, got: %v", admitted)
+	}
+	if !b.queued(resource.Identifier) || len(b.inFlight) != 1 {
+		t.Errorf("expected the newer update to be queued")
+	}
+}
@@ -0,0 +1,104 @@
+package kubernetes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+)
+
+// ClusterConfig - named cluster keel manages next to the one it runs in
+type ClusterConfig struct {
+	Name string
+	Opts *Opts
+}
+
+// ParseClusters - clusters of a list of kubeconfig contexts (comma separated,
+// name=context or context) from the kubeconfig at configPath, and of the
+// kubeconfig files in dir, named after the file
+func ParseClusters(contexts, dir, configPath string) ([]ClusterConfig, error) {
+	var clusters []ClusterConfig
+	for _, entry := range strings.Split(contexts, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, context, found := strings.Cut(entry, "=")
+		if !found {
+			context = name
+		}
+		if configPath == "" {
+			return nil, fmt.Errorf("cluster '%s': kubeconfig path is not set", name)
+		}
+		clusters = append(clusters, ClusterConfig{
+			Name: strings.TrimSpace(name),
+			Opts: &Opts{ConfigPath: configPath, CurrentContext: strings.TrimSpace(context)},
+		})
+	}
+
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read clusters directory: %w", err)
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		for _, entry := range entries {
+			// secret volumes keep their data in hidden directories
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			clusters = append(clusters, ClusterConfig{
+				Name: entry.Name(),
+				Opts: &Opts{ConfigPath: filepath.Join(dir, entry.Name())},
+			})
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, cluster := range clusters {
+		if err := ValidateClusterName(cluster.Name); err != nil {
+			return nil, err
+		}
+		if seen[cluster.Name] {
+			return nil, fmt.Errorf("cluster '%s' is defined twice", cluster.Name)
+		}
+		seen[cluster.Name] = true
+	}
+
+	return clusters, nil
+}
+
+// ValidateClusterName checks the name can prefix resource identifiers (ie:
+// production/deployment/default/app) without being mistaken for the kind of
+// an identifier of the unnamed cluster
+func ValidateClusterName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("cluster name cannot be empty")
+	case strings.Contains(name, "/"):
+		return fmt.Errorf("cluster '%s': name cannot contain '/'", name)
+	case isResourceKind(name):
+		return fmt.Errorf("cluster '%s': name cannot be a resource kind", name)
+	}
+	return nil
+}
+
+// isResourceKind checks whether identifiers can start with the name, kinds
+// are compared ignoring the case
+func isResourceKind(name string) bool {
+	for _, kind := range []string{"deployment", "statefulset", "daemonset", "cronjob", "chart", types.AuditResourceKindNamespace} {
+		if strings.EqualFold(name, kind) {
+			return true
+		}
+	}
+	for _, kind := range k8s.CustomKinds() {
+		if strings.EqualFold(name, kind.Kind) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package kubernetes
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseClusters(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"staging", ".hidden"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("apiVersion: v1"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "..data"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, err := ParseClusters("production=prod-context, eu-west,", dir, "/etc/kubeconfig")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []ClusterConfig{
+		{Name: "production", Opts: &Opts{ConfigPath: "/etc/kubeconfig", CurrentContext: "prod-context"}},
+		{Name: "eu-west", Opts: &Opts{ConfigPath: "/etc/kubeconfig", CurrentContext: "eu-west"}},
+		{Name: "staging", Opts: &Opts{ConfigPath: filepath.Join(dir, "staging")}},
+	}
+	if !reflect.DeepEqual(clusters, want) {
+		t.Errorf("unexpected clusters: %+v", clusters)
+	}
+}
+
+func TestParseClustersInvalid(t *testing.T) {
+	for _, contexts := range []string{
+		"=prod-context",
+		"prod/eu=prod-context",
+		"production=a,production=b",
+		"deployment=prod-context",
+		"Chart=prod-context",
+	} {
+		if _, err := ParseClusters(contexts, "", "/etc/kubeconfig"); err == nil {
+			t.Errorf("%s: expected error", contexts)
+		}
+	}
+
+	if _, err := ParseClusters("production", "", ""); err == nil {
+		t.Error("expected error without kubeconfig")
+	}
+	if _, err := ParseClusters("", filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Error("expected error for missing directory")
+	}
+}
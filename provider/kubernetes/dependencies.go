@@ -0,0 +1,321 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keel-hq/keel/internal/concurrent"
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// dependencyTimeout - how long dependents wait for an updated dependency to
+// become ready when it has no keel.sh/rolloutDeadline
+var dependencyTimeout = 10 * time.Minute
+
+// getDependencies returns resource identifiers listed in keel.sh/dependsOn.
+// Entries without a cluster (kind/namespace/name) name resources of the
+// cluster the resource belongs to.
+func getDependencies(resource *k8s.GenericResource) []string {
+	var dependencies []string
+	for _, entry := range strings.Split(resource.GetAnnotations()[types.KeelDependsOnAnnotation], ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Count(entry, "/") == 2 {
+			entry = k8s.ClusterIdentifier(resource.Cluster, entry)
+		}
+		dependencies = append(dependencies, entry)
+	}
+	return dependencies
+}
+
+// planDependencies returns dependencies of the plan that are updated by the
+// same event, other dependencies don't affect the order
+func planDependencies(plan *UpdatePlan, planned map[string]bool) []string {
+	var dependencies []string
+	for _, dependency := range getDependencies(plan.Resource) {
+		if planned[dependency] && dependency != plan.Resource.Identifier {
+			dependencies = append(dependencies, dependency)
+		}
+	}
+	return dependencies
+}
+
+// orderPlans groups plans into waves in topological order: plans of a wave
+// depend only on plans of the previous waves. Plans in a dependency cycle,
+// or depending on one, can't be ordered and are returned as cyclic.
+func orderPlans(plans []*UpdatePlan) (waves [][]*UpdatePlan, cyclic []*UpdatePlan) {
+	planned := make(map[string]bool, len(plans))
+	for _, plan := range plans {
+		planned[plan.Resource.Identifier] = true
+	}
+
+	pending := plans
+	done := make(map[string]bool, len(plans))
+	for len(pending) > 0 {
+		var wave, rest []*UpdatePlan
+		for _, plan := range pending {
+			ready := true
+			for _, dependency := range planDependencies(plan, planned) {
+				if !done[dependency] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				wave = append(wave, plan)
+			} else {
+				rest = append(rest, plan)
+			}
+		}
+		if len(wave) == 0 {
+			return waves, rest
+		}
+		for _, plan := range wave {
+			done[plan.Resource.Identifier] = true
+		}
+		waves = append(waves, wave)
+		pending = rest
+	}
+	return waves, nil
+}
+
+// applyOrderedPlans applies plans wave by wave. The first wave is applied
+// right away, later waves wait in the background for the dependencies they
+// have in the previous waves to become ready, so a slow rollout doesn't hold
+// up the event loop. Plans waiting for a keel.sh/preUpdateJob are applied in
+// the background too, they stay counted by the rollout budget and aren't
+// planned again meanwhile.
+// When a dependency fails to update or doesn't become ready in time, its
+// dependents are skipped and so are theirs. Plans waiting in the background
+// aren't planned again meanwhile and failures are remembered, dependents
+// planned by later events wait for them too (see holdDependents). Only the
+// resources applied right away are returned.
+func (p *Provider) applyOrderedPlans(plans []*UpdatePlan) (updated []*k8s.GenericResource) {
+	waves, cyclic := orderPlans(plans)
+	for _, plan := range cyclic {
+		p.skipPlan(plan, "dependency cycle in "+types.KeelDependsOnAnnotation)
+	}
+	if len(waves) == 0 {
+		return nil
+	}
+
+	planned := make(map[string]bool, len(plans))
+	dependedOn := make(map[string]bool)
+	for _, plan := range plans {
+		planned[plan.Resource.Identifier] = true
+	}
+	for _, plan := range plans {
+		for _, dependency := range planDependencies(plan, planned) {
+			dependedOn[dependency] = true
+		}
+	}
+
+	var first, delayed []*UpdatePlan
+	for _, plan := range waves[0] {
+		if hasPreUpdateJob(plan) {
+			delayed = append(delayed, plan)
+		} else {
+			first = append(first, plan)
+		}
+	}
+
+	failed := make(map[string]bool)
+	updated, applied := p.applyWave(first, planned, failed)
+	if len(delayed) > 0 || len(waves) > 1 {
+		background := delayed
+		for _, wave := range waves[1:] {
+			background = append(background, wave...)
+		}
+		p.pending.add(background)
+		go func() {
+			_, afterJobs := p.applyWave(delayed, planned, failed)
+			p.pending.done(delayed)
+			applied = append(applied, afterJobs...)
+			for _, wave := range waves[1:] {
+				for _, plan := range applied {
+					if dependedOn[plan.Resource.Identifier] && !p.waitReady(plan) {
+						failed[plan.Resource.Identifier] = true
+						p.pending.fail(plan)
+					}
+				}
+				_, applied = p.applyWave(wave, planned, failed)
+				p.pending.done(wave)
+			}
+		}()
+	}
+	return updated
+}
+
+// applyWave applies plans of a wave whose dependencies didn't fail, it
+// returns the updated resources and the plans they were updated by
+func (p *Provider) applyWave(wave []*UpdatePlan, planned, failed map[string]bool) (updated []*k8s.GenericResource, applied []*UpdatePlan) {
+	var runnable []*UpdatePlan
+	for _, plan := range wave {
+		if dependency, ok := failedDependency(plan, planned, failed); ok {
+			p.skipPlan(plan, fmt.Sprintf("dependency %s was not updated", dependency))
+			failed[plan.Resource.Identifier] = true
+			p.pending.fail(plan)
+			continue
+		}
+		runnable = append(runnable, plan)
+	}
+
+	results := make([]*k8s.GenericResource, len(runnable))
+	concurrent.Run(concurrentPlanWorkers, len(runnable), func(i int) {
+		results[i] = p.applyPlan(runnable[i])
+	})
+
+	for i, plan := range runnable {
+		if results[i] == nil {
+			p.budget.release(plan.Resource)
+			failed[plan.Resource.Identifier] = true
+			p.pending.fail(plan)
+			continue
+		}
+		p.pending.succeed(plan.Resource.Identifier)
+		updated = append(updated, results[i])
+		applied = append(applied, plan)
+	}
+	return updated, applied
+}
+
+// holdDependents splits plans that can be applied now from the ones held.
+// Plans depending on resources that aren't part of plans wait while a
+// dependency is queued, updated in the background, still rolls out or failed
+// to update in an earlier chain.
+func (p *Provider) holdDependents(plans []*UpdatePlan) (ready, held []*UpdatePlan) {
+	planned := make(map[string]bool, len(plans))
+	for _, plan := range plans {
+		planned[plan.Resource.Identifier] = true
+	}
+
+	for _, plan := range plans {
+		dependency, reason, ok := p.heldDependency(plan, planned)
+		if !ok {
+			ready = append(ready, plan)
+			continue
+		}
+		held = append(held, plan)
+		log.WithFields(log.Fields{
+			"name":       plan.Resource.Name,
+			"kind":       plan.Resource.Kind(),
+			"namespace":  plan.Resource.Namespace,
+			"new":        plan.NewVersion,
+			"dependency": dependency,
+			"reason":     reason,
+		}).Info("provider.kubernetes: update waits for its dependency")
+	}
+	return ready, held
+}
+
+// heldDependency returns the first dependency of the plan, not planned along
+// with it, the plan has to wait for
+func (p *Provider) heldDependency(plan *UpdatePlan, planned map[string]bool) (dependency, reason string, held bool) {
+	for _, dependency := range getDependencies(plan.Resource) {
+		if planned[dependency] || dependency == plan.Resource.Identifier {
+			continue
+		}
+		if p.budget.queued(dependency) {
+			return dependency, "queued", true
+		}
+		if _, ok := p.pending.version(dependency); ok {
+			return dependency, "update in progress", true
+		}
+		current := p.cachedResource(dependency)
+		if failure, ok := p.pending.failure(dependency); ok {
+			if current == nil || !sameImages(current, failure) {
+				return dependency, "update failed", true
+			}
+			p.pending.succeed(dependency)
+		}
+		if current == nil {
+			continue
+		}
+		if complete, ok := current.RolloutComplete(); ok && !complete {
+			return dependency, "rolling out", true
+		}
+	}
+	return "", "", false
+}
+
+func failedDependency(plan *UpdatePlan, planned, failed map[string]bool) (string, bool) {
+	for _, dependency := range planDependencies(plan, planned) {
+		if failed[dependency] {
+			return dependency, true
+		}
+	}
+	return "", false
+}
+
+// waitReady waits until the updated resource reports a completed rollout,
+// resources that don't report rollout status are considered ready
+func (p *Provider) waitReady(plan *UpdatePlan) bool {
+	resource := plan.Resource
+	timeout := dependencyTimeout
+	if deadline, ok := getRolloutDeadline(resource.GetLabels(), resource.GetAnnotations()); ok {
+		timeout = deadline
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(rolloutCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		current := p.cachedResource(resource.Identifier)
+		if current != nil && sameImages(current, resource) {
+			complete, ok := current.RolloutComplete()
+			if !ok || complete {
+				return true
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			log.WithFields(log.Fields{
+				"name":      resource.Name,
+				"kind":      resource.Kind(),
+				"namespace": resource.Namespace,
+				"timeout":   timeout,
+			}).Error("provider.kubernetes: resource didn't become ready in time")
+			return false
+		case <-p.stop:
+			return false
+		}
+	}
+}
+
+// skipPlan reports an update that isn't applied because of its dependencies
+func (p *Provider) skipPlan(plan *UpdatePlan, reason string) {
+	resource := plan.Resource
+	p.budget.release(resource)
+	currentVersion := formatVersionWithDigest(plan.CurrentVersion, plan.CurrentDigest)
+	newVersion := formatVersionWithDigest(plan.NewVersion, plan.NewDigest)
+
+	log.WithFields(log.Fields{
+		"name":      resource.Name,
+		"kind":      resource.Kind(),
+		"namespace": resource.Namespace,
+		"update":    fmt.Sprintf("%s->%s", currentVersion, newVersion),
+		"reason":    reason,
+	}).Error("provider.kubernetes: update skipped")
+
+	p.sender.Send(types.EventNotification{
+		Name:         "update resource",
+		ResourceKind: resource.Kind(),
+		Identifier:   resource.Identifier,
+		Message:      fmt.Sprintf("%s %s/%s update %s->%s skipped, %s", resource.Kind(), resource.Namespace, resource.Name, currentVersion, newVersion, reason),
+		CreatedAt:    time.Now(),
+		Type:         types.NotificationDeploymentUpdate,
+		Level:        types.LevelError,
+		Channels:     types.ParseEventNotificationChannels(resource.GetAnnotations()),
+		Metadata:     updateMetadata(resource, plan, p.GetName()),
+	})
+}
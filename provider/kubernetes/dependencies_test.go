@@ -0,0 +1,271 @@
+package kubernetes
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+
+	apps_v1 "k8s.io/api/apps/v1"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rolloutImplementer adds updated resources to the cache the way the watcher
+// does, reporting a completed rollout unless the resource is listed in stuck
+type rolloutImplementer struct {
+	fakeImplementer
+	cache *k8s.GenericResourceCache
+	stuck map[string]bool
+
+	mu      sync.Mutex
+	applied []string
+}
+
+func (i *rolloutImplementer) Update(obj, previous *k8s.GenericResource) error {
+	i.mu.Lock()
+	i.applied = append(i.applied, obj.Name)
+	i.mu.Unlock()
+
+	updated := obj.DeepCopy()
+	if deployment, ok := updated.GetResource().(*apps_v1.Deployment); ok && !i.stuck[obj.Name] {
+		deployment.Status = apps_v1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	}
+	i.cache.Add(updated)
+	return nil
+}
+
+func (i *rolloutImplementer) appliedNames() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]string(nil), i.applied...)
+}
+
+func (s *threadSafeSender) last() types.EventNotification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sent) == 0 {
+		return types.EventNotification{}
+	}
+	return s.sent[len(s.sent)-1]
+}
+
+func TestProcessEventDependencyOrder(t *testing.T) {
+	defer func(interval time.Duration) { rolloutCheckInterval = interval }(rolloutCheckInterval)
+	rolloutCheckInterval = 5 * time.Millisecond
+
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("worker", "1.1.1", map[string]string{types.KeelDependsOnAnnotation: "deployment/xxxx/api"})))
+	grc.Add(MustParseGR(dryRunTestDeployment("api", "1.1.1", map[string]string{types.KeelDependsOnAnnotation: "deployment/xxxx/db, deployment/other/missing"})))
+	grc.Add(MustParseGR(dryRunTestDeployment("db", "1.1.1", map[string]string{})))
+	fp := &rolloutImplementer{cache: grc}
+	approver, teardown := approver()
+	defer teardown()
+	p, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	updated, err := p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}})
+	if err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	// dependents are updated in the background
+	if len(updated) != 1 {
+		t.Fatalf("expected 1 updated resource, got: %d", len(updated))
+	}
+	require.Eventually(t, func() bool {
+		return len(fp.appliedNames()) == 3
+	}, 5*time.Second, 5*time.Millisecond, "dependents were not updated")
+	if !reflect.DeepEqual(fp.appliedNames(), []string{"db", "api", "worker"}) {
+		t.Errorf("unexpected update order: %v", fp.appliedNames())
+	}
+}
+
+func TestProcessEventDependencyOrderNamedCluster(t *testing.T) {
+	defer func(interval time.Duration) { rolloutCheckInterval = interval }(rolloutCheckInterval)
+	rolloutCheckInterval = 5 * time.Millisecond
+
+	grc := &k8s.GenericResourceCache{}
+	for _, deployment := range []*apps_v1.Deployment{
+		dryRunTestDeployment("worker", "1.1.1", map[string]string{types.KeelDependsOnAnnotation: "deployment/xxxx/api"}),
+		dryRunTestDeployment("api", "1.1.1", map[string]string{}),
+	} {
+		resource := MustParseGR(deployment)
+		resource.SetCluster("prod")
+		grc.Add(resource)
+	}
+	fp := &rolloutImplementer{cache: grc, stuck: map[string]bool{"api": true}}
+	approver, teardown := approver()
+	defer teardown()
+	p, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	p.SetCluster("prod")
+
+	updated, err := p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}})
+	if err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	// the worker waits for the api of its own cluster
+	if len(updated) != 1 || updated[0].Identifier != "prod/deployment/xxxx/api" {
+		t.Fatalf("expected only the dependency to be updated, got: %v", fp.appliedNames())
+	}
+
+	p.Stop()
+	require.Eventually(t, func() bool {
+		_, pending := p.pending.version("prod/deployment/xxxx/worker")
+		return !pending
+	}, 5*time.Second, 5*time.Millisecond, "expected the dependent to be given up")
+}
+
+func TestProcessEventDependencyNotReady(t *testing.T) {
+	defer func(interval time.Duration) { rolloutCheckInterval = interval }(rolloutCheckInterval)
+	rolloutCheckInterval = 5 * time.Millisecond
+	defer func(timeout time.Duration) { dependencyTimeout = timeout }(dependencyTimeout)
+	dependencyTimeout = 50 * time.Millisecond
+
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("worker", "1.1.1", map[string]string{types.KeelDependsOnAnnotation: "deployment/xxxx/api"})))
+	grc.Add(MustParseGR(dryRunTestDeployment("api", "1.1.1", map[string]string{})))
+	fp := &rolloutImplementer{cache: grc, stuck: map[string]bool{"api": true}}
+	approver, teardown := approver()
+	defer teardown()
+	sender := &threadSafeSender{}
+	p, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	updated, err := p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}})
+	if err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if len(updated) != 1 {
+		t.Fatalf("expected 1 updated resource, got: %d", len(updated))
+	}
+	require.Eventually(t, func() bool {
+		return strings.Contains(sender.last().Message, "dependency deployment/xxxx/api was not updated")
+	}, 5*time.Second, 5*time.Millisecond, "expected skipped update notification")
+	if last := sender.last(); last.Level != types.LevelError {
+		t.Errorf("unexpected skipped update notification: %+v", last)
+	}
+	if !reflect.DeepEqual(fp.appliedNames(), []string{"api"}) {
+		t.Errorf("expected only the dependency to be updated, got: %v", fp.appliedNames())
+	}
+}
+
+func TestProcessEventDependencyDoesNotBlock(t *testing.T) {
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("worker", "1.1.1", map[string]string{types.KeelDependsOnAnnotation: "deployment/xxxx/api"})))
+	grc.Add(MustParseGR(dryRunTestDeployment("api", "1.1.1", map[string]string{})))
+	fp := &rolloutImplementer{cache: grc, stuck: map[string]bool{"api": true}}
+	approver, teardown := approver()
+	defer teardown()
+	sender := &threadSafeSender{}
+	p, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event processing waited for the dependency rollout")
+	}
+	if !reflect.DeepEqual(fp.appliedNames(), []string{"api"}) {
+		t.Errorf("expected only the dependency to be updated, got: %v", fp.appliedNames())
+	}
+
+	// dependents are skipped on shutdown
+	p.Stop()
+	require.Eventually(t, func() bool {
+		return strings.Contains(sender.last().Message, "dependency deployment/xxxx/api was not updated")
+	}, 5*time.Second, 5*time.Millisecond, "expected skipped update notification")
+}
+
+func TestProcessEventDependencyWaitingNotPlannedAgain(t *testing.T) {
+	defer func(interval time.Duration) { rolloutCheckInterval = interval }(rolloutCheckInterval)
+	rolloutCheckInterval = 5 * time.Millisecond
+	defer func(timeout time.Duration) { dependencyTimeout = timeout }(dependencyTimeout)
+	dependencyTimeout = 500 * time.Millisecond
+
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("worker", "1.1.1", map[string]string{types.KeelDependsOnAnnotation: "deployment/xxxx/api"})))
+	grc.Add(MustParseGR(dryRunTestDeployment("api", "1.1.1", map[string]string{})))
+	fp := &rolloutImplementer{cache: grc, stuck: map[string]bool{"api": true}}
+	approver, teardown := approver()
+	defer teardown()
+	sender := &threadSafeSender{}
+	p, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	// polls repeat the event while the worker waits for the api rollout
+	event := &types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}}
+	if _, err := p.processEvent(event); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	planned := len(p.Plans())
+	if _, err := p.processEvent(event); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if plans := p.Plans(); len(plans) != planned {
+		t.Errorf("waiting dependent must not be planned again, got: %d plans", len(plans))
+	}
+	if !reflect.DeepEqual(fp.appliedNames(), []string{"api"}) {
+		t.Errorf("expected only the dependency to be updated, got: %v", fp.appliedNames())
+	}
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(sender.last().Message, "dependency deployment/xxxx/api was not updated")
+	}, 5*time.Second, 5*time.Millisecond, "expected skipped update notification")
+
+	// the failed dependency still holds the worker back
+	if _, err := p.processEvent(event); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if !reflect.DeepEqual(fp.appliedNames(), []string{"api"}) {
+		t.Errorf("dependent of a failed dependency must not be updated, got: %v", fp.appliedNames())
+	}
+
+	// and is updated once the dependency rolled out
+	api := p.cachedResource("deployment/xxxx/api").DeepCopy()
+	api.GetResource().(*apps_v1.Deployment).Status = apps_v1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	grc.Add(api)
+	if _, err := p.processEvent(event); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if !reflect.DeepEqual(fp.appliedNames(), []string{"api", "worker"}) {
+		t.Errorf("expected the dependent to be updated, got: %v", fp.appliedNames())
+	}
+}
+
+func TestOrderPlansCycle(t *testing.T) {
+	plans := []*UpdatePlan{
+		{Resource: MustParseGR(dryRunTestDeployment("a", "1.1.1", map[string]string{types.KeelDependsOnAnnotation: "deployment/xxxx/b"}))},
+		{Resource: MustParseGR(dryRunTestDeployment("b", "1.1.1", map[string]string{types.KeelDependsOnAnnotation: "deployment/xxxx/a"}))},
+		{Resource: MustParseGR(dryRunTestDeployment("c", "1.1.1", map[string]string{types.KeelDependsOnAnnotation: "deployment/xxxx/b"}))},
+		{Resource: MustParseGR(dryRunTestDeployment("d", "1.1.1", map[string]string{}))},
+	}
+
+	waves, cyclic := orderPlans(plans)
+	if len(waves) != 1 || len(waves[0]) != 1 || waves[0][0].Resource.Name != "d" {
+		t.Errorf("expected only d to be ordered, got: %v", waves)
+	}
+	if len(cyclic) != 3 {
+		t.Errorf("expected a, b and c to be rejected, got: %d", len(cyclic))
+	}
+}
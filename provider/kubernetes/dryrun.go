@@ -0,0 +1,117 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/provider"
+	"github.com/keel-hq/keel/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SetDryRun - enables cluster wide dry-run mode, updates are planned and
+// reported but resources are never changed
+func (p *Provider) SetDryRun(dryRun bool) {
+	p.dryRun = dryRun
+}
+
+// Plans - plans computed for the latest events
+func (p *Provider) Plans() []*types.Plan {
+	return p.plans.Plans()
+}
+
+// isDryRun checks whether updates of the resource should only be reported,
+// either globally or through the keel.sh/dryRun annotation
+func (p *Provider) isDryRun(resource *k8s.GenericResource) bool {
+	if p.dryRun {
+		return true
+	}
+	if value, ok := resource.GetAnnotations()[types.KeelDryRunAnnotation]; ok {
+		return value == "true"
+	}
+	return resource.GetLabels()[types.KeelDryRunAnnotation] == "true"
+}
+
+func (p *Provider) splitDryRunPlans(plans []*UpdatePlan) (live, dryRun []*UpdatePlan) {
+	return provider.SplitDryRunPlans(plans, func(plan *UpdatePlan) bool {
+		return p.isDryRun(plan.Resource)
+	})
+}
+
+// previewPlans reports dry-run plans, resources are left untouched. Since the
+// resource keeps running the old version, polling finds the same update again,
+// it is reported only once.
+func (p *Provider) previewPlans(plans []*UpdatePlan) {
+	for _, plan := range plans {
+		resource := plan.Resource
+		version := plan.NewVersion + "@" + plan.NewDigest
+		if p.previewed[resource.Identifier] == version {
+			continue
+		}
+		p.previewed[resource.Identifier] = version
+		currentVersion := formatVersionWithDigest(plan.CurrentVersion, plan.CurrentDigest)
+		newVersion := formatVersionWithDigest(plan.NewVersion, plan.NewDigest)
+
+		log.WithFields(log.Fields{
+			"name":      resource.Name,
+			"kind":      resource.Kind(),
+			"namespace": resource.Namespace,
+			"update":    fmt.Sprintf("%s->%s", currentVersion, newVersion),
+		}).Info("provider.kubernetes: dry-run, resource would be updated")
+
+		metadata := updateMetadata(resource, plan, p.GetName())
+		metadata["dryRun"] = "true"
+
+		p.sender.Send(types.EventNotification{
+			ResourceKind: resource.Kind(),
+			Identifier:   resource.Identifier,
+			Name:         "dry-run update",
+			Message:      fmt.Sprintf("Would update %s %s/%s %s->%s (%s)", resource.Kind(), resource.Namespace, resource.Name, currentVersion, newVersion, strings.Join(trackedResourceImages(resource), ", ")),
+			CreatedAt:    time.Now(),
+			Type:         types.NotificationWouldUpdate,
+			Level:        types.LevelInfo,
+			Channels:     types.ParseEventNotificationChannels(resource.GetAnnotations()),
+			Metadata:     metadata,
+		})
+	}
+}
+
+// recordPlans stores plans computed for the event so they can be listed
+// through the API
+func (p *Provider) recordPlans(event *types.Event, plans, approved, dryRun []*UpdatePlan) {
+	provider.RecordPlans(p.plans, event, plans, approved, dryRun, p.describePlan)
+}
+
+func (p *Provider) describePlan(plan *UpdatePlan) *types.Plan {
+	return &types.Plan{
+		Provider:       p.GetName(),
+		Identifier:     plan.Resource.Identifier,
+		Namespace:      plan.Resource.Namespace,
+		Name:           plan.Resource.Name,
+		CurrentVersion: plan.CurrentVersion,
+		NewVersion:     plan.NewVersion,
+		CurrentDigest:  plan.CurrentDigest,
+		NewDigest:      plan.NewDigest,
+		Changes:        trackedResourceImages(plan.Resource),
+	}
+}
+
+// trackedResourceImages returns images of the containers, init containers and
+// image volumes keel tracks for the resource
+func trackedResourceImages(resource *k8s.GenericResource) []string {
+	annotations := resource.GetAnnotations()
+	labels := resource.GetLabels()
+
+	containerFilterFunction := GetMonitorContainersFromMeta(labels, annotations)
+	images := resource.GetImages(containerFilterFunction)
+	if getInitContainerTrackingFromMeta(labels, annotations) {
+		images = append(images, resource.GetInitImages(containerFilterFunction)...)
+	}
+	if getImageVolumeTrackingFromMeta(labels, annotations) {
+		images = append(images, resource.GetImageVolumeReferences(GetMonitorVolumesFromMeta(labels, annotations))...)
+	}
+	return images
+}
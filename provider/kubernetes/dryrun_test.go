@@ -0,0 +1,114 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+
+	apps_v1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func dryRunTestDeployment(name, tag string, annotations map[string]string) *apps_v1.Deployment {
+	return &apps_v1.Deployment{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:        name,
+			Namespace:   "xxxx",
+			Labels:      map[string]string{types.KeelPolicyLabel: "all"},
+			Annotations: annotations,
+		},
+		Spec: apps_v1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{Name: "app", Image: "gcr.io/v2-namespace/hello-world:" + tag},
+					},
+				},
+			},
+		},
+	}
+}
+
+// rolledOut marks the single replica of the deployment as updated and
+// available
+func rolledOut(deployment *apps_v1.Deployment) *apps_v1.Deployment {
+	deployment.Generation = 1
+	deployment.Status = apps_v1.DeploymentStatus{
+		ObservedGeneration: 1,
+		Replicas:           1,
+		UpdatedReplicas:    1,
+		AvailableReplicas:  1,
+	}
+	return deployment
+}
+
+func TestProcessEventDryRunAnnotation(t *testing.T) {
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{types.KeelDryRunAnnotation: "true"})))
+	approver, teardown := approver()
+	defer teardown()
+	sender := &fakeSender{}
+	provider, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	event := &types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}}
+	updated, err := provider.processEvent(event)
+	if err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if len(updated) != 0 || fp.updated != nil {
+		t.Errorf("resource must not be updated in dry-run mode")
+	}
+	if sender.sentEvent.Type != types.NotificationWouldUpdate || sender.sentEvent.Metadata["dryRun"] != "true" {
+		t.Errorf("expected would update notification, got: %+v", sender.sentEvent)
+	}
+
+	plans := provider.Plans()
+	if len(plans) != 1 {
+		t.Fatalf("expected 1 plan, got: %d", len(plans))
+	}
+	if !plans[0].DryRun || plans[0].Identifier != "deployment/xxxx/dep-1" || plans[0].NewVersion != "1.4.5" || plans[0].Changes[0] != "gcr.io/v2-namespace/hello-world:1.4.5" {
+		t.Errorf("unexpected plan: %+v", plans[0])
+	}
+
+	// the same update found by the next poll is not reported again
+	sender.sentEvent = types.EventNotification{}
+	if _, err := provider.processEvent(event); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if sender.sentEvent.Type == types.NotificationWouldUpdate {
+		t.Errorf("did not expect a repeated notification")
+	}
+	if len(provider.Plans()) != 2 {
+		t.Errorf("expected plans of both events, got: %d", len(provider.Plans()))
+	}
+}
+
+func TestProcessEventGlobalDryRun(t *testing.T) {
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{})))
+	approver, teardown := approver()
+	defer teardown()
+	provider, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	provider.SetDryRun(true)
+
+	_, err = provider.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}})
+	if err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if fp.updated != nil {
+		t.Errorf("resource must not be updated in dry-run mode")
+	}
+	if plans := provider.Plans(); len(plans) != 1 || !plans[0].DryRun {
+		t.Errorf("expected a dry-run plan, got: %+v", plans)
+	}
+}
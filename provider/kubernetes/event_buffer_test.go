@@ -43,6 +43,12 @@ func (s *threadSafeSender) count() int {
 	return len(s.sent)
 }
 
+func (s *threadSafeSender) events() []types.EventNotification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]types.EventNotification(nil), s.sent...)
+}
+
 // slowImplementer records every update and simulates API latency.
 type slowImplementer struct {
 	fakeImplementer
@@ -51,7 +57,7 @@ type slowImplementer struct {
 	updated []string
 }
 
-func (i *slowImplementer) Update(obj *k8s.GenericResource) error {
+func (i *slowImplementer) Update(obj, previous *k8s.GenericResource) error {
 	time.Sleep(i.delay)
 	i.mu.Lock()
 	defer i.mu.Unlock()
@@ -0,0 +1,91 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"github.com/keel-hq/keel/internal/gitops"
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+	"github.com/keel-hq/keel/util/image"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SetGitOps - repository updates of resources with keel.sh/gitopsPath are
+// committed to instead of patching the resources, Flux or Argo CD sync them
+func (p *Provider) SetGitOps(repo *gitops.Repository) {
+	p.gitops = repo
+}
+
+// updateResource applies the updated resource. Resources synced from a
+// GitOps repository get their changed images committed to it, the SHA of
+// the commit is returned; other resources are patched in the cluster.
+func (p *Provider) updateResource(resource, previous *k8s.GenericResource, currentVersion, newVersion string) (string, error) {
+	annotations := resource.GetAnnotations()
+	path := annotations[types.KeelGitOpsPathAnnotation]
+	if path == "" {
+		return "", p.implementer.Update(resource, previous)
+	}
+	if p.gitops == nil {
+		return "", fmt.Errorf("%s is set but no GitOps repository is configured", types.KeelGitOpsPathAnnotation)
+	}
+
+	// same tag updates only change the pod template, there's nothing to
+	// write unless the images are pinned by digest
+	images := gitopsImages(resource, previous)
+	if len(images) == 0 {
+		return "", fmt.Errorf("no image changes to commit, use %s to write updates of the same tag", types.KeelPinDigestAnnotation)
+	}
+
+	commit, err := p.gitops.Commit(&gitops.Update{
+		Identifier:     resource.Identifier,
+		Kind:           resource.Kind(),
+		Namespace:      resource.Namespace,
+		Name:           resource.Name,
+		CurrentVersion: currentVersion,
+		NewVersion:     newVersion,
+		Path:           path,
+		Values:         annotations[types.KeelGitOpsValuesAnnotation],
+		Images:         images,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"name":      resource.Name,
+		"kind":      resource.Kind(),
+		"namespace": resource.Namespace,
+		"path":      path,
+		"commit":    commit,
+	}).Info("provider.kubernetes: update committed to the GitOps repository")
+
+	return commit, nil
+}
+
+// gitopsImages - images the update changes, all images of the resource
+// when the previous state is unknown
+func gitopsImages(resource, previous *k8s.GenericResource) []gitops.Image {
+	var updated []string
+	if previous != nil {
+		for _, change := range changedImages(previous, resource) {
+			updated = append(updated, change.updated)
+		}
+	} else {
+		updated = resourceImages(resource)
+	}
+
+	var images []gitops.Image
+	for _, img := range updated {
+		ref, err := image.Parse(img)
+		if err != nil {
+			continue
+		}
+		images = append(images, gitops.Image{
+			Repository: ref.Repository(),
+			Tag:        ref.Tag(),
+			Digest:     ref.Digest(),
+		})
+	}
+	return images
+}
@@ -0,0 +1,122 @@
+package kubernetes
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/keel-hq/keel/internal/gitops"
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %s: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gitopsRepository creates a local bare repository with the manifest of
+// dep-1 on main
+func gitopsRepository(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	bare := filepath.Join(root, "apps.git")
+	runGit(t, root, "init", "--bare", "--initial-branch=main", bare)
+	seed := filepath.Join(root, "seed")
+	runGit(t, root, "clone", bare, seed)
+	if err := os.MkdirAll(filepath.Join(seed, "xxxx"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dep-1
+  namespace: xxxx
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: gcr.io/v2-namespace/hello-world:1.1.1
+`
+	if err := os.WriteFile(filepath.Join(seed, "xxxx", "dep-1.yaml"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, seed, "add", ".")
+	runGit(t, seed, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-m", "initial")
+	runGit(t, seed, "push", "origin", "HEAD:refs/heads/main")
+	return bare
+}
+
+func TestProcessEventGitOpsWriteBack(t *testing.T) {
+	bare := gitopsRepository(t)
+	repo, err := gitops.New(gitops.Config{URL: bare, Dir: filepath.Join(t.TempDir(), "work")})
+	if err != nil {
+		t.Fatalf("failed to create repository: %s", err)
+	}
+
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{types.KeelGitOpsPathAnnotation: "xxxx/dep-1.yaml"})))
+	approver, teardown := approver()
+	defer teardown()
+	sender := &fakeSender{}
+	provider, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	provider.SetGitOps(repo)
+
+	event := &types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}}
+	updated, err := provider.processEvent(event)
+	if err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if len(updated) != 1 {
+		t.Fatalf("expected 1 updated resource, got: %d", len(updated))
+	}
+	if fp.updated != nil {
+		t.Errorf("resource must not be patched in the cluster")
+	}
+
+	head := runGit(t, bare, "rev-parse", "main")
+	if sender.sentEvent.Level != types.LevelSuccess || sender.sentEvent.Metadata["commit"] != head {
+		t.Errorf("expected successful update with commit %s, got: %+v", head, sender.sentEvent)
+	}
+	if content := runGit(t, bare, "show", "main:xxxx/dep-1.yaml"); !strings.Contains(content, "image: gcr.io/v2-namespace/hello-world:1.4.5") {
+		t.Errorf("image not written back:\n%s", content)
+	}
+}
+
+func TestProcessEventGitOpsWithoutRepository(t *testing.T) {
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{types.KeelGitOpsPathAnnotation: "xxxx/dep-1.yaml"})))
+	approver, teardown := approver()
+	defer teardown()
+	sender := &fakeSender{}
+	provider, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	event := &types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}}
+	updated, err := provider.processEvent(event)
+	if err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if len(updated) != 0 || fp.updated != nil {
+		t.Errorf("resource must not be updated")
+	}
+	if sender.sentEvent.Level != types.LevelError || !strings.Contains(sender.sentEvent.Message, "no GitOps repository is configured") {
+		t.Errorf("expected failed update notification, got: %+v", sender.sentEvent)
+	}
+}
@@ -0,0 +1,181 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/provider"
+	"github.com/keel-hq/keel/types"
+	"github.com/keel-hq/keel/util/image"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SetHistory - stores every applied update so it can be listed and rolled
+// back through the API
+func (p *Provider) SetHistory(history provider.HistoryStore) {
+	p.history = history
+}
+
+// imageChange - image of a container, init container or image volume
+// before and after an update
+type imageChange struct {
+	name     string
+	previous string
+	updated  string
+}
+
+// changedImages returns containers, init containers and image volumes with
+// different images in previous and updated
+func changedImages(previous, updated *k8s.GenericResource) (changes []imageChange) {
+	containers := updated.Containers()
+	for idx, c := range previous.Containers() {
+		if idx < len(containers) && containers[idx].Image != c.Image {
+			changes = append(changes, imageChange{name: c.Name, previous: c.Image, updated: containers[idx].Image})
+		}
+	}
+	initContainers := updated.InitContainers()
+	for idx, c := range previous.InitContainers() {
+		if idx < len(initContainers) && initContainers[idx].Image != c.Image {
+			changes = append(changes, imageChange{name: c.Name, previous: c.Image, updated: initContainers[idx].Image})
+		}
+	}
+	volumes := updated.Volumes()
+	for idx, vol := range previous.Volumes() {
+		if vol.Image != nil && idx < len(volumes) && volumes[idx].Image != nil && volumes[idx].Image.Reference != vol.Image.Reference {
+			changes = append(changes, imageChange{name: vol.Name, previous: vol.Image.Reference, updated: volumes[idx].Image.Reference})
+		}
+	}
+	return changes
+}
+
+// recordHistory stores an update record for every image changed by the plan
+func (p *Provider) recordHistory(plan *UpdatePlan) {
+	if p.history == nil || plan.Previous == nil {
+		return
+	}
+	resource := plan.Resource
+	if plan.Approver == "" {
+		plan.Approver = p.approvalVoters(plan)
+	}
+
+	changes := changedImages(plan.Previous, resource)
+	if len(changes) == 0 {
+		// same tag updates (force policy) only move the digest
+		for _, tc := range getTrackedContainers(resource, resource.GetLabels(), resource.GetAnnotations()) {
+			ref, err := image.Parse(tc.image)
+			if err == nil && ref.Tag() == plan.NewVersion {
+				changes = append(changes, imageChange{name: tc.name, previous: tc.image, updated: tc.image})
+			}
+		}
+	}
+
+	for _, change := range changes {
+		_, err := p.history.CreateUpdateRecord(&types.UpdateRecord{
+			Provider:       p.GetName(),
+			Identifier:     resource.Identifier,
+			ResourceKind:   resource.Kind(),
+			Container:      change.name,
+			PreviousImage:  change.previous,
+			NewImage:       change.updated,
+			PreviousDigest: plan.CurrentDigest,
+			NewDigest:      plan.NewDigest,
+			Trigger:        plan.Trigger,
+			Approver:       plan.Approver,
+		})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"name":      resource.Name,
+				"kind":      resource.Kind(),
+				"namespace": resource.Namespace,
+				"container": change.name,
+			}).Error("provider.kubernetes: failed to store update history")
+		}
+	}
+}
+
+// Rollback - re-applies the previous image of an update record. The rollback
+// is handed to the event loop and goes through the same path as any other
+// update (rollout budget, notifications, rollout verification, history) but
+// doesn't wait for approvals, requesting the rollback is the approval. It
+// returns once the rollback is accepted, without waiting for it to be
+// applied. Pre-update Jobs are not run, they target the new images.
+func (p *Provider) Rollback(record *types.UpdateRecord, user string) error {
+	var resource *k8s.GenericResource
+	for _, r := range p.cache.Values() {
+		if r.Identifier == record.Identifier {
+			resource = r
+			break
+		}
+	}
+	if resource == nil {
+		return provider.ErrResourceNotFound
+	}
+	if p.isDryRun(resource) {
+		return fmt.Errorf("%w: %s is in dry-run mode", provider.ErrInvalidRollback, resource.Identifier)
+	}
+
+	previous := resource.DeepCopy()
+	updated := resource.DeepCopy()
+	current, err := setImage(updated, record.Container, record.PreviousImage)
+	if err != nil {
+		return fmt.Errorf("%w: %s", provider.ErrInvalidRollback, err)
+	}
+	if current == record.PreviousImage {
+		return fmt.Errorf("%w: container %s is already running %s", provider.ErrInvalidRollback, record.Container, record.PreviousImage)
+	}
+	setUpdateTime(updated)
+
+	plan := &UpdatePlan{
+		Resource:       updated,
+		CurrentVersion: imageTag(current),
+		NewVersion:     imageTag(record.PreviousImage),
+		NewDigest:      record.PreviousDigest,
+		Previous:       previous,
+		Trigger:        types.TriggerTypeRollback.String(),
+		Approver:       user,
+	}
+	if current == record.NewImage {
+		plan.CurrentDigest = record.NewDigest
+	}
+
+	select {
+	case p.rollbacks <- plan:
+		return nil
+	case <-p.stop:
+		return ErrProviderStopped
+	}
+}
+
+// setImage updates the image of the named container, init container or image
+// volume, returning the image it replaced
+func setImage(resource *k8s.GenericResource, name, img string) (string, error) {
+	for idx, c := range resource.Containers() {
+		if c.Name == name {
+			resource.UpdateContainer(idx, img)
+			return c.Image, nil
+		}
+	}
+	for idx, c := range resource.InitContainers() {
+		if c.Name == name {
+			resource.UpdateInitContainer(idx, img)
+			return c.Image, nil
+		}
+	}
+	for idx, vol := range resource.Volumes() {
+		if vol.Name == name && vol.Image != nil {
+			resource.UpdateImageVolume(idx, img)
+			return vol.Image.Reference, nil
+		}
+	}
+	return "", fmt.Errorf("container %s not found in %s", name, resource.Identifier)
+}
+
+func imageTag(img string) string {
+	ref, err := image.Parse(img)
+	if err != nil {
+		return img
+	}
+	return ref.Tag()
+}
@@ -0,0 +1,120 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/provider"
+	"github.com/keel-hq/keel/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateHistoryAndRollback(t *testing.T) {
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{})))
+	store, teardown := NewTestingUtils()
+	defer teardown()
+	approver, teardownApprover := approver()
+	defer teardownApprover()
+	sender := &threadSafeSender{}
+	p, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	p.SetHistory(store)
+	p.SetRolloutBudget(5, 0)
+
+	_, err = p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5", Digest: "sha256:new"}})
+	if err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+
+	records, err := store.ListUpdateRecords(&types.UpdateRecordQuery{Identifier: "deployment/xxxx/dep-1"})
+	if err != nil {
+		t.Fatalf("failed to list history: %s", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 history entry, got: %d", len(records))
+	}
+	record := records[0]
+	if record.Container != "app" || record.PreviousImage != "gcr.io/v2-namespace/hello-world:1.1.1" || record.NewImage != "gcr.io/v2-namespace/hello-world:1.4.5" {
+		t.Errorf("unexpected history entry: %+v", record)
+	}
+	if record.NewDigest != "sha256:new" || record.Trigger != types.TriggerTypeDefault.String() || record.ResourceKind != "deployment" {
+		t.Errorf("unexpected history entry: %+v", record)
+	}
+
+	// watchers refresh the cache with the updated resource
+	grc.Add(fp.updated)
+
+	go p.Start()
+	defer p.Stop()
+
+	sent := sender.count()
+	err = p.Rollback(record, "admin")
+	if err != nil {
+		t.Fatalf("rollback failed: %s", err)
+	}
+	require.Eventually(t, func() bool {
+		last := sender.last()
+		return sender.count() > sent && last.Type == types.NotificationDeploymentUpdate && last.Level == types.LevelSuccess
+	}, 5*time.Second, 5*time.Millisecond, "expected update notification")
+	if img := fp.updated.Containers()[0].Image; img != "gcr.io/v2-namespace/hello-world:1.1.1" {
+		t.Errorf("expected previous image to be re-applied, got: %s", img)
+	}
+	p.budget.mu.Lock()
+	_, inFlight := p.budget.inFlight["deployment/xxxx/dep-1"]
+	p.budget.mu.Unlock()
+	if !inFlight {
+		t.Error("expected the rollback to count towards the rollout budget")
+	}
+
+	records, err = store.ListUpdateRecords(&types.UpdateRecordQuery{Identifier: "deployment/xxxx/dep-1"})
+	if err != nil {
+		t.Fatalf("failed to list history: %s", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected rollback to be stored in history, got: %d entries", len(records))
+	}
+	var rollback *types.UpdateRecord
+	for _, r := range records {
+		if r.Trigger == types.TriggerTypeRollback.String() {
+			rollback = r
+		}
+	}
+	if rollback == nil || rollback.Approver != "admin" || rollback.NewImage != "gcr.io/v2-namespace/hello-world:1.1.1" {
+		t.Errorf("unexpected rollback history entry: %+v", rollback)
+	}
+}
+
+func TestRollbackErrors(t *testing.T) {
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{})))
+	approver, teardown := approver()
+	defer teardown()
+	p, err := NewProvider(&fakeImplementer{}, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		record *types.UpdateRecord
+		want   error
+	}{
+		{"unknown resource", &types.UpdateRecord{Identifier: "deployment/xxxx/other", Container: "app", PreviousImage: "gcr.io/v2-namespace/hello-world:1.0.0"}, provider.ErrResourceNotFound},
+		{"unknown container", &types.UpdateRecord{Identifier: "deployment/xxxx/dep-1", Container: "proxy", PreviousImage: "gcr.io/v2-namespace/hello-world:1.0.0"}, provider.ErrInvalidRollback},
+		{"image already running", &types.UpdateRecord{Identifier: "deployment/xxxx/dep-1", Container: "app", PreviousImage: "gcr.io/v2-namespace/hello-world:1.1.1"}, provider.ErrInvalidRollback},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Rollback(tt.record, "admin"); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got: %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -12,7 +12,11 @@ import (
 	batch_v1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	batch_typed_v1 "k8s.io/client-go/kubernetes/typed/batch/v1"
 	core_v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/util/retry"
 
@@ -25,19 +29,21 @@ type Implementer interface {
 	Namespaces() (*v1.NamespaceList, error)
 	Nodes() (*v1.NodeList, error)
 	Deployments(namespace string) (*apps_v1.DeploymentList, error)
-	Update(obj *k8s.GenericResource) error
+	Update(obj, previous *k8s.GenericResource) error
 	Secret(namespace, name string) (*v1.Secret, error)
 	Pods(namespace, labelSelector string) (*v1.PodList, error)
 	DeletePod(namespace, name string, opts *meta_v1.DeleteOptions) error
 
 	ConfigMaps(namespace string) core_v1.ConfigMapInterface
+	Jobs(namespace string) batch_typed_v1.JobInterface
 }
 
 // KubernetesImplementer - default kubernetes client implementer, uses
 // https://github.com/kubernetes/client-go v3.0.0-beta.0
 type KubernetesImplementer struct {
-	cfg    *rest.Config
-	client kubernetes.Interface
+	cfg     *rest.Config
+	client  kubernetes.Interface
+	dynamic dynamic.Interface
 }
 
 // Opts - implementer options, usually for k8s deployments
@@ -92,7 +98,15 @@ func NewKubernetesImplementer(opts *Opts) (*KubernetesImplementer, error) {
 		return nil, err
 	}
 
-	return &KubernetesImplementer{client: client, cfg: cfg}, nil
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("provider.kubernetes: failed to create kubernetes dynamic client")
+		return nil, err
+	}
+
+	return &KubernetesImplementer{client: client, dynamic: dynamicClient, cfg: cfg}, nil
 }
 
 // Client returns the underlying kubernetes clientset.
@@ -100,6 +114,11 @@ func (i *KubernetesImplementer) Client() *kubernetes.Clientset {
 	return i.client.(*kubernetes.Clientset)
 }
 
+// Dynamic returns the dynamic client used for custom resources such as Argo Rollouts.
+func (i *KubernetesImplementer) Dynamic() dynamic.Interface {
+	return i.dynamic
+}
+
 func (i *KubernetesImplementer) Config() *rest.Config {
 	return i.cfg
 }
@@ -128,44 +147,82 @@ func (i *KubernetesImplementer) Deployments(namespace string) (*apps_v1.Deployme
 	return l, err
 }
 
-// Update converts generic resource into specific kubernetes type and updates it.
-// Updates are retried on conflict (HTTP 409) using exponential backoff, re-fetching
-// the latest object before each attempt so the retried write carries a fresh
-// resourceVersion.
-func (i *KubernetesImplementer) Update(obj *k8s.GenericResource) error {
+// Update writes the image and keel annotation changes of a generic resource
+// back to the cluster. Instead of sending the whole (possibly stale) object it
+// re-fetches the latest version and patches only the fields keel manages, with
+// the "keel" field manager, so fields owned by other controllers or GitOps
+// tools are left alone. Keel labels and annotations are only removed when
+// previous, the state obj was made from, had them. Patches are bound to the
+// fetched resourceVersion and retried on conflict (HTTP 409) using
+// exponential backoff.
+func (i *KubernetesImplementer) Update(obj, previous *k8s.GenericResource) error {
+	opts := meta_v1.PatchOptions{FieldManager: FieldManager}
 	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		switch resource := obj.GetResource().(type) {
 		case *apps_v1.Deployment:
-			latest, err := i.client.AppsV1().Deployments(resource.Namespace).Get(context.TODO(), resource.Name, meta_v1.GetOptions{})
+			client := i.client.AppsV1().Deployments(resource.Namespace)
+			latest, err := client.Get(context.TODO(), resource.Name, meta_v1.GetOptions{})
 			if err != nil {
 				return err
 			}
-			resource.ResourceVersion = latest.ResourceVersion
-			_, err = i.client.AppsV1().Deployments(resource.Namespace).Update(context.TODO(), resource, meta_v1.UpdateOptions{})
+			patch, err := createPatch(latest, obj, previous, apps_v1.Deployment{})
+			if err != nil || patch == nil {
+				return err
+			}
+			_, err = client.Patch(context.TODO(), resource.Name, k8stypes.StrategicMergePatchType, patch, opts)
 			return err
 		case *apps_v1.StatefulSet:
-			latest, err := i.client.AppsV1().StatefulSets(resource.Namespace).Get(context.TODO(), resource.Name, meta_v1.GetOptions{})
+			client := i.client.AppsV1().StatefulSets(resource.Namespace)
+			latest, err := client.Get(context.TODO(), resource.Name, meta_v1.GetOptions{})
 			if err != nil {
 				return err
 			}
-			resource.ResourceVersion = latest.ResourceVersion
-			_, err = i.client.AppsV1().StatefulSets(resource.Namespace).Update(context.TODO(), resource, meta_v1.UpdateOptions{})
+			patch, err := createPatch(latest, obj, previous, apps_v1.StatefulSet{})
+			if err != nil || patch == nil {
+				return err
+			}
+			_, err = client.Patch(context.TODO(), resource.Name, k8stypes.StrategicMergePatchType, patch, opts)
 			return err
 		case *apps_v1.DaemonSet:
-			latest, err := i.client.AppsV1().DaemonSets(resource.Namespace).Get(context.TODO(), resource.Name, meta_v1.GetOptions{})
+			client := i.client.AppsV1().DaemonSets(resource.Namespace)
+			latest, err := client.Get(context.TODO(), resource.Name, meta_v1.GetOptions{})
 			if err != nil {
 				return err
 			}
-			resource.ResourceVersion = latest.ResourceVersion
-			_, err = i.client.AppsV1().DaemonSets(resource.Namespace).Update(context.TODO(), resource, meta_v1.UpdateOptions{})
+			patch, err := createPatch(latest, obj, previous, apps_v1.DaemonSet{})
+			if err != nil || patch == nil {
+				return err
+			}
+			_, err = client.Patch(context.TODO(), resource.Name, k8stypes.StrategicMergePatchType, patch, opts)
 			return err
 		case *batch_v1.CronJob:
-			latest, err := i.client.BatchV1().CronJobs(resource.Namespace).Get(context.TODO(), resource.Name, meta_v1.GetOptions{})
+			client := i.client.BatchV1().CronJobs(resource.Namespace)
+			latest, err := client.Get(context.TODO(), resource.Name, meta_v1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			patch, err := createPatch(latest, obj, previous, batch_v1.CronJob{})
+			if err != nil || patch == nil {
+				return err
+			}
+			_, err = client.Patch(context.TODO(), resource.Name, k8stypes.StrategicMergePatchType, patch, opts)
+			return err
+		case *unstructured.Unstructured:
+			custom := obj.GetCustomKind()
+			if custom == nil {
+				return fmt.Errorf("unsupported resource kind: %s", resource.GroupVersionKind())
+			}
+			ri := i.dynamic.Resource(custom.GroupVersionResource()).Namespace(resource.GetNamespace())
+			latest, err := ri.Get(context.TODO(), resource.GetName(), meta_v1.GetOptions{})
 			if err != nil {
 				return err
 			}
-			resource.ResourceVersion = latest.ResourceVersion
-			_, err = i.client.BatchV1().CronJobs(resource.Namespace).Update(context.TODO(), resource, meta_v1.UpdateOptions{})
+			// custom resources have no strategic merge metadata
+			patch, err := createPatch(latest, obj, previous, nil)
+			if err != nil || patch == nil {
+				return err
+			}
+			_, err = ri.Patch(context.TODO(), resource.GetName(), k8stypes.MergePatchType, patch, opts)
 			return err
 		default:
 			return fmt.Errorf("unsupported object type")
@@ -192,3 +249,8 @@ func (i *KubernetesImplementer) DeletePod(namespace, name string, opts *meta_v1.
 func (i *KubernetesImplementer) ConfigMaps(namespace string) core_v1.ConfigMapInterface {
 	return i.client.CoreV1().ConfigMaps(namespace)
 }
+
+// Jobs - returns an interface to jobs for a specified namespace
+func (i *KubernetesImplementer) Jobs(namespace string) batch_typed_v1.JobInterface {
+	return i.client.BatchV1().Jobs(namespace)
+}
@@ -2,15 +2,23 @@ package kubernetes
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+
 	apps_v1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	fake "k8s.io/client-go/kubernetes/fake"
 	k8stesting "k8s.io/client-go/testing"
 )
@@ -41,7 +49,7 @@ func testDeployment(resourceVersion, image string) *apps_v1.Deployment {
 	}
 }
 
-// TestUpdateRetriesOnConflict verifies that a 409 Conflict on the first update
+// TestUpdateRetriesOnConflict verifies that a 409 Conflict on the first patch
 // attempt is retried: the retried attempt re-fetches the object, carries the
 // fresh resourceVersion, and succeeds.
 func TestUpdateRetriesOnConflict(t *testing.T) {
@@ -56,15 +64,23 @@ func TestUpdateRetriesOnConflict(t *testing.T) {
 	latest := testDeployment(freshRV, oldImage)
 	client := fake.NewSimpleClientset(latest)
 
-	// The first update attempt is rejected with 409 Conflict; subsequent
+	// The first patch attempt is rejected with 409 Conflict; subsequent
 	// attempts fall through to the default (object tracker) behavior.
 	var updateRVs []string
-	client.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
-		dep, ok := action.(k8stesting.UpdateAction).GetObject().(*apps_v1.Deployment)
+	client.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch, ok := action.(k8stesting.PatchAction)
 		if !ok {
-			t.Fatalf("expected a deployment update action, got %T", action)
+			t.Fatalf("expected a deployment patch action, got %T", action)
+		}
+		var fields struct {
+			Metadata struct {
+				ResourceVersion string `json:"resourceVersion"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(patch.GetPatch(), &fields); err != nil {
+			t.Fatalf("failed to decode patch: %v", err)
 		}
-		updateRVs = append(updateRVs, dep.ResourceVersion)
+		updateRVs = append(updateRVs, fields.Metadata.ResourceVersion)
 		if len(updateRVs) == 1 {
 			return true, nil, apierrors.NewConflict(
 				schema.GroupResource{Group: "apps", Resource: "deployments"},
@@ -80,17 +96,17 @@ func TestUpdateRetriesOnConflict(t *testing.T) {
 	stale := testDeployment(staleRV, newImage)
 
 	impl := &KubernetesImplementer{client: client}
-	err := impl.Update(MustParseGR(stale))
+	err := impl.Update(MustParseGR(stale), nil)
 	if err != nil {
 		t.Fatalf("expected Update to succeed after conflict retry, got: %v", err)
 	}
 
 	if len(updateRVs) != 2 {
-		t.Fatalf("expected the update to be attempted twice, got %d attempts", len(updateRVs))
+		t.Fatalf("expected the patch to be attempted twice, got %d attempts", len(updateRVs))
 	}
 	for i, rv := range updateRVs {
 		if rv != freshRV {
-			t.Errorf("update attempt %d carried resourceVersion %q, want the fresh %q from the re-fetch", i+1, rv, freshRV)
+			t.Errorf("patch attempt %d carried resourceVersion %q, want the fresh %q from the re-fetch", i+1, rv, freshRV)
 		}
 	}
 
@@ -101,9 +117,6 @@ func TestUpdateRetriesOnConflict(t *testing.T) {
 	if got := updated.Spec.Template.Spec.Containers[0].Image; got != newImage {
 		t.Errorf("expected deployment image %q, got %q", newImage, got)
 	}
-	if updated.ResourceVersion != freshRV {
-		t.Errorf("expected updated object to carry the fresh resourceVersion %q, got %q", freshRV, updated.ResourceVersion)
-	}
 }
 
 // TestUpdateDoesNotRetryOnForbidden verifies that non-conflict API errors are
@@ -113,7 +126,7 @@ func TestUpdateDoesNotRetryOnForbidden(t *testing.T) {
 	client := fake.NewSimpleClientset(latest)
 
 	var updateCount int
-	client.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+	client.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		updateCount++
 		return true, nil, apierrors.NewForbidden(
 			schema.GroupResource{Group: "apps", Resource: "deployments"},
@@ -125,7 +138,7 @@ func TestUpdateDoesNotRetryOnForbidden(t *testing.T) {
 	stale := testDeployment("1", "gcr.io/v2-namespace/hello-world:2.0.0")
 
 	impl := &KubernetesImplementer{client: client}
-	err := impl.Update(MustParseGR(stale))
+	err := impl.Update(MustParseGR(stale), nil)
 	if err == nil {
 		t.Fatal("expected an error from Update, got nil")
 	}
@@ -136,3 +149,189 @@ func TestUpdateDoesNotRetryOnForbidden(t *testing.T) {
 		t.Fatalf("expected the update to be attempted exactly once without retry, got %d attempts", updateCount)
 	}
 }
+
+// TestUpdateRollout verifies that Argo Rollouts are patched through the
+// dynamic client.
+func TestUpdateRollout(t *testing.T) {
+	rollout := func(resourceVersion, image string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "Rollout",
+			"metadata": map[string]interface{}{
+				"name":            conflictTestName,
+				"namespace":       conflictTestNamespace,
+				"resourceVersion": resourceVersion,
+			},
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{"name": "app", "image": image},
+						},
+					},
+				},
+			},
+		}}
+	}
+
+	scheme := runtime.NewScheme()
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme,
+		map[schema.GroupVersionResource]string{k8s.RolloutResource: "RolloutList"},
+		rollout("10", "gcr.io/v2-namespace/hello-world:1.0.0"))
+
+	impl := &KubernetesImplementer{dynamic: client}
+	err := impl.Update(MustParseGR(rollout("1", "gcr.io/v2-namespace/hello-world:2.0.0")), nil)
+	if err != nil {
+		t.Fatalf("failed to update rollout: %v", err)
+	}
+
+	updated, err := client.Resource(k8s.RolloutResource).Namespace(conflictTestNamespace).Get(context.TODO(), conflictTestName, meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get updated rollout: %v", err)
+	}
+	containers, _, _ := unstructured.NestedSlice(updated.Object, "spec", "template", "spec", "containers")
+	if got := containers[0].(map[string]interface{})["image"]; got != "gcr.io/v2-namespace/hello-world:2.0.0" {
+		t.Errorf("expected rollout image to be updated, got %q", got)
+	}
+}
+
+// TestUpdatePatchesOnlyKeelFields verifies that fields changed on the API
+// server by other controllers survive an update from a stale keel copy.
+func TestUpdatePatchesOnlyKeelFields(t *testing.T) {
+	serverReplicas := int32(5)
+	latest := testDeployment("10", "gcr.io/v2-namespace/hello-world:1.0.0")
+	latest.Spec.Replicas = &serverReplicas
+	latest.Annotations = map[string]string{"argocd.argoproj.io/sync-wave": "1"}
+	latest.Spec.Template.Spec.Containers[0].Name = "app"
+	latest.Spec.Template.Spec.Containers = append(latest.Spec.Template.Spec.Containers, v1.Container{Name: "istio-proxy", Image: "istio/proxyv2:1.20.0"})
+	client := fake.NewSimpleClientset(latest)
+
+	var patches []k8stesting.PatchActionImpl
+	client.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patches = append(patches, action.(k8stesting.PatchActionImpl))
+		return false, nil, nil
+	})
+
+	staleReplicas := int32(1)
+	stale := testDeployment("1", "gcr.io/v2-namespace/hello-world:2.0.0")
+	stale.Spec.Replicas = &staleReplicas
+	stale.Spec.Template.Spec.Containers[0].Name = "app"
+	stale.Annotations = map[string]string{types.KeelDigestAnnotation: "sha256:new", "kubernetes.io/change-cause": "keel automated update"}
+	stale.Spec.Template.Annotations = map[string]string{types.KeelUpdateTimeAnnotation: "now"}
+
+	impl := &KubernetesImplementer{client: client}
+	if err := impl.Update(MustParseGR(stale), nil); err != nil {
+		t.Fatalf("failed to update deployment: %v", err)
+	}
+
+	if len(patches) != 1 {
+		t.Fatalf("expected a single patch, got %d", len(patches))
+	}
+	if patches[0].PatchType != k8stypes.StrategicMergePatchType {
+		t.Errorf("unexpected patch type: %s", patches[0].PatchType)
+	}
+	if patches[0].PatchOptions.FieldManager != FieldManager {
+		t.Errorf("unexpected field manager: %q", patches[0].PatchOptions.FieldManager)
+	}
+	if strings.Contains(string(patches[0].Patch), "replicas") {
+		t.Errorf("patch should not touch replicas: %s", patches[0].Patch)
+	}
+
+	updated, err := client.AppsV1().Deployments(conflictTestNamespace).Get(context.TODO(), conflictTestName, meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get updated deployment: %v", err)
+	}
+	if *updated.Spec.Replicas != serverReplicas {
+		t.Errorf("expected replicas to be preserved, got %d", *updated.Spec.Replicas)
+	}
+	containers := updated.Spec.Template.Spec.Containers
+	if len(containers) != 2 || containers[0].Image != "gcr.io/v2-namespace/hello-world:2.0.0" || containers[1].Image != "istio/proxyv2:1.20.0" {
+		t.Errorf("unexpected containers: %+v", containers)
+	}
+	if updated.Annotations["argocd.argoproj.io/sync-wave"] != "1" || updated.Annotations[types.KeelDigestAnnotation] != "sha256:new" {
+		t.Errorf("unexpected annotations: %v", updated.Annotations)
+	}
+	if updated.Spec.Template.Annotations[types.KeelUpdateTimeAnnotation] != "now" {
+		t.Errorf("expected update time annotation, got: %v", updated.Spec.Template.Annotations)
+	}
+}
+
+// TestUpdatePatchesPolicyAnnotations verifies that keel.sh labels and
+// annotations changed through the API are written and removed.
+func TestUpdatePatchesPolicyAnnotations(t *testing.T) {
+	latest := testDeployment("10", "gcr.io/v2-namespace/hello-world:1.0.0")
+	latest.Labels = map[string]string{types.KeelPolicyLabel: "all", "app": "hello"}
+	latest.Annotations = map[string]string{"argocd.argoproj.io/sync-wave": "1"}
+	client := fake.NewSimpleClientset(latest)
+	previous := MustParseGR(latest.DeepCopy())
+
+	desired := testDeployment("10", "gcr.io/v2-namespace/hello-world:1.0.0")
+	desired.Labels = map[string]string{"app": "hello"}
+	desired.Annotations = map[string]string{types.KeelPolicyLabel: "minor", "keel.sh/proxy/policy": "patch"}
+
+	impl := &KubernetesImplementer{client: client}
+	if err := impl.Update(MustParseGR(desired), previous); err != nil {
+		t.Fatalf("failed to update deployment: %v", err)
+	}
+
+	updated, err := client.AppsV1().Deployments(conflictTestNamespace).Get(context.TODO(), conflictTestName, meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get updated deployment: %v", err)
+	}
+	if _, ok := updated.Labels[types.KeelPolicyLabel]; ok || updated.Labels["app"] != "hello" {
+		t.Errorf("unexpected labels: %v", updated.Labels)
+	}
+	if updated.Annotations[types.KeelPolicyLabel] != "minor" || updated.Annotations["keel.sh/proxy/policy"] != "patch" || updated.Annotations["argocd.argoproj.io/sync-wave"] != "1" {
+		t.Errorf("unexpected annotations: %v", updated.Annotations)
+	}
+}
+
+// TestUpdateKeepsNewKeelAnnotations verifies that keel.sh annotations added
+// on the API server after keel read the resource are not removed.
+func TestUpdateKeepsNewKeelAnnotations(t *testing.T) {
+	previous := testDeployment("1", "gcr.io/v2-namespace/hello-world:1.0.0")
+	previous.Annotations = map[string]string{types.KeelPolicyLabel: "all", types.KeelDigestAnnotation: "sha256:old"}
+
+	latest := testDeployment("10", "gcr.io/v2-namespace/hello-world:1.0.0")
+	latest.Annotations = map[string]string{types.KeelPolicyLabel: "all", types.KeelDigestAnnotation: "sha256:old", types.KeelPausedAnnotation: "true"}
+	client := fake.NewSimpleClientset(latest)
+
+	desired := testDeployment("1", "gcr.io/v2-namespace/hello-world:2.0.0")
+	desired.Annotations = map[string]string{types.KeelPolicyLabel: "all"}
+
+	impl := &KubernetesImplementer{client: client}
+	if err := impl.Update(MustParseGR(desired), MustParseGR(previous)); err != nil {
+		t.Fatalf("failed to update deployment: %v", err)
+	}
+
+	updated, err := client.AppsV1().Deployments(conflictTestNamespace).Get(context.TODO(), conflictTestName, meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get updated deployment: %v", err)
+	}
+	if updated.Annotations[types.KeelPausedAnnotation] != "true" {
+		t.Errorf("expected the annotation added after the resource was read to be kept, got: %v", updated.Annotations)
+	}
+	if _, ok := updated.Annotations[types.KeelDigestAnnotation]; ok {
+		t.Errorf("expected the removed digest annotation to be removed, got: %v", updated.Annotations)
+	}
+}
+
+// TestUpdateSkipsUnchanged verifies that no patch is sent when the cluster
+// already runs the desired images.
+func TestUpdateSkipsUnchanged(t *testing.T) {
+	client := fake.NewSimpleClientset(testDeployment("10", "gcr.io/v2-namespace/hello-world:2.0.0"))
+
+	var patchCount int
+	client.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patchCount++
+		return false, nil, nil
+	})
+
+	impl := &KubernetesImplementer{client: client}
+	if err := impl.Update(MustParseGR(testDeployment("1", "gcr.io/v2-namespace/hello-world:2.0.0")), nil); err != nil {
+		t.Fatalf("failed to update deployment: %v", err)
+	}
+	if patchCount != 0 {
+		t.Errorf("expected no patch, got %d", patchCount)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
 
@@ -18,10 +17,11 @@ import (
 
 	"github.com/keel-hq/keel/approvals"
 	"github.com/keel-hq/keel/extension/notification"
-	"github.com/keel-hq/keel/internal/concurrent"
+	"github.com/keel-hq/keel/internal/gitops"
 	"github.com/keel-hq/keel/internal/k8s"
 	"github.com/keel-hq/keel/internal/policy"
 	"github.com/keel-hq/keel/pkg/config"
+	"github.com/keel-hq/keel/provider"
 	"github.com/keel-hq/keel/types"
 	"github.com/keel-hq/keel/util/image"
 	"github.com/keel-hq/keel/util/policies"
@@ -79,6 +79,14 @@ func init() {
 // ProviderName - provider name
 const ProviderName = "kubernetes"
 
+// ProviderNameFor - name of the provider of the cluster, ie: kubernetes/production
+func ProviderNameFor(cluster string) string {
+	if cluster == "" {
+		return ProviderName
+	}
+	return ProviderName + "/" + cluster
+}
+
 var versionreg = regexp.MustCompile(`:[^:]*$`)
 
 // GenericResourceCache an interface for generic resource cache.
@@ -107,6 +115,20 @@ type UpdatePlan struct {
 	// New digest taken from the event repository, empty when the trigger
 	// did not provide one
 	NewDigest string
+
+	// Previous - resource state before the update, used to roll back
+	// when the rollout can't be verified
+	Previous *k8s.GenericResource
+
+	// Trigger and Approver are recorded in the update history
+	Trigger  string
+	Approver string
+
+	// Commit - SHA of the GitOps commit the update was written back with
+	Commit string
+
+	// event the plan was created for, queued plans are planned again with it
+	event *types.Event
 }
 
 func (p *UpdatePlan) String() string {
@@ -134,12 +156,18 @@ func updateMetadata(resource *k8s.GenericResource, plan *UpdatePlan, providerNam
 		"namespace": resource.GetNamespace(),
 		"name":      resource.GetName(),
 	}
+	if resource.Cluster != "" {
+		metadata["cluster"] = resource.Cluster
+	}
 	if plan.CurrentDigest != "" {
 		metadata["previousDigest"] = plan.CurrentDigest
 	}
 	if plan.NewDigest != "" {
 		metadata["newDigest"] = plan.NewDigest
 	}
+	if plan.Commit != "" {
+		metadata["commit"] = plan.Commit
+	}
 	return metadata
 }
 
@@ -155,8 +183,39 @@ type Provider struct {
 
 	cache GenericResourceCache
 
+	// dryRun - plan and report updates without changing any resource
+	dryRun bool
+	plans  *provider.PlanHistory
+	// previewed - latest version reported per resource in dry-run mode,
+	// only accessed while processing events
+	previewed map[string]string
+
+	// history - stores applied updates, optional
+	history provider.HistoryStore
+	// deferred - updates waiting for their update window
+	deferred *provider.DeferredQueue
+	// pauses - paused namespaces and versions available for paused resources
+	pauses provider.PauseStore
+	// stages - versions running in promotion stages
+	stages provider.StageStore
+	// promoted - latest version promoted per resource and repository, only
+	// accessed from the event loop
+	promoted map[string]string
+	// budget - limits rollouts in flight
+	budget *rolloutBudget
+	// pending - resources updated in the background, not planned again
+	// meanwhile
+	pending *pendingUpdates
+	// gitops - repository updates of resources with keel.sh/gitopsPath are
+	// committed to, optional
+	gitops *gitops.Repository
+	// cluster - name of the cluster, empty for the unnamed cluster keel runs in
+	cluster string
+
 	events chan *types.Event
-	stop   chan struct{}
+	// rollbacks - rollbacks requested through the API
+	rollbacks chan *UpdatePlan
+	stop      chan struct{}
 }
 
 // NewProvider - create new kubernetes based provider
@@ -171,7 +230,14 @@ func NewProvider(implementer Implementer, sender notification.Sender, approvalMa
 		runningDigests:  k8s.NewRunningDigestResolver(implementer),
 		cache:           cache,
 		approvalManager: approvalManager,
+		plans:           provider.NewPlanHistory(provider.DefaultPlanHistory),
+		previewed:       make(map[string]string),
+		promoted:        make(map[string]string),
+		budget:          newRolloutBudget("", 0, 0),
+		pending:         newPendingUpdates(),
+		deferred:        provider.NewDeferredQueue(ProviderName, nil, nil),
 		events:          make(chan *types.Event, config.DefaultEventBufferSize),
+		rollbacks:       make(chan *UpdatePlan),
 		stop:            make(chan struct{}),
 		sender:          sender,
 	}, nil
@@ -231,7 +297,16 @@ func logBackpressure(event *types.Event, p *Provider) {
 
 // GetName - get provider name
 func (p *Provider) GetName() string {
-	return ProviderName
+	return ProviderNameFor(p.cluster)
+}
+
+// SetCluster - names the cluster the provider updates, providers of several
+// clusters get distinct names
+func (p *Provider) SetCluster(name string) {
+	p.cluster = name
+	p.budget.mu.Lock()
+	p.budget.cluster = name
+	p.budget.mu.Unlock()
 }
 
 // Start - starts kubernetes provider, waits for events
@@ -347,6 +422,25 @@ func getImageVolumeTrackingFromMeta(labels map[string]string, annotations map[st
 	return false
 }
 
+func getPinDigestFromMeta(labels map[string]string, annotations map[string]string) bool {
+
+	searchKey := strings.ToLower(types.KeelPinDigestAnnotation)
+
+	for k, v := range labels {
+		if strings.ToLower(k) == searchKey {
+			return v == "true"
+		}
+	}
+
+	for k, v := range annotations {
+		if strings.ToLower(k) == searchKey {
+			return v == "true"
+		}
+	}
+
+	return false
+}
+
 // GetMonitorVolumesFromMeta returns a VolumeFilter that matches volume names
 // against the keel.sh/monitorContainers regex (shared with containers so a
 // single annotation governs all image references on the resource).
@@ -368,26 +462,10 @@ func (p *Provider) TrackedImages() ([]*types.TrackedImage, error) {
 
 		// ignoring unlabelled deployments
 		plc := policy.GetPolicyFromLabelsOrAnnotations(labels, annotations)
-		if plc.Type() == types.PolicyTypeNone {
+		if plc.Type() == types.PolicyTypeNone && !policy.HasContainerPolicies(annotations) {
 			continue
 		}
 
-		schedule, ok := annotations[types.KeelPollScheduleAnnotation]
-		if ok {
-			_, err := cron.Parse(schedule)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"error":     err,
-					"schedule":  schedule,
-					"name":      gr.Name,
-					"namespace": gr.Namespace,
-				}).Error("provider.kubernetes: failed to parse poll schedule, setting default schedule")
-				schedule = types.KeelPollDefaultSchedule
-			}
-		} else {
-			schedule = types.KeelPollDefaultSchedule
-		}
-
 		// trigger type, we only care for "poll" type triggers
 		trigger := policies.GetTriggerPolicy(labels, annotations)
 
@@ -399,25 +477,23 @@ func (p *Provider) TrackedImages() ([]*types.TrackedImage, error) {
 		}
 		secrets = append(secrets, gr.GetImagePullSecrets()...)
 
-		filterFunc := GetMonitorContainersFromMeta(annotations, labels)
-
-		images := gr.GetImages(filterFunc)
-		if getInitContainerTrackingFromMeta(labels, annotations) {
-			images = append(images, gr.GetInitImages(filterFunc)...)
-		}
-		if getImageVolumeTrackingFromMeta(labels, annotations) {
-			volumeFilter := GetMonitorVolumesFromMeta(annotations, labels)
-			images = append(images, gr.GetImageVolumeReferences(volumeFilter)...)
-		}
 		platforms, platformErr := p.platforms.Resolve(gr)
 		runningDigests := p.runningDigests.Resolve(gr)
+		pinDigest := getPinDigestFromMeta(labels, annotations)
 
-		for _, img := range images {
-			ref, err := image.Parse(img)
+		for _, tc := range getTrackedContainers(gr, labels, annotations) {
+			// container scoped annotations override the resource ones
+			containerAnnotations := policy.ContainerAnnotations(tc.name, annotations)
+			containerPolicy := policy.GetPolicyFromLabelsOrAnnotations(labels, containerAnnotations)
+			if containerPolicy.Type() == types.PolicyTypeNone {
+				continue
+			}
+
+			ref, err := image.Parse(tc.image)
 			if err != nil {
 				log.WithFields(log.Fields{
 					"error":     err,
-					"image":     img,
+					"image":     tc.image,
 					"namespace": gr.Namespace,
 					"name":      gr.Name,
 				}).Error("provider.kubernetes: failed to parse image")
@@ -435,16 +511,19 @@ func (p *Provider) TrackedImages() ([]*types.TrackedImage, error) {
 
 			trackedImages = append(trackedImages, &types.TrackedImage{
 				Image:          ref,
-				RunningDigests: runningDigests[img],
-				PollSchedule:   schedule,
+				Container:      tc.name,
+				RunningDigests: runningDigests[tc.image],
+				PollSchedule:   getPollSchedule(gr, containerAnnotations),
 				Trigger:        trigger,
 				Provider:       ProviderName,
+				Cluster:        gr.Cluster,
 				Namespace:      gr.Namespace,
 				Secrets:        secrets,
 				Meta:           make(map[string]string),
 				Platforms:      platforms,
 				PlatformErr:    platformErr,
-				Policy:         plc,
+				PinDigest:      pinDigest,
+				Policy:         containerPolicy,
 			})
 		}
 	}
@@ -452,12 +531,73 @@ func (p *Provider) TrackedImages() ([]*types.TrackedImage, error) {
 	return trackedImages, nil
 }
 
+// trackedContainer - name and image of a tracked container, init container
+// or image volume
+type trackedContainer struct {
+	name  string
+	image string
+}
+
+func getTrackedContainers(gr *k8s.GenericResource, labels map[string]string, annotations map[string]string) []trackedContainer {
+	var tracked []trackedContainer
+
+	filterFunc := GetMonitorContainersFromMeta(annotations, labels)
+	for _, c := range gr.Containers() {
+		if filterFunc(c) {
+			tracked = append(tracked, trackedContainer{name: c.Name, image: c.Image})
+		}
+	}
+	if getInitContainerTrackingFromMeta(labels, annotations) {
+		for _, c := range gr.InitContainers() {
+			if filterFunc(c) {
+				tracked = append(tracked, trackedContainer{name: c.Name, image: c.Image})
+			}
+		}
+	}
+	if getImageVolumeTrackingFromMeta(labels, annotations) {
+		volumeFilter := GetMonitorVolumesFromMeta(annotations, labels)
+		for _, vol := range gr.Volumes() {
+			if vol.Image != nil && vol.Image.Reference != "" && volumeFilter(vol) {
+				tracked = append(tracked, trackedContainer{name: vol.Name, image: vol.Image.Reference})
+			}
+		}
+	}
+	return tracked
+}
+
+// getPollSchedule returns keel.sh/pollSchedule or the default schedule when
+// it's not set or can't be parsed
+func getPollSchedule(gr *k8s.GenericResource, annotations map[string]string) string {
+	schedule, ok := annotations[types.KeelPollScheduleAnnotation]
+	if !ok {
+		return types.KeelPollDefaultSchedule
+	}
+	_, err := cron.Parse(schedule)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"schedule":  schedule,
+			"name":      gr.Name,
+			"namespace": gr.Namespace,
+		}).Error("provider.kubernetes: failed to parse poll schedule, setting default schedule")
+		return types.KeelPollDefaultSchedule
+	}
+	return schedule
+}
+
 func (p *Provider) startInternal() error {
 	log.WithFields(log.Fields{
 		"context":           "provider.kubernetes",
 		"event_buffer_size": cap(p.events),
 	}).Info("provider.kubernetes: starting event loop")
 
+	deferredTicker := time.NewTicker(provider.DeferredCheckInterval)
+	defer deferredTicker.Stop()
+	stageTicker := time.NewTicker(provider.StageCheckInterval)
+	defer stageTicker.Stop()
+	budgetTicker := time.NewTicker(rolloutCheckInterval)
+	defer budgetTicker.Stop()
+
 	for {
 		select {
 		case event := <-p.events:
@@ -469,6 +609,14 @@ func (p *Provider) startInternal() error {
 					"tag":   event.Repository.Tag,
 				}).Error("provider.kubernetes: failed to process event")
 			}
+		case plan := <-p.rollbacks:
+			p.updateDeployments([]*UpdatePlan{plan})
+		case <-deferredTicker.C:
+			p.processDeferred()
+		case <-stageTicker.C:
+			p.checkStages()
+		case <-budgetTicker.C:
+			p.processQueued()
 		case <-p.stop:
 			log.Info("provider.kubernetes: got shutdown signal, stopping...")
 			return nil
@@ -490,7 +638,20 @@ func (p *Provider) processEvent(event *types.Event) (updated []*k8s.GenericResou
 		return
 	}
 
+	// dry-run plans are only reported, they don't wait for approvals
+	plans, previews := p.splitDryRunPlans(plans)
+	p.previewPlans(previews)
+
 	approvedPlans := p.checkForApprovals(event, plans)
+	p.recordPlans(event, plans, approvedPlans, previews)
+	approvedPlans = p.deferPlans(event, approvedPlans)
+	for _, plan := range approvedPlans {
+		plan.event = event
+		plan.Trigger = event.TriggerName
+		if plan.Trigger == "" {
+			plan.Trigger = types.TriggerTypeDefault.String()
+		}
+	}
 
 	return p.updateDeployments(approvedPlans)
 }
@@ -498,24 +659,21 @@ func (p *Provider) processEvent(event *types.Event) (updated []*k8s.GenericResou
 // updateDeployments applies every update plan of a single event. Each plan
 // targets a distinct resource, so the plans are handed to a bounded worker
 // pool instead of being applied one after another: a slow deployment update
-// no longer delays the rest of the event (keel-hq/keel#443). Events
-// themselves are still processed one at a time, so ordering is preserved.
+// no longer delays the rest of the event (keel-hq/keel#443). Resources listed
+// in keel.sh/dependsOn of another planned resource are updated first and
+// must become ready before their dependents are updated, dependents wait in
+// the background. Plans over the rollout budget are queued and applied once
+// earlier rollouts complete. Events themselves are still processed one at a
+// time, so ordering is preserved.
 func (p *Provider) updateDeployments(plans []*UpdatePlan) (updated []*k8s.GenericResource, err error) {
 	updated = make([]*k8s.GenericResource, 0, len(plans))
 	if len(plans) == 0 {
 		return updated, nil
 	}
 
-	var mu sync.Mutex
-	concurrent.Run(concurrentPlanWorkers, len(plans), func(i int) {
-		if r := p.applyPlan(plans[i]); r != nil {
-			mu.Lock()
-			updated = append(updated, r)
-			mu.Unlock()
-		}
-	})
-
-	return updated, nil
+	// held plans are planned again by a later event
+	plans, _ = p.holdDependents(plans)
+	return append(updated, p.applyOrderedPlans(p.admitPlans(plans))...), nil
 }
 
 // applyPlan applies a single update plan to its resource and sends the
@@ -528,17 +686,7 @@ func (p *Provider) applyPlan(plan *UpdatePlan) *k8s.GenericResource {
 	labels := resource.GetLabels()
 
 	notificationChannels := types.ParseEventNotificationChannels(annotations)
-	containerFilterFunction := GetMonitorContainersFromMeta(labels, annotations)
-	trackInitContainers := getInitContainerTrackingFromMeta(labels, annotations)
-	trackImageVolumes := getImageVolumeTrackingFromMeta(labels, annotations)
-
-	images := resource.GetImages(containerFilterFunction)
-	if trackInitContainers {
-		images = append(images, resource.GetInitImages(containerFilterFunction)...)
-	}
-	if trackImageVolumes {
-		images = append(images, resource.GetImageVolumeReferences(GetMonitorVolumesFromMeta(labels, annotations))...)
-	}
+	images := trackedResourceImages(resource)
 
 	currentVersion := formatVersionWithDigest(plan.CurrentVersion, plan.CurrentDigest)
 	newVersion := formatVersionWithDigest(plan.NewVersion, plan.NewDigest)
@@ -555,6 +703,10 @@ func (p *Provider) applyPlan(plan *UpdatePlan) *k8s.GenericResource {
 		Metadata:     updateMetadata(resource, plan, p.GetName()),
 	})
 
+	if err := p.runPreUpdateJob(plan); err != nil {
+		return nil
+	}
+
 	timestamp := time.Now().Format(time.RFC3339)
 	annotations["kubernetes.io/change-cause"] = fmt.Sprintf("keel automated update, version %s -> %s [%s]", currentVersion, newVersion, timestamp)
 
@@ -568,7 +720,8 @@ func (p *Provider) applyPlan(plan *UpdatePlan) *k8s.GenericResource {
 
 	resource.SetAnnotations(annotations)
 
-	err := p.implementer.Update(resource)
+	commit, err := p.updateResource(resource, plan.Previous, plan.CurrentVersion, plan.NewVersion)
+	plan.Commit = commit
 	kubernetesVersionedUpdatesCounter.With(prometheus.Labels{"kubernetes": fmt.Sprintf("%s/%s", resource.Namespace, resource.Name)}).Inc()
 	if err != nil {
 		log.WithFields(log.Fields{
@@ -594,6 +747,10 @@ func (p *Provider) applyPlan(plan *UpdatePlan) *k8s.GenericResource {
 		return nil
 	}
 
+	// recorded before the approval is archived, its voters are the approvers
+	p.recordHistory(plan)
+	p.clearAvailable(resource)
+
 	if err := p.updateComplete(plan); err != nil {
 		log.WithFields(log.Fields{
 			"error":     err,
@@ -641,10 +798,39 @@ func (p *Provider) applyPlan(plan *UpdatePlan) *k8s.GenericResource {
 		"newDigest":      plan.NewDigest,
 		"namespace":      resource.Namespace,
 	}).Info("provider.kubernetes: resource updated")
+
+	// GitOps updates reach the cluster once synced, pods can't be
+	// restarted yet
+	if needsPodRestart(resource, plan.Previous) && plan.Commit == "" {
+		go p.restartPods(plan)
+	}
+
+	deadline, verify := getRolloutDeadline(labels, annotations)
+	verify = verify && plan.Previous != nil
+	smokeTests := getSmokeTests(resource)
+	switch {
+	case verify && len(smokeTests) > 0:
+		go func() {
+			if p.verifyRollout(plan, deadline) {
+				p.runSmokeTests(plan, smokeTests)
+			}
+		}()
+	case verify:
+		go p.verifyRollout(plan, deadline)
+	case len(smokeTests) > 0:
+		go func() {
+			if p.waitReady(plan) {
+				p.runSmokeTests(plan, smokeTests)
+			}
+		}()
+	}
+
 	return resource
 }
 
-func getDesiredImage(delta map[string]string, currentImage string) (string, error) {
+// getDesiredImage returns the image from delta (repository -> tag) that
+// replaces currentImage, pinned to the digest when one is given
+func getDesiredImage(delta map[string]string, currentImage, digest string) (string, error) {
 	currentRef, err := image.Parse(currentImage)
 	if err != nil {
 		return "", err
@@ -656,11 +842,7 @@ func getDesiredImage(delta map[string]string, currentImage string) (string, erro
 				return "", err
 			}
 
-			// updating image
-			if ref.Registry() == image.DefaultRegistryHostname {
-				return fmt.Sprintf("%s:%s", ref.ShortName(), tag), nil
-			}
-			return fmt.Sprintf("%s:%s", ref.Repository(), tag), nil
+			return updatedImage(ref, tag, digest), nil
 		}
 	}
 	return "", fmt.Errorf("image %s not found in deltas", currentImage)
@@ -672,13 +854,30 @@ func (p *Provider) createUpdatePlans(repo *types.Repository) ([]*UpdatePlan, err
 }
 
 func (p *Provider) createUpdatePlansForEvent(event *types.Event) ([]*UpdatePlan, error) {
+	if event.Chart {
+		return nil, nil
+	}
 	return p.createUpdatePlansForTrigger(&event.Repository, event.TriggerName)
 }
 
 func (p *Provider) createUpdatePlansForTrigger(repo *types.Repository, triggerName string) ([]*UpdatePlan, error) {
 	impacted := []*UpdatePlan{}
 
+	pausedNamespaces, err := p.pausedNamespaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get paused namespaces: %w", err)
+	}
+
 	for _, resource := range p.cache.Values() {
+		if version, ok := p.pending.version(resource.Identifier); ok {
+			log.WithFields(log.Fields{
+				"name":      resource.Name,
+				"kind":      resource.Kind(),
+				"namespace": resource.Namespace,
+				"pending":   version,
+			}).Debug("provider.kubernetes: update of the resource is in progress, ignoring")
+			continue
+		}
 
 		labels := resource.GetLabels()
 		annotations := resource.GetAnnotations()
@@ -689,11 +888,23 @@ func (p *Provider) createUpdatePlansForTrigger(repo *types.Repository, triggerNa
 			continue
 		}
 
+		// containers may have their own policies even when the resource has none
 		plc := policy.GetPolicyFromLabelsOrAnnotations(labels, annotations)
-		if plc.Type() == types.PolicyTypeNone {
+		if plc.Type() == types.PolicyTypeNone && !policy.HasContainerPolicies(annotations) {
 			continue
 		}
 
+		if isVersionBlocked(annotations, repo) {
+			log.WithFields(log.Fields{
+				"deployment": resource.Name,
+				"kind":       resource.Kind(),
+				"namespace":  resource.Namespace,
+				"image":      repo.String(),
+			}).Debug("provider.kubernetes: version is blocked after a failed rollout, ignoring")
+			continue
+		}
+
+		previous := resource.DeepCopy()
 		updated, shouldUpdateDeployment, err := checkForUpdate(plc, repo, resource)
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -705,7 +916,25 @@ func (p *Provider) createUpdatePlansForTrigger(repo *types.Repository, triggerNa
 			continue
 		}
 
+		if shouldUpdateDeployment && (pausedNamespaces[resource.Namespace] || IsPausedFromMeta(labels, annotations)) {
+			// paused resources are still checked to report the newest version
+			p.trackAvailable(resource, repo, updated)
+			continue
+		}
+
+		if shouldUpdateDeployment && !p.promotionAllowed(resource, repo, updated) {
+			log.WithFields(log.Fields{
+				"deployment": resource.Name,
+				"kind":       resource.Kind(),
+				"namespace":  resource.Namespace,
+				"image":      repo.String(),
+				"stage":      annotations[types.KeelPromoteAfterAnnotation],
+			}).Debug("provider.kubernetes: version has not soaked in the previous stage yet, ignoring")
+			continue
+		}
+
 		if shouldUpdateDeployment {
+			updated.Previous = previous
 			updated.CurrentDigest = p.currentDigest(resource, repo, updated)
 			if repo.PlatformVerified {
 				platforms, resolutionErr := p.platforms.Resolve(resource)
@@ -16,6 +16,8 @@ import (
 	apps_v1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	batch_typed_v1 "k8s.io/client-go/kubernetes/typed/batch/v1"
 	core_v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
@@ -35,6 +37,12 @@ func (p *fakeProvider) TrackedImages() ([]*types.TrackedImage, error) {
 func (p *fakeProvider) List() []string {
 	return []string{"fakeprovider"}
 }
+func (p *fakeProvider) Plans() []*types.Plan {
+	return nil
+}
+func (p *fakeProvider) Rollback(record *types.UpdateRecord, user string) error {
+	return nil
+}
 func (p *fakeProvider) Stop() {
 	return
 }
@@ -75,7 +83,7 @@ func (i *fakeImplementer) Deployments(namespace string) (*apps_v1.DeploymentList
 	return i.deploymentList, nil
 }
 
-func (i *fakeImplementer) Update(obj *k8s.GenericResource) error {
+func (i *fakeImplementer) Update(obj, previous *k8s.GenericResource) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 	i.updated = obj
@@ -109,6 +117,10 @@ func (i *fakeImplementer) ConfigMaps(namespace string) core_v1.ConfigMapInterfac
 	return nil
 }
 
+func (i *fakeImplementer) Jobs(namespace string) batch_typed_v1.JobInterface {
+	return nil
+}
+
 type fakeSender struct {
 	mu        sync.Mutex
 	sentEvent types.EventNotification
@@ -1003,6 +1015,61 @@ func TestProcessEvent(t *testing.T) {
 	}
 }
 
+func TestProcessEventRollout(t *testing.T) {
+	fp := &fakeImplementer{}
+	rollout := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Rollout",
+		"metadata": map[string]interface{}{
+			"name":        "rollout-1",
+			"namespace":   "ns-1",
+			"annotations": map[string]interface{}{types.KeelPolicyLabel: "minor"},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app", "image": "gcr.io/v2-namespace/hello-world:1.1.1"},
+					},
+				},
+			},
+			"strategy": map[string]interface{}{
+				"blueGreen": map[string]interface{}{"activeService": "active"},
+			},
+		},
+	}}
+
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(rollout))
+	approver, teardown := approver()
+	defer teardown()
+	provider, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	event := &types.Event{Repository: types.Repository{
+		Name: "gcr.io/v2-namespace/hello-world",
+		Tag:  "1.2.0",
+	}}
+	if _, err = provider.processEvent(event); err != nil {
+		t.Errorf("got error while processing event: %s", err)
+	}
+
+	if fp.updated == nil {
+		t.Fatalf("rollout was not updated")
+	}
+	if fp.updated.Kind() != "rollout" {
+		t.Errorf("unexpected kind: %s", fp.updated.Kind())
+	}
+	if fp.updated.Containers()[0].Image != "gcr.io/v2-namespace/hello-world:1.2.0" {
+		t.Errorf("expected rollout image to be updated, got: %s", fp.updated.Containers()[0].Image)
+	}
+	if fp.updated.GetSpecAnnotations()[types.KeelUpdateTimeAnnotation] == "" {
+		t.Errorf("expected rollout template to carry the update time annotation")
+	}
+}
+
 func TestProcessEventBuildNumber(t *testing.T) {
 	fp := &fakeImplementer{}
 	fp.namespaces = &v1.NamespaceList{
@@ -1914,3 +1981,116 @@ func TestTrackedInitImagesWithSecrets(t *testing.T) {
 		t.Errorf("expected very-secret, got: %s", imgs[0].Secrets[1])
 	}
 }
+
+func TestContainerScopedPolicies(t *testing.T) {
+	dep := &apps_v1.Deployment{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "dep-1",
+			Namespace: "xxxx",
+			Annotations: map[string]string{
+				types.KeelPolicyLabel:            "minor",
+				"keel.sh/proxy/policy":           "patch",
+				"keel.sh/proxy/pollSchedule":     "@every 5m",
+				"keel.sh/proxy/approvals":        "1",
+				types.KeelPollScheduleAnnotation: "@every 1h",
+			},
+		},
+		Spec: apps_v1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{Name: "app", Image: "gcr.io/v2-namespace/hello-world:1.1.1"},
+						{Name: "proxy", Image: "gcr.io/v2-namespace/proxy:1.1.1"},
+					},
+				},
+			},
+		},
+	}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dep))
+	approver, teardown := approver()
+	defer teardown()
+	provider, err := NewProvider(&fakeImplementer{}, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	imgs, err := provider.TrackedImages()
+	if err != nil || len(imgs) != 2 {
+		t.Fatalf("expected 2 tracked images, got: %v, error: %v", imgs, err)
+	}
+	for _, img := range imgs {
+		switch img.Container {
+		case "app":
+			if img.Policy.Name() != "minor" || img.PollSchedule != "@every 1h" {
+				t.Errorf("unexpected app tracking: %s, %s", img.Policy.Name(), img.PollSchedule)
+			}
+		case "proxy":
+			if img.Policy.Name() != "patch" || img.PollSchedule != "@every 5m" {
+				t.Errorf("unexpected proxy tracking: %s, %s", img.Policy.Name(), img.PollSchedule)
+			}
+		default:
+			t.Errorf("unexpected container: %s", img.Container)
+		}
+	}
+
+	plans, err := provider.createUpdatePlans(&types.Repository{Name: "gcr.io/v2-namespace/proxy", Tag: "1.2.0"})
+	if err != nil || len(plans) != 0 {
+		t.Errorf("expected minor proxy update to be ignored, got: %v, error: %v", plans, err)
+	}
+
+	plans, err = provider.createUpdatePlans(&types.Repository{Name: "gcr.io/v2-namespace/proxy", Tag: "1.1.2"})
+	if err != nil || len(plans) != 1 {
+		t.Fatalf("expected patch proxy update, got: %v, error: %v", plans, err)
+	}
+	if required, _ := getMinApprovals(plans[0]); required != 1 {
+		t.Errorf("expected proxy update to require 1 approval, got: %d", required)
+	}
+
+	plans, err = provider.createUpdatePlans(&types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.2.0"})
+	if err != nil || len(plans) != 1 {
+		t.Fatalf("expected minor app update, got: %v, error: %v", plans, err)
+	}
+	if required, _ := getMinApprovals(plans[0]); required != 0 {
+		t.Errorf("expected app update to require no approvals, got: %d", required)
+	}
+}
+
+func TestProviderCluster(t *testing.T) {
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	gr := MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{types.KeelDryRunAnnotation: "true"}))
+	gr.SetCluster("production")
+	grc.Add(gr)
+	approver, teardown := approver()
+	defer teardown()
+	sender := &fakeSender{}
+	provider, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	provider.SetCluster("production")
+
+	if provider.GetName() != "kubernetes/production" {
+		t.Errorf("unexpected provider name: %s", provider.GetName())
+	}
+
+	images, err := provider.TrackedImages()
+	if err != nil {
+		t.Fatalf("failed to get tracked images: %s", err)
+	}
+	if len(images) != 1 || images[0].Cluster != "production" {
+		t.Errorf("expected a tracked image of the production cluster, got: %+v", images)
+	}
+
+	event := &types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}}
+	if _, err := provider.processEvent(event); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if sender.sentEvent.Identifier != "production/deployment/xxxx/dep-1" {
+		t.Errorf("unexpected identifier: %s", sender.sentEvent.Identifier)
+	}
+	if sender.sentEvent.Metadata["cluster"] != "production" {
+		t.Errorf("expected the cluster in the notification metadata, got: %v", sender.sentEvent.Metadata)
+	}
+}
@@ -0,0 +1,178 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// FieldManager - field manager recorded for the changes keel makes
+const FieldManager = "keel"
+
+// isKeelManaged - labels and annotations owned by keel: its own keel.sh/ keys
+// (policies, schedules and the state written during updates, changed by keel
+// itself and through the HTTP API) plus the rollout change cause. Other keys
+// are left to their owners.
+func isKeelManaged(key string) bool {
+	return strings.HasPrefix(key, "keel.sh/") ||
+		strings.HasPrefix(key, "keel.observer/") ||
+		key == "kubernetes.io/change-cause"
+}
+
+// keelManagedSpecAnnotations - pod template annotations written by keel during updates
+var keelManagedSpecAnnotations = []string{
+	types.KeelUpdateTimeAnnotation,
+}
+
+// createPatch builds a patch for latest (the object as it is stored on the
+// API server) carrying only the images and keel labels and annotations
+// changed in desired. Keel labels and annotations are only removed when
+// previous (the state desired was made from) had them. Built-in kinds get a strategic merge patch (containers are merged
+// by name), custom resources a JSON merge patch. The patch is bound to the
+// resourceVersion of latest so concurrent writes end with a conflict instead
+// of being overwritten. A nil patch means there is nothing to change.
+func createPatch(latest interface{}, desired, previous *k8s.GenericResource, dataStruct interface{}) ([]byte, error) {
+	current, err := k8s.NewGenericResource(latest)
+	if err != nil {
+		return nil, err
+	}
+	modified := current.DeepCopy()
+	applyKeelChanges(modified, desired, previous)
+
+	originalJSON, err := json.Marshal(current.GetResource())
+	if err != nil {
+		return nil, err
+	}
+	modifiedJSON, err := json.Marshal(modified.GetResource())
+	if err != nil {
+		return nil, err
+	}
+
+	var patch []byte
+	if dataStruct != nil {
+		patch, err = strategicpatch.CreateTwoWayMergePatch(originalJSON, modifiedJSON, dataStruct)
+	} else {
+		patch, err = jsonpatch.CreateMergePatch(originalJSON, modifiedJSON)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	metadata, _ := fields["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		fields["metadata"] = metadata
+	}
+	metadata["resourceVersion"] = latestResourceVersion(current)
+	return json.Marshal(fields)
+}
+
+func latestResourceVersion(r *k8s.GenericResource) string {
+	if obj, ok := r.GetResource().(interface{ GetResourceVersion() string }); ok {
+		return obj.GetResourceVersion()
+	}
+	return ""
+}
+
+// applyKeelChanges copies images and keel managed labels and annotations from desired
+// onto target. Containers and volumes are matched by name.
+func applyKeelChanges(target, desired, previous *k8s.GenericResource) {
+	containers := target.Containers()
+	for idx, c := range desired.Containers() {
+		if i := containerIndex(containers, c.Name, idx); i >= 0 && containers[i].Image != c.Image {
+			target.UpdateContainer(i, c.Image)
+		}
+	}
+	initContainers := target.InitContainers()
+	for idx, c := range desired.InitContainers() {
+		if i := containerIndex(initContainers, c.Name, idx); i >= 0 && initContainers[i].Image != c.Image {
+			target.UpdateInitContainer(i, c.Image)
+		}
+	}
+	volumes := target.Volumes()
+	for idx, vol := range desired.Volumes() {
+		if vol.Image == nil {
+			continue
+		}
+		if i := volumeIndex(volumes, vol.Name, idx); i >= 0 && volumes[i].Image != nil && volumes[i].Image.Reference != vol.Image.Reference {
+			target.UpdateImageVolume(i, vol.Image.Reference)
+		}
+	}
+
+	var previousLabels, previousAnnotations map[string]string
+	if previous != nil {
+		previousLabels, previousAnnotations = previous.GetLabels(), previous.GetAnnotations()
+	}
+	target.SetLabels(syncKeelManaged(target.GetLabels(), desired.GetLabels(), previousLabels))
+	target.SetAnnotations(syncKeelManaged(target.GetAnnotations(), desired.GetAnnotations(), previousAnnotations))
+
+	specAnnotations := target.GetSpecAnnotations()
+	desiredSpecAnnotations := desired.GetSpecAnnotations()
+	for _, key := range keelManagedSpecAnnotations {
+		if value, ok := desiredSpecAnnotations[key]; ok {
+			specAnnotations[key] = value
+		}
+	}
+	target.SetSpecAnnotations(specAnnotations)
+}
+
+// syncKeelManaged sets keel managed keys of current to their desired values.
+// Keel managed keys of previous missing in desired are removed (except the
+// change cause which is only ever overwritten), keys added after previous was
+// read are kept.
+func syncKeelManaged(current, desired, previous map[string]string) map[string]string {
+	if current == nil {
+		current = map[string]string{}
+	}
+	for key := range previous {
+		if _, ok := desired[key]; !ok && isKeelManaged(key) && key != "kubernetes.io/change-cause" {
+			delete(current, key)
+		}
+	}
+	for key, value := range desired {
+		if isKeelManaged(key) {
+			current[key] = value
+		}
+	}
+	return current
+}
+
+// containerIndex finds a container by name, preferring the one at the hinted
+// index so unnamed or duplicate containers keep their position
+func containerIndex(containers []v1.Container, name string, hint int) int {
+	if hint < len(containers) && containers[hint].Name == name {
+		return hint
+	}
+	for i, c := range containers {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func volumeIndex(volumes []v1.Volume, name string, hint int) int {
+	if hint < len(volumes) && volumes[hint].Name == name {
+		return hint
+	}
+	for i, vol := range volumes {
+		if vol.Name == name {
+			return i
+		}
+	}
+	return -1
+}
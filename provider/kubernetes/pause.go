@@ -0,0 +1,128 @@
+package kubernetes
+
+import (
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/provider"
+	"github.com/keel-hq/keel/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SetPauses - store of the namespaces paused through the API, the newest
+// versions found for paused resources are kept there too
+func (p *Provider) SetPauses(pauses provider.PauseStore) {
+	p.pauses = pauses
+}
+
+// IsPausedFromMeta - whether updates of the resource are paused through the
+// keel.sh/paused annotation (or label)
+func IsPausedFromMeta(labels map[string]string, annotations map[string]string) bool {
+	if value, ok := annotations[types.KeelPausedAnnotation]; ok {
+		return value == "true"
+	}
+	return labels[types.KeelPausedAnnotation] == "true"
+}
+
+// pausedNamespaces returns namespaces of the cluster paused through the API
+func (p *Provider) pausedNamespaces() (map[string]bool, error) {
+	paused := make(map[string]bool)
+	if p.pauses == nil {
+		return paused, nil
+	}
+	namespaces, err := p.pauses.ListPausedNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, ns := range namespaces {
+		if ns.Cluster == p.cluster {
+			paused[ns.Namespace] = true
+		}
+	}
+	return paused, nil
+}
+
+// trackAvailable stores the newest version found for an image of a paused
+// resource so it can be reported until the resource is resumed
+func (p *Provider) trackAvailable(resource *k8s.GenericResource, repo *types.Repository, plan *UpdatePlan) {
+	log.WithFields(log.Fields{
+		"name":      resource.Name,
+		"kind":      resource.Kind(),
+		"namespace": resource.Namespace,
+		"image":     repo.String(),
+	}).Debug("provider.kubernetes: updates are paused, ignoring")
+
+	if p.pauses == nil {
+		return
+	}
+
+	existing, err := p.pauses.ListAvailableUpdates(&types.AvailableUpdateQuery{
+		Provider:   p.GetName(),
+		Identifier: resource.Identifier,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":      err,
+			"identifier": resource.Identifier,
+		}).Error("provider.kubernetes: failed to get available updates")
+		return
+	}
+	for _, update := range existing {
+		if update.Repository != repo.Name {
+			continue
+		}
+		if update.CurrentVersion == plan.CurrentVersion && update.NewVersion == plan.NewVersion {
+			return
+		}
+		update.CurrentVersion = plan.CurrentVersion
+		update.NewVersion = plan.NewVersion
+		err = p.pauses.UpdateAvailableUpdate(update)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":      err,
+				"identifier": resource.Identifier,
+			}).Error("provider.kubernetes: failed to update available update")
+		}
+		return
+	}
+
+	_, err = p.pauses.CreateAvailableUpdate(&types.AvailableUpdate{
+		Provider:       p.GetName(),
+		Identifier:     resource.Identifier,
+		Repository:     repo.Name,
+		CurrentVersion: plan.CurrentVersion,
+		NewVersion:     plan.NewVersion,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":      err,
+			"identifier": resource.Identifier,
+		}).Error("provider.kubernetes: failed to store available update")
+	}
+}
+
+// clearAvailable removes versions tracked while the resource was paused, they
+// are outdated once it's updated
+func (p *Provider) clearAvailable(resource *k8s.GenericResource) {
+	if p.pauses == nil {
+		return
+	}
+	existing, err := p.pauses.ListAvailableUpdates(&types.AvailableUpdateQuery{
+		Provider:   p.GetName(),
+		Identifier: resource.Identifier,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":      err,
+			"identifier": resource.Identifier,
+		}).Error("provider.kubernetes: failed to get available updates")
+		return
+	}
+	for _, update := range existing {
+		if err := p.pauses.DeleteAvailableUpdate(update); err != nil {
+			log.WithFields(log.Fields{
+				"error":      err,
+				"identifier": resource.Identifier,
+			}).Error("provider.kubernetes: failed to delete available update")
+		}
+	}
+}
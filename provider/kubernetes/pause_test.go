@@ -0,0 +1,107 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+)
+
+func TestProcessEventPausedResource(t *testing.T) {
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{types.KeelPausedAnnotation: "true"})))
+	store, teardown := NewTestingUtils()
+	defer teardown()
+	approver, teardownApprover := approver()
+	defer teardownApprover()
+	p, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	p.SetPauses(store)
+
+	for _, tag := range []string{"1.4.5", "1.5.0"} {
+		if _, err := p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: tag}}); err != nil {
+			t.Fatalf("got error while processing event: %s", err)
+		}
+	}
+	if fp.updated != nil {
+		t.Fatalf("paused resource must not be updated")
+	}
+
+	available, err := store.ListAvailableUpdates(&types.AvailableUpdateQuery{Identifier: "deployment/xxxx/dep-1"})
+	if err != nil {
+		t.Fatalf("failed to list available updates: %s", err)
+	}
+	if len(available) != 1 || available[0].CurrentVersion != "1.1.1" || available[0].NewVersion != "1.5.0" {
+		t.Fatalf("unexpected available updates: %+v", available)
+	}
+
+	// resumed, the update is applied and the available version cleared
+	grc.Add(MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{})))
+	if _, err := p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.5.0"}}); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if fp.updated == nil || fp.updated.Containers()[0].Image != "gcr.io/v2-namespace/hello-world:1.5.0" {
+		t.Fatalf("expected resource to be updated after resuming, got: %+v", fp.updated)
+	}
+	if available, _ := store.ListAvailableUpdates(&types.AvailableUpdateQuery{}); len(available) != 0 {
+		t.Errorf("expected available updates to be cleared, got: %+v", available)
+	}
+}
+
+func TestProcessEventPausedNamespace(t *testing.T) {
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{})))
+	store, teardown := NewTestingUtils()
+	defer teardown()
+	approver, teardownApprover := approver()
+	defer teardownApprover()
+	p, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	p.SetPauses(store)
+
+	if _, err := store.CreatePausedNamespace(&types.PausedNamespace{Namespace: "xxxx"}); err != nil {
+		t.Fatalf("failed to pause namespace: %s", err)
+	}
+
+	if _, err := p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}}); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if fp.updated != nil {
+		t.Fatalf("resource in a paused namespace must not be updated")
+	}
+	if available, _ := store.ListAvailableUpdates(&types.AvailableUpdateQuery{}); len(available) != 1 {
+		t.Errorf("expected an available update, got: %+v", available)
+	}
+}
+
+func TestProcessEventNamespacePausedInOtherCluster(t *testing.T) {
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{})))
+	store, teardown := NewTestingUtils()
+	defer teardown()
+	approver, teardownApprover := approver()
+	defer teardownApprover()
+	p, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	p.SetPauses(store)
+
+	if _, err := store.CreatePausedNamespace(&types.PausedNamespace{Cluster: "staging", Namespace: "xxxx"}); err != nil {
+		t.Fatalf("failed to pause namespace: %s", err)
+	}
+
+	if _, err := p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}}); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if fp.updated == nil {
+		t.Fatalf("namespace paused in another cluster must not pause the resource")
+	}
+}
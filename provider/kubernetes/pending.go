@@ -0,0 +1,76 @@
+package kubernetes
+
+import (
+	"sync"
+
+	"github.com/keel-hq/keel/internal/k8s"
+)
+
+// pendingUpdates - resources with an update applied in the background, ie:
+// waiting for a keel.sh/preUpdateJob or for their dependencies. Events
+// repeated meanwhile (every poll until the resource runs the new version)
+// must not plan them again. Resources whose update failed are kept too,
+// their dependents wait until they run the failed update after all.
+type pendingUpdates struct {
+	mu       sync.Mutex
+	versions map[string]string
+	failures map[string]*k8s.GenericResource
+}
+
+func newPendingUpdates() *pendingUpdates {
+	return &pendingUpdates{
+		versions: make(map[string]string),
+		failures: make(map[string]*k8s.GenericResource),
+	}
+}
+
+// add marks the resource of every plan as pending
+func (u *pendingUpdates) add(plans []*UpdatePlan) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, plan := range plans {
+		u.versions[plan.Resource.Identifier] = plan.NewVersion
+	}
+}
+
+// done clears resources of the plans once their updates were applied or
+// given up
+func (u *pendingUpdates) done(plans []*UpdatePlan) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, plan := range plans {
+		if u.versions[plan.Resource.Identifier] == plan.NewVersion {
+			delete(u.versions, plan.Resource.Identifier)
+		}
+	}
+}
+
+// version returns the version the resource is being updated to
+func (u *pendingUpdates) version(identifier string) (string, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	version, ok := u.versions[identifier]
+	return version, ok
+}
+
+// fail records that the update of the plan failed or was skipped
+func (u *pendingUpdates) fail(plan *UpdatePlan) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.failures[plan.Resource.Identifier] = plan.Resource
+}
+
+// succeed forgets an earlier failure of the resource
+func (u *pendingUpdates) succeed(identifier string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.failures, identifier)
+}
+
+// failure returns the resource as the failed update would have left it
+func (u *pendingUpdates) failure(identifier string) (*k8s.GenericResource, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	resource, ok := u.failures[identifier]
+	return resource, ok
+}
@@ -0,0 +1,161 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/internal/policy"
+	"github.com/keel-hq/keel/types"
+)
+
+func TestCheckForUpdatePinDigest(t *testing.T) {
+	pinned := map[string]string{types.KeelPinDigestAnnotation: "true"}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		image       string
+		repo        types.Repository
+		policy      string
+		wantUpdate  bool
+		wantImage   string
+	}{
+		{
+			name:        "pinned to the new digest",
+			annotations: pinned,
+			image:       "gcr.io/v2-namespace/hello-world:1.1.1",
+			repo:        types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.2", Digest: newImageDigest},
+			policy:      "all",
+			wantUpdate:  true,
+			wantImage:   "gcr.io/v2-namespace/hello-world:1.4.2@" + newImageDigest,
+		},
+		{
+			name:        "unknown digest keeps the tag",
+			annotations: pinned,
+			image:       "gcr.io/v2-namespace/hello-world:1.1.1",
+			repo:        types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.2"},
+			policy:      "all",
+			wantUpdate:  true,
+			wantImage:   "gcr.io/v2-namespace/hello-world:1.4.2",
+		},
+		{
+			name:        "not opted in",
+			annotations: map[string]string{},
+			image:       "gcr.io/v2-namespace/hello-world:1.1.1",
+			repo:        types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.2", Digest: newImageDigest},
+			policy:      "all",
+			wantUpdate:  true,
+			wantImage:   "gcr.io/v2-namespace/hello-world:1.4.2",
+		},
+		{
+			name:        "pinned image is compared by tag",
+			annotations: pinned,
+			image:       "gcr.io/v2-namespace/hello-world:1.1.1@" + oldImageDigest,
+			repo:        types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.2", Digest: newImageDigest},
+			policy:      "all",
+			wantUpdate:  true,
+			wantImage:   "gcr.io/v2-namespace/hello-world:1.4.2@" + newImageDigest,
+		},
+		{
+			name:        "default registry keeps the short name",
+			annotations: pinned,
+			image:       "karolisr/keel:0.1.0@" + oldImageDigest,
+			repo:        types.Repository{Name: "karolisr/keel", Tag: "0.2.0", Digest: newImageDigest},
+			policy:      "minor",
+			wantUpdate:  true,
+			wantImage:   "karolisr/keel:0.2.0@" + newImageDigest,
+		},
+		{
+			name:        "new digest of the same tag",
+			annotations: pinned,
+			image:       "gcr.io/v2-namespace/hello-world:latest@" + oldImageDigest,
+			repo:        types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "latest", Digest: newImageDigest},
+			policy:      "force",
+			wantUpdate:  true,
+			wantImage:   "gcr.io/v2-namespace/hello-world:latest@" + newImageDigest,
+		},
+		{
+			name:        "already pinned to the digest",
+			annotations: pinned,
+			image:       "gcr.io/v2-namespace/hello-world:latest@" + newImageDigest,
+			repo:        types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "latest", Digest: newImageDigest},
+			policy:      "force",
+			wantUpdate:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deployment := dryRunTestDeployment("dep-1", "1.1.1", tt.annotations)
+			deployment.Labels[types.KeelPolicyLabel] = tt.policy
+			deployment.Spec.Template.Spec.Containers[0].Image = tt.image
+			resource := MustParseGR(deployment)
+
+			plc := policy.GetPolicyFromLabelsOrAnnotations(resource.GetLabels(), resource.GetAnnotations())
+			plan, shouldUpdate, err := checkForUpdate(plc, &tt.repo, resource)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if shouldUpdate != tt.wantUpdate {
+				t.Fatalf("expected update %v, got: %v", tt.wantUpdate, shouldUpdate)
+			}
+			if !shouldUpdate {
+				return
+			}
+			if got := plan.Resource.Containers()[0].Image; got != tt.wantImage {
+				t.Errorf("expected image %s, got: %s", tt.wantImage, got)
+			}
+			if plan.NewVersion != tt.repo.Tag {
+				t.Errorf("expected new version %s, got: %s", tt.repo.Tag, plan.NewVersion)
+			}
+		})
+	}
+}
+
+func TestGetDesiredImagePinDigest(t *testing.T) {
+	delta := map[string]string{"gcr.io/v2-namespace/hello-world": "1.4.2"}
+
+	desired, err := getDesiredImage(delta, "gcr.io/v2-namespace/hello-world:1.1.1@"+oldImageDigest, newImageDigest)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if desired != "gcr.io/v2-namespace/hello-world:1.4.2@"+newImageDigest {
+		t.Errorf("unexpected image: %s", desired)
+	}
+
+	desired, err = getDesiredImage(delta, "gcr.io/v2-namespace/hello-world:1.1.1", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if desired != "gcr.io/v2-namespace/hello-world:1.4.2" {
+		t.Errorf("unexpected image: %s", desired)
+	}
+}
+
+func TestTrackedImagesPinnedImage(t *testing.T) {
+	deployment := dryRunTestDeployment("dep-1", "1.1.1", map[string]string{types.KeelPinDigestAnnotation: "true"})
+	deployment.Spec.Template.Spec.Containers[0].Image = "gcr.io/v2-namespace/hello-world:1.4.2@" + newImageDigest
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(deployment))
+
+	approver, teardown := approver()
+	defer teardown()
+	provider, err := NewProvider(&fakeImplementer{}, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	tracked, err := provider.TrackedImages()
+	if err != nil {
+		t.Fatalf("failed to get tracked images: %s", err)
+	}
+	if len(tracked) != 1 {
+		t.Fatalf("expected 1 tracked image, got: %d", len(tracked))
+	}
+	// watchers poll the tag, the digest is what's running
+	if tracked[0].Image.Tag() != "1.4.2" || tracked[0].Image.Digest() != newImageDigest {
+		t.Errorf("unexpected tracked image: %s (%s)", tracked[0].Image.Remote(), tracked[0].Image.Digest())
+	}
+	if tracked[0].Image.Remote() != "gcr.io/v2-namespace/hello-world:1.4.2" {
+		t.Errorf("unexpected remote: %s", tracked[0].Image.Remote())
+	}
+}
@@ -0,0 +1,253 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+	"github.com/keel-hq/keel/util/image"
+
+	batch_v1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// preUpdateJobTimeout - how long a pre-update Job may run before the update
+// is given up
+var preUpdateJobTimeout = 30 * time.Minute
+
+// preUpdateJobTTL - seconds finished pre-update Jobs are kept for, unless
+// the template sets ttlSecondsAfterFinished
+var preUpdateJobTTL int32 = 3600
+
+// preUpdateJobTemplateKey - ConfigMap key holding the Job manifest, a
+// ConfigMap with a single key may use any name
+const preUpdateJobTemplateKey = "job.yaml"
+
+// labels the Job controller sets, they can't be copied to a new Job
+var jobControllerLabels = []string{
+	"controller-uid",
+	"job-name",
+	"batch.kubernetes.io/controller-uid",
+	"batch.kubernetes.io/job-name",
+}
+
+// hasPreUpdateJob - whether the update waits for the keel.sh/preUpdateJob of
+// its resource, rollbacks don't
+func hasPreUpdateJob(plan *UpdatePlan) bool {
+	return plan.Trigger != types.TriggerTypeRollback.String() &&
+		plan.Resource.GetAnnotations()[types.KeelPreUpdateJobAnnotation] != ""
+}
+
+// runPreUpdateJob runs the keel.sh/preUpdateJob of the resource with its
+// new images and waits for it to complete, the update must not be applied
+// when an error is returned. It blocks for as long as the Job runs, so it
+// must not be called from the event loop.
+func (p *Provider) runPreUpdateJob(plan *UpdatePlan) error {
+	resource := plan.Resource
+	if !hasPreUpdateJob(plan) {
+		return nil
+	}
+	reference := resource.GetAnnotations()[types.KeelPreUpdateJobAnnotation]
+
+	currentVersion := formatVersionWithDigest(plan.CurrentVersion, plan.CurrentDigest)
+	newVersion := formatVersionWithDigest(plan.NewVersion, plan.NewDigest)
+	notify := func(level types.Level, message string) {
+		p.sender.Send(types.EventNotification{
+			ResourceKind: resource.Kind(),
+			Identifier:   resource.Identifier,
+			Name:         "pre-update job",
+			Message:      message,
+			CreatedAt:    time.Now(),
+			Type:         types.NotificationPreUpdateJob,
+			Level:        level,
+			Channels:     types.ParseEventNotificationChannels(resource.GetAnnotations()),
+			Metadata:     updateMetadata(resource, plan, p.GetName()),
+		})
+	}
+	fail := func(err error) error {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"name":      resource.Name,
+			"kind":      resource.Kind(),
+			"namespace": resource.Namespace,
+			"job":       reference,
+		}).Error("provider.kubernetes: pre-update job failed, update skipped")
+		notify(types.LevelError, fmt.Sprintf("%s %s/%s update %s->%s skipped, pre-update job %s failed: %s", resource.Kind(), resource.Namespace, resource.Name, currentVersion, newVersion, reference, err))
+		return err
+	}
+
+	template, err := p.preUpdateJobTemplate(resource.Namespace, reference)
+	if err != nil {
+		return fail(err)
+	}
+
+	job, err := p.implementer.Jobs(resource.Namespace).Create(context.TODO(), newPreUpdateJob(template, resource), meta_v1.CreateOptions{})
+	if err != nil {
+		return fail(fmt.Errorf("failed to create job: %w", err))
+	}
+	notify(types.LevelInfo, fmt.Sprintf("Started pre-update job %s/%s before updating %s %s/%s %s->%s", job.Namespace, job.Name, resource.Kind(), resource.Namespace, resource.Name, currentVersion, newVersion))
+
+	if err := p.waitJobComplete(job); err != nil {
+		return fail(fmt.Errorf("job %s: %w", job.Name, err))
+	}
+
+	notify(types.LevelSuccess, fmt.Sprintf("Pre-update job %s/%s completed, updating %s %s/%s %s->%s", job.Namespace, job.Name, resource.Kind(), resource.Namespace, resource.Name, currentVersion, newVersion))
+	return nil
+}
+
+// preUpdateJobTemplate loads the Job a keel.sh/preUpdateJob value refers
+// to: job/<name>, configmap/<name> or just the name of a Job
+func (p *Provider) preUpdateJobTemplate(namespace, reference string) (*batch_v1.Job, error) {
+	kind, name, found := strings.Cut(reference, "/")
+	if !found {
+		kind, name = "job", reference
+	}
+	if name == "" {
+		return nil, fmt.Errorf("invalid job template reference '%s'", reference)
+	}
+
+	switch strings.ToLower(kind) {
+	case "job":
+		return p.implementer.Jobs(namespace).Get(context.TODO(), name, meta_v1.GetOptions{})
+	case "configmap":
+		configMap, err := p.implementer.ConfigMaps(namespace).Get(context.TODO(), name, meta_v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		manifest, ok := configMap.Data[preUpdateJobTemplateKey]
+		if !ok && len(configMap.Data) == 1 {
+			for _, value := range configMap.Data {
+				manifest = value
+			}
+		}
+		if manifest == "" {
+			return nil, fmt.Errorf("configmap %s has no %s key", name, preUpdateJobTemplateKey)
+		}
+		var job batch_v1.Job
+		if err := yaml.Unmarshal([]byte(manifest), &job); err != nil {
+			return nil, fmt.Errorf("configmap %s: invalid job manifest: %w", name, err)
+		}
+		if job.Kind != "" && job.Kind != "Job" {
+			return nil, fmt.Errorf("configmap %s: expected a Job manifest, got %s", name, job.Kind)
+		}
+		if job.Name == "" {
+			job.Name = name
+		}
+		return &job, nil
+	}
+	return nil, fmt.Errorf("invalid job template reference '%s', expected job/<name> or configmap/<name>", reference)
+}
+
+// newPreUpdateJob - a new Job of the template, running the images of the
+// updated resource in place of the template images of the same repository
+func newPreUpdateJob(template *batch_v1.Job, resource *k8s.GenericResource) *batch_v1.Job {
+	// controller generated names are at most 63 characters long
+	name := strings.TrimSuffix(truncate(template.Name, 48), "-")
+	job := &batch_v1.Job{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:        name + "-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+			Namespace:   resource.Namespace,
+			Labels:      withoutControllerLabels(template.Labels),
+			Annotations: map[string]string{types.KeelPreUpdateJobAnnotation: resource.Identifier},
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+	job.Spec.Suspend = nil
+	if job.Spec.TTLSecondsAfterFinished == nil {
+		ttl := preUpdateJobTTL
+		job.Spec.TTLSecondsAfterFinished = &ttl
+	}
+	job.Spec.Selector = nil
+	job.Spec.ManualSelector = nil
+	job.Spec.Template.Labels = withoutControllerLabels(job.Spec.Template.Labels)
+
+	images := make(map[string]string)
+	for _, img := range resourceImages(resource) {
+		if ref, err := image.Parse(img); err == nil {
+			images[ref.Repository()] = img
+		}
+	}
+	replace := func(containers []v1.Container) {
+		for i := range containers {
+			ref, err := image.Parse(containers[i].Image)
+			if err != nil {
+				continue
+			}
+			if img, ok := images[ref.Repository()]; ok {
+				containers[i].Image = img
+			}
+		}
+	}
+	replace(job.Spec.Template.Spec.InitContainers)
+	replace(job.Spec.Template.Spec.Containers)
+
+	return job
+}
+
+// waitJobComplete waits until the Job succeeds, fails or runs out of time
+func (p *Provider) waitJobComplete(job *batch_v1.Job) error {
+	timer := time.NewTimer(preUpdateJobTimeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(rolloutCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			return fmt.Errorf("did not complete within %s", preUpdateJobTimeout)
+		case <-p.stop:
+			return fmt.Errorf("keel is stopping")
+		}
+
+		current, err := p.implementer.Jobs(job.Namespace).Get(context.TODO(), job.Name, meta_v1.GetOptions{})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"job":       job.Name,
+				"namespace": job.Namespace,
+			}).Warn("provider.kubernetes: failed to get pre-update job status")
+			continue
+		}
+		for _, condition := range current.Status.Conditions {
+			if condition.Status != v1.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case batch_v1.JobComplete:
+				return nil
+			case batch_v1.JobFailed:
+				return fmt.Errorf("%s: %s", condition.Reason, condition.Message)
+			}
+		}
+	}
+}
+
+func withoutControllerLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	cleaned := make(map[string]string, len(labels))
+	for key, value := range labels {
+		cleaned[key] = value
+	}
+	for _, key := range jobControllerLabels {
+		delete(cleaned, key)
+	}
+	return cleaned
+}
+
+func truncate(s string, length int) string {
+	if len(s) > length {
+		return s[:length]
+	}
+	return s
+}
@@ -0,0 +1,325 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+
+	batch_v1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	batch_typed_v1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+	core_v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// jobImplementer keeps ConfigMaps and Jobs in a fake clientset, created
+// Jobs finish with the given condition right away
+type jobImplementer struct {
+	fakeImplementer
+	client *fake.Clientset
+}
+
+func newJobImplementer(result batch_v1.JobConditionType, objects ...runtime.Object) *jobImplementer {
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batch_v1.Job)
+		job.Status.Conditions = append(job.Status.Conditions, batch_v1.JobCondition{
+			Type:    result,
+			Status:  v1.ConditionTrue,
+			Reason:  "BackoffLimitExceeded",
+			Message: "Job has reached the specified backoff limit",
+		})
+		return false, nil, nil
+	})
+	return &jobImplementer{client: client}
+}
+
+func (i *jobImplementer) ConfigMaps(namespace string) core_v1.ConfigMapInterface {
+	return i.client.CoreV1().ConfigMaps(namespace)
+}
+
+func (i *jobImplementer) Jobs(namespace string) batch_typed_v1.JobInterface {
+	return i.client.BatchV1().Jobs(namespace)
+}
+
+func (i *jobImplementer) updatedResource() *k8s.GenericResource {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.updated
+}
+
+func (i *jobImplementer) createdJobs() []batch_v1.Job {
+	var jobs []batch_v1.Job
+	for _, action := range i.client.Actions() {
+		if action.GetVerb() == "create" && action.GetResource().Resource == "jobs" {
+			jobs = append(jobs, *action.(k8stesting.CreateAction).GetObject().(*batch_v1.Job))
+		}
+	}
+	return jobs
+}
+
+func migrationJob() *batch_v1.Job {
+	suspend := true
+	return &batch_v1.Job{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "migrate",
+			Namespace: "xxxx",
+			Labels:    map[string]string{"app": "hello", "controller-uid": "abc"},
+		},
+		Spec: batch_v1.JobSpec{
+			Suspend:  &suspend,
+			Selector: &meta_v1.LabelSelector{MatchLabels: map[string]string{"controller-uid": "abc"}},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: meta_v1.ObjectMeta{Labels: map[string]string{"controller-uid": "abc", "job-name": "migrate"}},
+				Spec: v1.PodSpec{
+					RestartPolicy: v1.RestartPolicyNever,
+					Containers: []v1.Container{
+						{Name: "migrate", Image: "gcr.io/v2-namespace/hello-world:1.1.1", Command: []string{"migrate"}},
+						{Name: "proxy", Image: "cloudsql-proxy:1.0.0"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func preUpdateJobProvider(t *testing.T, fp Implementer, reference string) (*Provider, *threadSafeSender, func()) {
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("hello", "1.1.1", map[string]string{types.KeelPreUpdateJobAnnotation: reference})))
+	approver, teardown := approver()
+	sender := &threadSafeSender{}
+	provider, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	return provider, sender, teardown
+}
+
+func TestPreUpdateJob(t *testing.T) {
+	defer func(interval time.Duration) { rolloutCheckInterval = interval }(rolloutCheckInterval)
+	rolloutCheckInterval = 5 * time.Millisecond
+
+	fp := newJobImplementer(batch_v1.JobComplete, migrationJob())
+	provider, sender, teardown := preUpdateJobProvider(t, fp, "job/migrate")
+	defer teardown()
+
+	_, err := provider.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.1.2"}})
+	if err != nil {
+		t.Fatalf("failed to process event: %s", err)
+	}
+
+	require.Eventually(t, func() bool {
+		return fp.updatedResource() != nil
+	}, 5*time.Second, 5*time.Millisecond, "expected the deployment to be updated after the job completed")
+
+	jobs := fp.createdJobs()
+	if len(jobs) != 1 {
+		t.Fatalf("expected a single job, got: %d", len(jobs))
+	}
+	job := jobs[0]
+	containers := job.Spec.Template.Spec.Containers
+	if containers[0].Image != "gcr.io/v2-namespace/hello-world:1.1.2" {
+		t.Errorf("expected the new image, got: %s", containers[0].Image)
+	}
+	if containers[1].Image != "cloudsql-proxy:1.0.0" {
+		t.Errorf("unrelated images must not change, got: %s", containers[1].Image)
+	}
+	if job.Spec.Suspend != nil || job.Spec.Selector != nil {
+		t.Error("expected the job to run with a generated selector")
+	}
+	if _, ok := job.Spec.Template.Labels["controller-uid"]; ok {
+		t.Error("controller labels must not be copied")
+	}
+	if job.Name == "migrate" || job.Annotations[types.KeelPreUpdateJobAnnotation] != "deployment/xxxx/hello" {
+		t.Errorf("unexpected job metadata: %+v", job.ObjectMeta)
+	}
+	if job.Spec.TTLSecondsAfterFinished == nil || *job.Spec.TTLSecondsAfterFinished != preUpdateJobTTL {
+		t.Errorf("expected finished jobs to be cleaned up, got: %v", job.Spec.TTLSecondsAfterFinished)
+	}
+
+	var completed bool
+	for _, event := range sender.events() {
+		if event.Type == types.NotificationPreUpdateJob && event.Level == types.LevelSuccess {
+			completed = true
+		}
+	}
+	if !completed {
+		t.Error("expected a pre-update job success notification")
+	}
+}
+
+func TestPreUpdateJobDoesNotBlock(t *testing.T) {
+	// jobs without a complete or failed condition keep running
+	fp := newJobImplementer("", migrationJob())
+	provider, sender, teardown := preUpdateJobProvider(t, fp, "job/migrate")
+	defer teardown()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		provider.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.1.2"}})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event processing waited for the pre-update job")
+	}
+	require.Eventually(t, func() bool {
+		return len(fp.createdJobs()) == 1
+	}, 5*time.Second, 5*time.Millisecond, "expected the job to be created")
+	if fp.updatedResource() != nil {
+		t.Error("the deployment must not be updated before the job completed")
+	}
+
+	// the job is given up on shutdown
+	provider.Stop()
+	require.Eventually(t, func() bool {
+		return sender.last().Level == types.LevelError
+	}, 5*time.Second, 5*time.Millisecond, "expected the update to be skipped")
+}
+
+func TestPreUpdateJobPendingNotPlannedAgain(t *testing.T) {
+	defer func(interval time.Duration) { rolloutCheckInterval = interval }(rolloutCheckInterval)
+	rolloutCheckInterval = 5 * time.Millisecond
+
+	// jobs without a complete or failed condition keep running
+	fp := newJobImplementer("", migrationJob())
+	provider, sender, teardown := preUpdateJobProvider(t, fp, "job/migrate")
+	defer teardown()
+
+	// polls repeat the event until the resource runs the new version
+	event := &types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.1.2"}, TriggerName: types.TriggerTypeDefault.String()}
+	if _, err := provider.processEvent(event); err != nil {
+		t.Fatalf("failed to process event: %s", err)
+	}
+	require.Eventually(t, func() bool {
+		return len(fp.createdJobs()) == 1
+	}, 5*time.Second, 5*time.Millisecond, "expected the job to be created")
+
+	if _, err := provider.processEvent(event); err != nil {
+		t.Fatalf("failed to process event: %s", err)
+	}
+	if plans := provider.Plans(); len(plans) != 1 {
+		t.Errorf("resource waiting for its job must not be planned again, got: %d plans", len(plans))
+	}
+	require.Never(t, func() bool {
+		return len(fp.createdJobs()) > 1
+	}, 100*time.Millisecond, 5*time.Millisecond, "expected a single job")
+
+	provider.Stop()
+	require.Eventually(t, func() bool {
+		_, pending := provider.pending.version("deployment/xxxx/hello")
+		return !pending && sender.last().Level == types.LevelError
+	}, 5*time.Second, 5*time.Millisecond, "expected the resource to be planned again once the job was given up")
+}
+
+func TestPreUpdateJobTTL(t *testing.T) {
+	ttl := int32(60)
+	template := migrationJob()
+	template.Spec.TTLSecondsAfterFinished = &ttl
+
+	job := newPreUpdateJob(template, MustParseGR(dryRunTestDeployment("hello", "1.1.1", map[string]string{})))
+	if *job.Spec.TTLSecondsAfterFinished != 60 {
+		t.Errorf("expected the template TTL, got: %d", *job.Spec.TTLSecondsAfterFinished)
+	}
+}
+
+func TestPreUpdateJobFailed(t *testing.T) {
+	defer func(interval time.Duration) { rolloutCheckInterval = interval }(rolloutCheckInterval)
+	rolloutCheckInterval = 5 * time.Millisecond
+
+	fp := newJobImplementer(batch_v1.JobFailed, migrationJob())
+	provider, sender, teardown := preUpdateJobProvider(t, fp, "migrate")
+	defer teardown()
+
+	_, err := provider.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.1.2"}})
+	if err != nil {
+		t.Fatalf("failed to process event: %s", err)
+	}
+
+	require.Eventually(t, func() bool {
+		last := sender.last()
+		return last.Type == types.NotificationPreUpdateJob && last.Level == types.LevelError
+	}, 5*time.Second, 5*time.Millisecond, "expected a pre-update job error notification")
+	if fp.updatedResource() != nil {
+		t.Error("the deployment must not be updated when the job failed")
+	}
+}
+
+func TestPreUpdateJobTemplate(t *testing.T) {
+	fp := newJobImplementer(batch_v1.JobComplete,
+		&v1.ConfigMap{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "migrate", Namespace: "xxxx"},
+			Data: map[string]string{"migration": `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: db-migrate
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: migrate
+        image: gcr.io/v2-namespace/hello-world:1.1.1
+`},
+		},
+		&v1.ConfigMap{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "deployment", Namespace: "xxxx"},
+			Data:       map[string]string{preUpdateJobTemplateKey: "kind: Deployment"},
+		},
+	)
+	provider, _, teardown := preUpdateJobProvider(t, fp, "")
+	defer teardown()
+
+	job, err := provider.preUpdateJobTemplate("xxxx", "configmap/migrate")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if job.Name != "db-migrate" || job.Spec.Template.Spec.Containers[0].Name != "migrate" {
+		t.Errorf("unexpected job: %+v", job)
+	}
+
+	for _, reference := range []string{"configmap/deployment", "configmap/missing", "job/missing", "secret/migrate", "job/"} {
+		if _, err := provider.preUpdateJobTemplate("xxxx", reference); err == nil {
+			t.Errorf("%s: expected error", reference)
+		}
+	}
+}
+
+func TestRollbackSkipsPreUpdateJob(t *testing.T) {
+	fp := newJobImplementer(batch_v1.JobComplete, migrationJob())
+	provider, sender, teardown := preUpdateJobProvider(t, fp, "job/migrate")
+	defer teardown()
+
+	go provider.Start()
+	defer provider.Stop()
+
+	err := provider.Rollback(&types.UpdateRecord{
+		Identifier:    "deployment/xxxx/hello",
+		Container:     "app",
+		PreviousImage: "gcr.io/v2-namespace/hello-world:1.0.0",
+	}, "admin")
+	if err != nil {
+		t.Fatalf("rollback failed: %s", err)
+	}
+
+	require.Eventually(t, func() bool {
+		last := sender.last()
+		return last.Type == types.NotificationDeploymentUpdate && last.Level == types.LevelSuccess
+	}, 5*time.Second, 5*time.Millisecond, "expected the rollback to be applied")
+	if img := fp.updatedResource().Containers()[0].Image; img != "gcr.io/v2-namespace/hello-world:1.0.0" {
+		t.Errorf("expected previous image to be re-applied, got: %s", img)
+	}
+	if jobs := fp.createdJobs(); len(jobs) != 0 {
+		t.Errorf("rollbacks must not run the pre-update job, got: %d jobs", len(jobs))
+	}
+}
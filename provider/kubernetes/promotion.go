@@ -0,0 +1,351 @@
+package kubernetes
+
+import (
+	"strings"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/provider"
+	"github.com/keel-hq/keel/types"
+	"github.com/keel-hq/keel/util/image"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SetStages - store of the versions running in promotion stages, required
+// by resources with keel.sh/promoteAfter
+func (p *Provider) SetStages(stages provider.StageStore) {
+	p.stages = stages
+}
+
+// getSoakTime returns keel.sh/soakTime, provider.DefaultSoakTime when it's
+// not set or invalid
+func getSoakTime(annotations map[string]string) time.Duration {
+	value, ok := annotations[types.KeelSoakTimeAnnotation]
+	if !ok || value == "" {
+		return provider.DefaultSoakTime
+	}
+	soak, err := time.ParseDuration(value)
+	if err != nil || soak < 0 {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"soak_time": value,
+		}).Error("provider.kubernetes: failed to parse soak time, using default")
+		return provider.DefaultSoakTime
+	}
+	return soak
+}
+
+type stageKey struct {
+	stage      string
+	repository string
+}
+
+// stageRef - promotion stage named by keel.sh/promoteAfter, stages are
+// observed per cluster
+type stageRef struct {
+	provider string
+	stage    string
+}
+
+// previousStage returns the stage named by keel.sh/promoteAfter. Stages of
+// other clusters are named cluster/stage, /stage names a stage of the unnamed
+// cluster keel runs in.
+func (p *Provider) previousStage(value string) stageRef {
+	if cluster, stage, ok := strings.Cut(value, "/"); ok {
+		return stageRef{provider: ProviderNameFor(cluster), stage: stage}
+	}
+	return stageRef{provider: p.GetName(), stage: value}
+}
+
+// stageVersions returns versions of the stage per image repository, versions
+// of the cluster's own stages were just observed
+func (p *Provider) stageVersions(ref stageRef, observed map[stageKey]*types.StageVersion) (map[string]*types.StageVersion, error) {
+	versions := make(map[string]*types.StageVersion)
+	if ref.provider == p.GetName() {
+		for key, version := range observed {
+			if key.stage == ref.stage {
+				versions[key.repository] = version
+			}
+		}
+		return versions, nil
+	}
+
+	stored, err := p.stages.ListStageVersions(&types.StageVersionQuery{Provider: ref.provider, Stage: ref.stage})
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range stored {
+		versions[version.Repository] = version
+	}
+	return versions, nil
+}
+
+// observeStages returns versions running in every stage, per image
+// repository tracked by the resources of the stage
+func (p *Provider) observeStages() map[stageKey]*types.StageVersion {
+	observed := make(map[stageKey]*types.StageVersion)
+	// digests differ between resources, the version can't be trusted
+	conflicting := make(map[stageKey]bool)
+
+	for _, resource := range p.cache.Values() {
+		stage := resource.GetAnnotations()[types.KeelStageAnnotation]
+		if stage == "" {
+			continue
+		}
+		complete, ok := resource.RolloutComplete()
+		healthy := complete || !ok
+
+		var running map[string][]string
+		if p.runningDigests != nil {
+			running = p.runningDigests.Resolve(resource)
+		}
+
+		for _, img := range trackedResourceImages(resource) {
+			ref, err := image.Parse(img)
+			if err != nil {
+				continue
+			}
+			var digest string
+			if digests := running[img]; len(digests) > 0 {
+				digest = digests[0]
+			}
+
+			key := stageKey{stage: stage, repository: ref.Repository()}
+			current, ok := observed[key]
+			if !ok {
+				observed[key] = &types.StageVersion{
+					Provider:   p.GetName(),
+					Stage:      stage,
+					Repository: ref.Repository(),
+					Version:    ref.Tag(),
+					Digest:     digest,
+					Healthy:    healthy,
+				}
+				continue
+			}
+			if current.Version != ref.Tag() {
+				current.Version = ""
+			}
+			if digest != "" {
+				if current.Digest != "" && current.Digest != digest {
+					conflicting[key] = true
+				}
+				current.Digest = digest
+			}
+			current.Healthy = current.Healthy && healthy
+		}
+	}
+
+	for key, version := range observed {
+		if version.Version == "" || conflicting[key] {
+			version.Healthy = false
+			version.Digest = ""
+		}
+	}
+	return observed
+}
+
+// checkStages stores the versions running in promotion stages and promotes
+// versions that soaked long enough to the resources of the next stages
+func (p *Provider) checkStages() {
+	if p.stages == nil {
+		return
+	}
+	now := time.Now()
+
+	stored, err := p.stages.ListStageVersions(&types.StageVersionQuery{Provider: p.GetName()})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("provider.kubernetes: failed to get stage versions")
+		return
+	}
+	existing := make(map[stageKey]*types.StageVersion)
+	for _, version := range stored {
+		existing[stageKey{stage: version.Stage, repository: version.Repository}] = version
+	}
+
+	versions := make(map[stageKey]*types.StageVersion)
+	for key, observed := range p.observeStages() {
+		version, err := p.storeStageVersion(existing[key], observed, now)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":      err,
+				"stage":      observed.Stage,
+				"repository": observed.Repository,
+			}).Error("provider.kubernetes: failed to store stage version")
+			continue
+		}
+		versions[key] = version
+	}
+	for key, version := range existing {
+		if _, ok := versions[key]; ok {
+			continue
+		}
+		// no resource of the stage tracks the repository anymore
+		if err := p.stages.DeleteStageVersion(version); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"stage": version.Stage,
+			}).Error("provider.kubernetes: failed to delete stage version")
+		}
+	}
+
+	for _, event := range p.promotionEvents(versions, now) {
+		log.WithFields(log.Fields{
+			"image": event.Repository.Name,
+			"tag":   event.Repository.Tag,
+		}).Info("provider.kubernetes: promoting version to the next stage")
+
+		if _, err := p.processEvent(event); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"image": event.Repository.Name,
+				"tag":   event.Repository.Tag,
+			}).Error("provider.kubernetes: failed to process promotion event")
+		}
+	}
+}
+
+// storeStageVersion creates or updates the stored version, the soak time
+// restarts whenever the version, its digest or health changes
+func (p *Provider) storeStageVersion(current, observed *types.StageVersion, now time.Time) (*types.StageVersion, error) {
+	if observed.Healthy {
+		observed.HealthySince = now
+	}
+	if current == nil {
+		return p.stages.CreateStageVersion(observed)
+	}
+
+	// running digests are not always known, keep the last one
+	if observed.Digest == "" && observed.Version == current.Version && observed.Healthy {
+		observed.Digest = current.Digest
+	}
+	if current.Version == observed.Version && current.Digest == observed.Digest && current.Healthy == observed.Healthy {
+		return current, nil
+	}
+
+	current.Version = observed.Version
+	current.Digest = observed.Digest
+	current.Healthy = observed.Healthy
+	current.HealthySince = observed.HealthySince
+	return current, p.stages.UpdateStageVersion(current)
+}
+
+// promotionEvents returns events for versions that soaked in the previous
+// stage of resources still running another version, each event once
+func (p *Provider) promotionEvents(versions map[stageKey]*types.StageVersion, now time.Time) []*types.Event {
+	var events []*types.Event
+	seen := make(map[string]bool)
+	stages := make(map[stageRef]map[string]*types.StageVersion)
+
+	for _, resource := range p.cache.Values() {
+		annotations := resource.GetAnnotations()
+		previous := annotations[types.KeelPromoteAfterAnnotation]
+		if previous == "" {
+			continue
+		}
+		soak := getSoakTime(annotations)
+
+		after := p.previousStage(previous)
+		stage, ok := stages[after]
+		if !ok {
+			var err error
+			stage, err = p.stageVersions(after, versions)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":    err,
+					"stage":    after.stage,
+					"provider": after.provider,
+				}).Error("provider.kubernetes: failed to get stage versions")
+			} else if len(stage) == 0 {
+				log.WithFields(log.Fields{
+					"stage":    after.stage,
+					"provider": after.provider,
+				}).Error("provider.kubernetes: promotion stage has no resources, resources promoted after it are not updated")
+			}
+			stages[after] = stage
+		}
+
+		for _, img := range trackedResourceImages(resource) {
+			ref, err := image.Parse(img)
+			if err != nil {
+				continue
+			}
+			version, ok := stage[ref.Repository()]
+			if !ok || !version.Healthy || version.Version == ref.Tag() || now.Before(version.HealthySince.Add(soak)) {
+				continue
+			}
+
+			key := resource.Identifier + " " + ref.Repository()
+			if p.promoted[key] == version.Version {
+				continue
+			}
+			p.promoted[key] = version.Version
+
+			event := version.Repository + ":" + version.Version
+			if seen[event] {
+				continue
+			}
+			seen[event] = true
+			events = append(events, &types.Event{
+				Repository: types.Repository{
+					Name:   version.Repository,
+					Tag:    version.Version,
+					Digest: version.Digest,
+				},
+				TriggerName: types.TriggerTypePromotion.String(),
+				CreatedAt:   now,
+			})
+		}
+	}
+	return events
+}
+
+// promotionAllowed checks whether the stage in keel.sh/promoteAfter has run
+// the new version healthily for the soak time of the resource
+func (p *Provider) promotionAllowed(resource *k8s.GenericResource, repo *types.Repository, plan *UpdatePlan) bool {
+	annotations := resource.GetAnnotations()
+	previous := annotations[types.KeelPromoteAfterAnnotation]
+	if previous == "" {
+		return true
+	}
+	if p.stages == nil {
+		log.WithFields(log.Fields{
+			"name":      resource.Name,
+			"kind":      resource.Kind(),
+			"namespace": resource.Namespace,
+		}).Error("provider.kubernetes: no store for promotion stages, resource is not updated")
+		return false
+	}
+
+	ref, err := image.Parse(repo.String())
+	if err != nil {
+		return false
+	}
+	stage := p.previousStage(previous)
+	versions, err := p.stages.ListStageVersions(&types.StageVersionQuery{
+		Provider:   stage.provider,
+		Stage:      stage.stage,
+		Repository: ref.Repository(),
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"stage": previous,
+		}).Error("provider.kubernetes: failed to get stage versions")
+		return false
+	}
+
+	for _, version := range versions {
+		if !version.Healthy || version.Version != plan.NewVersion {
+			continue
+		}
+		if plan.NewDigest != "" && version.Digest != "" && plan.NewDigest != version.Digest {
+			continue
+		}
+		return !time.Now().Before(version.HealthySince.Add(getSoakTime(annotations)))
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+
+	apps_v1 "k8s.io/api/apps/v1"
+)
+
+func TestPromotionAfterSoakTime(t *testing.T) {
+	productionAnnotations := map[string]string{
+		types.KeelStageAnnotation:        "production",
+		types.KeelPromoteAfterAnnotation: "staging",
+		types.KeelSoakTimeAnnotation:     "1h",
+	}
+
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(rolledOut(dryRunTestDeployment("staging", "1.1.1", map[string]string{types.KeelStageAnnotation: "staging"}))))
+	grc.Add(MustParseGR(rolledOut(dryRunTestDeployment("production", "1.1.1", productionAnnotations))))
+	store, teardown := NewTestingUtils()
+	defer teardown()
+	approver, teardownApprover := approver()
+	defer teardownApprover()
+	p, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	p.SetStages(store)
+
+	updated, err := p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}})
+	if err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if len(updated) != 1 || updated[0].Name != "staging" {
+		t.Fatalf("expected only the staging resource to be updated, got: %d", len(updated))
+	}
+
+	// staging runs the new version
+	grc.Add(MustParseGR(rolledOut(dryRunTestDeployment("staging", "1.4.5", map[string]string{types.KeelStageAnnotation: "staging"}))))
+	fp.updated = nil
+	p.checkStages()
+	if fp.updated != nil {
+		t.Fatalf("production must not be updated before the soak time passes")
+	}
+
+	versions, err := store.ListStageVersions(&types.StageVersionQuery{Stage: "staging"})
+	if err != nil {
+		t.Fatalf("failed to list stage versions: %s", err)
+	}
+	if len(versions) != 1 || !versions[0].Healthy || versions[0].Version != "1.4.5" {
+		t.Fatalf("unexpected stage versions: %+v", versions)
+	}
+
+	// soaked for long enough
+	versions[0].HealthySince = time.Now().Add(-2 * time.Hour)
+	if err := store.UpdateStageVersion(versions[0]); err != nil {
+		t.Fatalf("failed to update stage version: %s", err)
+	}
+	p.checkStages()
+	if fp.updated == nil || fp.updated.Name != "production" || fp.updated.Containers()[0].Image != "gcr.io/v2-namespace/hello-world:1.4.5" {
+		t.Fatalf("expected production to be promoted, got: %+v", fp.updated)
+	}
+}
+
+func TestStageVersionNotHealthy(t *testing.T) {
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(rolledOut(dryRunTestDeployment("staging-1", "1.4.5", map[string]string{types.KeelStageAnnotation: "staging"}))))
+	grc.Add(MustParseGR(rolledOut(dryRunTestDeployment("staging-2", "1.1.1", map[string]string{types.KeelStageAnnotation: "staging"}))))
+	store, teardown := NewTestingUtils()
+	defer teardown()
+	approver, teardownApprover := approver()
+	defer teardownApprover()
+	p, err := NewProvider(&fakeImplementer{}, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	p.SetStages(store)
+
+	p.checkStages()
+	versions, err := store.ListStageVersions(&types.StageVersionQuery{})
+	if err != nil {
+		t.Fatalf("failed to list stage versions: %s", err)
+	}
+	if len(versions) != 1 || versions[0].Healthy || versions[0].Version != "" {
+		t.Fatalf("expected stage running different versions to be unhealthy, got: %+v", versions)
+	}
+}
+
+func TestPromotionAfterStageOfOtherCluster(t *testing.T) {
+	store, teardown := NewTestingUtils()
+	defer teardown()
+	approver, teardownApprover := approver()
+	defer teardownApprover()
+
+	clusterProvider := func(cluster string, deployment *apps_v1.Deployment) (*Provider, *fakeImplementer) {
+		resource := MustParseGR(deployment)
+		resource.SetCluster(cluster)
+		grc := &k8s.GenericResourceCache{}
+		grc.Add(resource)
+		fp := &fakeImplementer{}
+		p, err := NewProvider(fp, &fakeSender{}, approver, grc)
+		if err != nil {
+			t.Fatalf("failed to get provider: %s", err)
+		}
+		p.SetCluster(cluster)
+		p.SetStages(store)
+		return p, fp
+	}
+	staging, _ := clusterProvider("stg", rolledOut(dryRunTestDeployment("api", "1.4.5", map[string]string{types.KeelStageAnnotation: "staging"})))
+	production, fp := clusterProvider("prod", rolledOut(dryRunTestDeployment("api", "1.1.1", map[string]string{
+		types.KeelStageAnnotation:        "production",
+		types.KeelPromoteAfterAnnotation: "stg/staging",
+		types.KeelSoakTimeAnnotation:     "1h",
+	})))
+
+	staging.checkStages()
+	production.checkStages()
+	if fp.updated != nil {
+		t.Fatalf("production must not be updated before the soak time passes")
+	}
+
+	versions, err := store.ListStageVersions(&types.StageVersionQuery{Provider: "kubernetes/stg", Stage: "staging"})
+	if err != nil {
+		t.Fatalf("failed to list stage versions: %s", err)
+	}
+	if len(versions) != 1 || !versions[0].Healthy || versions[0].Version != "1.4.5" {
+		t.Fatalf("unexpected stage versions: %+v", versions)
+	}
+	versions[0].HealthySince = time.Now().Add(-2 * time.Hour)
+	if err := store.UpdateStageVersion(versions[0]); err != nil {
+		t.Fatalf("failed to update stage version: %s", err)
+	}
+
+	// stages of other clusters are left alone
+	production.checkStages()
+	if fp.updated == nil || fp.updated.Containers()[0].Image != "gcr.io/v2-namespace/hello-world:1.4.5" {
+		t.Fatalf("expected production to be promoted, got: %+v", fp.updated)
+	}
+	if versions, _ := store.ListStageVersions(&types.StageVersionQuery{Stage: "staging"}); len(versions) != 1 {
+		t.Errorf("expected the staging version to be kept, got: %+v", versions)
+	}
+}
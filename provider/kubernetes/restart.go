@@ -0,0 +1,201 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+
+	v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// podRestartTimeout - how long a deleted pod may take to be replaced by a
+// ready one unless the resource has a keel.sh/rolloutDeadline
+var podRestartTimeout = 10 * time.Minute
+
+// getRestartStrategy returns the keel.sh/restartStrategy of the resource,
+// rolling when it's not set or unknown
+func getRestartStrategy(labels, annotations map[string]string) string {
+	value, ok := annotations[types.KeelRestartStrategyAnnotation]
+	if !ok {
+		value = labels[types.KeelRestartStrategyAnnotation]
+	}
+	switch value {
+	case types.RestartStrategyDelete, types.RestartStrategyNone:
+		return value
+	}
+	return types.RestartStrategyRolling
+}
+
+// needsPodRestart - whether keel.sh/restartStrategy delete has to delete the
+// pods of the updated resource: its images didn't change (same tag updates)
+// or the controller doesn't roll pods on template changes. Otherwise the
+// controller rolls them already.
+func needsPodRestart(resource, previous *k8s.GenericResource) bool {
+	if getRestartStrategy(resource.GetLabels(), resource.GetAnnotations()) != types.RestartStrategyDelete {
+		return false
+	}
+	return previous == nil || resource.OnDeleteUpdates() || len(changedImages(previous, resource)) == 0
+}
+
+// restartPods deletes the pods of an updated resource one by one, from the
+// highest StatefulSet ordinal down, each replacement has to be ready before
+// the next pod is deleted. Progress is reported through notifications.
+func (p *Provider) restartPods(plan *UpdatePlan) {
+	resource := plan.Resource
+	notificationChannels := types.ParseEventNotificationChannels(resource.GetAnnotations())
+	notify := func(level types.Level, message string) {
+		p.sender.Send(types.EventNotification{
+			ResourceKind: resource.Kind(),
+			Identifier:   resource.Identifier,
+			Name:         "restart pods",
+			Message:      message,
+			CreatedAt:    time.Now(),
+			Type:         types.NotificationPodRestart,
+			Level:        level,
+			Channels:     notificationChannels,
+			Metadata:     updateMetadata(resource, plan, p.GetName()),
+		})
+	}
+
+	selector, ok := resource.GetPodSelector()
+	if !ok {
+		notify(types.LevelError, fmt.Sprintf("Can't restart pods of %s %s/%s, it has no pod selector", resource.Kind(), resource.Namespace, resource.Name))
+		return
+	}
+	podList, err := p.implementer.Pods(resource.Namespace, selector)
+	if err != nil {
+		notify(types.LevelError, fmt.Sprintf("Failed to list pods of %s %s/%s, error: %s", resource.Kind(), resource.Namespace, resource.Name, err))
+		return
+	}
+	pods := restartOrder(podList)
+	if len(pods) == 0 {
+		return
+	}
+
+	timeout := podRestartTimeout
+	if deadline, ok := getRolloutDeadline(resource.GetLabels(), resource.GetAnnotations()); ok {
+		timeout = deadline
+	}
+
+	notify(types.LevelInfo, fmt.Sprintf("Restarting %d pods of %s %s/%s one by one", len(pods), resource.Kind(), resource.Namespace, resource.Name))
+
+	for i, pod := range pods {
+		// the deleted pod counts when ready, its replacement has to be
+		ready := readyPods(podList, "")
+		err := p.implementer.DeletePod(pod.Namespace, pod.Name, &meta_v1.DeleteOptions{})
+		if err != nil {
+			notify(types.LevelError, fmt.Sprintf("Failed to delete pod %s/%s (%d/%d), error: %s", pod.Namespace, pod.Name, i+1, len(pods), err))
+			return
+		}
+
+		podList, err = p.waitPodReplaced(resource, selector, pod.UID, ready, timeout)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"name":      resource.Name,
+				"kind":      resource.Kind(),
+				"namespace": resource.Namespace,
+				"pod":       pod.Name,
+			}).Error("provider.kubernetes: pod restart failed")
+			notify(types.LevelError, fmt.Sprintf("Pod %s/%s (%d/%d) was deleted but %s, remaining pods are not restarted", pod.Namespace, pod.Name, i+1, len(pods), err))
+			return
+		}
+
+		notify(types.LevelInfo, fmt.Sprintf("Restarted pod %s/%s (%d/%d)", pod.Namespace, pod.Name, i+1, len(pods)))
+	}
+
+	notify(types.LevelSuccess, fmt.Sprintf("Restarted all %d pods of %s %s/%s", len(pods), resource.Kind(), resource.Namespace, resource.Name))
+}
+
+// waitPodReplaced waits until the deleted pod is gone and at least as many
+// other pods are ready as before its deletion
+func (p *Provider) waitPodReplaced(resource *k8s.GenericResource, selector string, deleted k8stypes.UID, ready int, timeout time.Duration) (*v1.PodList, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(rolloutCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			return nil, fmt.Errorf("no replacement became ready within %s", timeout)
+		case <-p.stop:
+			return nil, fmt.Errorf("keel is stopping")
+		}
+
+		podList, err := p.implementer.Pods(resource.Namespace, selector)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"name":      resource.Name,
+				"namespace": resource.Namespace,
+			}).Warn("provider.kubernetes: failed to list pods while restarting")
+			continue
+		}
+		if podList == nil || hasPod(podList, deleted) {
+			continue
+		}
+		if readyPods(podList, deleted) >= ready {
+			return podList, nil
+		}
+	}
+}
+
+// restartOrder returns pods to restart, highest StatefulSet ordinal first
+func restartOrder(podList *v1.PodList) []v1.Pod {
+	if podList == nil {
+		return nil
+	}
+	var pods []v1.Pod
+	for _, pod := range podList.Items {
+		if pod.DeletionTimestamp == nil {
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		// ordinals have no leading zeros, longer names have higher ones
+		if len(pods[i].Name) != len(pods[j].Name) {
+			return len(pods[i].Name) > len(pods[j].Name)
+		}
+		return pods[i].Name > pods[j].Name
+	})
+	return pods
+}
+
+// readyPods counts ready pods that are not being deleted, except the one
+// with the excluded UID
+func readyPods(podList *v1.PodList, excluded k8stypes.UID) int {
+	if podList == nil {
+		return 0
+	}
+	var ready int
+	for _, pod := range podList.Items {
+		if pod.UID == excluded || pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+				ready++
+				break
+			}
+		}
+	}
+	return ready
+}
+
+func hasPod(podList *v1.PodList, uid k8stypes.UID) bool {
+	for _, pod := range podList.Items {
+		if pod.UID == uid {
+			return true
+		}
+	}
+	return false
+}
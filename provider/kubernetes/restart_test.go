@@ -0,0 +1,246 @@
+package kubernetes
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+
+	apps_v1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+// restartingImplementer replaces deleted pods with ready ones, like a
+// StatefulSet controller
+type restartingImplementer struct {
+	fakeImplementer
+	mu      sync.Mutex
+	pods    []v1.Pod
+	deleted []string
+	// pods that never become ready again
+	broken map[string]bool
+}
+
+func readyPod(name string, uid string, ready bool) v1.Pod {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: "xxxx", UID: k8stypes.UID(uid)},
+		Status:     v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}}},
+	}
+}
+
+func (i *restartingImplementer) Pods(namespace, labelSelector string) (*v1.PodList, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return &v1.PodList{Items: append([]v1.Pod(nil), i.pods...)}, nil
+}
+
+func (i *restartingImplementer) DeletePod(namespace, name string, opts *meta_v1.DeleteOptions) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.deleted = append(i.deleted, name)
+	for idx, pod := range i.pods {
+		if pod.Name == name {
+			i.pods[idx] = readyPod(name, fmt.Sprintf("%s-%d", name, len(i.deleted)), !i.broken[name])
+		}
+	}
+	return nil
+}
+
+// restartTestStatefulSet - the dry-run test deployment as a StatefulSet
+// keeping the tag
+func restartTestStatefulSet(tag string, annotations map[string]string) *apps_v1.StatefulSet {
+	deployment := dryRunTestDeployment("db", tag, annotations)
+	deployment.Labels[types.KeelPolicyLabel] = "force"
+	return &apps_v1.StatefulSet{
+		ObjectMeta: deployment.ObjectMeta,
+		Spec: apps_v1.StatefulSetSpec{
+			Selector: &meta_v1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			Template: deployment.Spec.Template,
+		},
+	}
+}
+
+func TestGetRestartStrategy(t *testing.T) {
+	for _, tt := range []struct {
+		labels, annotations map[string]string
+		want                string
+	}{
+		{nil, nil, types.RestartStrategyRolling},
+		{nil, map[string]string{types.KeelRestartStrategyAnnotation: "delete"}, types.RestartStrategyDelete},
+		{map[string]string{types.KeelRestartStrategyAnnotation: "none"}, nil, types.RestartStrategyNone},
+		{map[string]string{types.KeelRestartStrategyAnnotation: "none"}, map[string]string{types.KeelRestartStrategyAnnotation: "rolling"}, types.RestartStrategyRolling},
+		{nil, map[string]string{types.KeelRestartStrategyAnnotation: "recreate"}, types.RestartStrategyRolling},
+	} {
+		if got := getRestartStrategy(tt.labels, tt.annotations); got != tt.want {
+			t.Errorf("getRestartStrategy(%v, %v) = %s, want %s", tt.labels, tt.annotations, got, tt.want)
+		}
+	}
+}
+
+func TestRestartOrder(t *testing.T) {
+	podList := &v1.PodList{}
+	for _, name := range []string{"db-0", "db-10", "db-2", "db-1"} {
+		podList.Items = append(podList.Items, readyPod(name, name, true))
+	}
+	terminating := readyPod("db-3", "db-3", true)
+	terminating.DeletionTimestamp = &meta_v1.Time{Time: time.Now()}
+	podList.Items = append(podList.Items, terminating)
+
+	var names []string
+	for _, pod := range restartOrder(podList) {
+		names = append(names, pod.Name)
+	}
+	if want := []string{"db-10", "db-2", "db-1", "db-0"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("unexpected order: %v, want %v", names, want)
+	}
+}
+
+func TestSetUpdateTimeRestartStrategy(t *testing.T) {
+	for strategy, bumped := range map[string]bool{"": true, "rolling": true, "delete": false, "none": false} {
+		gr := MustParseGR(restartTestStatefulSet("latest", map[string]string{types.KeelRestartStrategyAnnotation: strategy}))
+		setUpdateTime(gr)
+		if _, ok := gr.GetSpecAnnotations()[types.KeelUpdateTimeAnnotation]; ok != bumped {
+			t.Errorf("strategy '%s': update time set: %t, want %t", strategy, ok, bumped)
+		}
+	}
+}
+
+func TestNeedsPodRestart(t *testing.T) {
+	onDelete := func(tag string) *k8s.GenericResource {
+		ss := restartTestStatefulSet(tag, map[string]string{types.KeelRestartStrategyAnnotation: types.RestartStrategyDelete})
+		ss.Spec.UpdateStrategy.Type = apps_v1.OnDeleteStatefulSetStrategyType
+		return MustParseGR(ss)
+	}
+	rolling := func(strategy, tag string) *k8s.GenericResource {
+		return MustParseGR(restartTestStatefulSet(tag, map[string]string{types.KeelRestartStrategyAnnotation: strategy}))
+	}
+
+	for _, tt := range []struct {
+		name               string
+		resource, previous *k8s.GenericResource
+		want               bool
+	}{
+		{"same tag", rolling(types.RestartStrategyDelete, "latest"), rolling(types.RestartStrategyDelete, "latest"), true},
+		{"new tag rolls the pods", rolling(types.RestartStrategyDelete, "1.1.0"), rolling(types.RestartStrategyDelete, "1.0.0"), false},
+		{"new tag with OnDelete updates", onDelete("1.1.0"), onDelete("1.0.0"), true},
+		{"rolling strategy", rolling(types.RestartStrategyRolling, "latest"), rolling(types.RestartStrategyRolling, "latest"), false},
+	} {
+		if got := needsPodRestart(tt.resource, tt.previous); got != tt.want {
+			t.Errorf("%s: needsPodRestart = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRestartPods(t *testing.T) {
+	defer func(interval time.Duration) { rolloutCheckInterval = interval }(rolloutCheckInterval)
+	rolloutCheckInterval = 5 * time.Millisecond
+
+	fp := &restartingImplementer{pods: []v1.Pod{
+		readyPod("db-0", "a", true),
+		readyPod("db-1", "b", true),
+		readyPod("db-2", "c", true),
+	}}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(restartTestStatefulSet("latest", map[string]string{types.KeelRestartStrategyAnnotation: types.RestartStrategyDelete})))
+	approver, teardown := approver()
+	defer teardown()
+	sender := &threadSafeSender{}
+	provider, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	plans, err := provider.createUpdatePlans(&types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "latest"})
+	if err != nil || len(plans) != 1 {
+		t.Fatalf("expected a single plan, got: %v, %s", plans, err)
+	}
+	if _, ok := plans[0].Resource.GetSpecAnnotations()[types.KeelUpdateTimeAnnotation]; ok {
+		t.Error("pod template must not change, keel deletes the pods")
+	}
+
+	provider.restartPods(plans[0])
+
+	if want := []string{"db-2", "db-1", "db-0"}; !reflect.DeepEqual(fp.deleted, want) {
+		t.Errorf("unexpected deleted pods: %v, want %v", fp.deleted, want)
+	}
+	// started, 3 pods, finished
+	if len(sender.sent) != 5 {
+		t.Fatalf("expected 5 notifications, got: %d", len(sender.sent))
+	}
+	if last := sender.sent[4]; last.Type != types.NotificationPodRestart || last.Level != types.LevelSuccess {
+		t.Errorf("unexpected notification: %+v", last)
+	}
+}
+
+func TestRestartPodsNotReady(t *testing.T) {
+	defer func(interval time.Duration) { rolloutCheckInterval = interval }(rolloutCheckInterval)
+	rolloutCheckInterval = 5 * time.Millisecond
+	defer func(timeout time.Duration) { podRestartTimeout = timeout }(podRestartTimeout)
+	podRestartTimeout = 50 * time.Millisecond
+
+	fp := &restartingImplementer{
+		pods:   []v1.Pod{readyPod("db-0", "a", true), readyPod("db-1", "b", true)},
+		broken: map[string]bool{"db-1": true},
+	}
+	approver, teardown := approver()
+	defer teardown()
+	sender := &threadSafeSender{}
+	provider, err := NewProvider(fp, sender, approver, &k8s.GenericResourceCache{})
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	gr := MustParseGR(restartTestStatefulSet("latest", nil))
+	provider.restartPods(&UpdatePlan{Resource: gr, CurrentVersion: "latest", NewVersion: "latest"})
+
+	if want := []string{"db-1"}; !reflect.DeepEqual(fp.deleted, want) {
+		t.Errorf("db-0 must not be deleted before db-1 is ready again, deleted: %v", fp.deleted)
+	}
+	if last := sender.sent[len(sender.sent)-1]; last.Level != types.LevelError {
+		t.Errorf("expected an error notification, got: %+v", last)
+	}
+}
+
+func TestRollbackRestartsOnDeletePods(t *testing.T) {
+	defer func(interval time.Duration) { rolloutCheckInterval = interval }(rolloutCheckInterval)
+	rolloutCheckInterval = 5 * time.Millisecond
+
+	fp := &restartingImplementer{pods: []v1.Pod{readyPod("db-0", "a", true), readyPod("db-1", "b", true)}}
+	approver, teardown := approver()
+	defer teardown()
+	sender := &threadSafeSender{}
+	provider, err := NewProvider(fp, sender, approver, &k8s.GenericResourceCache{})
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	statefulSet := func(tag string) *k8s.GenericResource {
+		ss := restartTestStatefulSet(tag, map[string]string{types.KeelRestartStrategyAnnotation: types.RestartStrategyDelete})
+		ss.Spec.UpdateStrategy.Type = apps_v1.OnDeleteStatefulSetStrategyType
+		return MustParseGR(ss)
+	}
+	plan := &UpdatePlan{Resource: statefulSet("1.1.0"), Previous: statefulSet("1.0.0"), CurrentVersion: "1.0.0", NewVersion: "1.1.0"}
+	provider.rollback(plan, plan.Resource, "failed smoke test")
+
+	require.Eventually(t, func() bool {
+		last := sender.last()
+		return last.Type == types.NotificationPodRestart && last.Level == types.LevelSuccess
+	}, 5*time.Second, 5*time.Millisecond, "expected the pods to be restarted")
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if want := []string{"db-1", "db-0"}; !reflect.DeepEqual(fp.deleted, want) {
+		t.Errorf("unexpected deleted pods: %v, want %v", fp.deleted, want)
+	}
+}
@@ -0,0 +1,278 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+	"github.com/keel-hq/keel/util/image"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// rolloutCheckInterval - how often the resource status is checked while
+// verifying a rollout
+var rolloutCheckInterval = 5 * time.Second
+
+// getRolloutDeadline returns the keel.sh/rolloutDeadline duration, ok is false
+// when rollout verification is not enabled for the resource
+func getRolloutDeadline(labels map[string]string, annotations map[string]string) (time.Duration, bool) {
+	value, ok := annotations[types.KeelRolloutDeadlineAnnotation]
+	if !ok {
+		value, ok = labels[types.KeelRolloutDeadlineAnnotation]
+	}
+	if !ok || value == "" {
+		return 0, false
+	}
+	deadline, err := time.ParseDuration(value)
+	if err != nil || deadline <= 0 {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"deadline": value,
+		}).Error("provider.kubernetes: failed to parse rollout deadline, rollout won't be verified")
+		return 0, false
+	}
+	return deadline, true
+}
+
+func getBlockFailedVersionsFromMeta(labels map[string]string, annotations map[string]string) bool {
+	if value, ok := annotations[types.KeelBlockFailedVersionsAnnotation]; ok {
+		return value == "true"
+	}
+	return labels[types.KeelBlockFailedVersionsAnnotation] == "true"
+}
+
+// getBlockedVersions returns image references listed in keel.sh/blockedVersions
+func getBlockedVersions(annotations map[string]string) []string {
+	var blocked []string
+	for _, entry := range strings.Split(annotations[types.KeelBlockedVersionsAnnotation], ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			blocked = append(blocked, entry)
+		}
+	}
+	return blocked
+}
+
+// isVersionBlocked checks whether the repository and tag of the event were
+// blocked after a failed rollout
+func isVersionBlocked(annotations map[string]string, repo *types.Repository) bool {
+	blocked := getBlockedVersions(annotations)
+	if len(blocked) == 0 {
+		return false
+	}
+	repoRef, err := image.Parse(repo.String())
+	if err != nil {
+		return false
+	}
+	for _, entry := range blocked {
+		ref, err := image.Parse(entry)
+		if err != nil {
+			continue
+		}
+		if ref.Repository() == repoRef.Repository() && ref.Tag() == repoRef.Tag() {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyRollout waits until the updated resource reports a completed rollout.
+// When it doesn't within the deadline, the images and the keel.sh/digest
+// annotation are reverted to the values they had before the update. Returns
+// whether the rollout completed or can't be verified.
+func (p *Provider) verifyRollout(plan *UpdatePlan, deadline time.Duration) bool {
+	timer := time.NewTimer(deadline)
+	defer timer.Stop()
+	ticker := time.NewTicker(rolloutCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		current := p.cachedResource(plan.Resource.Identifier)
+		// the cache catches up with the update asynchronously, only
+		// status of the updated images is relevant
+		if current != nil && sameImages(current, plan.Resource) {
+			complete, ok := current.RolloutComplete()
+			if !ok {
+				log.WithFields(log.Fields{
+					"name":      current.Name,
+					"kind":      current.Kind(),
+					"namespace": current.Namespace,
+				}).Debug("provider.kubernetes: resource doesn't report rollout status, skipping verification")
+				return true
+			}
+			if complete {
+				log.WithFields(log.Fields{
+					"name":      current.Name,
+					"kind":      current.Kind(),
+					"namespace": current.Namespace,
+					"new":       plan.NewVersion,
+				}).Info("provider.kubernetes: rollout verified")
+				return true
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			if current == nil || !sameImages(current, plan.Resource) {
+				current = plan.Resource
+			}
+			p.rollback(plan, current, fmt.Sprintf("did not become ready within %s", deadline))
+			return false
+		case <-p.stop:
+			return false
+		}
+	}
+}
+
+// rollback reverts images changed by plan on the latest known state of the
+// resource, reason tells why the update failed
+func (p *Provider) rollback(plan *UpdatePlan, current *k8s.GenericResource, reason string) {
+	resource := current.DeepCopy()
+	previous := plan.Previous
+
+	annotations := resource.GetAnnotations()
+	labels := resource.GetLabels()
+	notificationChannels := types.ParseEventNotificationChannels(annotations)
+
+	failed := restoreImages(resource, previous)
+
+	if digest := previous.GetAnnotations()[types.KeelDigestAnnotation]; digest != "" {
+		annotations[types.KeelDigestAnnotation] = digest
+	} else {
+		delete(annotations, types.KeelDigestAnnotation)
+	}
+	if getBlockFailedVersionsFromMeta(labels, annotations) {
+		blocked := getBlockedVersions(annotations)
+		for _, img := range failed {
+			if !containsString(blocked, img) {
+				blocked = append(blocked, img)
+			}
+		}
+		annotations[types.KeelBlockedVersionsAnnotation] = strings.Join(blocked, ",")
+	}
+	annotations["kubernetes.io/change-cause"] = fmt.Sprintf("keel automated rollback, version %s -> %s [%s]", plan.NewVersion, plan.CurrentVersion, time.Now().Format(time.RFC3339))
+	resource.SetAnnotations(annotations)
+	setUpdateTime(resource)
+
+	metadata := updateMetadata(resource, plan, p.GetName())
+	metadata["rollbackReason"] = reason
+
+	commit, err := p.updateResource(resource, current, plan.NewVersion, plan.CurrentVersion)
+	if commit != "" {
+		metadata["commit"] = commit
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"name":      resource.Name,
+			"kind":      resource.Kind(),
+			"namespace": resource.Namespace,
+			"rollback":  fmt.Sprintf("%s->%s", plan.NewVersion, plan.CurrentVersion),
+		}).Error("provider.kubernetes: got error while rolling back resource")
+
+		p.sender.Send(types.EventNotification{
+			Name:         "rollback resource",
+			ResourceKind: resource.Kind(),
+			Identifier:   resource.Identifier,
+			Message:      fmt.Sprintf("%s %s/%s %s after update %s->%s, rollback failed, error: %s", resource.Kind(), resource.Namespace, resource.Name, reason, plan.CurrentVersion, plan.NewVersion, err),
+			CreatedAt:    time.Now(),
+			Type:         types.NotificationDeploymentRollback,
+			Level:        types.LevelError,
+			Channels:     notificationChannels,
+			Metadata:     metadata,
+		})
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"name":      resource.Name,
+		"kind":      resource.Kind(),
+		"namespace": resource.Namespace,
+		"previous":  plan.CurrentVersion,
+		"failed":    plan.NewVersion,
+		"reason":    reason,
+	}).Warn("provider.kubernetes: update failed, resource rolled back")
+
+	if len(failed) > 0 && needsPodRestart(resource, current) && commit == "" {
+		go p.restartPods(&UpdatePlan{
+			Resource:       resource,
+			Previous:       current,
+			CurrentVersion: plan.NewVersion,
+			NewVersion:     plan.CurrentVersion,
+		})
+	}
+
+	p.sender.Send(types.EventNotification{
+		Name:         "rollback resource",
+		ResourceKind: resource.Kind(),
+		Identifier:   resource.Identifier,
+		Message:      fmt.Sprintf("%s %s/%s %s after update %s->%s, rolled back to %s", resource.Kind(), resource.Namespace, resource.Name, reason, plan.CurrentVersion, plan.NewVersion, plan.CurrentVersion),
+		CreatedAt:    time.Now(),
+		Type:         types.NotificationDeploymentRollback,
+		Level:        types.LevelError,
+		Channels:     notificationChannels,
+		Metadata:     metadata,
+	})
+}
+
+// restoreImages sets images that differ from previous back to their previous
+// values and returns the images that were replaced
+func restoreImages(resource, previous *k8s.GenericResource) (replaced []string) {
+	containers := resource.Containers()
+	for idx, c := range previous.Containers() {
+		if idx < len(containers) && containers[idx].Image != c.Image {
+			replaced = append(replaced, containers[idx].Image)
+			resource.UpdateContainer(idx, c.Image)
+		}
+	}
+	initContainers := resource.InitContainers()
+	for idx, c := range previous.InitContainers() {
+		if idx < len(initContainers) && initContainers[idx].Image != c.Image {
+			replaced = append(replaced, initContainers[idx].Image)
+			resource.UpdateInitContainer(idx, c.Image)
+		}
+	}
+	volumes := resource.Volumes()
+	for idx, v := range previous.Volumes() {
+		if v.Image == nil || idx >= len(volumes) || volumes[idx].Image == nil {
+			continue
+		}
+		if volumes[idx].Image.Reference != v.Image.Reference {
+			replaced = append(replaced, volumes[idx].Image.Reference)
+			resource.UpdateImageVolume(idx, v.Image.Reference)
+		}
+	}
+	return replaced
+}
+
+func sameImages(a, b *k8s.GenericResource) bool {
+	return strings.Join(resourceImages(a), ",") == strings.Join(resourceImages(b), ",")
+}
+
+func resourceImages(r *k8s.GenericResource) []string {
+	images := r.GetImages(nil)
+	images = append(images, r.GetInitImages(nil)...)
+	return append(images, r.GetImageVolumeReferences(nil)...)
+}
+
+func (p *Provider) cachedResource(identifier string) *k8s.GenericResource {
+	for _, gr := range p.cache.Values() {
+		if gr.Identifier == identifier {
+			return gr
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
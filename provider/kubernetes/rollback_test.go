@@ -0,0 +1,109 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+)
+
+func TestVerifyRolloutRollsBack(t *testing.T) {
+	defer func(interval time.Duration) { rolloutCheckInterval = interval }(rolloutCheckInterval)
+	rolloutCheckInterval = 5 * time.Millisecond
+
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(rolledOut(dryRunTestDeployment("deployment-1", "1.1.1", map[string]string{
+		types.KeelRolloutDeadlineAnnotation:     "30ms",
+		types.KeelBlockFailedVersionsAnnotation: "true",
+		types.KeelDigestAnnotation:              "sha256:previous",
+	}))))
+	approver, teardown := approver()
+	defer teardown()
+	sender := &fakeSender{}
+	provider, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	repo := &types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5", Digest: "sha256:new"}
+	plans, err := provider.createUpdatePlans(repo)
+	if err != nil || len(plans) != 1 {
+		t.Fatalf("expected one plan, got: %v, error: %v", plans, err)
+	}
+	fp.Update(plans[0].Resource, plans[0].Previous)
+
+	// the cache never reports the new pods as available
+	notReady := rolledOut(dryRunTestDeployment("deployment-1", "1.4.5", plans[0].Resource.GetAnnotations()))
+	notReady.Generation = 2
+	grc.Add(MustParseGR(notReady))
+
+	provider.verifyRollout(plans[0], 30*time.Millisecond)
+
+	fp.mu.Lock()
+	rolledBack := fp.updated
+	fp.mu.Unlock()
+	if image := rolledBack.Containers()[0].Image; image != "gcr.io/v2-namespace/hello-world:1.1.1" {
+		t.Errorf("expected image to be rolled back, got: %s", image)
+	}
+	annotations := rolledBack.GetAnnotations()
+	if annotations[types.KeelDigestAnnotation] != "sha256:previous" {
+		t.Errorf("expected digest to be restored, got: %s", annotations[types.KeelDigestAnnotation])
+	}
+	if annotations[types.KeelBlockedVersionsAnnotation] != "gcr.io/v2-namespace/hello-world:1.4.5" {
+		t.Errorf("unexpected blocked versions: %s", annotations[types.KeelBlockedVersionsAnnotation])
+	}
+	if sender.sentEvent.Type != types.NotificationDeploymentRollback || sender.sentEvent.Level != types.LevelError {
+		t.Errorf("expected rollback notification, got: %+v", sender.sentEvent)
+	}
+
+	// blocked version is not planned again
+	grc.Add(rolledBack)
+	plans, err = provider.createUpdatePlans(repo)
+	if err != nil {
+		t.Fatalf("failed to create plans: %s", err)
+	}
+	if len(plans) != 0 {
+		t.Errorf("expected blocked version to be skipped, got: %v", plans)
+	}
+}
+
+func TestVerifyRolloutComplete(t *testing.T) {
+	defer func(interval time.Duration) { rolloutCheckInterval = interval }(rolloutCheckInterval)
+	rolloutCheckInterval = 5 * time.Millisecond
+
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(rolledOut(dryRunTestDeployment("deployment-1", "1.1.1", map[string]string{
+		types.KeelRolloutDeadlineAnnotation: "1m",
+	}))))
+	approver, teardown := approver()
+	defer teardown()
+	provider, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+
+	plans, err := provider.createUpdatePlans(&types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"})
+	if err != nil || len(plans) != 1 {
+		t.Fatalf("expected one plan, got: %v, error: %v", plans, err)
+	}
+	ready := rolledOut(dryRunTestDeployment("deployment-1", "1.4.5", plans[0].Resource.GetAnnotations()))
+	grc.Add(MustParseGR(ready))
+
+	done := make(chan struct{})
+	go func() {
+		provider.verifyRollout(plans[0], time.Minute)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("rollout verification did not finish")
+	}
+	if fp.updated != nil {
+		t.Errorf("did not expect a rollback, got: %s", strings.Join(fp.updated.GetImages(nil), ","))
+	}
+}
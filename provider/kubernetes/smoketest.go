@@ -0,0 +1,209 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+
+	"sigs.k8s.io/yaml"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// smokeTestRetryInterval - pause between attempts of a failing smoke test
+var smokeTestRetryInterval = 5 * time.Second
+
+// defaultSmokeTestTimeout - timeout of a single request unless set
+const defaultSmokeTestTimeout = 10 * time.Second
+
+// smokeTestBodyLimit - how much of the response body is matched
+const smokeTestBodyLimit = 1 << 20
+
+// smokeTest - HTTP check of keel.sh/smokeTest
+type smokeTest struct {
+	URL string `json:"url"`
+	// Status - expected status code, 200 when not set
+	Status int `json:"status"`
+	// Body - regular expression the response body has to match
+	Body string `json:"body"`
+	// Timeout - timeout of a single request, ie: 5s
+	Timeout string `json:"timeout"`
+	// Retries - additional attempts before the check fails
+	Retries int `json:"retries"`
+
+	bodyRegexp     *regexp.Regexp
+	requestTimeout time.Duration
+}
+
+// parseSmokeTests parses a keel.sh/smokeTest value, a YAML or JSON list
+// of checks
+func parseSmokeTests(value string) ([]smokeTest, error) {
+	var tests []smokeTest
+	if err := yaml.Unmarshal([]byte(value), &tests); err != nil {
+		return nil, err
+	}
+	for i := range tests {
+		test := &tests[i]
+		if test.URL == "" {
+			return nil, fmt.Errorf("check %d: url is required", i+1)
+		}
+		if test.Status == 0 {
+			test.Status = http.StatusOK
+		}
+		if test.Retries < 0 {
+			return nil, fmt.Errorf("check %s: retries cannot be negative", test.URL)
+		}
+		test.requestTimeout = defaultSmokeTestTimeout
+		if test.Timeout != "" {
+			timeout, err := time.ParseDuration(test.Timeout)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("check %s: invalid timeout '%s'", test.URL, test.Timeout)
+			}
+			test.requestTimeout = timeout
+		}
+		if test.Body != "" {
+			body, err := regexp.Compile(test.Body)
+			if err != nil {
+				return nil, fmt.Errorf("check %s: invalid body regex: %w", test.URL, err)
+			}
+			test.bodyRegexp = body
+		}
+	}
+	return tests, nil
+}
+
+// getSmokeTests returns smoke tests of the resource, invalid configuration
+// is logged and ignored
+func getSmokeTests(resource *k8s.GenericResource) []smokeTest {
+	value, ok := resource.GetAnnotations()[types.KeelSmokeTestAnnotation]
+	if !ok || value == "" {
+		return nil
+	}
+	tests, err := parseSmokeTests(value)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"name":      resource.Name,
+			"kind":      resource.Kind(),
+			"namespace": resource.Namespace,
+		}).Error("provider.kubernetes: failed to parse smoke tests, they won't run")
+		return nil
+	}
+	return tests
+}
+
+// check runs the request once
+func (t smokeTest) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, t.requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != t.Status {
+		return fmt.Errorf("expected status %d, got %d", t.Status, resp.StatusCode)
+	}
+	if t.bodyRegexp == nil {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, smokeTestBodyLimit))
+	if err != nil {
+		return fmt.Errorf("failed to read body: %w", err)
+	}
+	if !t.bodyRegexp.Match(body) {
+		return fmt.Errorf("body doesn't match '%s'", t.Body)
+	}
+	return nil
+}
+
+// runSmokeTest retries the check until it passes or runs out of attempts
+func (p *Provider) runSmokeTest(test smokeTest) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var err error
+	for attempt := 0; attempt <= test.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(smokeTestRetryInterval):
+			case <-ctx.Done():
+				return fmt.Errorf("keel is stopping")
+			}
+		}
+		if err = test.check(ctx); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// runSmokeTests runs the smoke tests of an update that became ready, a
+// failure is reported and, with keel.sh/smokeTestRollback, rolled back
+func (p *Provider) runSmokeTests(plan *UpdatePlan, tests []smokeTest) {
+	resource := plan.Resource
+	currentVersion := formatVersionWithDigest(plan.CurrentVersion, plan.CurrentDigest)
+	newVersion := formatVersionWithDigest(plan.NewVersion, plan.NewDigest)
+	notify := func(level types.Level, result, message string) {
+		metadata := updateMetadata(resource, plan, p.GetName())
+		metadata["smokeTest"] = result
+		p.sender.Send(types.EventNotification{
+			ResourceKind: resource.Kind(),
+			Identifier:   resource.Identifier,
+			Name:         "smoke test",
+			Message:      message,
+			CreatedAt:    time.Now(),
+			Type:         types.NotificationSmokeTest,
+			Level:        level,
+			Channels:     types.ParseEventNotificationChannels(resource.GetAnnotations()),
+			Metadata:     metadata,
+		})
+	}
+
+	for _, test := range tests {
+		err := p.runSmokeTest(test)
+		if err == nil {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"error":     err,
+			"name":      resource.Name,
+			"kind":      resource.Kind(),
+			"namespace": resource.Namespace,
+			"url":       test.URL,
+			"update":    fmt.Sprintf("%s->%s", currentVersion, newVersion),
+		}).Error("provider.kubernetes: smoke test failed")
+		notify(types.LevelError, "failed", fmt.Sprintf("%s %s/%s update %s->%s failed smoke test %s: %s", resource.Kind(), resource.Namespace, resource.Name, currentVersion, newVersion, test.URL, err))
+
+		if resource.GetAnnotations()[types.KeelSmokeTestRollbackAnnotation] == "true" && plan.Previous != nil {
+			current := p.cachedResource(resource.Identifier)
+			if current == nil || !sameImages(current, resource) {
+				current = resource
+			}
+			p.rollback(plan, current, fmt.Sprintf("failed smoke test %s", test.URL))
+		}
+		return
+	}
+
+	notify(types.LevelSuccess, "passed", fmt.Sprintf("%s %s/%s update %s->%s passed %d smoke tests", resource.Kind(), resource.Namespace, resource.Name, currentVersion, newVersion, len(tests)))
+}
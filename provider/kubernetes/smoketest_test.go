@@ -0,0 +1,140 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/types"
+)
+
+func TestParseSmokeTests(t *testing.T) {
+	tests, err := parseSmokeTests(`
+- url: http://api.default.svc/healthz
+- url: http://api.default.svc/version
+  status: 204
+  body: '"version":\s*"1\.'
+  timeout: 2s
+  retries: 3
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(tests) != 2 {
+		t.Fatalf("expected 2 checks, got: %d", len(tests))
+	}
+	if tests[0].Status != http.StatusOK || tests[0].requestTimeout != defaultSmokeTestTimeout || tests[0].bodyRegexp != nil {
+		t.Errorf("unexpected defaults: %+v", tests[0])
+	}
+	if tests[1].Status != 204 || tests[1].requestTimeout != 2*time.Second || tests[1].Retries != 3 || !tests[1].bodyRegexp.MatchString(`{"version": "1.2"}`) {
+		t.Errorf("unexpected check: %+v", tests[1])
+	}
+
+	for _, value := range []string{
+		"- status: 200",
+		"- url: http://api\n  timeout: soon",
+		"- url: http://api\n  body: '['",
+		"- url: http://api\n  retries: -1",
+		"url: http://api",
+	} {
+		if _, err := parseSmokeTests(value); err == nil {
+			t.Errorf("%q: expected error", value)
+		}
+	}
+}
+
+func smokeTestProvider(t *testing.T, annotations map[string]string) (*Provider, *fakeImplementer, *threadSafeSender, *UpdatePlan, func()) {
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(rolledOut(dryRunTestDeployment("deployment-1", "1.1.1", annotations))))
+	approver, teardown := approver()
+	sender := &threadSafeSender{}
+	provider, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	plans, err := provider.createUpdatePlans(&types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"})
+	if err != nil || len(plans) != 1 {
+		t.Fatalf("expected one plan, got: %v, error: %v", plans, err)
+	}
+	return provider, fp, sender, plans[0], teardown
+}
+
+func TestSmokeTestsPass(t *testing.T) {
+	defer func(interval time.Duration) { smokeTestRetryInterval = interval }(smokeTestRetryInterval)
+	smokeTestRetryInterval = time.Millisecond
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first request hits a pod that isn't serving yet
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"status": "ok"}`)
+	}))
+	defer srv.Close()
+
+	provider, fp, sender, plan, teardown := smokeTestProvider(t, map[string]string{types.KeelSmokeTestRollbackAnnotation: "true"})
+	defer teardown()
+
+	tests, err := parseSmokeTests(fmt.Sprintf(`[{"url": "%s", "body": "\"ok\"", "retries": 1}]`, srv.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	provider.runSmokeTests(plan, tests)
+
+	if fp.updated != nil {
+		t.Error("did not expect a rollback")
+	}
+	if len(sender.sent) != 1 {
+		t.Fatalf("expected a single notification, got: %d", len(sender.sent))
+	}
+	if event := sender.sent[0]; event.Type != types.NotificationSmokeTest || event.Level != types.LevelSuccess || event.Metadata["smokeTest"] != "passed" {
+		t.Errorf("unexpected notification: %+v", event)
+	}
+}
+
+func TestSmokeTestsRollBack(t *testing.T) {
+	defer func(interval time.Duration) { smokeTestRetryInterval = interval }(smokeTestRetryInterval)
+	smokeTestRetryInterval = time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	for rollback, rolledBack := range map[string]bool{"true": true, "": false} {
+		provider, fp, sender, plan, teardown := smokeTestProvider(t, map[string]string{types.KeelSmokeTestRollbackAnnotation: rollback})
+
+		tests, err := parseSmokeTests(fmt.Sprintf(`[{"url": "%s", "retries": 2}]`, srv.URL))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		provider.runSmokeTests(plan, tests)
+		teardown()
+
+		if len(sender.sent) == 0 {
+			t.Fatal("expected notifications")
+		}
+		if event := sender.sent[0]; event.Type != types.NotificationSmokeTest || event.Level != types.LevelError || event.Metadata["smokeTest"] != "failed" {
+			t.Errorf("unexpected notification: %+v", event)
+		}
+		if (fp.updated != nil) != rolledBack {
+			t.Fatalf("rollback '%s': rolled back: %t, want %t", rollback, fp.updated != nil, rolledBack)
+		}
+		if !rolledBack {
+			continue
+		}
+		if image := fp.updated.Containers()[0].Image; image != "gcr.io/v2-namespace/hello-world:1.1.1" {
+			t.Errorf("expected image to be rolled back, got: %s", image)
+		}
+		if event := sender.sent[len(sender.sent)-1]; event.Type != types.NotificationDeploymentRollback {
+			t.Errorf("expected a rollback notification, got: %+v", event)
+		}
+	}
+}
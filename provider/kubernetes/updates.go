@@ -28,6 +28,14 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 	}).Debug("provider.kubernetes.checkVersionedDeployment: keel policy found, checking resource...")
 	shouldUpdateDeployment = false
 
+	// keel.sh/pinDigest writes images as tag@digest, the digest has to come
+	// with the event (resolved by the poll trigger or sent by the registry)
+	pinDigest := getPinDigestFromMeta(resource.GetLabels(), resource.GetAnnotations())
+	var digest string
+	if pinDigest {
+		digest = repo.Digest
+	}
+
 	containerFilterFunc := GetMonitorContainersFromMeta(resource.GetAnnotations(), resource.GetLabels())
 	volumeFilterFunc := GetMonitorVolumesFromMeta(resource.GetAnnotations(), resource.GetLabels())
 
@@ -39,6 +47,7 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 			if !volumeFilterFunc(vol) {
 				continue
 			}
+			containerPolicy := getContainerPolicy(plc, vol.Name, resource)
 
 			volumeImageRef, err := image.Parse(vol.Image.Reference)
 			if err != nil {
@@ -57,7 +66,7 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 				"parsed_image_name": volumeImageRef.Remote(),
 				"target_image_name": repo.Name,
 				"target_tag":        repo.Tag,
-				"policy":            plc.Name(),
+				"policy":            containerPolicy.Name(),
 				"image":             vol.Image.Reference,
 			}).Debug("provider.kubernetes: checking image volume")
 
@@ -69,13 +78,17 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 				continue
 			}
 
-			shouldUpdateVolume, err := plc.ShouldUpdate(volumeImageRef.Tag(), eventRepoRef.Tag())
+			if alreadyPinned(volumeImageRef, repo) {
+				continue
+			}
+
+			shouldUpdateVolume, err := containerPolicy.ShouldUpdate(volumeImageRef.Tag(), eventRepoRef.Tag())
 			if err != nil {
 				log.WithFields(log.Fields{
 					"error":             err,
 					"parsed_image_name": volumeImageRef.Remote(),
 					"target_image_name": repo.Name,
-					"policy":            plc.Name(),
+					"policy":            containerPolicy.Name(),
 				}).Error("provider.kubernetes: failed to check whether image volume should be updated")
 				continue
 			}
@@ -86,11 +99,7 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 
 			setUpdateTime(resource)
 
-			if volumeImageRef.Registry() == image.DefaultRegistryHostname {
-				resource.UpdateImageVolume(idx, fmt.Sprintf("%s:%s", volumeImageRef.ShortName(), repo.Tag))
-			} else {
-				resource.UpdateImageVolume(idx, fmt.Sprintf("%s:%s", volumeImageRef.Repository(), repo.Tag))
-			}
+			resource.UpdateImageVolume(idx, updatedImage(volumeImageRef, repo.Tag, digest))
 
 			shouldUpdateDeployment = true
 
@@ -106,6 +115,7 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 			if !containerFilterFunc(c) {
 				continue
 			}
+			containerPolicy := getContainerPolicy(plc, c.Name, resource)
 			containerImageRef, err := image.Parse(c.Image)
 			if err != nil {
 				log.WithFields(log.Fields{
@@ -122,7 +132,7 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 				"parsed_image_name": containerImageRef.Remote(),
 				"target_image_name": repo.Name,
 				"target_tag":        repo.Tag,
-				"policy":            plc.Name(),
+				"policy":            containerPolicy.Name(),
 				"image":             c.Image,
 			}).Debug("provider.kubernetes: checking image")
 
@@ -134,13 +144,17 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 				continue
 			}
 
-			shouldUpdateContainer, err := plc.ShouldUpdate(containerImageRef.Tag(), eventRepoRef.Tag())
+			if alreadyPinned(containerImageRef, repo) {
+				continue
+			}
+
+			shouldUpdateContainer, err := containerPolicy.ShouldUpdate(containerImageRef.Tag(), eventRepoRef.Tag())
 			if err != nil {
 				log.WithFields(log.Fields{
 					"error":             err,
 					"parsed_image_name": containerImageRef.Remote(),
 					"target_image_name": repo.Name,
-					"policy":            plc.Name(),
+					"policy":            containerPolicy.Name(),
 				}).Error("provider.kubernetes: failed to check whether init container should be updated")
 				continue
 			}
@@ -153,11 +167,7 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 			setUpdateTime(resource)
 
 			// updating image
-			if containerImageRef.Registry() == image.DefaultRegistryHostname {
-				resource.UpdateInitContainer(idx, fmt.Sprintf("%s:%s", containerImageRef.ShortName(), repo.Tag))
-			} else {
-				resource.UpdateInitContainer(idx, fmt.Sprintf("%s:%s", containerImageRef.Repository(), repo.Tag))
-			}
+			resource.UpdateInitContainer(idx, updatedImage(containerImageRef, repo.Tag, digest))
 
 			shouldUpdateDeployment = true
 
@@ -171,6 +181,7 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 		if !containerFilterFunc(c) {
 			continue
 		}
+		containerPolicy := getContainerPolicy(plc, c.Name, resource)
 		containerImageRef, err := image.Parse(c.Image)
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -187,7 +198,7 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 			"parsed_image_name": containerImageRef.Remote(),
 			"target_image_name": repo.Name,
 			"target_tag":        repo.Tag,
-			"policy":            plc.Name(),
+			"policy":            containerPolicy.Name(),
 			"image":             c.Image,
 		}).Debug("provider.kubernetes: checking image")
 
@@ -199,13 +210,17 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 			continue
 		}
 
-		shouldUpdateContainer, err := plc.ShouldUpdate(containerImageRef.Tag(), eventRepoRef.Tag())
+		if alreadyPinned(containerImageRef, repo) {
+			continue
+		}
+
+		shouldUpdateContainer, err := containerPolicy.ShouldUpdate(containerImageRef.Tag(), eventRepoRef.Tag())
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error":             err,
 				"parsed_image_name": containerImageRef.Remote(),
 				"target_image_name": repo.Name,
-				"policy":            plc.Name(),
+				"policy":            containerPolicy.Name(),
 			}).Error("provider.kubernetes: failed to check whether container should be updated")
 			continue
 		}
@@ -218,11 +233,7 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 		setUpdateTime(resource)
 
 		// updating image
-		if containerImageRef.Registry() == image.DefaultRegistryHostname {
-			resource.UpdateContainer(idx, fmt.Sprintf("%s:%s", containerImageRef.ShortName(), repo.Tag))
-		} else {
-			resource.UpdateContainer(idx, fmt.Sprintf("%s:%s", containerImageRef.Repository(), repo.Tag))
-		}
+		resource.UpdateContainer(idx, updatedImage(containerImageRef, repo.Tag, digest))
 
 		shouldUpdateDeployment = true
 
@@ -232,10 +243,54 @@ func checkForUpdate(plc policy.Policy, repo *types.Repository, resource *k8s.Gen
 		updatePlan.Resource = resource
 	}
 
+	if shouldUpdateDeployment && pinDigest && digest == "" {
+		log.WithFields(log.Fields{
+			"name":      resource.Name,
+			"namespace": resource.Namespace,
+			"kind":      resource.Kind(),
+			"image":     repo.String(),
+		}).Warn("provider.kubernetes: digest of the new version is unknown, image is not pinned")
+	}
+
 	return updatePlan, shouldUpdateDeployment, nil
 }
 
+// updatedImage returns the image of ref updated to tag and pinned to digest
+// unless it's empty. Images from the default registry keep their short name.
+func updatedImage(ref *image.Reference, tag, digest string) string {
+	name := ref.Repository()
+	if ref.Registry() == image.DefaultRegistryHostname {
+		name = ref.ShortName()
+	}
+	if digest != "" {
+		return fmt.Sprintf("%s:%s@%s", name, tag, digest)
+	}
+	return fmt.Sprintf("%s:%s", name, tag)
+}
+
+// alreadyPinned - whether the image is pinned to the tag and digest of the
+// event, there is nothing to update then even for the force policy
+func alreadyPinned(ref *image.Reference, repo *types.Repository) bool {
+	return ref.Digest() != "" && ref.Digest() == repo.Digest && ref.Tag() == repo.Tag
+}
+
+// getContainerPolicy returns the policy of a single container or image volume,
+// plc applies unless it has container scoped policy annotations
+func getContainerPolicy(plc policy.Policy, name string, resource *k8s.GenericResource) policy.Policy {
+	annotations := resource.GetAnnotations()
+	if !policy.HasContainerPolicy(name, annotations) {
+		return plc
+	}
+	return policy.GetContainerPolicy(name, resource.GetLabels(), annotations)
+}
+
+// setUpdateTime bumps keel.sh/update-time of the pod template so that pods
+// are restarted even when the tag is unchanged, unless keel restarts them
+// itself or not at all
 func setUpdateTime(resource *k8s.GenericResource) {
+	if getRestartStrategy(resource.GetLabels(), resource.GetAnnotations()) != types.RestartStrategyRolling {
+		return
+	}
 	specAnnotations := resource.GetSpecAnnotations()
 	specAnnotations[types.KeelUpdateTimeAnnotation] = time.Now().String()
 	resource.SetSpecAnnotations(specAnnotations)
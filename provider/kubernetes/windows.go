@@ -0,0 +1,105 @@
+package kubernetes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/keel-hq/keel/provider"
+	"github.com/keel-hq/keel/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SetUpdateWindows - queue keeping updates that fall outside of the
+// keel.sh/updateWindow of their resource or into a freeze period
+func (p *Provider) SetUpdateWindows(queue *provider.DeferredQueue) {
+	p.deferred = queue
+}
+
+// deferPlans returns plans that can be applied now, the rest is deferred
+// until the update window of the resource opens
+func (p *Provider) deferPlans(event *types.Event, plans []*UpdatePlan) (ready []*UpdatePlan) {
+	now := time.Now()
+	for _, plan := range plans {
+		resource := plan.Resource
+		notBefore, err := p.deferred.NextOpen(resource.GetAnnotations()[types.KeelUpdateWindowAnnotation], now)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"name":      resource.Name,
+				"kind":      resource.Kind(),
+				"namespace": resource.Namespace,
+			}).Error("provider.kubernetes: invalid update window, resource is not updated")
+			continue
+		}
+		if !notBefore.After(now) {
+			ready = append(ready, plan)
+			continue
+		}
+
+		created, err := p.deferred.Defer(&types.DeferredUpdate{
+			Identifier:     resource.Identifier,
+			ResourceKind:   resource.Kind(),
+			Event:          event,
+			CurrentVersion: plan.CurrentVersion,
+			NewVersion:     plan.NewVersion,
+			NotBefore:      notBefore,
+		})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"name":      resource.Name,
+				"kind":      resource.Kind(),
+				"namespace": resource.Namespace,
+			}).Error("provider.kubernetes: failed to defer update")
+			continue
+		}
+		if !created {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"name":       resource.Name,
+			"kind":       resource.Kind(),
+			"namespace":  resource.Namespace,
+			"update":     fmt.Sprintf("%s->%s", plan.CurrentVersion, plan.NewVersion),
+			"not_before": notBefore,
+		}).Info("provider.kubernetes: outside of the update window, update deferred")
+
+		metadata := updateMetadata(resource, plan, p.GetName())
+		metadata["notBefore"] = notBefore.Format(time.RFC3339)
+
+		p.sender.Send(types.EventNotification{
+			ResourceKind: resource.Kind(),
+			Identifier:   resource.Identifier,
+			Name:         "update deferred",
+			Message:      fmt.Sprintf("Update of %s %s/%s %s->%s deferred until %s", resource.Kind(), resource.Namespace, resource.Name, formatVersionWithDigest(plan.CurrentVersion, plan.CurrentDigest), formatVersionWithDigest(plan.NewVersion, plan.NewDigest), notBefore.Format(time.RFC3339)),
+			CreatedAt:    time.Now(),
+			Type:         types.NotificationUpdateDeferred,
+			Level:        types.LevelInfo,
+			Channels:     types.ParseEventNotificationChannels(resource.GetAnnotations()),
+			Metadata:     metadata,
+		})
+	}
+	return ready
+}
+
+// processDeferred submits events of deferred updates whose window opened
+func (p *Provider) processDeferred() {
+	due, err := p.deferred.Due(time.Now())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("provider.kubernetes: failed to get deferred updates")
+		return
+	}
+	for _, event := range provider.DueEvents(due) {
+		if _, err := p.processEvent(event); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"image": event.Repository.Name,
+				"tag":   event.Repository.Tag,
+			}).Error("provider.kubernetes: failed to process deferred event")
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keel-hq/keel/internal/k8s"
+	"github.com/keel-hq/keel/internal/window"
+	"github.com/keel-hq/keel/provider"
+	"github.com/keel-hq/keel/types"
+)
+
+func TestProcessEventOutsideUpdateWindow(t *testing.T) {
+	// a window two days from now is closed
+	day := time.Now().UTC().Add(48 * time.Hour).Weekday().String()[:3]
+
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{types.KeelUpdateWindowAnnotation: day + " 10:00-11:00"})))
+	store, teardown := NewTestingUtils()
+	defer teardown()
+	approver, teardownApprover := approver()
+	defer teardownApprover()
+	sender := &fakeSender{}
+	p, err := NewProvider(fp, sender, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	p.SetUpdateWindows(provider.NewDeferredQueue(ProviderName, store, nil))
+
+	event := &types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}}
+	if _, err := p.processEvent(event); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if fp.updated != nil {
+		t.Fatalf("resource must not be updated outside of the update window")
+	}
+	if sender.sentEvent.Type != types.NotificationUpdateDeferred || !strings.Contains(sender.sentEvent.Message, "10:00:00Z") {
+		t.Errorf("expected update deferred notification, got: %+v", sender.sentEvent)
+	}
+
+	deferred, err := store.ListDeferredUpdates(&types.DeferredUpdateQuery{Identifier: "deployment/xxxx/dep-1"})
+	if err != nil {
+		t.Fatalf("failed to list deferred updates: %s", err)
+	}
+	if len(deferred) != 1 || deferred[0].NewVersion != "1.4.5" || deferred[0].NotBefore.UTC().Hour() != 10 {
+		t.Fatalf("unexpected deferred updates: %+v", deferred)
+	}
+
+	// polling finds the update again, it is deferred once
+	sender.sentEvent = types.EventNotification{}
+	if _, err := p.processEvent(event); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if sender.sentEvent.Type == types.NotificationUpdateDeferred {
+		t.Errorf("did not expect a repeated notification")
+	}
+	if deferred, _ := store.ListDeferredUpdates(&types.DeferredUpdateQuery{}); len(deferred) != 1 {
+		t.Errorf("expected a single deferred update, got: %d", len(deferred))
+	}
+}
+
+func TestDeferredUpdateAppliedAfterFreeze(t *testing.T) {
+	fp := &fakeImplementer{}
+	grc := &k8s.GenericResourceCache{}
+	grc.Add(MustParseGR(dryRunTestDeployment("dep-1", "1.1.1", map[string]string{})))
+	store, teardown := NewTestingUtils()
+	defer teardown()
+	approver, teardownApprover := approver()
+	defer teardownApprover()
+	p, err := NewProvider(fp, &fakeSender{}, approver, grc)
+	if err != nil {
+		t.Fatalf("failed to get provider: %s", err)
+	}
+	freeze := window.Freeze{Start: time.Now().Add(-time.Hour), End: time.Now().Add(time.Hour)}
+	p.SetUpdateWindows(provider.NewDeferredQueue(ProviderName, store, []window.Freeze{freeze}))
+
+	if _, err := p.processEvent(&types.Event{Repository: types.Repository{Name: "gcr.io/v2-namespace/hello-world", Tag: "1.4.5"}}); err != nil {
+		t.Fatalf("got error while processing event: %s", err)
+	}
+	if fp.updated != nil {
+		t.Fatalf("resource must not be updated during a freeze")
+	}
+
+	// the freeze is over
+	deferred, err := store.ListDeferredUpdates(&types.DeferredUpdateQuery{})
+	if err != nil || len(deferred) != 1 {
+		t.Fatalf("expected a deferred update, got: %d, error: %v", len(deferred), err)
+	}
+	deferred[0].NotBefore = time.Now().Add(-time.Minute)
+	if err := store.UpdateDeferredUpdate(deferred[0]); err != nil {
+		t.Fatalf("failed to update deferred update: %s", err)
+	}
+	p.SetUpdateWindows(provider.NewDeferredQueue(ProviderName, store, nil))
+
+	p.processDeferred()
+	if fp.updated == nil || fp.updated.Containers()[0].Image != "gcr.io/v2-namespace/hello-world:1.4.5" {
+		t.Fatalf("expected deferred update to be applied")
+	}
+	if deferred, _ := store.ListDeferredUpdates(&types.DeferredUpdateQuery{}); len(deferred) != 0 {
+		t.Errorf("expected applied update to leave the queue, got: %d", len(deferred))
+	}
+}
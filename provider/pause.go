@@ -0,0 +1,14 @@
+package provider
+
+import "github.com/keel-hq/keel/types"
+
+// PauseStore - persists paused namespaces and the newest versions found for
+// paused resources
+type PauseStore interface {
+	ListPausedNamespaces() ([]*types.PausedNamespace, error)
+
+	CreateAvailableUpdate(update *types.AvailableUpdate) (*types.AvailableUpdate, error)
+	UpdateAvailableUpdate(update *types.AvailableUpdate) error
+	ListAvailableUpdates(q *types.AvailableUpdateQuery) ([]*types.AvailableUpdate, error)
+	DeleteAvailableUpdate(update *types.AvailableUpdate) error
+}
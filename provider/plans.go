@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/keel-hq/keel/types"
+)
+
+// DefaultPlanHistory - number of events providers keep the computed plans for
+const DefaultPlanHistory = 50
+
+// PlanLister - implemented by providers that keep the plans computed for
+// the latest events
+type PlanLister interface {
+	Plans() []*types.Plan
+}
+
+// PlanHistory - plans computed for the latest events that produced any
+type PlanHistory struct {
+	mu     sync.Mutex
+	size   int
+	events [][]*types.Plan
+}
+
+// NewPlanHistory - new plan history keeping plans of the latest size events
+func NewPlanHistory(size int) *PlanHistory {
+	return &PlanHistory{size: size}
+}
+
+// Record - stores plans computed for a single event, events without plans
+// are ignored so they don't push useful entries out
+func (h *PlanHistory) Record(plans []*types.Plan) {
+	if len(plans) == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, plans)
+	if len(h.events) > h.size {
+		h.events = h.events[len(h.events)-h.size:]
+	}
+}
+
+// Plans - recorded plans, latest events first
+func (h *PlanHistory) Plans() []*types.Plan {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	plans := []*types.Plan{}
+	for i := len(h.events) - 1; i >= 0; i-- {
+		plans = append(plans, h.events[i]...)
+	}
+	return plans
+}
+
+// RecordPlans - stores plans computed for the event in history: plans that
+// wait for approvals, the approved ones marked, and dry-run plans. describe
+// maps a provider plan to the provider, resource, versions and changes of
+// the recorded one.
+func RecordPlans[P comparable](h *PlanHistory, event *types.Event, plans, approved, dryRun []P, describe func(P) *types.Plan) {
+	var recorded []*types.Plan
+	for _, plan := range plans {
+		recorded = append(recorded, eventPlan(event, describe(plan), slices.Contains(approved, plan), false))
+	}
+	for _, plan := range dryRun {
+		recorded = append(recorded, eventPlan(event, describe(plan), false, true))
+	}
+	h.Record(recorded)
+}
+
+func eventPlan(event *types.Event, plan *types.Plan, approved, dryRun bool) *types.Plan {
+	plan.Repository = event.Repository.String()
+	plan.Trigger = event.TriggerName
+	plan.Approved = approved
+	plan.DryRun = dryRun
+	plan.CreatedAt = time.Now()
+	return plan
+}
+
+// SplitDryRunPlans - separates plans that are only reported from the ones
+// that are applied
+func SplitDryRunPlans[P any](plans []P, isDryRun func(P) bool) (live, dryRun []P) {
+	for _, plan := range plans {
+		if isDryRun(plan) {
+			dryRun = append(dryRun, plan)
+		} else {
+			live = append(live, plan)
+		}
+	}
+	return live, dryRun
+}
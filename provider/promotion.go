@@ -0,0 +1,23 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/keel-hq/keel/types"
+)
+
+// StageCheckInterval - how often providers check the versions running in
+// promotion stages
+const StageCheckInterval = time.Minute
+
+// DefaultSoakTime - how long the previous stage has to run a version
+// healthily when keel.sh/soakTime is not set
+const DefaultSoakTime = time.Hour
+
+// StageStore - persists versions running in promotion stages
+type StageStore interface {
+	CreateStageVersion(version *types.StageVersion) (*types.StageVersion, error)
+	UpdateStageVersion(version *types.StageVersion) error
+	ListStageVersions(q *types.StageVersionQuery) ([]*types.StageVersion, error)
+	DeleteStageVersion(version *types.StageVersion) error
+}
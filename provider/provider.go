@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"sort"
 
 	"github.com/keel-hq/keel/approvals"
 	"github.com/keel-hq/keel/types"
@@ -21,6 +22,8 @@ type Provider interface {
 type Providers interface {
 	Submit(event types.Event) error
 	TrackedImages() ([]*types.TrackedImage, error)
+	Plans() []*types.Plan // plans computed for the latest events
+	Rollback(record *types.UpdateRecord, user string) error
 	List() []string // list all providers
 	Stop()          // stop all providers
 }
@@ -112,6 +115,30 @@ func (p *DefaultProviders) TrackedImages() ([]*types.TrackedImage, error) {
 	return trackedImages, nil
 }
 
+// Plans - get plans computed by providers for the latest events
+func (p *DefaultProviders) Plans() []*types.Plan {
+	plans := []*types.Plan{}
+	for _, provider := range p.providers {
+		if lister, ok := provider.(PlanLister); ok {
+			plans = append(plans, lister.Plans()...)
+		}
+	}
+	sort.SliceStable(plans, func(i, j int) bool {
+		return plans[i].CreatedAt.After(plans[j].CreatedAt)
+	})
+	return plans
+}
+
+// Rollback - re-apply the previous image of an update record through the
+// provider that applied it
+func (p *DefaultProviders) Rollback(record *types.UpdateRecord, user string) error {
+	rollbacker, ok := p.providers[record.Provider].(Rollbacker)
+	if !ok {
+		return ErrRollbackNotSupported
+	}
+	return rollbacker.Rollback(record, user)
+}
+
 // List - list available providers
 func (p *DefaultProviders) List() []string {
 	list := []string{}
@@ -52,6 +52,18 @@ func NewGetter(implementer kubernetes.Implementer, defaultDockerConfig DockerCfg
 	}
 }
 
+// ClusterGetter - looks up secrets in the cluster of the tracked image
+type ClusterGetter map[string]Getter
+
+// Get - get secret for tracked image from the getter of its cluster
+func (g ClusterGetter) Get(image *types.TrackedImage) (*types.Credentials, error) {
+	getter, ok := g[image.Cluster]
+	if !ok {
+		return nil, fmt.Errorf("unknown cluster '%s'", image.Cluster)
+	}
+	return getter.Get(image)
+}
+
 // Get - get secret for tracked image
 func (g *DefaultGetter) Get(image *types.TrackedImage) (*types.Credentials, error) {
 	if image.Namespace == "" {
@@ -65,6 +65,46 @@ func TestGetSecret(t *testing.T) {
 	}
 }
 
+func TestClusterGetter(t *testing.T) {
+	imgRef, _ := image.Parse("karolisr/webhook-demo:0.0.11")
+
+	secret := func(payload string) map[string]*v1.Secret {
+		return map[string]*v1.Secret{
+			"myregistrysecret": {
+				Data: map[string][]byte{
+					dockerConfigKey: []byte(payload),
+				},
+				Type: v1.SecretTypeDockercfg,
+			},
+		}
+	}
+
+	getter := ClusterGetter{
+		"":           NewGetter(&testutil.FakeK8sImplementer{AvailableSecret: secret(secretDataPayload)}, nil),
+		"production": NewGetter(&testutil.FakeK8sImplementer{AvailableSecret: secret(secretDataPayload2)}, nil),
+	}
+
+	for cluster, username := range map[string]string{"": "user-x", "production": "foo-user-x-2"} {
+		creds, err := getter.Get(&types.TrackedImage{
+			Image:     imgRef,
+			Cluster:   cluster,
+			Namespace: "default",
+			Secrets:   []string{"myregistrysecret"},
+		})
+		if err != nil {
+			t.Fatalf("failed to get creds: %s", err)
+		}
+		if creds.Username != username {
+			t.Errorf("cluster '%s': unexpected username: %s", cluster, creds.Username)
+		}
+	}
+
+	_, err := getter.Get(&types.TrackedImage{Image: imgRef, Cluster: "staging", Namespace: "default", Secrets: []string{"myregistrysecret"}})
+	if err == nil {
+		t.Error("expected error for unknown cluster")
+	}
+}
+
 func TestGetDockerConfigJSONSecret(t *testing.T) {
 	imgRef, _ := image.Parse("quay.io/karolisr/webhook-demo:0.0.11")
 
@@ -1,6 +1,8 @@
 package poll
 
 import (
+	"slices"
+
 	"github.com/keel-hq/keel/extension/credentialshelper"
 	"github.com/keel-hq/keel/provider"
 	"github.com/keel-hq/keel/registry"
@@ -95,6 +97,12 @@ func (j *WatchRepositoryTagsJob) computeEvents(tags []string) ([]types.Event, er
 	platformCache := make(map[string][]types.Platform)
 	platformErrorCache := make(map[string]error)
 	diagnosedCandidates := make(map[string]bool)
+	// events go to every related image, digests are only needed when one of
+	// them is pinned
+	pinDigest := slices.ContainsFunc(allRelatedTrackedImages, func(trackedImage *types.TrackedImage) bool {
+		return trackedImage.PinDigest
+	})
+	digestCache := make(map[string]string)
 
 	for _, trackedImage := range allRelatedTrackedImages {
 		if trackedImage.PlatformErr != types.PlatformErrorNone || len(trackedImage.Platforms) == 0 {
@@ -163,10 +171,24 @@ func (j *WatchRepositoryTagsJob) computeEvents(tags []string) ([]types.Event, er
 				continue
 			}
 			if !exists(tag, events) {
+				// resources with keel.sh/pinDigest are updated to tag@digest
+				digest, resolved := digestCache[tag]
+				if pinDigest && !resolved {
+					digest, err = j.candidateDigest(trackedImage, tag)
+					if err != nil {
+						log.WithFields(log.Fields{
+							"error": err,
+							"image": trackedImage.Image.Repository(),
+							"tag":   tag,
+						}).Warn("trigger.poll.WatchRepositoryTagsJob: failed to resolve candidate digest")
+					}
+					digestCache[tag] = digest
+				}
 				event := types.Event{
 					Repository: types.Repository{
 						Name:             trackedImage.Image.Repository(),
 						Tag:              tag,
+						Digest:           digest,
 						Platforms:        platforms,
 						PlatformVerified: true,
 					},
@@ -202,6 +224,14 @@ func relatedPlatforms(trackedImages []*types.TrackedImage) []types.Platform {
 }
 
 func (j *WatchRepositoryTagsJob) candidatePlatforms(trackedImage *types.TrackedImage, tag string) ([]types.Platform, error) {
+	return j.registryClient.Platforms(candidateOpts(trackedImage, tag))
+}
+
+func (j *WatchRepositoryTagsJob) candidateDigest(trackedImage *types.TrackedImage, tag string) (string, error) {
+	return j.registryClient.Digest(candidateOpts(trackedImage, tag))
+}
+
+func candidateOpts(trackedImage *types.TrackedImage, tag string) registry.Opts {
 	opts := registry.Opts{
 		Registry: trackedImage.Image.Scheme() + "://" + trackedImage.Image.Registry(),
 		Name:     trackedImage.Image.ShortName(),
@@ -211,7 +241,7 @@ func (j *WatchRepositoryTagsJob) candidatePlatforms(trackedImage *types.TrackedI
 		opts.Username = creds.Username
 		opts.Password = creds.Password
 	}
-	return j.registryClient.Platforms(opts)
+	return opts
 }
 
 func supportsRelatedWorkloads(candidatePlatforms []types.Platform, candidateTag string, trackedImages []*types.TrackedImage) bool {
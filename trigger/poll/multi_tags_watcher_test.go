@@ -344,3 +344,43 @@ func TestWatchMultipleTagsWithCredentialsHelper(t *testing.T) {
 	})
 
 }
+
+func TestWatchAllTagsDigestOnlyWhenPinned(t *testing.T) {
+	for _, pinned := range []bool{false, true} {
+		reference, _ := image.Parse("foo/bar:1.0.0")
+		other, _ := image.Parse("foo/bar:1.0.0")
+		fp := &fakeProvider{
+			images: []*types.TrackedImage{
+				{Image: reference, Trigger: types.TriggerTypePoll, Policy: policy.NewSemverPolicy(policy.SemverPolicyTypeMinor, true)},
+				{Image: other, Trigger: types.TriggerTypePoll, Policy: policy.NewSemverPolicy(policy.SemverPolicyTypeMajor, true), PinDigest: pinned},
+			},
+		}
+		store, teardown := newTestingUtils()
+		am := approvals.New(&approvals.Opts{
+			Store: store,
+		})
+		providers := provider.New([]provider.Provider{fp}, am)
+		frc := &fakeRegistryClient{
+			digestToReturn: "sha256:0604af35299dd37ff23937d115d103532948b568a9dd8197d14c256a8ab8b0bb",
+			tagsToReturn:   []string{"1.1.0", "2.0.0"},
+		}
+
+		job := NewWatchRepositoryTagsJob(providers, frc, &watchDetails{trackedImage: fp.images[0]})
+		job.Run()
+		teardown()
+
+		if len(fp.submitted) != 2 {
+			t.Fatalf("pinned %t: expected 2 events, got: %d", pinned, len(fp.submitted))
+		}
+		if !pinned {
+			if frc.digestCalls != 0 || fp.submitted[0].Repository.Digest != "" {
+				t.Errorf("digests must not be resolved without pinned images, got %d requests", frc.digestCalls)
+			}
+			continue
+		}
+		// every resource gets the events, the digest is resolved once per tag
+		if frc.digestCalls != 2 || fp.submitted[0].Repository.Digest != frc.digestToReturn {
+			t.Errorf("expected the digest of each candidate tag, got %d requests: %+v", frc.digestCalls, fp.submitted)
+		}
+	}
+}
@@ -31,7 +31,7 @@ func (i *integrationImplementer) Nodes() (*core_v1.NodeList, error) { return i.n
 func (i *integrationImplementer) Pods(string, string) (*core_v1.PodList, error) {
 	return &core_v1.PodList{}, nil
 }
-func (i *integrationImplementer) Update(resource *k8s.GenericResource) error {
+func (i *integrationImplementer) Update(resource, previous *k8s.GenericResource) error {
 	i.updated <- resource.DeepCopy()
 	return nil
 }
@@ -53,8 +53,12 @@ func (p integrationProviders) Submit(event types.Event) error { return p.provide
 func (p integrationProviders) TrackedImages() ([]*types.TrackedImage, error) {
 	return p.provider.TrackedImages()
 }
-func (p integrationProviders) List() []string { return []string{p.provider.GetName()} }
-func (p integrationProviders) Stop()          { p.provider.Stop() }
+func (p integrationProviders) List() []string       { return []string{p.provider.GetName()} }
+func (p integrationProviders) Plans() []*types.Plan { return nil }
+func (p integrationProviders) Stop()                { p.provider.Stop() }
+func (p integrationProviders) Rollback(record *types.UpdateRecord, user string) error {
+	return p.provider.Rollback(record, user)
+}
 
 type registryPlatform struct {
 	OS           string
@@ -110,73 +114,98 @@ func TestRegistryPollingToKubernetesPlatformSelection(t *testing.T) {
 			server := newPlatformRegistry(t, tt.tags, tt.manifests)
 			defer server.Close()
 
-			imageName := strings.TrimPrefix(server.URL, "http://") + "/jellyfin/jellyfin:" + tt.currentTag
-			deployment := &apps_v1.Deployment{
-				ObjectMeta: meta_v1.ObjectMeta{
-					Name:      "jellyfin",
-					Namespace: "media",
-					Labels: map[string]string{
-						types.KeelPolicyLabel:  "major",
-						types.KeelTriggerLabel: "poll",
-					},
-				},
-				Spec: apps_v1.DeploymentSpec{
-					Selector: &meta_v1.LabelSelector{MatchLabels: map[string]string{"app": "jellyfin"}},
-					Template: core_v1.PodTemplateSpec{
-						ObjectMeta: meta_v1.ObjectMeta{Labels: map[string]string{"app": "jellyfin"}},
-						Spec: core_v1.PodSpec{
-							NodeSelector: tt.selector,
-							Containers:   []core_v1.Container{{Name: "jellyfin", Image: "http://" + imageName}},
-						},
-					},
-				},
-			}
-			resource, err := k8s.NewGenericResource(deployment)
-			if err != nil {
-				t.Fatal(err)
+			deployment := pollTestDeployment(server, tt.currentTag, tt.selector, map[string]string{})
+			got := pollUpdate(t, deployment, tt.nodePlatforms)
+			if len(got) != 1 || !strings.HasSuffix(got[0], ":"+tt.wantTag) {
+				t.Fatalf("expected selected tag %s, got %v", tt.wantTag, got)
 			}
-			cache := &k8s.GenericResourceCache{}
-			cache.Add(resource)
+		})
+	}
+}
 
-			implementer := &integrationImplementer{updated: make(chan *k8s.GenericResource, 1)}
-			for index, platform := range tt.nodePlatforms {
-				implementer.nodes = appendNode(implementer.nodes, index, platform)
-			}
-			kubeProvider, err := kubernetes.NewProvider(implementer, integrationSender{}, integrationApprovals{}, cache)
-			if err != nil {
-				t.Fatal(err)
-			}
-			providers := integrationProviders{provider: kubeProvider}
-			providerDone := make(chan error, 1)
-			go func() { providerDone <- kubeProvider.Start() }()
-			defer func() {
-				providers.Stop()
-				<-providerDone
-			}()
+func TestRegistryPollingPinsDigest(t *testing.T) {
+	manifests := map[string][]registryPlatform{"1.1.0": {{OS: "linux", Architecture: "amd64"}}}
+	server := newPlatformRegistry(t, []string{"1.0.0", "1.1.0"}, manifests)
+	defer server.Close()
 
-			tracked, err := providers.TrackedImages()
-			if err != nil {
-				t.Fatal(err)
-			}
-			if len(tracked) != 1 {
-				t.Fatalf("expected one tracked image, got %d", len(tracked))
-			}
-			job := NewWatchRepositoryTagsJob(providers, registry.New(), &watchDetails{trackedImage: tracked[0]})
-			job.Run()
+	deployment := pollTestDeployment(server, "1.0.0", nil, map[string]string{types.KeelPinDigestAnnotation: "true"})
+	got := pollUpdate(t, deployment, []registryPlatform{{OS: "linux", Architecture: "amd64"}})
+	if len(got) != 1 || !strings.HasSuffix(got[0], ":1.1.0@"+manifestDigest("1.1.0")) {
+		t.Fatalf("expected the image pinned to the digest of 1.1.0, got %v", got)
+	}
+}
 
-			select {
-			case updated := <-implementer.updated:
-				got := updated.GetImages(nil)
-				if len(got) != 1 || !strings.HasSuffix(got[0], ":"+tt.wantTag) {
-					t.Fatalf("expected selected tag %s, got %v", tt.wantTag, got)
-				}
-			case <-time.After(2 * time.Second):
-				t.Fatalf("timed out waiting for Kubernetes update to %s", tt.wantTag)
-			}
-		})
+func pollTestDeployment(server *httptest.Server, tag string, selector, annotations map[string]string) *apps_v1.Deployment {
+	imageName := strings.TrimPrefix(server.URL, "http://") + "/jellyfin/jellyfin:" + tag
+	return &apps_v1.Deployment{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "jellyfin",
+			Namespace: "media",
+			Labels: map[string]string{
+				types.KeelPolicyLabel:  "major",
+				types.KeelTriggerLabel: "poll",
+			},
+			Annotations: annotations,
+		},
+		Spec: apps_v1.DeploymentSpec{
+			Selector: &meta_v1.LabelSelector{MatchLabels: map[string]string{"app": "jellyfin"}},
+			Template: core_v1.PodTemplateSpec{
+				ObjectMeta: meta_v1.ObjectMeta{Labels: map[string]string{"app": "jellyfin"}},
+				Spec: core_v1.PodSpec{
+					NodeSelector: selector,
+					Containers:   []core_v1.Container{{Name: "jellyfin", Image: "http://" + imageName}},
+				},
+			},
+		},
 	}
 }
 
+// pollUpdate runs the tags watcher of the deployment image against the
+// kubernetes provider and returns the images of the updated deployment
+func pollUpdate(t *testing.T, deployment *apps_v1.Deployment, nodePlatforms []registryPlatform) []string {
+	t.Helper()
+	resource, err := k8s.NewGenericResource(deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := &k8s.GenericResourceCache{}
+	cache.Add(resource)
+
+	implementer := &integrationImplementer{updated: make(chan *k8s.GenericResource, 1)}
+	for index, platform := range nodePlatforms {
+		implementer.nodes = appendNode(implementer.nodes, index, platform)
+	}
+	kubeProvider, err := kubernetes.NewProvider(implementer, integrationSender{}, integrationApprovals{}, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providers := integrationProviders{provider: kubeProvider}
+	providerDone := make(chan error, 1)
+	go func() { providerDone <- kubeProvider.Start() }()
+	defer func() {
+		providers.Stop()
+		<-providerDone
+	}()
+
+	tracked, err := providers.TrackedImages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracked) != 1 {
+		t.Fatalf("expected one tracked image, got %d", len(tracked))
+	}
+	job := NewWatchRepositoryTagsJob(providers, registry.New(), &watchDetails{trackedImage: tracked[0]})
+	job.Run()
+
+	select {
+	case updated := <-implementer.updated:
+		return updated.GetImages(nil)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for Kubernetes update")
+	}
+	return nil
+}
+
 func appendNode(nodes *core_v1.NodeList, index int, platform registryPlatform) *core_v1.NodeList {
 	if nodes == nil {
 		nodes = &core_v1.NodeList{}
@@ -210,6 +239,7 @@ func newPlatformRegistry(t *testing.T, tags []string, manifests map[string][]reg
 				http.NotFound(w, r)
 				return
 			}
+			w.Header().Set("Docker-Content-Digest", manifestDigest(tag))
 			if len(platforms) == 1 {
 				w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
 				_ = json.NewEncoder(w).Encode(map[string]interface{}{
@@ -248,10 +278,18 @@ func newPlatformRegistry(t *testing.T, tags []string, manifests map[string][]reg
 	}))
 }
 
+func manifestDigest(tag string) string {
+	return fmt.Sprintf("sha256:%064x", 1<<16+tagSum(tag))
+}
+
 func configDigest(tag string) string {
+	return fmt.Sprintf("sha256:%064x", tagSum(tag))
+}
+
+func tagSum(tag string) int {
 	var total int
 	for _, char := range tag {
 		total += int(char)
 	}
-	return fmt.Sprintf("sha256:%064x", total)
+	return total
 }
@@ -114,8 +114,13 @@ func (p *fakeProviders) TrackedImages() ([]*types.TrackedImage, error) {
 	return p.provider.TrackedImages()
 }
 
-func (p *fakeProviders) List() []string { return []string{p.provider.GetName()} }
-func (p *fakeProviders) Stop()          {}
+func (p *fakeProviders) List() []string       { return []string{p.provider.GetName()} }
+func (p *fakeProviders) Plans() []*types.Plan { return nil }
+func (p *fakeProviders) Stop()                {}
+
+func (p *fakeProviders) Rollback(record *types.UpdateRecord, user string) error {
+	return nil
+}
 
 func (p *fakeProvider) Submit(event types.Event) error {
 	p.submitted = append(p.submitted, event)
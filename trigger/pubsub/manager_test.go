@@ -70,6 +70,12 @@ func (p *fakeProvider) TrackedImages() ([]*types.TrackedImage, error) {
 func (p *fakeProvider) List() []string {
 	return []string{"fakeprovider"}
 }
+func (p *fakeProvider) Plans() []*types.Plan {
+	return nil
+}
+func (p *fakeProvider) Rollback(record *types.UpdateRecord, user string) error {
+	return nil
+}
 func (p *fakeProvider) Stop() {
 	return
 }
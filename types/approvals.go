@@ -13,6 +13,7 @@ type GetApprovalQuery struct {
 	Identifier string
 	// Rejected   bool
 	Archived bool
+	Cluster  string
 }
 
 // Approval used to store and track updates
@@ -25,6 +26,9 @@ type Approval struct {
 	// Provider name - Kubernetes/Helm
 	Provider ProviderType `json:"provider"`
 
+	// Cluster of the resource when keel manages several clusters
+	Cluster string `json:"cluster,omitempty"`
+
 	// Identifier is used to inform user about specific
 	// Helm release or k8s deployment
 	// ie: k8s <namespace>/<deployment name>
@@ -43,6 +47,10 @@ type Approval struct {
 	// If digest doesn't match for the image, votes are reset.
 	Digest string `json:"digest"`
 
+	// Diff shows what the update changes, ie: unified diff of the
+	// deployed and rendered Helm release manifests
+	Diff string `json:"diff,omitempty" gorm:"type:text"`
+
 	// Requirements for the update such as number of votes
 	// and deadline
 	VotesRequired int `json:"votesRequired"`
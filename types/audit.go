@@ -15,10 +15,18 @@ const (
 	AuditActionApprovalExpired  = "expired"
 	AuditActionApprovalArchived = "archived"
 
+	// AuditActionRollback - previous image re-applied through the rollback API
+	AuditActionRollback = "rollback"
+
+	// Updates of a resource or namespace paused and resumed through the API
+	AuditActionPaused  = "paused"
+	AuditActionResumed = "resumed"
+
 	// audit specific resource kinds (others are set by
 	// providers, ie: deployment, daemonset, helm chart)
-	AuditResourceKindApproval = "approval"
-	AuditResourceKindWebhook  = "webhook"
+	AuditResourceKindApproval  = "approval"
+	AuditResourceKindWebhook   = "webhook"
+	AuditResourceKindNamespace = "namespace"
 )
 
 // AuditLog - audit logs lets users basic things happening in keel such as
@@ -63,6 +71,8 @@ type AuditLogQuery struct {
 	Offset   int    `json:"offset"`
 
 	ResourceKindFilter []string `json:"resourceKindFilter"`
+	// Cluster - entries of resources in the cluster only
+	Cluster string `json:"cluster"`
 }
 
 type AuditLogStatsQuery struct {
@@ -0,0 +1,32 @@
+package types
+
+import "time"
+
+// DeferredUpdate - update waiting for the update window of its resource to
+// open (or a freeze period to end), the event is submitted again once it does
+type DeferredUpdate struct {
+	ID        string    `json:"id" gorm:"primary_key;type:varchar(36)"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Provider     string `json:"provider"`
+	Identifier   string `json:"identifier" gorm:"index"`
+	ResourceKind string `json:"resourceKind"`
+
+	// Event that triggered the update
+	Event *Event `json:"event" gorm:"type:json"`
+
+	CurrentVersion string `json:"currentVersion"`
+	NewVersion     string `json:"newVersion"`
+
+	// NotBefore - when the update window opens
+	NotBefore time.Time `json:"notBefore"`
+}
+
+// DeferredUpdateQuery - struct used to query deferred updates
+type DeferredUpdateQuery struct {
+	Provider   string
+	Identifier string
+	// Due - only updates with NotBefore before this time
+	Due time.Time
+}
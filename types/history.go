@@ -0,0 +1,30 @@
+package types
+
+import "time"
+
+// UpdateRecord - an applied update of a single container, init container or
+// image volume, kept so updates can be reviewed and rolled back
+type UpdateRecord struct {
+	ID        string    `json:"id" gorm:"primary_key;type:varchar(36)"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	Provider     string `json:"provider"`
+	Identifier   string `json:"identifier" gorm:"index"` // resource identifier, ie: deployment/default/app
+	ResourceKind string `json:"resourceKind"`
+	Container    string `json:"container"`
+
+	PreviousImage  string `json:"previousImage"`
+	NewImage       string `json:"newImage"`
+	PreviousDigest string `json:"previousDigest,omitempty"`
+	NewDigest      string `json:"newDigest,omitempty"`
+
+	Trigger  string `json:"trigger"`  // webhook, poll, approval, rollback
+	Approver string `json:"approver"` // approval voters or the user that requested a rollback
+}
+
+// UpdateRecordQuery - struct used to query update history
+type UpdateRecordQuery struct {
+	ID         string
+	Identifier string
+	Limit      int
+}
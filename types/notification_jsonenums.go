@@ -18,6 +18,13 @@ var (
 		"NotificationSystemEvent":         NotificationSystemEvent,
 		"NotificationUpdateApproved":      NotificationUpdateApproved,
 		"NotificationUpdateRejected":      NotificationUpdateRejected,
+		"NotificationDeploymentRollback":  NotificationDeploymentRollback,
+		"NotificationWouldUpdate":         NotificationWouldUpdate,
+		"NotificationUpdateDeferred":      NotificationUpdateDeferred,
+		"NotificationPodRestart":          NotificationPodRestart,
+		"NotificationPreUpdateJob":        NotificationPreUpdateJob,
+		"NotificationSmokeTest":           NotificationSmokeTest,
+		"NotificationApprovalRequired":    NotificationApprovalRequired,
 	}
 
 	_NotificationValueToName = map[Notification]string{
@@ -30,6 +37,13 @@ var (
 		NotificationSystemEvent:         "NotificationSystemEvent",
 		NotificationUpdateApproved:      "NotificationUpdateApproved",
 		NotificationUpdateRejected:      "NotificationUpdateRejected",
+		NotificationDeploymentRollback:  "NotificationDeploymentRollback",
+		NotificationWouldUpdate:         "NotificationWouldUpdate",
+		NotificationUpdateDeferred:      "NotificationUpdateDeferred",
+		NotificationPodRestart:          "NotificationPodRestart",
+		NotificationPreUpdateJob:        "NotificationPreUpdateJob",
+		NotificationSmokeTest:           "NotificationSmokeTest",
+		NotificationApprovalRequired:    "NotificationApprovalRequired",
 	}
 )
 
@@ -46,6 +60,13 @@ func init() {
 			interface{}(NotificationSystemEvent).(fmt.Stringer).String():         NotificationSystemEvent,
 			interface{}(NotificationUpdateApproved).(fmt.Stringer).String():      NotificationUpdateApproved,
 			interface{}(NotificationUpdateRejected).(fmt.Stringer).String():      NotificationUpdateRejected,
+			interface{}(NotificationDeploymentRollback).(fmt.Stringer).String():  NotificationDeploymentRollback,
+			interface{}(NotificationWouldUpdate).(fmt.Stringer).String():         NotificationWouldUpdate,
+			interface{}(NotificationUpdateDeferred).(fmt.Stringer).String():      NotificationUpdateDeferred,
+			interface{}(NotificationPodRestart).(fmt.Stringer).String():          NotificationPodRestart,
+			interface{}(NotificationPreUpdateJob).(fmt.Stringer).String():        NotificationPreUpdateJob,
+			interface{}(NotificationSmokeTest).(fmt.Stringer).String():           NotificationSmokeTest,
+			interface{}(NotificationApprovalRequired).(fmt.Stringer).String():    NotificationApprovalRequired,
 		}
 	}
 }
@@ -0,0 +1,38 @@
+package types
+
+import "time"
+
+// PausedNamespace - namespace whose resources keel doesn't update, paused
+// through the API
+type PausedNamespace struct {
+	ID        string    `json:"id" gorm:"primary_key;type:varchar(36)"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Cluster - cluster the namespace is paused in, empty for the unnamed
+	// cluster keel runs in
+	Cluster   string `json:"cluster" gorm:"unique_index:idx_paused_namespaces_cluster_namespace"`
+	Namespace string `json:"namespace" gorm:"unique_index:idx_paused_namespaces_cluster_namespace"`
+	// User - who paused the namespace
+	User string `json:"user"`
+}
+
+// AvailableUpdate - newest version found for an image of a paused resource,
+// reported until the resource is updated
+type AvailableUpdate struct {
+	ID        string    `json:"id" gorm:"primary_key;type:varchar(36)"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Provider   string `json:"provider"`
+	Identifier string `json:"identifier" gorm:"index"`
+	Repository string `json:"repository"` // image repository, without the tag
+
+	CurrentVersion string `json:"currentVersion"`
+	NewVersion     string `json:"newVersion"`
+}
+
+// AvailableUpdateQuery - struct used to query available updates
+type AvailableUpdateQuery struct {
+	Provider   string
+	Identifier string
+}
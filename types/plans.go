@@ -0,0 +1,21 @@
+package types
+
+import "time"
+
+// Plan - update planned by a provider for an event, listed by the /v1/plans API
+type Plan struct {
+	Provider       string    `json:"provider"`
+	Identifier     string    `json:"identifier"`
+	Namespace      string    `json:"namespace"`
+	Name           string    `json:"name"`
+	Repository     string    `json:"repository"` // image from the event, repository:tag
+	Trigger        string    `json:"trigger"`
+	CurrentVersion string    `json:"currentVersion"`
+	NewVersion     string    `json:"newVersion"`
+	CurrentDigest  string    `json:"currentDigest,omitempty"`
+	NewDigest      string    `json:"newDigest,omitempty"`
+	Changes        []string  `json:"changes"` // images or chart values after the update
+	Approved       bool      `json:"approved"`
+	DryRun         bool      `json:"dryRun"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
@@ -0,0 +1,32 @@
+package types
+
+import "time"
+
+// StageVersion - version of an image running in a promotion stage, later
+// stages are updated to it once it has been healthy for their soak time
+type StageVersion struct {
+	ID        string    `json:"id" gorm:"primary_key;type:varchar(36)"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Provider   string `json:"provider"`
+	Stage      string `json:"stage" gorm:"index"`
+	Repository string `json:"repository"` // image repository, without the tag
+
+	// Version - tag every resource of the stage runs, empty when they differ
+	Version string `json:"version"`
+	Digest  string `json:"digest,omitempty"`
+
+	// Healthy - every resource of the stage runs the version and its rollout
+	// is complete
+	Healthy bool `json:"healthy"`
+	// HealthySince - soak time of the next stages counts from here
+	HealthySince time.Time `json:"healthySince"`
+}
+
+// StageVersionQuery - struct used to query stage versions
+type StageVersionQuery struct {
+	Provider   string
+	Stage      string
+	Repository string
+}
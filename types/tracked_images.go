@@ -13,9 +13,11 @@ type Credentials struct {
 // TrackedImage - tracked image data+metadata
 type TrackedImage struct {
 	Image        *image.Reference  `json:"image"`
+	Container    string            `json:"container"` // container or image volume name, empty when not applicable
 	Trigger      TriggerType       `json:"trigger"`
 	PollSchedule string            `json:"pollSchedule"`
 	Provider     string            `json:"provider"`
+	Cluster      string            `json:"cluster,omitempty"`
 	Namespace    string            `json:"namespace"`
 	Secrets      []string          `json:"secrets"`
 	Meta         map[string]string `json:"meta"` // metadata supplied by providers
@@ -24,6 +26,9 @@ type TrackedImage struct {
 	// RunningDigests are the image digests reported by the workload runtime for
 	// this image reference. Empty when the provider cannot observe them.
 	RunningDigests []string `json:"-"`
+	// PinDigest - updates are written as tag@digest (keel.sh/pinDigest), the
+	// digest of candidate tags has to be resolved
+	PinDigest bool `json:"-"`
 	// a list of pre-release tags, ie: 1.0.0-dev, 1.5.0-prod get translated into
 	// dev, prod
 	// combined semver tags
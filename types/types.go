@@ -51,11 +51,16 @@ const KeelImageVolumeAnnotation = "keel.sh/imageVolumes"
 
 // KeelMonitorContainers - you can only have one keel settings per object type, but some of them might have multiple containers. Use this setting to
 // specify with a regular expression which containers should be monitored. If empty, all containers will be monitored.
-// It is currently a limitation that all containers in the same object will share the same configuration (pollSchedule, etc.).
-// Support a per-container configuration would require quite a refactor that would impact the frontend and the current implementation.
-// Future proposal for this would be to have namespaced annotations such as keel.sh/mycontainer/poolSchedule
+// Policy, poll schedule and approvals can be overridden for a single container with container scoped annotations, see ContainerAnnotation.
 const KeelMonitorContainers = "keel.sh/monitorContainers"
 
+// ContainerAnnotation - returns the container scoped variant of a keel annotation, for example
+// keel.sh/policy for container "sidecar" becomes keel.sh/sidecar/policy. Container scoped
+// annotations override the resource wide ones for that container only.
+func ContainerAnnotation(container, annotation string) string {
+	return strings.Replace(annotation, "keel.sh/", "keel.sh/"+container+"/", 1)
+}
+
 // KeelPollDefaultSchedule - defaul polling schedule
 var KeelPollDefaultSchedule = "@every 1m"
 
@@ -81,6 +86,85 @@ const KeelApprovalDeadlineDefault = 24
 // KeelReleasePage - optional release notes URL passed on with notification
 const KeelReleaseNotesURL = "keel.sh/releaseNotes"
 
+// KeelRolloutDeadlineAnnotation - optional duration (e.g. 5m) keel waits for an updated
+// resource to become ready, when it doesn't images are reverted to the previous version
+const KeelRolloutDeadlineAnnotation = "keel.sh/rolloutDeadline"
+
+// KeelBlockFailedVersionsAnnotation - when "true", versions that were rolled back are
+// added to keel.sh/blockedVersions so they are not applied again
+const KeelBlockFailedVersionsAnnotation = "keel.sh/blockFailedVersions"
+
+// KeelBlockedVersionsAnnotation - comma separated list of image references (repository:tag)
+// keel won't update the resource to, remove an entry to allow the version again
+const KeelBlockedVersionsAnnotation = "keel.sh/blockedVersions"
+
+// KeelDryRunAnnotation - when "true", updates are only planned and reported, the resource
+// is never changed
+const KeelDryRunAnnotation = "keel.sh/dryRun"
+
+// KeelUpdateWindowAnnotation - when updates may be applied, ie: "Mon-Fri 09:00-17:00 Europe/London",
+// updates outside of the window are deferred until it opens
+const KeelUpdateWindowAnnotation = "keel.sh/updateWindow"
+
+// KeelPausedAnnotation - when "true", keel doesn't update the resource but keeps reporting
+// the newest version available for it
+const KeelPausedAnnotation = "keel.sh/paused"
+
+// KeelDependsOnAnnotation - comma separated identifiers of resources (ie: deployment/default/api)
+// that are updated, and have to become ready, before this resource when an event affects both
+const KeelDependsOnAnnotation = "keel.sh/dependsOn"
+
+// KeelStageAnnotation - promotion stage of the resource, ie: staging
+const KeelStageAnnotation = "keel.sh/stage"
+
+// KeelPromoteAfterAnnotation - stage (cluster/stage for stages of other clusters) that has to run
+// a version healthily for the soak time before the resource is updated to it
+const KeelPromoteAfterAnnotation = "keel.sh/promoteAfter"
+
+// KeelSoakTimeAnnotation - how long the previous stage has to run a version (default 1h)
+const KeelSoakTimeAnnotation = "keel.sh/soakTime"
+
+// KeelPinDigestAnnotation - label or annotation to write updated images as
+// tag@digest when the digest of the new version is known, defaults to false
+const KeelPinDigestAnnotation = "keel.sh/pinDigest"
+
+// KeelGitOpsPathAnnotation - file of the GitOps repository the resource is
+// synced from, updates are committed to it instead of patching the resource
+const KeelGitOpsPathAnnotation = "keel.sh/gitopsPath"
+
+// KeelGitOpsValuesAnnotation - Helm values of the keel.sh/gitopsPath file
+// holding images, ie: image.repository:image.tag,sidecar.image
+const KeelGitOpsValuesAnnotation = "keel.sh/gitopsValues"
+
+// KeelRestartStrategyAnnotation - label or annotation setting how pods are restarted
+// after an update: rolling (default), delete or none
+const KeelRestartStrategyAnnotation = "keel.sh/restartStrategy"
+
+// available restart strategies
+const (
+	// RestartStrategyRolling - keel.sh/update-time of the pod template is bumped
+	// so the controller rolls the pods, even when the image tag is unchanged
+	RestartStrategyRolling = "rolling"
+	// RestartStrategyDelete - pods are deleted one by one, each replacement has
+	// to be ready before the next pod is deleted, ie: for OnDelete StatefulSets
+	RestartStrategyDelete = "delete"
+	// RestartStrategyNone - keel doesn't restart pods, updates of the same tag
+	// wait for the pods to be restarted by other means
+	RestartStrategyNone = "none"
+)
+
+// KeelPreUpdateJobAnnotation - Job template keel runs with the new images
+// before updating the resource, ie: job/migrate (a suspended Job) or
+// configmap/migrate (a ConfigMap holding a Job manifest)
+const KeelPreUpdateJobAnnotation = "keel.sh/preUpdateJob"
+
+// KeelSmokeTestAnnotation - HTTP checks (YAML or JSON list of url, status,
+// body regex, timeout and retries) run once an update is ready
+const KeelSmokeTestAnnotation = "keel.sh/smokeTest"
+
+// KeelSmokeTestRollbackAnnotation - roll back updates failing their smoke tests
+const KeelSmokeTestRollbackAnnotation = "keel.sh/smokeTestRollback"
+
 func init() {
 	value, found := os.LookupEnv("POLL_DEFAULTSCHEDULE")
 	if found {
@@ -119,6 +203,9 @@ type Event struct {
 	CreatedAt  time.Time  `json:"createdAt,omitempty"`
 	// optional field to identify trigger
 	TriggerName string `json:"triggerName,omitempty"`
+	// Chart - the repository is a Helm chart (repository URL/chart name)
+	// and the tag its new version, only the helm3 provider handles it
+	Chart bool `json:"chart,omitempty"`
 }
 
 func (e *Event) Value() (driver.Value, error) {
@@ -176,9 +263,11 @@ type TriggerType int
 
 // Available trigger types
 const (
-	TriggerTypeDefault  TriggerType = iota // default policy is to wait for external triggers
-	TriggerTypePoll                        // poll policy sets up watchers for the affected repositories
-	TriggerTypeApproval                    // fulfilled approval requests trigger events
+	TriggerTypeDefault   TriggerType = iota // default policy is to wait for external triggers
+	TriggerTypePoll                         // poll policy sets up watchers for the affected repositories
+	TriggerTypeApproval                     // fulfilled approval requests trigger events
+	TriggerTypeRollback                     // previous images re-applied through the rollback API
+	TriggerTypePromotion                    // versions soaked in the previous stage are promoted
 )
 
 func (t TriggerType) String() string {
@@ -189,6 +278,10 @@ func (t TriggerType) String() string {
 		return "poll"
 	case TriggerTypeApproval:
 		return "approval"
+	case TriggerTypeRollback:
+		return "rollback"
+	case TriggerTypePromotion:
+		return "promotion"
 	default:
 		return "default"
 	}
@@ -217,6 +310,10 @@ type EventNotification struct {
 	Channels []string `json:"-"`
 
 	Metadata map[string]string `json:"metadata"`
+
+	// Diff - manifest diff of an update waiting for approvals, only for
+	// senders that render it as they print or store metadata as is
+	Diff string `json:"-"`
 }
 
 // ParseEventNotificationChannels - parses deployment annotations  or chart config
@@ -265,6 +362,26 @@ const (
 
 	NotificationUpdateApproved
 	NotificationUpdateRejected
+
+	NotificationDeploymentRollback
+
+	// NotificationWouldUpdate - update skipped in dry-run mode
+	NotificationWouldUpdate
+
+	// NotificationUpdateDeferred - update waits for the update window to open
+	NotificationUpdateDeferred
+
+	// NotificationPodRestart - progress of pods restarted after an update
+	NotificationPodRestart
+
+	// NotificationPreUpdateJob - pre-update Job started, completed or failed
+	NotificationPreUpdateJob
+
+	// NotificationSmokeTest - smoke tests of an update passed or failed
+	NotificationSmokeTest
+
+	// NotificationApprovalRequired - update waits for approvals
+	NotificationApprovalRequired
 )
 
 func (n Notification) String() string {
@@ -287,6 +404,20 @@ func (n Notification) String() string {
 		return "update approved"
 	case NotificationUpdateRejected:
 		return "update rejected "
+	case NotificationDeploymentRollback:
+		return "deployment rollback"
+	case NotificationWouldUpdate:
+		return "would update"
+	case NotificationUpdateDeferred:
+		return "update deferred"
+	case NotificationPodRestart:
+		return "pod restart"
+	case NotificationPreUpdateJob:
+		return "pre-update job"
+	case NotificationSmokeTest:
+		return "smoke test"
+	case NotificationApprovalRequired:
+		return "approval required"
 	default:
 		return "unknown"
 	}
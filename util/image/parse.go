@@ -8,6 +8,7 @@ import (
 type Reference struct {
 	named  Named  `json:"named"`
 	tag    string `json:"tag"`
+	digest string `json:"digest"`
 	scheme string `json:"scheme"` // registry scheme, i.e. http, https
 }
 
@@ -33,6 +34,13 @@ func (r Reference) Tag() string {
 	return ""
 }
 
+// Digest returns the digest of references pinned by both tag and digest
+// (ie: debian:8.2@sha256:abcdef...), empty otherwise. Tag returns the tag of
+// such references.
+func (r Reference) Digest() string {
+	return r.digest
+}
+
 // Registry returns the image's registry. (ie: host[:port])
 func (r Reference) Registry() string {
 	return r.named.Hostname()
@@ -72,6 +80,20 @@ func clean(url string) (cleaned string, scheme string) {
 	return s, scheme
 }
 
+// splitTag returns the ":tag" or "@digest" suffix of the reference and, when
+// it has both, the digest it is pinned to
+func splitTag(n Named) (tag, digest string) {
+	switch x := n.(type) {
+	case TaggedCanonical:
+		return ":" + x.Tag(), x.Digest().String()
+	case Canonical:
+		return "@" + x.Digest().String(), ""
+	case NamedTagged:
+		return ":" + x.Tag(), ""
+	}
+	return "", ""
+}
+
 // Parse returns a Reference from analyzing the given remote identifier.
 func Parse(remote string) (*Reference, error) {
 
@@ -84,15 +106,9 @@ func Parse(remote string) (*Reference, error) {
 
 	n = WithDefaultTag(n)
 
-	var t string
-	switch x := n.(type) {
-	case Canonical:
-		t = "@" + x.Digest().String()
-	case NamedTagged:
-		t = ":" + x.Tag()
-	}
+	t, d := splitTag(n)
 
-	return &Reference{named: n, tag: t, scheme: scheme}, nil
+	return &Reference{named: n, tag: t, digest: d, scheme: scheme}, nil
 }
 
 // ParseRepo - parses remote
@@ -109,15 +125,9 @@ func ParseRepo(remote string) (*Repository, error) {
 
 	n = WithDefaultTag(n)
 
-	var t string
-	switch x := n.(type) {
-	case Canonical:
-		t = "@" + x.Digest().String()
-	case NamedTagged:
-		t = ":" + x.Tag()
-	}
+	t, d := splitTag(n)
 
-	ref := &Reference{named: n, tag: t, scheme: scheme}
+	ref := &Reference{named: n, tag: t, digest: d, scheme: scheme}
 
 	return &Repository{
 		Name:       ref.Name(),
@@ -126,6 +136,7 @@ func ParseRepo(remote string) (*Repository, error) {
 		Remote:     ref.Remote(),
 		ShortName:  ref.ShortName(),
 		Tag:        ref.Tag(),
+		Digest:     ref.Digest(),
 		Scheme:     ref.scheme,
 	}, nil
 }
@@ -128,6 +128,35 @@ func TestParseRepo(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "foo/bar:1.1@sha256 (pinned)",
+			args: args{remote: "foo/bar:1.1@sha256:b4e8d4b4b13a4b1b2e5d9e8f0e4c0a5c8b0f2ad3cbb6e7f0b3f5e2d6c3a1f4e9"},
+			want: &Repository{
+				Name:       "foo/bar:1.1",
+				Repository: "index.docker.io/foo/bar",
+				Remote:     "index.docker.io/foo/bar:1.1",
+				Registry:   DefaultRegistryHostname,
+				ShortName:  "foo/bar",
+				Tag:        "1.1",
+				Digest:     "sha256:b4e8d4b4b13a4b1b2e5d9e8f0e4c0a5c8b0f2ad3cbb6e7f0b3f5e2d6c3a1f4e9",
+				Scheme:     "https",
+			},
+			wantErr: false,
+		},
+		{
+			name: "foo/bar@sha256 (digest only)",
+			args: args{remote: "foo/bar@sha256:b4e8d4b4b13a4b1b2e5d9e8f0e4c0a5c8b0f2ad3cbb6e7f0b3f5e2d6c3a1f4e9"},
+			want: &Repository{
+				Name:       "foo/bar@sha256:b4e8d4b4b13a4b1b2e5d9e8f0e4c0a5c8b0f2ad3cbb6e7f0b3f5e2d6c3a1f4e9",
+				Repository: "index.docker.io/foo/bar",
+				Remote:     "index.docker.io/foo/bar@sha256:b4e8d4b4b13a4b1b2e5d9e8f0e4c0a5c8b0f2ad3cbb6e7f0b3f5e2d6c3a1f4e9",
+				Registry:   DefaultRegistryHostname,
+				ShortName:  "foo/bar",
+				Tag:        "sha256:b4e8d4b4b13a4b1b2e5d9e8f0e4c0a5c8b0f2ad3cbb6e7f0b3f5e2d6c3a1f4e9",
+				Scheme:     "https",
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
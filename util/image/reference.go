@@ -34,6 +34,7 @@ type Repository struct {
 	ShortName  string // ShortName returns the image's name (ie: debian)
 	Remote     string // Remote returns the image's remote identifier. (ie: registry/name[:tag])
 	Tag        string // Tag returns the image's tag (or digest).
+	Digest     string // Digest the image is pinned to next to its tag. (ie: sha256:abcdef...)
 }
 
 // Named is an object with a full name
@@ -63,6 +64,13 @@ type Canonical interface {
 	Digest() digest.Digest
 }
 
+// TaggedCanonical reference is an object including a name, tag and digest,
+// ie: debian:8.2@sha256:abcdef...
+type TaggedCanonical interface {
+	NamedTagged
+	Digest() digest.Digest
+}
+
 // ParseNamed parses s and returns a syntactically valid reference implementing
 // the Named interface. The reference must have a name, otherwise an error is
 // returned.
@@ -79,6 +87,13 @@ func ParseNamed(s string) (Named, error) {
 		return nil, err
 	}
 	if canonical, isCanonical := named.(reference.Canonical); isCanonical {
+		if tagged, isTagged := named.(reference.NamedTagged); isTagged {
+			t, err := WithTag(r, tagged.Tag())
+			if err != nil {
+				return nil, err
+			}
+			return WithTagAndDigest(t, canonical.Digest())
+		}
 		return WithDigest(r, canonical.Digest())
 	}
 
@@ -125,6 +140,16 @@ func WithDigest(name Named, digest digest.Digest) (Canonical, error) {
 	return &canonicalRef{namedRef{r}}, nil
 }
 
+// WithTagAndDigest combines the name and tag from "name" and the digest from
+// "digest" to form a reference pinned to the digest that keeps the tag.
+func WithTagAndDigest(name NamedTagged, digest digest.Digest) (TaggedCanonical, error) {
+	r, err := reference.WithDigest(name, digest)
+	if err != nil {
+		return nil, err
+	}
+	return &taggedCanonicalRef{namedRef{r}}, nil
+}
+
 type namedRef struct {
 	reference.Named
 }
@@ -134,6 +159,9 @@ type taggedRef struct {
 type canonicalRef struct {
 	namedRef
 }
+type taggedCanonicalRef struct {
+	namedRef
+}
 
 func (r *namedRef) FullName() string {
 	hostname, remoteName := splitHostname(r.Name())
@@ -153,6 +181,12 @@ func (r *taggedRef) Tag() string {
 func (r *canonicalRef) Digest() digest.Digest {
 	return r.namedRef.Named.(reference.Canonical).Digest()
 }
+func (r *taggedCanonicalRef) Tag() string {
+	return r.namedRef.Named.(reference.NamedTagged).Tag()
+}
+func (r *taggedCanonicalRef) Digest() digest.Digest {
+	return r.namedRef.Named.(reference.Canonical).Digest()
+}
 
 // WithDefaultTag adds a default tag to a reference if it only has a repo name.
 func WithDefaultTag(ref Named) Named {
@@ -10,6 +10,7 @@ import (
 	apps_v1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batch_v1 "k8s.io/client-go/kubernetes/typed/batch/v1"
 	core_v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
@@ -53,7 +54,7 @@ func (i *FakeK8sImplementer) Deployments(namespace string) (*apps_v1.DeploymentL
 }
 
 // Update - update deployment
-func (i *FakeK8sImplementer) Update(obj *k8s.GenericResource) error {
+func (i *FakeK8sImplementer) Update(obj, previous *k8s.GenericResource) error {
 	i.Updated = obj
 	return nil
 }
@@ -80,6 +81,11 @@ func (i *FakeK8sImplementer) ConfigMaps(namespace string) core_v1.ConfigMapInter
 	panic("not implemented")
 }
 
+// Jobs - returns nothing (not implemented)
+func (i *FakeK8sImplementer) Jobs(namespace string) batch_v1.JobInterface {
+	panic("not implemented")
+}
+
 // DeletePod - adds pod to DeletedPods list
 func (i *FakeK8sImplementer) DeletePod(namespace, name string, opts *meta_v1.DeleteOptions) error {
 	i.DeletedPods = append(i.DeletedPods, &v1.Pod{